@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+)
+
+// loopCloseDistance is how close (in kilometers) the end of a track must come
+// to its start for the track to count as a loop
+const loopCloseDistance = 0.1
+
+// isLoop reports whether the track returns to where it started
+func isLoop(points []TrackPoint) bool {
+	if len(points) < 4 {
+		return false
+	}
+
+	first, last := points[0], points[len(points)-1]
+	return haversineDistance(first.Latitude, first.Longitude, last.Latitude, last.Longitude) <= loopCloseDistance
+}
+
+// enclosedArea returns the area in square kilometers enclosed by a closed track.
+// Points are projected onto a plane tangent at the track's centroid and the shoelace
+// formula is applied, which is accurate for areas a walk can enclose.
+func enclosedArea(points []TrackPoint) float64 {
+	if len(points) < 3 {
+		return 0
+	}
+
+	// Earth's radius in kilometers
+	const R = 6371.0
+
+	var centerLat, centerLng float64
+	for _, point := range points {
+		centerLat += point.Latitude
+		centerLng += point.Longitude
+	}
+	centerLat /= float64(len(points))
+	centerLng /= float64(len(points))
+
+	cosLat := math.Cos(centerLat * math.Pi / 180)
+	toXY := func(point TrackPoint) (float64, float64) {
+		x := (point.Longitude - centerLng) * math.Pi / 180 * R * cosLat
+		y := (point.Latitude - centerLat) * math.Pi / 180 * R
+		return x, y
+	}
+
+	// The polygon is implicitly closed from the last point back to the first
+	sum := 0.0
+	for i := range points {
+		x1, y1 := toXY(points[i])
+		x2, y2 := toXY(points[(i+1)%len(points)])
+		sum += x1*y2 - x2*y1
+	}
+
+	return math.Abs(sum) / 2
+}
+
+// routeAreaHandler returns the area enclosed by a loop route
+func routeAreaHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		filename := r.PathValue("filename")
+
+		route, ok := store.GetByFilename(filename)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		points := route.TrackPoints
+		if !isLoop(points) {
+			writeJSONError(w, http.StatusUnprocessableEntity, "Route is not a loop")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"filename": filename,
+			"area":     roundTo(enclosedArea(points), config.DistancePrecision),
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// squareLoop returns a closed loop around a square with sides of about sideKm kilometers
+func squareLoop(sideKm float64) []TrackPoint {
+	const lat, lng = 52.5, 13.4
+	dLat := sideKm / 111.195
+	dLng := sideKm / (111.195 * math.Cos(lat*math.Pi/180))
+	return []TrackPoint{
+		{Latitude: lat, Longitude: lng},
+		{Latitude: lat, Longitude: lng + dLng},
+		{Latitude: lat + dLat, Longitude: lng + dLng},
+		{Latitude: lat + dLat, Longitude: lng},
+		{Latitude: lat, Longitude: lng},
+	}
+}
+
+func TestEnclosedArea(t *testing.T) {
+	if area := enclosedArea(squareLoop(1)); math.Abs(area-1) > 0.01 {
+		t.Errorf("Expected an area of about 1 km², got %f", area)
+	}
+	if area := enclosedArea(squareLoop(2)); math.Abs(area-4) > 0.04 {
+		t.Errorf("Expected an area of about 4 km², got %f", area)
+	}
+}
+
+func TestRouteAreaHandler(t *testing.T) {
+	store := withRoutes(t,
+		RouteData{Filename: "square.gpx", TrackPoints: squareLoop(1)},
+		RouteData{Filename: "line.gpx", TrackPoints: squareLoop(1)[:3]},
+	)
+
+	request := func(filename string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/routes/"+filename+"/area", nil)
+		req.SetPathValue("filename", filename)
+		rec := httptest.NewRecorder()
+		routeAreaHandler(store)(rec, req)
+		return rec
+	}
+
+	rec := request("square.gpx")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Area float64 `json:"area"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if math.Abs(response.Area-1) > 0.01 {
+		t.Errorf("Expected an area of about 1 km², got %f", response.Area)
+	}
+
+	if rec := request("line.gpx"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a route that isn't a loop, got %d", rec.Code)
+	}
+	if rec := request("missing.gpx"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing route, got %d", rec.Code)
+	}
+}
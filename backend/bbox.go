@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+)
+
+// boundingBox is the smallest latitude/longitude box containing a set of points.
+// The zero value is an empty box; hasPoints tells it apart from a box around (0, 0).
+type boundingBox struct {
+	minLat, maxLat float64
+	minLng, maxLng float64
+	hasPoints      bool
+}
+
+// extend grows the box to contain the point
+func (b *boundingBox) extend(point TrackPoint) {
+	if !b.hasPoints {
+		b.minLat, b.maxLat = point.Latitude, point.Latitude
+		b.minLng, b.maxLng = point.Longitude, point.Longitude
+		b.hasPoints = true
+		return
+	}
+
+	// Each bound is compared independently, a single point can extend several of them
+	b.minLat = math.Min(b.minLat, point.Latitude)
+	b.maxLat = math.Max(b.maxLat, point.Latitude)
+	b.minLng = math.Min(b.minLng, point.Longitude)
+	b.maxLng = math.Max(b.maxLng, point.Longitude)
+}
+
+// RouteBounds is the latitude/longitude box a route fits in, so clients can frame it without scanning its points
+type RouteBounds struct {
+	MinLat float64 `json:"minLat"`
+	MaxLat float64 `json:"maxLat"`
+	MinLng float64 `json:"minLng"`
+	MaxLng float64 `json:"maxLng"`
+}
+
+// bounds returns the box for use in responses, or nil if it has no points
+func (b boundingBox) bounds() *RouteBounds {
+	if !b.hasPoints {
+		return nil
+	}
+	return &RouteBounds{MinLat: b.minLat, MaxLat: b.maxLat, MinLng: b.minLng, MaxLng: b.maxLng}
+}
+
+// center returns the middle of the box
+func (b boundingBox) center() TrackPoint {
+	return TrackPoint{Latitude: (b.minLat + b.maxLat) / 2, Longitude: (b.minLng + b.maxLng) / 2}
+}
+
+// distanceTo returns the distance in kilometers from the point to the nearest point of
+// the box, zero for points inside it
+func (b boundingBox) distanceTo(point TrackPoint) float64 {
+	nearest := TrackPoint{
+		Latitude:  math.Max(b.minLat, math.Min(b.maxLat, point.Latitude)),
+		Longitude: math.Max(b.minLng, math.Min(b.maxLng, point.Longitude)),
+	}
+	return haversineDistance(point.Latitude, point.Longitude, nearest.Latitude, nearest.Longitude)
+}
+
+// perimeter returns the length of the box outline in kilometers, measured along its southern and western edges
+func (b boundingBox) perimeter() float64 {
+	width := haversineDistance(b.minLat, b.minLng, b.minLat, b.maxLng)
+	height := haversineDistance(b.minLat, b.minLng, b.maxLat, b.minLng)
+	return 2 * (width + height)
+}
+
+// pointsBoundingBox returns the bounding box of the points
+func pointsBoundingBox(points []TrackPoint) boundingBox {
+	var box boundingBox
+	for _, point := range points {
+		box.extend(point)
+	}
+	return box
+}
+
+// routesBoundingBox returns the bounding box of the points of all routes
+func routesBoundingBox(routes []RouteData) boundingBox {
+	var box boundingBox
+	for _, route := range routes {
+		for _, point := range route.TrackPoints {
+			box.extend(point)
+		}
+	}
+	return box
+}
+
+// addBounds sets the bounds of each suggested route from its final points
+func addBounds(suggested []SuggestedRoute) {
+	for i := range suggested {
+		suggested[i].Bounds = pointsBoundingBox(suggested[i].Points).bounds()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBoundingBoxExtremesAfterFirstPoint(t *testing.T) {
+	// The first point is in the middle, and one point sets both a minimum and a maximum
+	routes := []RouteData{
+		{Filename: "empty.gpx"},
+		{Filename: "a.gpx", TrackPoints: []TrackPoint{
+			{Latitude: 52.50, Longitude: 13.40},
+			{Latitude: 52.45, Longitude: 13.50},
+		}},
+		{Filename: "b.gpx", TrackPoints: []TrackPoint{
+			{Latitude: 52.55, Longitude: 13.30},
+			{Latitude: 52.48, Longitude: 13.45},
+		}},
+	}
+
+	box := routesBoundingBox(routes)
+	expected := boundingBox{minLat: 52.45, maxLat: 52.55, minLng: 13.30, maxLng: 13.50, hasPoints: true}
+	if box != expected {
+		t.Errorf("Expected %+v, got %+v", expected, box)
+	}
+
+	if center := box.center(); center.Latitude != 52.5 || center.Longitude != 13.4 {
+		t.Errorf("Expected the center at 52.5, 13.4, got %v", center)
+	}
+}
+
+func TestBoundingBoxOfMonotonicTrack(t *testing.T) {
+	// Latitudes only grow and longitudes only shrink, so every point after the first
+	// extends the maximum latitude and the minimum longitude at once
+	var points []TrackPoint
+	for i := 0; i < 5; i++ {
+		points = append(points, TrackPoint{Latitude: 52.50 + float64(i)*0.01, Longitude: 13.40 - float64(i)*0.01})
+	}
+
+	box := NewRouteStore(RouteData{Filename: "diagonal.gpx", TrackPoints: points}).BoundingBox()
+	first, last := points[0], points[len(points)-1]
+	expected := boundingBox{minLat: first.Latitude, maxLat: last.Latitude, minLng: last.Longitude, maxLng: first.Longitude, hasPoints: true}
+	if box != expected {
+		t.Errorf("Expected %+v, got %+v", expected, box)
+	}
+}
+
+func TestBoundingBoxWithoutPoints(t *testing.T) {
+	box := routesBoundingBox([]RouteData{{Filename: "empty.gpx"}})
+	if box.hasPoints {
+		t.Errorf("Expected an empty box, got %+v", box)
+	}
+
+	// A box around the origin is still a box
+	box = pointsBoundingBox([]TrackPoint{{Latitude: 0, Longitude: 0}})
+	if !box.hasPoints {
+		t.Error("Expected a box containing the origin")
+	}
+}
+
+func TestSuggestedRouteBoundsEncloseAllPoints(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var suggested []SuggestedRoute
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+	}
+
+	route := suggested[0]
+	if route.Bounds == nil {
+		t.Fatalf("Expected the suggestion to have bounds")
+	}
+
+	bounds := *route.Bounds
+	for i, point := range route.Points {
+		if point.Latitude < bounds.MinLat || point.Latitude > bounds.MaxLat ||
+			point.Longitude < bounds.MinLng || point.Longitude > bounds.MaxLng {
+			t.Errorf("Point %d at %v lies outside the bounds %+v", i, point, bounds)
+		}
+	}
+
+	// The bounds are tight, not just enclosing
+	if expected := *pointsBoundingBox(route.Points).bounds(); bounds != expected {
+		t.Errorf("Expected bounds %+v, got %+v", expected, bounds)
+	}
+}
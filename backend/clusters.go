@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Route clustering defaults
+const (
+	defaultClusterThreshold = 100.0 // meters
+	maxClusterThreshold     = 5000.0
+
+	// clusterSamples is the number of points sampled along each route for comparison
+	clusterSamples = 20
+)
+
+// RouteCluster is a group of routes with similar geometry
+type RouteCluster struct {
+	ID        int      `json:"id"`
+	Filenames []string `json:"filenames"`
+}
+
+// ClusterResponse is returned by /clusters
+type ClusterResponse struct {
+	Clusters    []RouteCluster `json:"clusters"`
+	Assignments map[string]int `json:"assignments"` // Cluster ID for each filename
+}
+
+// clusterRoute is the precomputed data used to compare a route with others
+type clusterRoute struct {
+	filename string
+	points   []TrackPoint
+	samples  []TrackPoint
+	box      boundingBox
+}
+
+// newClusterRoute samples a route and computes its bounding box
+func newClusterRoute(route RouteData) clusterRoute {
+	c := clusterRoute{filename: route.Filename, points: route.TrackPoints}
+	if len(c.points) == 0 {
+		return c
+	}
+
+	c.box = pointsBoundingBox(c.points)
+
+	// Sample evenly by distance so dense and sparse recordings compare alike
+	length := calculateRouteDistance(c.points)
+	for i := 0; i < clusterSamples; i++ {
+		sample, _ := pointAtDistance(c.points, length*float64(i)/float64(clusterSamples-1))
+		c.samples = append(c.samples, sample)
+	}
+
+	return c
+}
+
+// boxesNear reports whether the bounding boxes of two routes are within thresholdKm of each other
+func boxesNear(a, b clusterRoute, thresholdKm float64) bool {
+	marginLat := thresholdKm / 111.0
+	marginLng := marginLat / math.Max(math.Cos(a.box.maxLat*math.Pi/180), 0.01)
+	return a.box.minLat-marginLat <= b.box.maxLat && b.box.minLat-marginLat <= a.box.maxLat &&
+		a.box.minLng-marginLng <= b.box.maxLng && b.box.minLng-marginLng <= a.box.maxLng
+}
+
+// meanDistanceTo returns the mean distance in kilometers from the samples of a to the track of b
+func meanDistanceTo(a, b clusterRoute) float64 {
+	total := 0.0
+	for _, sample := range a.samples {
+		nearest := math.Inf(1)
+		if len(b.points) == 1 {
+			nearest = perpendicularDistance(sample, b.points[0], b.points[0])
+		}
+		for i := 0; i < len(b.points)-1; i++ {
+			nearest = math.Min(nearest, perpendicularDistance(sample, b.points[i], b.points[i+1]))
+		}
+		total += nearest
+	}
+	return total / float64(len(a.samples))
+}
+
+// similarRoutes reports whether two routes follow the same path, in either direction.
+// Both routes must stay within thresholdKm of each other on average.
+func similarRoutes(a, b clusterRoute, thresholdKm float64) bool {
+	if len(a.samples) == 0 || len(b.samples) == 0 || !boxesNear(a, b, thresholdKm) {
+		return false
+	}
+	return meanDistanceTo(a, b) <= thresholdKm && meanDistanceTo(b, a) <= thresholdKm
+}
+
+// clusterRoutes groups similar routes. Similarity is transitive: if A is similar to B
+// and B to C, all three end up in the same cluster.
+func clusterRoutes(routes []RouteData, thresholdKm float64) ClusterResponse {
+	prepared := make([]clusterRoute, len(routes))
+	for i, route := range routes {
+		prepared[i] = newClusterRoute(route)
+	}
+
+	// Union-find over route indices
+	parent := make([]int, len(prepared))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range prepared {
+		for j := i + 1; j < len(prepared); j++ {
+			if find(i) != find(j) && similarRoutes(prepared[i], prepared[j], thresholdKm) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	// Collect the clusters, ordered by their first filename so IDs are stable
+	groups := make(map[int][]string)
+	for i, route := range prepared {
+		root := find(i)
+		groups[root] = append(groups[root], route.filename)
+	}
+
+	response := ClusterResponse{Clusters: []RouteCluster{}, Assignments: make(map[string]int)}
+	for _, filenames := range groups {
+		sort.Strings(filenames)
+		response.Clusters = append(response.Clusters, RouteCluster{Filenames: filenames})
+	}
+	sort.Slice(response.Clusters, func(i, j int) bool {
+		return response.Clusters[i].Filenames[0] < response.Clusters[j].Filenames[0]
+	})
+	for id := range response.Clusters {
+		response.Clusters[id].ID = id
+		for _, filename := range response.Clusters[id].Filenames {
+			response.Assignments[filename] = id
+		}
+	}
+
+	return response
+}
+
+// clustersHandler groups the stored routes into clusters of near-duplicates
+func clustersHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Threshold is given in meters
+		threshold := defaultClusterThreshold
+		if value := r.URL.Query().Get("threshold"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 || parsed > maxClusterThreshold {
+				writeJSONError(w, http.StatusBadRequest, "threshold must be between 0 and 5000 meters")
+				return
+			}
+			threshold = parsed
+		}
+
+		response := clusterRoutes(store.All(), threshold/1000.0)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
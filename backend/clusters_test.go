@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// straightRoute returns a route heading east from the given point, recorded every step degrees
+func straightRoute(filename string, lat, lng, step float64) RouteData {
+	route := RouteData{Filename: filename}
+	for x := 0.0; x <= 0.02+1e-9; x += step {
+		route.TrackPoints = append(route.TrackPoints, TrackPoint{Latitude: lat, Longitude: lng + x})
+	}
+	return route
+}
+
+func TestClustersHandler(t *testing.T) {
+	// The same street recorded twice with different GPS noise and density, in opposite
+	// directions, and a walk about 2 km further north
+	morning := straightRoute("morning.gpx", 52.5200, 13.40, 0.001)
+	evening := straightRoute("evening.gpx", 52.5202, 13.40, 0.004)
+	for i, j := 0, len(evening.TrackPoints)-1; i < j; i, j = i+1, j-1 {
+		evening.TrackPoints[i], evening.TrackPoints[j] = evening.TrackPoints[j], evening.TrackPoints[i]
+	}
+	north := straightRoute("north.gpx", 52.5400, 13.40, 0.001)
+	store := withRoutes(t, morning, north, evening)
+
+	req := httptest.NewRequest(http.MethodGet, "/clusters", nil)
+	rec := httptest.NewRecorder()
+	clustersHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ClusterResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+
+	if len(response.Clusters) != 2 {
+		t.Fatalf("Expected 2 clusters, got %+v", response.Clusters)
+	}
+	if response.Assignments["morning.gpx"] != response.Assignments["evening.gpx"] {
+		t.Errorf("Expected the similar routes to share a cluster, got %v", response.Assignments)
+	}
+	if response.Assignments["north.gpx"] == response.Assignments["morning.gpx"] {
+		t.Errorf("Expected the distinct route in its own cluster, got %v", response.Assignments)
+	}
+
+	// A tight threshold separates the two recordings of the same street
+	req = httptest.NewRequest(http.MethodGet, "/clusters?threshold=5", nil)
+	rec = httptest.NewRecorder()
+	clustersHandler(store)(rec, req)
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if len(response.Clusters) != 3 {
+		t.Errorf("Expected 3 clusters with a 5 m threshold, got %+v", response.Clusters)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// comparisonTolerancePercent is how close to the average a distance must be to count as usual
+const comparisonTolerancePercent = 5
+
+// averageWalkDistance returns the mean distance of the routes that have actually been walked.
+// Saved suggestions that were never completed don't describe the user's habits.
+func averageWalkDistance(routes []RouteData) (float64, bool) {
+	total, count := 0.0, 0
+	for _, route := range routes {
+		if route.WalkCount < 1 || route.Distance <= 0 {
+			continue
+		}
+		total += route.Distance
+		count++
+	}
+
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
+
+// describeComparison describes a distance relative to the average walk, e.g.
+// "20% longer than your usual walk"
+func describeComparison(distance, average float64) string {
+	percent := math.Round((distance - average) / average * 100)
+	switch {
+	case math.Abs(percent) < comparisonTolerancePercent:
+		return "about as long as your usual walk"
+	case percent > 0:
+		return fmt.Sprintf("%.0f%% longer than your usual walk", percent)
+	default:
+		return fmt.Sprintf("%.0f%% shorter than your usual walk", -percent)
+	}
+}
+
+// addComparisons sets the Comparison of each suggestion against the stored routes.
+// Elevation isn't compared because routes don't record it.
+func addComparisons(store *RouteStore, suggested []SuggestedRoute) {
+	average, ok := averageWalkDistance(store.All())
+	if !ok {
+		return
+	}
+
+	for i := range suggested {
+		suggested[i].Comparison = describeComparison(suggested[i].Distance, average)
+	}
+}
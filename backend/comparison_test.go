@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAddComparisons(t *testing.T) {
+	store := withRoutes(t,
+		RouteData{Filename: "short.gpx", Distance: 4, WalkCount: 1},
+		RouteData{Filename: "long.gpx", Distance: 6, WalkCount: 3},
+		// Never walked, so it doesn't count towards the average
+		RouteData{Filename: "plan.gpx", Distance: 50, Source: sourceSuggested},
+	)
+
+	suggested := []SuggestedRoute{{Distance: 6}, {Distance: 4}, {Distance: 5.1}}
+	addComparisons(store, suggested)
+
+	expected := []string{
+		"20% longer than your usual walk",
+		"20% shorter than your usual walk",
+		"about as long as your usual walk",
+	}
+	for i, want := range expected {
+		if suggested[i].Comparison != want {
+			t.Errorf("Expected %q for %f km, got %q", want, suggested[i].Distance, suggested[i].Comparison)
+		}
+	}
+}
+
+func TestAddComparisonsWithoutHistory(t *testing.T) {
+	store := withRoutes(t)
+
+	suggested := []SuggestedRoute{{Distance: 6}}
+	addComparisons(store, suggested)
+
+	if suggested[0].Comparison != "" {
+		t.Errorf("Expected no comparison without walked routes, got %q", suggested[0].Comparison)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the tunable server settings. Values are read from environment
+// variables at startup and fall back to sensible defaults.
+type Config struct {
+	// DistancePrecision is the number of decimal places used when reporting
+	// distances and durations in JSON responses
+	DistancePrecision int
+
+	// CoordinatePrecision is the number of decimal places latitudes and longitudes are
+	// rounded to when points are stored or decoded from OSRM. Six (about 10 cm) keeps GPS
+	// detail and matches the precision of OSRM's polyline6 geometry.
+	CoordinatePrecision int
+
+	// OSRMServer is the base URL of the OSRM routing server
+	OSRMServer string
+
+	// OSRMTimeout bounds each OSRM request, from connecting to reading the response
+	OSRMTimeout time.Duration
+
+	// ReadinessTimeout bounds the OSRM request made by /readyz, so probes don't hang
+	ReadinessTimeout time.Duration
+
+	// ShutdownTimeout is how long the requests in flight may take to finish once the
+	// server is asked to stop
+	ShutdownTimeout time.Duration
+
+	// DataDir is the directory where uploaded GPX files are stored
+	DataDir string
+
+	// FrontendDir is the directory the static frontend files are served from
+	FrontendDir string
+
+	// DistanceSource selects the distance used for street routes: "osrm" for the distance
+	// OSRM reports, "geometry" for the distance along the decoded geometry, or "reconcile"
+	// for the geometry unless it differs from OSRM's by more than DistanceMismatchPercent
+	DistanceSource string
+
+	// DistanceModel selects how distances between points are computed: "haversine" on a
+	// sphere, or "vincenty" on the WGS-84 ellipsoid, which is slower but more accurate
+	DistanceModel string
+
+	// DistanceMismatchPercent is how far (in percent) the distance computed from the
+	// OSRM geometry may drift from the OSRM-reported distance before the latter is used
+	DistanceMismatchPercent float64
+
+	// OffRoadCheck enables map-matching uploaded tracks against OSRM to flag
+	// tracks that don't follow the road network
+	OffRoadCheck bool
+
+	// StreamingParseThreshold is the GPX file size in bytes above which the
+	// streaming parser is used instead of loading the whole document
+	StreamingParseThreshold int64
+
+	// MaxUploadSize is the largest request body in bytes /upload accepts
+	MaxUploadSize int64
+
+	// MinSegmentDistance in meters is how far a track point must be from the last counted
+	// point before the distance between them is added to the route. Shorter moves are
+	// treated as GPS jitter while standing still. Zero counts every move.
+	MinSegmentDistance float64
+
+	// ParseTimeout is the longest a GPX file may take to parse before it's rejected.
+	// Zero or less disables the limit.
+	ParseTimeout time.Duration
+
+	// FixSwappedCoordinates exchanges latitude and longitude of uploaded tracks
+	// that look like their exporter mixed them up
+	FixSwappedCoordinates bool
+
+	// MaxOSRMURLLength is the longest OSRM request URL the server accepts. Waypoints
+	// are dropped until requests fit. Zero or less disables the limit.
+	MaxOSRMURLLength int
+
+	// OSRMMaxWaypoints is the most waypoints sent to OSRM for a suggestion. Longer routes
+	// are reduced using OSRMSampling, either "douglas-peucker", which keeps the points that
+	// shape the route most, or "stride", which keeps every Nth point.
+	OSRMMaxWaypoints int
+	OSRMSampling     string
+
+	// OSRMCacheSize is the number of street routes kept in memory so repeated requests
+	// for the same waypoints don't reach OSRM. Zero or less disables the cache.
+	OSRMCacheSize int
+
+	// Connection pool settings for OSRM requests. OSRMMaxIdleConnsPerHost should be at
+	// least the number of suggestions expected to be generated concurrently.
+	OSRMMaxIdleConnsPerHost int
+	OSRMIdleConnTimeout     time.Duration
+	OSRMDialTimeout         time.Duration
+
+	// FootpathExcludeClasses is the comma separated list of OSRM classes excluded when
+	// suggestions should prefer footpaths. The classes must be declared as excludable
+	// in the server's profile; the stock foot profile declares none, so it's empty by default.
+	FootpathExcludeClasses string
+
+	// OSRMBreakerThreshold is the number of consecutive failed OSRM requests after which
+	// OSRM isn't contacted for OSRMBreakerCooldown. Zero or less disables the breaker.
+	OSRMBreakerThreshold int
+	OSRMBreakerCooldown  time.Duration
+
+	// OSRMAttempts is how often a request failing with a network error, a 5xx or a 429
+	// status is sent before giving up. The wait between attempts starts at
+	// OSRMRetryBackoff and doubles each time.
+	OSRMAttempts     int
+	OSRMRetryBackoff time.Duration
+
+	// TimestampFutureTolerance is how far in the future a GPX timestamp may lie before
+	// it's ignored. Timestamps before 2000 are always ignored.
+	TimestampFutureTolerance time.Duration
+
+	// WalkingSpeed in km/h is used to estimate the duration of tracks whose timestamps are unusable
+	WalkingSpeed float64
+
+	// GeocoderURL is the base URL of a Nominatim-compatible reverse geocoding service used
+	// to label where suggestions start and end. Empty disables geocoding.
+	GeocoderURL string
+
+	// GeocoderInterval is the minimum time between reverse geocoding requests. Nominatim's
+	// usage policy allows at most one request per second.
+	GeocoderInterval time.Duration
+
+	// SuggestionHistoryTTL is how long generated suggestions are listed by /suggestions/history
+	SuggestionHistoryTTL time.Duration
+
+	// MaxZigzagMeters caps how far the zigzags added to lengthen a route that doesn't
+	// follow streets may stray from the original segment
+	MaxZigzagMeters float64
+
+	// KnownPoints are named places such as home that routes starting or ending within
+	// KnownPointRadius meters of are annotated with
+	KnownPoints      []KnownPoint
+	KnownPointRadius float64
+
+	// ElevationURL is the base URL of an Open-Elevation compatible service used to look up
+	// the elevation of tracks recorded without one. Empty disables the lookup.
+	ElevationURL string
+
+	// ElevationSampleDistance in meters is how far apart the points looked up are.
+	// The elevation of the points in between is interpolated.
+	ElevationSampleDistance float64
+
+	// GapDistance in meters and GapDuration are how far apart consecutive points of a
+	// segment must be for /routes/{filename}/gaps to report a recording gap. Zero disables a criterion.
+	GapDistance float64
+	GapDuration time.Duration
+
+	// DebugEndpoints enables the troubleshooting endpoints under /debug
+	DebugEndpoints bool
+
+	// LogLevel is the least severe level logged. The routing details, e.g. every waypoint
+	// sent to OSRM, are only logged at debug level.
+	LogLevel slog.Level
+}
+
+// config is the active server configuration
+var config = defaultConfig()
+
+// defaultConfig returns the configuration used when no overrides are set
+func defaultConfig() Config {
+	return Config{
+		DistancePrecision:   2,
+		CoordinatePrecision: 6,
+		// We'll use the public OSRM demo server by default
+		// In a production environment, you would want to host your own OSRM server
+		OSRMServer:  "https://router.project-osrm.org",
+		OSRMTimeout: 10 * time.Second,
+		DataDir:     "data",
+		FrontendDir: "frontend",
+
+		ReadinessTimeout: 2 * time.Second,
+		ShutdownTimeout:  20 * time.Second,
+
+		LogLevel: slog.LevelInfo,
+
+		DistanceSource:          distanceSourceOSRM,
+		DistanceModel:           distanceModelHaversine,
+		DistanceMismatchPercent: 10,
+		StreamingParseThreshold: 20 << 20,
+		MaxUploadSize:           50 << 20,
+		ParseTimeout:            30 * time.Second,
+		MinSegmentDistance:      1,
+		// Many OSRM deployments reject URLs longer than 8 KB
+		MaxOSRMURLLength: 8000,
+		OSRMMaxWaypoints: 100,
+		OSRMSampling:     samplingDouglasPeucker,
+		OSRMCacheSize:    256,
+
+		OSRMMaxIdleConnsPerHost: 16,
+		OSRMIdleConnTimeout:     90 * time.Second,
+		OSRMDialTimeout:         5 * time.Second,
+
+		OSRMBreakerThreshold: 5,
+		OSRMBreakerCooldown:  30 * time.Second,
+
+		OSRMAttempts:     3,
+		OSRMRetryBackoff: 200 * time.Millisecond,
+
+		TimestampFutureTolerance: 24 * time.Hour,
+		WalkingSpeed:             5,
+		SuggestionHistoryTTL:     time.Hour,
+		GeocoderInterval:         time.Second,
+		KnownPointRadius:         200,
+		MaxZigzagMeters:          1000,
+		ElevationSampleDistance:  50,
+		GapDistance:              100,
+		GapDuration:              time.Minute,
+	}
+}
+
+// loadConfig builds the configuration from environment variables
+func loadConfig() Config {
+	cfg := defaultConfig()
+
+	cfg.DistancePrecision = envInt("DISTANCE_PRECISION", cfg.DistancePrecision)
+	if cfg.DistancePrecision < 0 {
+		slog.Warn("Invalid DISTANCE_PRECISION, using default", "value", cfg.DistancePrecision)
+		cfg.DistancePrecision = defaultConfig().DistancePrecision
+	}
+
+	cfg.CoordinatePrecision = envInt("COORDINATE_PRECISION", cfg.CoordinatePrecision)
+	if cfg.CoordinatePrecision < 1 || cfg.CoordinatePrecision > 15 {
+		slog.Warn("Invalid COORDINATE_PRECISION, using default", "value", cfg.CoordinatePrecision)
+		cfg.CoordinatePrecision = defaultConfig().CoordinatePrecision
+	}
+
+	cfg.OSRMServer = strings.TrimRight(envString("OSRM_SERVER", cfg.OSRMServer), "/")
+	cfg.OSRMTimeout = envDuration("OSRM_TIMEOUT", cfg.OSRMTimeout)
+	if cfg.OSRMTimeout <= 0 {
+		slog.Warn("Invalid OSRM_TIMEOUT, using default", "value", cfg.OSRMTimeout)
+		cfg.OSRMTimeout = defaultConfig().OSRMTimeout
+	}
+	cfg.ReadinessTimeout = envDuration("READINESS_TIMEOUT", cfg.ReadinessTimeout)
+	if cfg.ReadinessTimeout <= 0 {
+		slog.Warn("Invalid READINESS_TIMEOUT, using default", "value", cfg.ReadinessTimeout)
+		cfg.ReadinessTimeout = defaultConfig().ReadinessTimeout
+	}
+	cfg.ShutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout)
+	if cfg.ShutdownTimeout <= 0 {
+		slog.Warn("Invalid SHUTDOWN_TIMEOUT, using default", "value", cfg.ShutdownTimeout)
+		cfg.ShutdownTimeout = defaultConfig().ShutdownTimeout
+	}
+	cfg.DataDir = envString("DATA_DIR", cfg.DataDir)
+	cfg.FrontendDir = envString("FRONTEND_DIR", cfg.FrontendDir)
+	cfg.DistanceSource = strings.ToLower(envString("DISTANCE_SOURCE", cfg.DistanceSource))
+	switch cfg.DistanceSource {
+	case distanceSourceOSRM, distanceSourceGeometry, distanceSourceReconcile:
+	default:
+		slog.Warn("Invalid DISTANCE_SOURCE, using default", "value", cfg.DistanceSource)
+		cfg.DistanceSource = defaultConfig().DistanceSource
+	}
+	cfg.DistanceModel = strings.ToLower(envString("DISTANCE_MODEL", cfg.DistanceModel))
+	if cfg.DistanceModel != distanceModelHaversine && cfg.DistanceModel != distanceModelVincenty {
+		slog.Warn("Invalid DISTANCE_MODEL, using default", "value", cfg.DistanceModel)
+		cfg.DistanceModel = defaultConfig().DistanceModel
+	}
+	cfg.DistanceMismatchPercent = envFloat("DISTANCE_MISMATCH_PERCENT", cfg.DistanceMismatchPercent)
+	cfg.OffRoadCheck = envBool("OFFROAD_CHECK", cfg.OffRoadCheck)
+	cfg.StreamingParseThreshold = int64(envInt("STREAMING_PARSE_THRESHOLD", int(cfg.StreamingParseThreshold)))
+	cfg.MaxUploadSize = int64(envInt("MAX_UPLOAD_SIZE", int(cfg.MaxUploadSize)))
+	if cfg.MaxUploadSize <= 0 {
+		slog.Warn("Invalid MAX_UPLOAD_SIZE, using default", "value", cfg.MaxUploadSize)
+		cfg.MaxUploadSize = defaultConfig().MaxUploadSize
+	}
+	cfg.FootpathExcludeClasses = envString("OSRM_FOOTPATH_EXCLUDE", cfg.FootpathExcludeClasses)
+	cfg.MinSegmentDistance = envFloat("MIN_SEGMENT_DISTANCE", cfg.MinSegmentDistance)
+	cfg.ParseTimeout = envDuration("GPX_PARSE_TIMEOUT", cfg.ParseTimeout)
+	cfg.MaxOSRMURLLength = envInt("OSRM_MAX_URL_LENGTH", cfg.MaxOSRMURLLength)
+	cfg.OSRMMaxWaypoints = envInt("OSRM_MAX_WAYPOINTS", cfg.OSRMMaxWaypoints)
+	cfg.OSRMSampling = strings.ToLower(envString("OSRM_SAMPLING", cfg.OSRMSampling))
+	if cfg.OSRMSampling != samplingStride && cfg.OSRMSampling != samplingDouglasPeucker {
+		slog.Warn("Invalid OSRM_SAMPLING, using default", "value", cfg.OSRMSampling)
+		cfg.OSRMSampling = defaultConfig().OSRMSampling
+	}
+	cfg.OSRMCacheSize = envInt("OSRM_CACHE_SIZE", cfg.OSRMCacheSize)
+	cfg.OSRMMaxIdleConnsPerHost = envInt("OSRM_MAX_IDLE_CONNS_PER_HOST", cfg.OSRMMaxIdleConnsPerHost)
+	cfg.OSRMIdleConnTimeout = envDuration("OSRM_IDLE_CONN_TIMEOUT", cfg.OSRMIdleConnTimeout)
+	cfg.OSRMDialTimeout = envDuration("OSRM_DIAL_TIMEOUT", cfg.OSRMDialTimeout)
+	cfg.OSRMBreakerThreshold = envInt("OSRM_BREAKER_THRESHOLD", cfg.OSRMBreakerThreshold)
+	cfg.OSRMBreakerCooldown = envDuration("OSRM_BREAKER_COOLDOWN", cfg.OSRMBreakerCooldown)
+	cfg.OSRMAttempts = envInt("OSRM_ATTEMPTS", cfg.OSRMAttempts)
+	if cfg.OSRMAttempts < 1 {
+		slog.Warn("Invalid OSRM_ATTEMPTS, using default", "value", cfg.OSRMAttempts)
+		cfg.OSRMAttempts = defaultConfig().OSRMAttempts
+	}
+	cfg.OSRMRetryBackoff = envDuration("OSRM_RETRY_BACKOFF", cfg.OSRMRetryBackoff)
+	cfg.TimestampFutureTolerance = envDuration("TIMESTAMP_FUTURE_TOLERANCE", cfg.TimestampFutureTolerance)
+	cfg.WalkingSpeed = envFloat("WALKING_SPEED", cfg.WalkingSpeed)
+	cfg.GeocoderURL = strings.TrimRight(envString("GEOCODER_URL", cfg.GeocoderURL), "/")
+	cfg.GeocoderInterval = envDuration("GEOCODER_INTERVAL", cfg.GeocoderInterval)
+	cfg.SuggestionHistoryTTL = envDuration("SUGGESTION_HISTORY_TTL", cfg.SuggestionHistoryTTL)
+	cfg.FixSwappedCoordinates = envBool("FIX_SWAPPED_COORDINATES", cfg.FixSwappedCoordinates)
+	cfg.MaxZigzagMeters = envFloat("ZIGZAG_MAX_METERS", cfg.MaxZigzagMeters)
+	cfg.KnownPointRadius = envFloat("KNOWN_POINT_RADIUS", cfg.KnownPointRadius)
+	if value := os.Getenv("KNOWN_POINTS"); value != "" {
+		knownPoints, err := parseKnownPoints(value)
+		if err != nil {
+			slog.Warn("Invalid KNOWN_POINTS, ignoring them", "error", err)
+		} else {
+			cfg.KnownPoints = knownPoints
+		}
+	}
+	cfg.ElevationURL = strings.TrimRight(envString("ELEVATION_URL", cfg.ElevationURL), "/")
+	cfg.ElevationSampleDistance = envFloat("ELEVATION_SAMPLE_DISTANCE", cfg.ElevationSampleDistance)
+	cfg.GapDistance = envFloat("GAP_DISTANCE", cfg.GapDistance)
+	cfg.GapDuration = envDuration("GAP_DURATION", cfg.GapDuration)
+	cfg.DebugEndpoints = envBool("DEBUG_ENDPOINTS", cfg.DebugEndpoints)
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(value)); err != nil {
+			slog.Warn("Invalid LOG_LEVEL, using default", "value", value)
+			cfg.LogLevel = defaultConfig().LogLevel
+		}
+	}
+
+	return cfg
+}
+
+// envString reads a string environment variable, returning fallback when unset
+func envString(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envInt reads an integer environment variable, returning fallback when unset or invalid
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid value, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// envFloat reads a float environment variable, returning fallback when unset or invalid
+func envFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Invalid value, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// envBool reads a boolean environment variable, returning fallback when unset or invalid
+func envBool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid value, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
+// envDuration reads a duration environment variable such as "30s", returning fallback when unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid value, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+
+	return parsed
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"math"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// swappedFarDistance is the distance in kilometers from the explored area beyond which
+// an upload that would lie within it with its coordinates swapped is judged swapped
+const swappedFarDistance = 100
+
+// swappedNearDistance is how close in kilometers to the explored area a swapped track
+// must lie to count as inside it
+const swappedNearDistance = 10
+
+// coordinatesLookSwapped reports whether a track appears to have latitude and longitude
+// exchanged. Latitudes can't exceed 90 degrees, so a track where most points have an
+// impossible latitude while every longitude would be a valid latitude was almost
+// certainly written with the two mixed up. Swapped tracks whose longitudes are within
+// ±90 degrees (e.g. Berlin written as lat=13, lng=52) remain valid coordinates, see
+// swappedIntoExploredArea for telling those apart on upload.
+func coordinatesLookSwapped(points []TrackPoint) bool {
+	if len(points) == 0 {
+		return false
+	}
+
+	outOfRange := 0
+	for _, point := range points {
+		// Swapping would make this point invalid, so the track can't be swapped
+		if math.Abs(point.Longitude) > 90 {
+			return false
+		}
+		if math.Abs(point.Latitude) > 90 {
+			outOfRange++
+		}
+	}
+
+	return outOfRange*2 > len(points)
+}
+
+// swappedIntoExploredArea reports whether a track with valid coordinates appears to have
+// latitude and longitude exchanged, judged by the area the stored routes cover: it lies
+// far outside that area, but with its coordinates swapped it would lie inside.
+func swappedIntoExploredArea(points []TrackPoint, explored boundingBox) bool {
+	if len(points) == 0 || !explored.hasPoints {
+		return false
+	}
+	for _, point := range points {
+		// Swapping would make this point invalid, so the track can't be swapped
+		if math.Abs(point.Longitude) > 90 {
+			return false
+		}
+	}
+
+	center := pointsBoundingBox(points).center()
+	swappedCenter := TrackPoint{Latitude: center.Longitude, Longitude: center.Latitude}
+	return explored.distanceTo(center) > swappedFarDistance && explored.distanceTo(swappedCenter) <= swappedNearDistance
+}
+
+// swapGPXFile exchanges latitude and longitude of every point in a GPX file in the data
+// directory, so the file is read correctly however it's parsed later
+func swapGPXFile(ctx context.Context, filename string) error {
+	gpxData, err := parseGPX(ctx, filename)
+	if err != nil {
+		return err
+	}
+
+	swap := func(points []gpx.GPXPoint) {
+		for i := range points {
+			points[i].Latitude, points[i].Longitude = points[i].Longitude, points[i].Latitude
+		}
+	}
+	for t := range gpxData.Tracks {
+		for s := range gpxData.Tracks[t].Segments {
+			swap(gpxData.Tracks[t].Segments[s].Points)
+		}
+	}
+	for r := range gpxData.Routes {
+		swap(gpxData.Routes[r].Points)
+	}
+	swap(gpxData.Waypoints)
+
+	return writeGPX(filename, gpxData)
+}
+
+// canonicalPoint rounds a point's coordinates to config.CoordinatePrecision decimal places.
+// Uploaded tracks and decoded OSRM geometry both go through it, so their points lie on
+// the same grid and can be compared and merged reliably.
+func canonicalPoint(point TrackPoint) TrackPoint {
+	point.Latitude = roundTo(point.Latitude, config.CoordinatePrecision)
+	point.Longitude = roundTo(point.Longitude, config.CoordinatePrecision)
+	return point
+}
+
+// samePoint reports whether two points are at the same position at the canonical precision
+func samePoint(a, b TrackPoint) bool {
+	a, b = canonicalPoint(a), canonicalPoint(b)
+	return a.Latitude == b.Latitude && a.Longitude == b.Longitude
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// tokyoTrack is a short walk in Tokyo, where longitudes exceed 90 degrees
+var tokyoTrack = []TrackPoint{
+	{Latitude: 35.6812, Longitude: 139.7671},
+	{Latitude: 35.6830, Longitude: 139.7700},
+	{Latitude: 35.6852, Longitude: 139.7725},
+	{Latitude: 35.6870, Longitude: 139.7760},
+}
+
+// swapped returns the points with latitude and longitude exchanged
+func swapped(points []TrackPoint) []TrackPoint {
+	result := make([]TrackPoint, len(points))
+	for i, point := range points {
+		result[i] = TrackPoint{Latitude: point.Longitude, Longitude: point.Latitude}
+	}
+	return result
+}
+
+func TestCoordinatesLookSwapped(t *testing.T) {
+	if coordinatesLookSwapped(tokyoTrack) {
+		t.Error("A valid track must not be flagged as swapped")
+	}
+	if !coordinatesLookSwapped(swapped(tokyoTrack)) {
+		t.Error("Expected the swapped Tokyo track to be flagged")
+	}
+
+	// A single corrupt latitude isn't consistent enough to call the track swapped
+	corrupt := append([]TrackPoint{{Latitude: 135, Longitude: 35.68}}, tokyoTrack[:2]...)
+	corrupt = append(corrupt, TrackPoint{Latitude: 35.69, Longitude: 40})
+	if coordinatesLookSwapped(corrupt) {
+		t.Error("A track with a single implausible point must not be flagged as swapped")
+	}
+}
+
+func TestSwappedCoordinatesUpload(t *testing.T) {
+	withDataDir(t)
+	writeTestGPX(t, "swapped.gpx", swapped(tokyoTrack))
+
+	// Without the fix enabled the route is only flagged
+	route, err := loadRoute(context.Background(), "swapped.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load route: %v", err)
+	}
+	if !route.CoordinatesSwapped {
+		t.Error("Expected the route to be flagged as swapped")
+	}
+	if route.TrackPoints[0].Latitude != tokyoTrack[0].Longitude {
+		t.Errorf("Expected points to be left as is, got %+v", route.TrackPoints[0])
+	}
+
+	// With the fix enabled the points and distance match the real track
+	cfg := config
+	cfg.FixSwappedCoordinates = true
+	withConfig(t, cfg)
+
+	route, err = loadRoute(context.Background(), "swapped.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load route: %v", err)
+	}
+	if !route.CoordinatesSwapped {
+		t.Error("Expected the fixed route to still be flagged as swapped")
+	}
+	for i, point := range route.TrackPoints {
+		if point != tokyoTrack[i] {
+			t.Fatalf("Expected point %d to be %+v, got %+v", i, tokyoTrack[i], point)
+		}
+	}
+	if want := calculateRouteDistance(tokyoTrack); math.Abs(route.Distance-want) > 1e-9 {
+		t.Errorf("Expected distance %f, got %f", want, route.Distance)
+	}
+
+	// The streaming parser applies the same fix
+	cfg.StreamingParseThreshold = 0
+	withConfig(t, cfg)
+
+	streamed, err := loadRoute(context.Background(), "swapped.gpx")
+	if err != nil {
+		t.Fatalf("Unable to stream route: %v", err)
+	}
+	if !streamed.CoordinatesSwapped || streamed.TrackPoints[0] != tokyoTrack[0] {
+		t.Errorf("Expected the streamed route to be fixed, got %+v", streamed.TrackPoints[0])
+	}
+}
+
+// berlinWalk is a walk in Berlin, near coverageTestRoute
+var berlinWalk = []TrackPoint{
+	{Latitude: 52.5300, Longitude: 13.4200},
+	{Latitude: 52.5315, Longitude: 13.4230},
+	{Latitude: 52.5330, Longitude: 13.4260},
+	{Latitude: 52.5345, Longitude: 13.4290},
+}
+
+func TestSwappedIntoExploredArea(t *testing.T) {
+	explored := pointsBoundingBox(coverageTestRoute.TrackPoints)
+
+	// Berlin exported as lat=13, lng=52 is valid, but only makes sense swapped
+	if !swappedIntoExploredArea(swapped(berlinWalk), explored) {
+		t.Error("Expected the swapped Berlin walk to be flagged next to a Berlin route")
+	}
+	if swappedIntoExploredArea(berlinWalk, explored) {
+		t.Error("A walk within the explored area must not be flagged")
+	}
+
+	// Far away, but not the explored area swapped either
+	paris := []TrackPoint{{Latitude: 48.8566, Longitude: 2.3522}, {Latitude: 48.8584, Longitude: 2.2945}}
+	if swappedIntoExploredArea(paris, explored) {
+		t.Error("A walk elsewhere must not be flagged")
+	}
+	if swappedIntoExploredArea(swapped(berlinWalk), boundingBox{}) {
+		t.Error("Without stored routes nothing can be judged")
+	}
+}
+
+func TestSwappedCoordinatesUploadNextToStoredRoutes(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t, coverageTestRoute)
+
+	// Without the fix enabled the route is only flagged
+	uploadRoute(t, store, "flagged.gpx", swapped(berlinWalk))
+	flagged, _ := store.GetByFilename("flagged.gpx")
+	if !flagged.CoordinatesSwapped || flagged.TrackPoints[0].Latitude != berlinWalk[0].Longitude {
+		t.Errorf("Expected the route to be flagged and left as is, got %t with %+v", flagged.CoordinatesSwapped, flagged.TrackPoints[0])
+	}
+
+	// With the fix enabled the points match the real walk
+	cfg := config
+	cfg.FixSwappedCoordinates = true
+	withConfig(t, cfg)
+
+	// A shorter walk, as the same file again would be turned down as a duplicate
+	uploadRoute(t, store, "fixed.gpx", swapped(berlinWalk[:3]))
+	fixed, _ := store.GetByFilename("fixed.gpx")
+	if !fixed.CoordinatesSwapped {
+		t.Error("Expected the fixed route to still be flagged as swapped")
+	}
+	for i, point := range fixed.TrackPoints {
+		if point != berlinWalk[i] {
+			t.Fatalf("Expected point %d to be %+v, got %+v", i, berlinWalk[i], point)
+		}
+	}
+
+	// Both survive being derived from their files again, without the other routes
+	for _, filename := range []string{"flagged.gpx", "fixed.gpx"} {
+		if err := persister.Delete(filename); err != nil {
+			t.Fatalf("Unable to remove the sidecar: %v", err)
+		}
+	}
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload the route index: %v", err)
+	}
+	restarted := NewRouteStore(loadExistingGPXFiles()...)
+	if reloaded, _ := restarted.GetByFilename("flagged.gpx"); !reloaded.CoordinatesSwapped {
+		t.Error("Expected the flagged route to still be flagged after a restart")
+	}
+	if reloaded, _ := restarted.GetByFilename("fixed.gpx"); !reloaded.CoordinatesSwapped || reloaded.TrackPoints[0] != berlinWalk[0] {
+		t.Errorf("Expected the fixed route to stay fixed after a restart, got %t with %+v", reloaded.CoordinatesSwapped, reloaded.TrackPoints[0])
+	}
+}
+
+func TestSwappedCoordinatesDeriveLikeNormalTrack(t *testing.T) {
+	withDataDir(t)
+	cfg := config
+	cfg.FixSwappedCoordinates = true
+	cfg.MinSegmentDistance = 5
+	withConfig(t, cfg)
+
+	// A timed walk in Tokyo with a pause of jitter within a few meters, in two tracks
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	timedTrack := func(swap bool) *gpx.GPX {
+		doc := &gpx.GPX{}
+		for track := 0; track < 2; track++ {
+			var segment gpx.GPXTrackSegment
+			for i := 0; i < 20; i++ {
+				lat, lng := 35.68+float64(track)*0.01, 139.76+float64(i)*0.0005
+				if i >= 5 && i < 10 {
+					lat, lng = 35.68+float64(track)*0.01+float64(i%2)*0.00001, 139.7625
+				}
+				if swap {
+					lat, lng = lng, lat
+				}
+				segment.Points = append(segment.Points, gpx.GPXPoint{
+					Point:     gpx.Point{Latitude: lat, Longitude: lng},
+					Timestamp: start.Add(time.Duration(track*20+i) * 30 * time.Second),
+				})
+			}
+			doc.Tracks = append(doc.Tracks, gpx.GPXTrack{Segments: []gpx.GPXTrackSegment{segment}})
+		}
+		return doc
+	}
+	if err := writeGPX("walk.gpx", timedTrack(false)); err != nil {
+		t.Fatalf("Unable to write GPX: %v", err)
+	}
+	if err := writeGPX("swapped.gpx", timedTrack(true)); err != nil {
+		t.Fatalf("Unable to write GPX: %v", err)
+	}
+
+	walk, err := loadRoute(context.Background(), "walk.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load route: %v", err)
+	}
+	fixed, err := loadRoute(context.Background(), "swapped.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load route: %v", err)
+	}
+
+	if !fixed.CoordinatesSwapped || walk.CoordinatesSwapped {
+		t.Fatalf("Expected only the swapped route to be flagged, got %t and %t", walk.CoordinatesSwapped, fixed.CoordinatesSwapped)
+	}
+	if fixed.Distance != walk.Distance || fixed.MovingTime != walk.MovingTime || fixed.Duration != walk.Duration {
+		t.Errorf("Expected the fixed route to measure %f km, %f s moving and %f s, got %f km, %f s and %f s",
+			walk.Distance, walk.MovingTime, walk.Duration, fixed.Distance, fixed.MovingTime, fixed.Duration)
+	}
+}
+
+func TestSamePointIgnoresDifferencesBelowPrecision(t *testing.T) {
+	cfg := config
+	cfg.CoordinatePrecision = 5
+	withConfig(t, cfg)
+
+	a := TrackPoint{Latitude: 52.520001, Longitude: 13.400004}
+	b := TrackPoint{Latitude: 52.519998, Longitude: 13.399996}
+	if !samePoint(a, b) {
+		t.Errorf("Expected %v and %v to be the same point at 5 decimals", a, b)
+	}
+	if c := (TrackPoint{Latitude: 52.52002, Longitude: 13.4}); samePoint(a, c) {
+		t.Errorf("Expected %v and %v to differ at 5 decimals", a, c)
+	}
+
+	// Stored tracks are on the same grid as the geometry decoded from OSRM
+	route, err := processGPXData("walk.gpx", buildTestGPX([]TrackPoint{a, {Latitude: 52.53, Longitude: 13.41}}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	decoded := decodePolyline(encodePolyline([]TrackPoint{b}, polylinePrecision), polylinePrecision)
+	if first := route.TrackPoints[0]; first.Latitude != decoded[0][0] || first.Longitude != decoded[0][1] {
+		t.Errorf("Expected the stored point %v to equal the decoded point %v", first, decoded[0])
+	}
+
+	// Sampling doesn't append a last point that only differs below the precision from
+	// the last sampled one, which OSRM would see as a zero-length leg
+	points := jitteryLine(9)
+	points = append(points, TrackPoint{Latitude: points[8].Latitude + 0.000001, Longitude: points[8].Longitude})
+	if sampled := samplePoints(points, 5); len(sampled) != 5 || sampled[4] != points[8] {
+		t.Errorf("Expected points 0, 2, 4, 6 and 8 to be sampled, got %v", sampled)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Coverage grid defaults and limits
+const (
+	defaultCellSize = 200.0 // meters
+	minCellSize     = 10.0
+	maxCellSize     = 10000.0
+
+	defaultGridPadding = 500.0 // meters
+	maxGridPadding     = 20000.0
+
+	// maxGridCells keeps fine grids over large areas from exhausting memory
+	maxGridCells = 250000
+
+	// metersPerDegreeLat is the approximate length of one degree of latitude
+	metersPerDegreeLat = 111320.0
+)
+
+// errCoverageGridTooLarge is returned when a grid would have more than maxGridCells cells
+var errCoverageGridTooLarge = errors.New("coverage grid too large")
+
+// CoverageCell is a single square of the coverage grid
+type CoverageCell struct {
+	MinLat float64 `json:"minLat"`
+	MinLng float64 `json:"minLng"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLng float64 `json:"maxLng"`
+	Visits int     `json:"visits"`         // Number of routes passing through the cell
+	Name   string  `json:"name,omitempty"` // Set for the most visited cells when names are requested
+}
+
+// CoverageGrid bins the area around the existing routes into square cells
+type CoverageGrid struct {
+	CellSize float64        `json:"cellSize"` // meters
+	Padding  float64        `json:"padding"`  // meters
+	Rows     int            `json:"rows"`
+	Cols     int            `json:"cols"`
+	Cells    []CoverageCell `json:"cells"` // Row-major, starting at the south-west corner
+
+	minLat, minLng   float64
+	latStep, lngStep float64
+}
+
+// buildCoverageGrid computes the coverage grid for the given routes. cellSize and padding are in meters.
+func buildCoverageGrid(routes []RouteData, cellSize, padding float64) (CoverageGrid, error) {
+	grid := CoverageGrid{CellSize: cellSize, Padding: padding}
+
+	// Find the bounding box of all points
+	box := routesBoundingBox(routes)
+	if !box.hasPoints {
+		return grid, nil
+	}
+	minLat, maxLat, minLng, maxLng := box.minLat, box.maxLat, box.minLng, box.maxLng
+
+	// Convert meters to degrees at the center of the area
+	centerLat := (minLat + maxLat) / 2
+	metersPerDegreeLng := metersPerDegreeLat * math.Cos(centerLat*math.Pi/180)
+	grid.latStep = cellSize / metersPerDegreeLat
+	grid.lngStep = cellSize / metersPerDegreeLng
+
+	grid.minLat = minLat - padding/metersPerDegreeLat
+	grid.minLng = minLng - padding/metersPerDegreeLng
+	grid.Rows = int(math.Floor((maxLat+padding/metersPerDegreeLat-grid.minLat)/grid.latStep)) + 1
+	grid.Cols = int(math.Floor((maxLng+padding/metersPerDegreeLng-grid.minLng)/grid.lngStep)) + 1
+
+	if grid.Rows*grid.Cols > maxGridCells {
+		return CoverageGrid{}, fmt.Errorf("%w: %dx%d cells exceed the limit of %d, use a larger cell size",
+			errCoverageGridTooLarge, grid.Rows, grid.Cols, maxGridCells)
+	}
+
+	grid.Cells = make([]CoverageCell, grid.Rows*grid.Cols)
+	for row := 0; row < grid.Rows; row++ {
+		for col := 0; col < grid.Cols; col++ {
+			cell := &grid.Cells[row*grid.Cols+col]
+			cell.MinLat = grid.minLat + float64(row)*grid.latStep
+			cell.MinLng = grid.minLng + float64(col)*grid.lngStep
+			cell.MaxLat = cell.MinLat + grid.latStep
+			cell.MaxLng = cell.MinLng + grid.lngStep
+		}
+	}
+
+	// Count each route at most once per cell
+	for _, route := range routes {
+		visited := make(map[int]bool)
+		for _, point := range route.TrackPoints {
+			index, ok := grid.cellIndex(point)
+			if ok && !visited[index] {
+				visited[index] = true
+				grid.Cells[index].Visits++
+			}
+		}
+	}
+
+	return grid, nil
+}
+
+// cellIndex returns the index of the cell containing the point
+func (g CoverageGrid) cellIndex(point TrackPoint) (int, bool) {
+	if g.latStep == 0 || g.lngStep == 0 {
+		return 0, false
+	}
+
+	row := int(math.Floor((point.Latitude - g.minLat) / g.latStep))
+	col := int(math.Floor((point.Longitude - g.minLng) / g.lngStep))
+	if row < 0 || row >= g.Rows || col < 0 || col >= g.Cols {
+		return 0, false
+	}
+
+	return row*g.Cols + col, true
+}
+
+// unvisitedFraction returns the share of grid cells within the box that no route passes through
+func (g CoverageGrid) unvisitedFraction(minLat, maxLat, minLng, maxLng float64) (float64, bool) {
+	total, unvisited := 0, 0
+	for _, cell := range g.Cells {
+		centerLat := (cell.MinLat + cell.MaxLat) / 2
+		centerLng := (cell.MinLng + cell.MaxLng) / 2
+		if centerLat < minLat || centerLat > maxLat || centerLng < minLng || centerLng > maxLng {
+			continue
+		}
+
+		total++
+		if cell.Visits == 0 {
+			unvisited++
+		}
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+
+	return float64(unvisited) / float64(total), true
+}
+
+// coverageBiasedBox shifts a bounding box towards the least explored part of the grid.
+// Candidates are the box itself and the box moved by half its size in each of the eight
+// compass directions; the one covering the largest share of unvisited cells wins.
+func coverageBiasedBox(grid CoverageGrid, minLat, maxLat, minLng, maxLng float64) (float64, float64, float64, float64) {
+	latShift := (maxLat - minLat) / 2
+	lngShift := (maxLng - minLng) / 2
+
+	bestLat, bestLng := 0.0, 0.0
+	bestScore := -1.0
+	for _, dLat := range []float64{0, -1, 1} {
+		for _, dLng := range []float64{0, -1, 1} {
+			offsetLat := dLat * latShift
+			offsetLng := dLng * lngShift
+
+			score, ok := grid.unvisitedFraction(minLat+offsetLat, maxLat+offsetLat, minLng+offsetLng, maxLng+offsetLng)
+			if ok && score > bestScore {
+				bestScore = score
+				bestLat, bestLng = offsetLat, offsetLng
+			}
+		}
+	}
+
+	return minLat + bestLat, maxLat + bestLat, minLng + bestLng, maxLng + bestLng
+}
+
+// parseCoverageParams reads and validates the cellSize and padding query parameters (in meters)
+func parseCoverageParams(query url.Values) (float64, float64, error) {
+	cellSize := defaultCellSize
+	padding := defaultGridPadding
+
+	if value := query.Get("cellSize"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < minCellSize || parsed > maxCellSize {
+			return 0, 0, fmt.Errorf("cellSize must be between %.0f and %.0f meters", minCellSize, maxCellSize)
+		}
+		cellSize = parsed
+	}
+
+	if value := query.Get("padding"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > maxGridPadding {
+			return 0, 0, fmt.Errorf("padding must be between 0 and %.0f meters", maxGridPadding)
+		}
+		padding = parsed
+	}
+
+	return cellSize, padding, nil
+}
+
+// coverageHandler returns the coverage grid of all existing routes
+func coverageHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		cellSize, padding, err := parseCoverageParams(r.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		names, err := parseCellNamesParam(r.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grid, err := store.coverageGrid(cellSize, padding)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grid = grid.withCellNames(r.Context(), names)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grid)
+	}
+}
+
+// geoJSON converts the grid into a FeatureCollection with one square polygon per cell
+func (g CoverageGrid) geoJSON() GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, len(g.Cells))
+	for i, cell := range g.Cells {
+		features[i] = GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: boxPolygon(cell.MinLat, cell.MinLng, cell.MaxLat, cell.MaxLng),
+			Properties: map[string]interface{}{
+				"visits": cell.Visits,
+			},
+		}
+		if cell.Name != "" {
+			features[i].Properties["name"] = cell.Name
+		}
+	}
+	return newFeatureCollection(features)
+}
+
+// coverageGeoJSONHandler returns the coverage grid as GeoJSON for use in GIS tools
+func coverageGeoJSONHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		cellSize, padding, err := parseCoverageParams(r.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		names, err := parseCellNamesParam(r.URL.Query())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grid, err := store.coverageGrid(cellSize, padding)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		grid = grid.withCellNames(r.Context(), names)
+
+		w.Header().Set("Content-Type", geoJSONContentType)
+		json.NewEncoder(w).Encode(grid.geoJSON())
+	}
+}
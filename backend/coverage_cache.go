@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+)
+
+// maxCachedGrids bounds the number of grids kept per route set version, in case
+// clients request many different cell sizes
+const maxCachedGrids = 16
+
+// coverageCacheKey identifies a coverage grid by its parameters
+type coverageCacheKey struct {
+	cellSize, padding float64
+}
+
+// coverageCache keeps the coverage grids computed for a route store's current version
+type coverageCache struct {
+	mu      sync.Mutex
+	version uint64
+	grids   map[coverageCacheKey]CoverageGrid
+	builds  int // Number of grids computed, for tests
+}
+
+// coverageGrid returns the coverage grid of all stored routes, computing it only when
+// the routes changed since it was last computed with these parameters
+func (s *RouteStore) coverageGrid(cellSize, padding float64) (CoverageGrid, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cache := &s.grids
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.grids == nil || cache.version != s.version {
+		cache.grids = map[coverageCacheKey]CoverageGrid{}
+		cache.version = s.version
+	}
+
+	key := coverageCacheKey{cellSize: cellSize, padding: padding}
+	if grid, ok := cache.grids[key]; ok {
+		return grid, nil
+	}
+
+	grid, err := buildCoverageGrid(s.routes, cellSize, padding)
+	if err != nil {
+		return CoverageGrid{}, err
+	}
+	cache.builds++
+	if len(cache.grids) >= maxCachedGrids {
+		cache.grids = map[coverageCacheKey]CoverageGrid{}
+	}
+	cache.grids[key] = grid
+
+	return grid, nil
+}
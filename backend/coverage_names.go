@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// maxNamedCells caps the names parameter of the coverage endpoints. Reverse lookups are
+// rate limited, so each uncached name can add config.GeocoderInterval to the response time.
+const maxNamedCells = 20
+
+// maxCellNameLookups caps the uncached reverse lookups of one coverage request, so it
+// waits for the geocoder at most that many times. Further cells are left unnamed until
+// later requests have cached their names.
+const maxCellNameLookups = 5
+
+// maxCachedCellNames bounds the cell name cache; it's cleared when full
+const maxCachedCellNames = 4096
+
+// cellNameCache remembers the names of cell centers, which rarely change, so repeated
+// coverage requests don't hit the geocoder again. Failed lookups aren't cached.
+var cellNameCache = struct {
+	mu    sync.Mutex
+	names map[string]string
+}{names: map[string]string{}}
+
+// cellNameKey identifies a point by its coordinates rounded to 5 decimals (about a meter)
+func cellNameKey(point TrackPoint) string {
+	return fmt.Sprintf("%.5f,%.5f", point.Latitude, point.Longitude)
+}
+
+// resetCellNames empties the cell name cache
+func resetCellNames() {
+	cellNameCache.mu.Lock()
+	defer cellNameCache.mu.Unlock()
+	cellNameCache.names = map[string]string{}
+}
+
+// cachedCellName returns the cached name of the location of a cell center
+func cachedCellName(center TrackPoint) (string, bool) {
+	cellNameCache.mu.Lock()
+	defer cellNameCache.mu.Unlock()
+	name, ok := cellNameCache.names[cellNameKey(center)]
+	return name, ok
+}
+
+// lookupCellName looks up the name of the location of a cell center and caches it
+func lookupCellName(ctx context.Context, center TrackPoint) (string, error) {
+	name, err := reverseGeocode(ctx, center)
+	if err != nil {
+		return "", err
+	}
+
+	cellNameCache.mu.Lock()
+	if len(cellNameCache.names) >= maxCachedCellNames {
+		cellNameCache.names = map[string]string{}
+	}
+	cellNameCache.names[cellNameKey(center)] = name
+	cellNameCache.mu.Unlock()
+
+	return name, nil
+}
+
+// parseCellNamesParam reads the number of most visited cells to name, zero if not requested
+func parseCellNamesParam(query url.Values) (int, error) {
+	value := query.Get("names")
+	if value == "" {
+		return 0, nil
+	}
+
+	names, err := strconv.Atoi(value)
+	if err != nil || names < 0 || names > maxNamedCells {
+		return 0, fmt.Errorf("names must be between 0 and %d", maxNamedCells)
+	}
+	return names, nil
+}
+
+// withCellNames returns a copy of the grid with the n most visited cells named after the
+// location of their center. Unvisited cells are never named. Without a geocoder the grid is
+// returned as is. Cells whose lookup fails, or that would exceed maxCellNameLookups or the
+// context, are left unnamed.
+func (g CoverageGrid) withCellNames(ctx context.Context, n int) CoverageGrid {
+	if n <= 0 || config.GeocoderURL == "" {
+		return g
+	}
+
+	var visited []int
+	for i, cell := range g.Cells {
+		if cell.Visits > 0 {
+			visited = append(visited, i)
+		}
+	}
+	// Stable, so ties go to the cells further south-west
+	sort.SliceStable(visited, func(a, b int) bool {
+		return g.Cells[visited[a]].Visits > g.Cells[visited[b]].Visits
+	})
+	if len(visited) > n {
+		visited = visited[:n]
+	}
+
+	// The cells are shared with the cached grid, so name a copy
+	g.Cells = append([]CoverageCell(nil), g.Cells...)
+	lookups := 0
+	for _, index := range visited {
+		cell := &g.Cells[index]
+		center := TrackPoint{Latitude: (cell.MinLat + cell.MaxLat) / 2, Longitude: (cell.MinLng + cell.MaxLng) / 2}
+
+		name, ok := cachedCellName(center)
+		if !ok {
+			if lookups >= maxCellNameLookups || ctx.Err() != nil {
+				continue
+			}
+			lookups++
+
+			var err error
+			if name, err = lookupCellName(ctx, center); err != nil {
+				slog.WarnContext(ctx, "Unable to name a coverage cell", "lat", center.Latitude, "lng", center.Longitude, "error", err)
+				continue
+			}
+		}
+		cell.Name = name
+	}
+
+	return g
+}
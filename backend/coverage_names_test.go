@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCoverageNamesOnlyTopCells(t *testing.T) {
+	var lookups atomic.Int32
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"address": map[string]string{"suburb": "Near " + r.URL.Query().Get("lat")},
+		})
+	})
+	resetCellNames()
+	t.Cleanup(resetCellNames)
+
+	// The first point is passed by three routes, the second by two, the rest by one
+	points := coverageTestRoute.TrackPoints
+	store := withRoutes(t,
+		coverageTestRoute,
+		RouteData{Filename: "short.gpx", TrackPoints: points[:2]},
+		RouteData{Filename: "start.gpx", TrackPoints: points[:1]},
+	)
+
+	coverage := func(query string) CoverageGrid {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		coverageHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/coverage?padding=0&cellSize=200"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var grid CoverageGrid
+		if err := json.NewDecoder(rec.Body).Decode(&grid); err != nil {
+			t.Fatalf("Unable to decode response: %v", err)
+		}
+		return grid
+	}
+
+	grid := coverage("&names=2")
+	named := 0
+	for _, cell := range grid.Cells {
+		if cell.Name == "" {
+			continue
+		}
+		named++
+		if cell.Visits < 2 {
+			t.Errorf("Expected only the most visited cells to be named, got %q with %d visits", cell.Name, cell.Visits)
+		}
+	}
+	if named != 2 {
+		t.Errorf("Expected 2 named cells, got %d", named)
+	}
+
+	// Names are cached, and the cached grid itself stays unnamed
+	before := lookups.Load()
+	coverage("&names=2")
+	if lookups.Load() != before {
+		t.Errorf("Expected cached names to be reused, got %d more lookups", lookups.Load()-before)
+	}
+	for _, cell := range coverage("").Cells {
+		if cell.Name != "" {
+			t.Errorf("Expected no names unless requested, got %q", cell.Name)
+		}
+	}
+}
+
+func TestCoverageNamesLimitsLookups(t *testing.T) {
+	var lookups atomic.Int32
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.Write([]byte(`{"address":{"suburb":"Mitte"}}`))
+	})
+	resetCellNames()
+	t.Cleanup(resetCellNames)
+	store := withRoutes(t, RouteData{Filename: "line.gpx", TrackPoints: jitteryLine(20)})
+
+	named := func() int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		coverageHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/coverage?padding=0&cellSize=50&names=20", nil))
+
+		var grid CoverageGrid
+		if err := json.NewDecoder(rec.Body).Decode(&grid); err != nil {
+			t.Fatalf("Unable to decode response: %v", err)
+		}
+		count := 0
+		for _, cell := range grid.Cells {
+			if cell.Name != "" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Each request looks up a few more names, the cache names the rest
+	if count := named(); count != maxCellNameLookups || lookups.Load() != maxCellNameLookups {
+		t.Fatalf("Expected %d named cells and lookups, got %d and %d", maxCellNameLookups, count, lookups.Load())
+	}
+	if count := named(); count != 2*maxCellNameLookups {
+		t.Errorf("Expected %d named cells after another request, got %d", 2*maxCellNameLookups, count)
+	}
+}
+
+func TestCoverageNamesStopWithContext(t *testing.T) {
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"address":{"suburb":"Mitte"}}`))
+	})
+	resetCellNames()
+	t.Cleanup(resetCellNames)
+
+	grid, err := NewRouteStore(RouteData{Filename: "line.gpx", TrackPoints: jitteryLine(20)}).coverageGrid(50, 0)
+	if err != nil {
+		t.Fatalf("Unable to build the grid: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, cell := range grid.withCellNames(ctx, 5).Cells {
+		if cell.Name != "" {
+			t.Errorf("Expected no lookups once the request is gone, got %q", cell.Name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// coverageTestRoute is a short route heading north-east through Berlin
+var coverageTestRoute = RouteData{
+	Filename: "coverage.gpx",
+	TrackPoints: []TrackPoint{
+		{Latitude: 52.520, Longitude: 13.400},
+		{Latitude: 52.522, Longitude: 13.403},
+		{Latitude: 52.524, Longitude: 13.406},
+		{Latitude: 52.526, Longitude: 13.409},
+		{Latitude: 52.528, Longitude: 13.412},
+	},
+}
+
+func TestBuildCoverageGrid(t *testing.T) {
+	grid, err := buildCoverageGrid([]RouteData{coverageTestRoute, coverageTestRoute}, 200, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(grid.Cells) != grid.Rows*grid.Cols {
+		t.Fatalf("Expected %d cells, got %d", grid.Rows*grid.Cols, len(grid.Cells))
+	}
+
+	// Every point lies in a cell visited by both routes
+	for _, point := range coverageTestRoute.TrackPoints {
+		index, ok := grid.cellIndex(point)
+		if !ok {
+			t.Fatalf("Point %v is outside the grid", point)
+		}
+		if grid.Cells[index].Visits != 2 {
+			t.Errorf("Expected 2 visits for the cell containing %v, got %d", point, grid.Cells[index].Visits)
+		}
+	}
+
+	// A route is counted once per cell even if several of its points fall inside it
+	dense := RouteData{TrackPoints: []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.52001, Longitude: 13.40001},
+	}}
+	grid, err = buildCoverageGrid([]RouteData{dense}, 200, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(grid.Cells) != 1 || grid.Cells[0].Visits != 1 {
+		t.Errorf("Expected a single cell with 1 visit, got %+v", grid.Cells)
+	}
+}
+
+func TestCoverageCellSizeChangesCellCount(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	cellCount := func(cellSize string) int {
+		req := httptest.NewRequest(http.MethodGet, "/coverage?padding=100&cellSize="+cellSize, nil)
+		rec := httptest.NewRecorder()
+		coverageHandler(store)(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var grid CoverageGrid
+		if err := json.NewDecoder(rec.Body).Decode(&grid); err != nil {
+			t.Fatalf("Unable to decode response: %v", err)
+		}
+		return len(grid.Cells)
+	}
+
+	coarse := cellCount("500")
+	fine := cellCount("50")
+	if fine <= coarse {
+		t.Errorf("Expected smaller cells to produce more cells, got %d (50m) vs %d (500m)", fine, coarse)
+	}
+}
+
+func TestCoverageHandlerValidatesParams(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	for _, query := range []string{"cellSize=1", "cellSize=abc", "padding=-5", "padding=1000000"} {
+		req := httptest.NewRequest(http.MethodGet, "/coverage?"+query, nil)
+		rec := httptest.NewRecorder()
+		coverageHandler(store)(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Query %q: Expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestCoverageBiasedBoxMovesTowardsUnexploredCells(t *testing.T) {
+	// Two routes cover the western half of the area densely
+	var west RouteData
+	for lat := 52.50; lat <= 52.54; lat += 0.001 {
+		for lng := 13.30; lng <= 13.34; lng += 0.002 {
+			west.TrackPoints = append(west.TrackPoints, TrackPoint{Latitude: lat, Longitude: lng})
+		}
+	}
+	east := RouteData{TrackPoints: []TrackPoint{
+		{Latitude: 52.50, Longitude: 13.38},
+		{Latitude: 52.54, Longitude: 13.38},
+	}}
+
+	grid, err := buildCoverageGrid([]RouteData{west, east}, 200, 3000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	minLat, maxLat, minLng, maxLng := 52.50, 52.54, 13.30, 13.38
+	_, _, newMinLng, newMaxLng := coverageBiasedBox(grid, minLat, maxLat, minLng, maxLng)
+
+	if newMinLng <= minLng || newMaxLng <= maxLng {
+		t.Errorf("Expected the box to move east away from the explored area, got [%f, %f]", newMinLng, newMaxLng)
+	}
+}
+
+func TestCoverageGeoJSON(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	req := httptest.NewRequest(http.MethodGet, "/coverage.geojson?padding=0", nil)
+	rec := httptest.NewRecorder()
+	coverageGeoJSONHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string         `json:"type"`
+				Coordinates [][][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Visits int `json:"visits"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&collection); err != nil {
+		t.Fatalf("Unable to decode GeoJSON: %v", err)
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) == 0 {
+		t.Fatalf("Expected a non-empty FeatureCollection, got %s with %d features", collection.Type, len(collection.Features))
+	}
+
+	// Find the polygon containing the first point, remembering positions are [lng, lat]
+	start := coverageTestRoute.TrackPoints[0]
+	found := false
+	for _, feature := range collection.Features {
+		ring := feature.Geometry.Coordinates[0]
+		if feature.Geometry.Type != "Polygon" || len(ring) != 5 || ring[0] != ring[4] {
+			t.Fatalf("Expected closed square polygons, got %+v", feature.Geometry)
+		}
+
+		minLng, minLat := ring[0][0], ring[0][1]
+		maxLng, maxLat := ring[2][0], ring[2][1]
+		if start.Latitude >= minLat && start.Latitude < maxLat && start.Longitude >= minLng && start.Longitude < maxLng {
+			found = true
+			if feature.Properties.Visits != 1 {
+				t.Errorf("Expected the visited cell to have 1 visit, got %d", feature.Properties.Visits)
+			}
+		}
+	}
+	if !found {
+		t.Error("No polygon contains the route's first point")
+	}
+}
+
+func TestCoverageGridIsCachedUntilRoutesChange(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	request := func() {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		coverageHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/coverage?cellSize=100", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	request()
+	request()
+	if got := store.grids.builds; got != 1 {
+		t.Errorf("Expected the grid to be computed once for unchanged routes, got %d computations", got)
+	}
+
+	// Adding a route invalidates the cached grid
+	store.Add(RouteData{Filename: "extra.gpx", TrackPoints: []TrackPoint{{Latitude: 52.53, Longitude: 13.42}}})
+
+	request()
+	if got := store.grids.builds; got != 2 {
+		t.Errorf("Expected the grid to be recomputed after routes changed, got %d computations", got)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parseWaypoints reads waypoints given as "lat,lng" values. Go's query parser rejects
+// semicolons, so they can't be joined the way OSRM does.
+func parseWaypoints(values []string) ([]TrackPoint, error) {
+	var points []TrackPoint
+	for _, pair := range values {
+		lat, lng, ok := strings.Cut(pair, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid point %q, expected lat,lng", pair)
+		}
+
+		latitude, errLat := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		longitude, errLng := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		if errLat != nil || errLng != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+			return nil, fmt.Errorf("invalid point %q, expected lat,lng", pair)
+		}
+
+		points = append(points, TrackPoint{Latitude: latitude, Longitude: longitude})
+	}
+
+	if len(points) < 2 {
+		return nil, errors.New("at least 2 points are required, e.g. point=52.52,13.40&point=52.53,13.41")
+	}
+	return points, nil
+}
+
+// debugOSRMURLHandler returns the OSRM request getRouteFollowingStreets would make for the
+// given waypoints and options, without contacting OSRM. It's only served when debug
+// endpoints are enabled.
+func debugOSRMURLHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.DebugEndpoints {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	points, err := parseWaypoints(r.URL.Query()["point"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var opts SuggestOptions
+	if err := parseStreetOptions(r.URL.Query(), &opts); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	url, used, err := buildOSRMRouteURL(osrmServiceRoute, points, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":       url,
+		"waypoints": len(used),
+	})
+}
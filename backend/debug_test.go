@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugOSRMURLMatchesRequest(t *testing.T) {
+	var requested string
+	server := withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requested = r.RequestURI
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	cfg := config
+	cfg.DebugEndpoints = true
+	cfg.FootpathExcludeClasses = "motorway"
+	withConfig(t, cfg)
+
+	points := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}, {Latitude: 52.52, Longitude: 13.40}}
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{PreferFootpaths: true, SnapAny: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet,
+		"/debug/osrm-url?point=52.52,13.40&point=52.53,13.41&point=52.52,13.40&preferFootpaths=true&snapping=any", nil)
+	debugOSRMURLHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		URL       string `json:"url"`
+		Waypoints int    `json:"waypoints"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if response.URL != server.URL+requested {
+		t.Errorf("Expected URL %s, got %s", server.URL+requested, response.URL)
+	}
+	if response.Waypoints != 3 {
+		t.Errorf("Expected 3 waypoints, got %d", response.Waypoints)
+	}
+}
+
+func TestDebugOSRMURLDisabledByDefault(t *testing.T) {
+	rec := httptest.NewRecorder()
+	debugOSRMURLHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/osrm-url?point=52.52,13.40&point=52.53,13.41", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without DEBUG_ENDPOINTS, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxMainStreets is the number of streets named in a route summary
+const maxMainStreets = 3
+
+// RouteDirections are turn-by-turn directions for a street route together with a
+// summary for showing the route on a card. They're only requested with verbose=true.
+type RouteDirections struct {
+	Steps   []RouteStep  `json:"steps"`
+	Summary RouteSummary `json:"summary"`
+}
+
+// RouteStep is a single instruction of the directions
+type RouteStep struct {
+	Instruction string  `json:"instruction"` // e.g. "Turn left onto Main St"
+	Street      string  `json:"street,omitempty"`
+	Distance    float64 `json:"distance"` // Kilometers until the next instruction
+	Duration    float64 `json:"duration"` // Seconds until the next instruction
+}
+
+// RouteSummary describes a route in a few numbers and a sentence
+type RouteSummary struct {
+	Distance    float64  `json:"distance"` // Kilometers
+	Duration    float64  `json:"duration"` // Estimated seconds
+	Turns       int      `json:"turns"`
+	MainStreets []string `json:"mainStreets"` // Streets covering the longest distance, longest first
+	Text        string   `json:"text"`        // e.g. "3.2 km, about 40 min, 5 turns via Main St and Park Ave"
+}
+
+// OSRMStep is a step of an OSRM route leg, returned when steps=true
+type OSRMStep struct {
+	Distance float64 `json:"distance"` // Meters
+	Duration float64 `json:"duration"` // Seconds
+	Name     string  `json:"name"`
+	Maneuver struct {
+		Type     string `json:"type"`
+		Modifier string `json:"modifier"`
+	} `json:"maneuver"`
+}
+
+// buildDirections turns the steps of an OSRM route into directions. distance is the
+// route's distance in kilometers and duration OSRM's estimate in seconds.
+func buildDirections(steps []OSRMStep, distance, duration float64) *RouteDirections {
+	directions := &RouteDirections{Steps: make([]RouteStep, len(steps))}
+
+	streetDistances := map[string]float64{}
+	for i, step := range steps {
+		directions.Steps[i] = RouteStep{
+			Instruction: describeManeuver(step),
+			Street:      step.Name,
+			Distance:    step.Distance / 1000,
+			Duration:    step.Duration,
+		}
+
+		if isTurn(step) {
+			directions.Summary.Turns++
+		}
+		if step.Name != "" {
+			streetDistances[step.Name] += step.Distance
+		}
+	}
+
+	streets := make([]string, 0, len(streetDistances))
+	for street := range streetDistances {
+		streets = append(streets, street)
+	}
+	sort.Slice(streets, func(i, j int) bool {
+		if streetDistances[streets[i]] != streetDistances[streets[j]] {
+			return streetDistances[streets[i]] > streetDistances[streets[j]]
+		}
+		return streets[i] < streets[j]
+	})
+	if len(streets) > maxMainStreets {
+		streets = streets[:maxMainStreets]
+	}
+
+	directions.Summary.Distance = distance
+	directions.Summary.Duration = duration
+	directions.Summary.MainStreets = streets
+	directions.Summary.Text = summaryText(directions.Summary, unitKilometers)
+
+	return directions
+}
+
+// isTurn reports whether following the step means changing direction
+func isTurn(step OSRMStep) bool {
+	switch step.Maneuver.Type {
+	case "depart", "arrive":
+		return false
+	}
+	return step.Maneuver.Modifier != "" && step.Maneuver.Modifier != "straight"
+}
+
+// describeManeuver returns a human-readable instruction for the step
+func describeManeuver(step OSRMStep) string {
+	onto := ""
+	if step.Name != "" {
+		onto = " onto " + step.Name
+	}
+
+	switch step.Maneuver.Type {
+	case "depart":
+		if step.Name != "" {
+			return "Start on " + step.Name
+		}
+		return "Start"
+	case "arrive":
+		return "Arrive at your destination"
+	case "roundabout", "rotary":
+		return "Take the roundabout" + onto
+	}
+
+	switch step.Maneuver.Modifier {
+	case "uturn":
+		return "Make a U-turn" + onto
+	case "straight", "":
+		return "Continue" + onto
+	case "slight left", "slight right":
+		return "Keep " + step.Maneuver.Modifier + onto
+	default:
+		return "Turn " + step.Maneuver.Modifier + onto
+	}
+}
+
+// summaryText writes the summary, whose distance is in the unit, as a sentence
+func summaryText(summary RouteSummary, unit Unit) string {
+	format := "%.1f %s, about %d min"
+	if unit == unitMeters {
+		format = "%.0f %s, about %d min"
+	}
+	text := fmt.Sprintf(format, summary.Distance, unit, int(summary.Duration/60+0.5))
+
+	switch summary.Turns {
+	case 0:
+		text += ", no turns"
+	case 1:
+		text += ", 1 turn"
+	default:
+		text += fmt.Sprintf(", %d turns", summary.Turns)
+	}
+
+	switch len(summary.MainStreets) {
+	case 0:
+	case 1:
+		text += " via " + summary.MainStreets[0]
+	default:
+		last := len(summary.MainStreets) - 1
+		text += " via " + strings.Join(summary.MainStreets[:last], ", ") + " and " + summary.MainStreets[last]
+	}
+
+	return text
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// steppedOSRMResponse is a 1 km, 12 minute route with a left and a right turn
+const steppedOSRMResponse = `{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":720,
+	"legs":[{"steps":[
+		{"distance":400,"duration":290,"name":"Main St","maneuver":{"type":"depart","modifier":"right"}},
+		{"distance":250,"duration":180,"name":"Park Ave","maneuver":{"type":"turn","modifier":"left"}},
+		{"distance":100,"duration":70,"name":"Main St","maneuver":{"type":"new name","modifier":"straight"}},
+		{"distance":250,"duration":180,"name":"Elm St","maneuver":{"type":"end of road","modifier":"right"}},
+		{"distance":0,"duration":0,"name":"Elm St","maneuver":{"type":"arrive"}}
+	]}]}]}`
+
+func TestSuggestVerboseReturnsDirections(t *testing.T) {
+	var queries []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(steppedOSRMResponse))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	// The stubbed route is far from the existing one, so accept it regardless
+	req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true&verbose=true&boundsStrictness=0", nil)
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(queries) == 0 || !strings.Contains(queries[0], "steps=true") {
+		t.Errorf("Expected OSRM to be asked for steps, got %v", queries)
+	}
+
+	var suggested []SuggestedRoute
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Unable to decode suggestions: %v", err)
+	}
+	directions := suggested[0].Directions
+	if directions == nil {
+		t.Fatal("Expected directions with verbose=true")
+	}
+
+	if len(directions.Steps) != 5 || directions.Steps[1].Instruction != "Turn left onto Park Ave" || directions.Steps[1].Distance != 0.25 {
+		t.Errorf("Expected a left turn onto Park Ave for 0.25 km, got %+v", directions.Steps)
+	}
+
+	summary := directions.Summary
+	if summary.Distance != 1 || summary.Duration != 720 || summary.Turns != 2 {
+		t.Errorf("Expected 1 km, 720 s and 2 turns, got %+v", summary)
+	}
+	if strings.Join(summary.MainStreets, ",") != "Main St,Elm St,Park Ave" {
+		t.Errorf("Expected Main St, Elm St and Park Ave by distance, got %v", summary.MainStreets)
+	}
+	if summary.Text != "1.0 km, about 12 min, 2 turns via Main St, Elm St and Park Ave" {
+		t.Errorf("Unexpected summary text %q", summary.Text)
+	}
+}
+
+func TestSuggestWithoutVerboseHasNoDirections(t *testing.T) {
+	var queries []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(steppedOSRMResponse))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true&boundsStrictness=0", nil)
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, req)
+
+	if strings.Contains(rec.Body.String(), `"directions"`) {
+		t.Errorf("Expected no directions without verbose, got %s", rec.Body.String())
+	}
+	for _, query := range queries {
+		if strings.Contains(query, "steps=") {
+			t.Errorf("Expected no steps to be requested, got %s", query)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "math"
+
+// Distance models, selecting how the distance between two points is computed
+const (
+	distanceModelHaversine = "haversine" // Great circle on a sphere, see haversineDistance
+	distanceModelVincenty  = "vincenty"  // Geodesic on the WGS-84 ellipsoid, see vincentyDistance
+)
+
+// WGS-84 ellipsoid
+const (
+	wgs84SemiMajorAxis = 6378137.0 // Meters
+	wgs84Flattening    = 1 / 298.257223563
+	wgs84SemiMinorAxis = (1 - wgs84Flattening) * wgs84SemiMajorAxis
+)
+
+// vincentyMaxIterations bounds the iterations of vincentyDistance, which only fails to
+// converge for nearly antipodal points
+const vincentyMaxIterations = 200
+
+// pointDistance returns the distance in kilometers between two points using the
+// configured distance model
+func pointDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	if config.DistanceModel == distanceModelVincenty {
+		return vincentyDistance(lat1, lon1, lat2, lon2)
+	}
+	return haversineDistance(lat1, lon1, lat2, lon2)
+}
+
+// vincentyDistance returns the distance in kilometers between two points along the
+// geodesic on the WGS-84 ellipsoid, using Vincenty's inverse formula. It's accurate to
+// within a millimeter, where the haversine formula can be off by over 0.5%. Nearly
+// antipodal points, for which the formula doesn't converge, fall back to haversineDistance.
+func vincentyDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	if lat1 == lat2 && lon1 == lon2 {
+		return 0
+	}
+
+	const f = wgs84Flattening
+	toRadians := math.Pi / 180
+	lonDiff := (lon2 - lon1) * toRadians
+
+	// Reduced latitudes
+	sinU1, cosU1 := math.Sincos(math.Atan((1 - f) * math.Tan(lat1*toRadians)))
+	sinU2, cosU2 := math.Sincos(math.Atan((1 - f) * math.Tan(lat2*toRadians)))
+
+	lambda := lonDiff
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // Coincident points
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0 // Both points on the equator
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+
+		c := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		previous := lambda
+		lambda = lonDiff + (1-c)*f*sinAlpha*
+			(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-previous) < 1e-12 {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return haversineDistance(lat1, lon1, lat2, lon2)
+	}
+
+	uSq := cosSqAlpha * (wgs84SemiMajorAxis*wgs84SemiMajorAxis - wgs84SemiMinorAxis*wgs84SemiMinorAxis) /
+		(wgs84SemiMinorAxis * wgs84SemiMinorAxis)
+	a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+	return wgs84SemiMinorAxis * a * (sigma - deltaSigma) / 1000
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// dms converts degrees, minutes and seconds to decimal degrees
+func dms(degrees, minutes, seconds float64) float64 {
+	if degrees < 0 {
+		return degrees - minutes/60 - seconds/3600
+	}
+	return degrees + minutes/60 + seconds/3600
+}
+
+func TestVincentyDistanceMatchesKnownGeodesics(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		expected               float64 // km
+	}{
+		// Vincenty's own example, from the Geoscience Australia geodetic calculators
+		{"Flinders Peak to Buninyong", dms(-37, 57, 3.72030), dms(144, 25, 29.52440),
+			dms(-37, 39, 10.15610), dms(143, 55, 35.38390), 54.972271},
+		{"1 degree of longitude on the equator", 0, 0, 0, 1, 111.319491},
+		{"1 degree of latitude from the equator", 0, 0, 1, 0, 110.574389},
+		{"Same point", 52.52, 13.4, 52.52, 13.4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := vincentyDistance(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(d-tt.expected) > 1e-6 {
+				t.Errorf("Expected %.6f km, got %.6f km", tt.expected, d)
+			}
+
+			// Haversine is off by up to about 0.56% on a meridian
+			if d := haversineDistance(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(d-tt.expected) > tt.expected*0.006 {
+				t.Errorf("Expected haversine within 0.6%% of %.6f km, got %.6f km", tt.expected, d)
+			}
+		})
+	}
+}
+
+func TestVincentyDistanceFallsBackForAntipodalPoints(t *testing.T) {
+	if d, expected := vincentyDistance(0, 0, 0.5, 179.7), haversineDistance(0, 0, 0.5, 179.7); d != expected {
+		t.Errorf("Expected the haversine distance %f km for nearly antipodal points, got %f km", expected, d)
+	}
+}
+
+func TestCalculateRouteDistanceUsesDistanceModel(t *testing.T) {
+	points := []TrackPoint{{Latitude: 0, Longitude: 0}, {Latitude: 1, Longitude: 0}}
+
+	if d := calculateRouteDistance(points); d != haversineDistance(0, 0, 1, 0) {
+		t.Errorf("Expected the haversine distance by default, got %f km", d)
+	}
+
+	cfg := config
+	cfg.DistanceModel = distanceModelVincenty
+	withConfig(t, cfg)
+	if d := calculateRouteDistance(points); math.Abs(d-110.574389) > 1e-6 {
+		t.Errorf("Expected the Vincenty distance, got %f km", d)
+	}
+}
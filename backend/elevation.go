@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// elevationClient is used for elevation lookups, which are optional and
+// mustn't hold up loading routes for long
+var elevationClient = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	// elevationBatchSize is the number of points looked up per request
+	elevationBatchSize = 100
+
+	// maxCachedElevations bounds the memory used by the elevation cache
+	maxCachedElevations = 100000
+)
+
+// The elevation cache maps coordinates rounded to about a meter to their elevation
+var (
+	elevationCache      = map[[2]float64]float64{}
+	elevationCacheMutex sync.Mutex
+)
+
+// elevationCacheKey rounds a point to five decimal places, about a meter
+func elevationCacheKey(point TrackPoint) [2]float64 {
+	return [2]float64{roundTo(point.Latitude, 5), roundTo(point.Longitude, 5)}
+}
+
+// openElevationLocation is a location in an Open-Elevation lookup request or response
+type openElevationLocation struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Elevation *float64 `json:"elevation,omitempty"`
+}
+
+// lookupElevations returns the elevation of each point in meters using an Open-Elevation
+// compatible service. Points are looked up in batches and answers are cached.
+func lookupElevations(ctx context.Context, points []TrackPoint) ([]float64, error) {
+	elevations := make([]float64, len(points))
+
+	// Only ask for the points that aren't cached yet
+	var missing []int
+	elevationCacheMutex.Lock()
+	for i, point := range points {
+		if elevation, ok := elevationCache[elevationCacheKey(point)]; ok {
+			elevations[i] = elevation
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	elevationCacheMutex.Unlock()
+
+	for start := 0; start < len(missing); start += elevationBatchSize {
+		batch := missing[start:min(start+elevationBatchSize, len(missing))]
+
+		locations := make([]openElevationLocation, len(batch))
+		for i, index := range batch {
+			locations[i] = openElevationLocation{Latitude: points[index].Latitude, Longitude: points[index].Longitude}
+		}
+
+		results, err := requestElevations(ctx, locations)
+		if err != nil {
+			return nil, err
+		}
+
+		elevationCacheMutex.Lock()
+		if len(elevationCache)+len(batch) > maxCachedElevations {
+			elevationCache = map[[2]float64]float64{}
+		}
+		for i, index := range batch {
+			elevations[index] = results[i]
+			elevationCache[elevationCacheKey(points[index])] = results[i]
+		}
+		elevationCacheMutex.Unlock()
+	}
+
+	return elevations, nil
+}
+
+// requestElevations sends a single lookup request to the elevation service
+func requestElevations(ctx context.Context, locations []openElevationLocation) ([]float64, error) {
+	body, err := json.Marshal(map[string]interface{}{"locations": locations})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.ElevationURL+"/api/v1/lookup", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := elevationClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("elevation service returned status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Results []openElevationLocation `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) != len(locations) {
+		return nil, fmt.Errorf("elevation service returned %d results for %d locations", len(response.Results), len(locations))
+	}
+
+	elevations := make([]float64, len(locations))
+	for i, result := range response.Results {
+		if result.Elevation == nil {
+			return nil, fmt.Errorf("elevation service returned no elevation for %f, %f", result.Latitude, result.Longitude)
+		}
+		elevations[i] = *result.Elevation
+	}
+
+	return elevations, nil
+}
+
+// elevationSampleIndices picks the points to look up: the first and last point and
+// every point at least spacing meters from the previously picked one
+func elevationSampleIndices(points []TrackPoint, spacing float64) []int {
+	if len(points) == 0 {
+		return nil
+	}
+
+	indices := []int{0}
+	last := points[0]
+	for i := 1; i < len(points)-1; i++ {
+		if haversineDistance(last.Latitude, last.Longitude, points[i].Latitude, points[i].Longitude)*1000 >= spacing {
+			indices = append(indices, i)
+			last = points[i]
+		}
+	}
+	if len(points) > 1 {
+		indices = append(indices, len(points)-1)
+	}
+
+	return indices
+}
+
+// elevationChange sums the elevation gained and lost between consecutive points
+// that both have an elevation
+func elevationChange(points []TrackPoint) (ascent, descent float64) {
+	for i := 1; i < len(points); i++ {
+		if !points[i-1].HasElevation || !points[i].HasElevation {
+			continue
+		}
+		if climb := points[i].Elevation - points[i-1].Elevation; climb > 0 {
+			ascent += climb
+		} else {
+			descent -= climb
+		}
+	}
+	return ascent, descent
+}
+
+// netElevationChange returns the elevation of the last point minus that of the first,
+// skipping points without elevation at either end. It's zero without elevation data.
+func netElevationChange(points []TrackPoint) float64 {
+	first, last := -1, -1
+	for i, point := range points {
+		if point.HasElevation {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first == -1 {
+		return 0
+	}
+	return points[last].Elevation - points[first].Elevation
+}
+
+// enrichElevation fills in the elevation of routes recorded without one when an
+// elevation service is configured. Sampled points are looked up and the points in
+// between are interpolated. Failures are logged and leave the route without elevation.
+func enrichElevation(ctx context.Context, route *RouteData) {
+	points := route.TrackPoints
+	if config.ElevationURL == "" || len(points) == 0 {
+		return
+	}
+	for _, point := range points {
+		if point.HasElevation {
+			return
+		}
+	}
+
+	if err := fillElevation(ctx, points); err != nil {
+		slog.WarnContext(ctx, "Unable to look up elevation", "file", route.Filename, "error", err)
+		return
+	}
+
+	route.TotalAscent, route.TotalDescent = elevationChange(points)
+	route.NetElevation = netElevationChange(points)
+}
+
+// fillElevation sets the elevation of every point by looking up points sampled every
+// config.ElevationSampleDistance meters and interpolating the ones in between
+func fillElevation(ctx context.Context, points []TrackPoint) error {
+	indices := elevationSampleIndices(points, config.ElevationSampleDistance)
+	sampled := make([]TrackPoint, len(indices))
+	for i, index := range indices {
+		sampled[i] = points[index]
+	}
+
+	elevations, err := lookupElevations(ctx, sampled)
+	if err != nil {
+		return err
+	}
+
+	// Interpolate linearly by point index between consecutive samples
+	for i, index := range indices {
+		points[index].Elevation = elevations[i]
+		points[index].HasElevation = true
+		if i == 0 {
+			continue
+		}
+
+		prev := indices[i-1]
+		for j := prev + 1; j < index; j++ {
+			fraction := float64(j-prev) / float64(index-prev)
+			points[j].Elevation = elevations[i-1] + fraction*(elevations[i]-elevations[i-1])
+			points[j].HasElevation = true
+		}
+	}
+
+	return nil
+}
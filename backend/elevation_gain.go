@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+)
+
+// elevationGainCandidates is the number of suggestions generated when looking for one
+// that climbs no more than the requested maximum elevation gain
+const elevationGainCandidates = 5
+
+// suggestionAscent looks up the elevation along a suggested route and returns the total
+// ascent in meters. The route's points are left without elevation.
+func suggestionAscent(ctx context.Context, points []TrackPoint) (float64, error) {
+	withElevation := make([]TrackPoint, len(points))
+	copy(withElevation, points)
+
+	if err := fillElevation(ctx, withElevation); err != nil {
+		return 0, err
+	}
+
+	ascent, _ := elevationChange(withElevation)
+	return ascent, nil
+}
+
+// suggestWithinElevationGain generates candidate suggestions until one climbs no more than
+// opts.MaxElevationGain meters. Unless the request asks for a bearing, each further candidate
+// heads out in another direction, so it crosses different terrain.
+func suggestWithinElevationGain(ctx context.Context, opts SuggestOptions,
+	generate func(SuggestOptions) ([]SuggestedRoute, error)) ([]SuggestedRoute, error) {
+	flattest := math.Inf(1)
+	for attempt := 0; attempt < elevationGainCandidates; attempt++ {
+		candidateOpts := opts
+		if attempt > 0 && opts.PreferredBearing == nil {
+			bearing := 360 * float64(attempt) / elevationGainCandidates
+			candidateOpts.PreferredBearing = &bearing
+		}
+
+		suggested, err := generate(candidateOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, route := range suggested {
+			ascent, err := suggestionAscent(ctx, route.Points)
+			if err != nil {
+				slog.WarnContext(ctx, "Unable to look up the elevation of a suggestion", "error", err)
+				continue
+			}
+
+			if ascent <= opts.MaxElevationGain {
+				route.TotalAscent = ascent
+				return []SuggestedRoute{route}, nil
+			}
+			slog.DebugContext(ctx, "Rejecting a suggestion climbing too much", "ascent", ascent, "maxElevationGain", opts.MaxElevationGain)
+			flattest = math.Min(flattest, ascent)
+		}
+	}
+
+	if math.IsInf(flattest, 1) {
+		return nil, errElevationUnavailable
+	}
+	return nil, fmt.Errorf("%w: the flattest of %d candidates climbs %.0f m, more than %.0f m",
+		errExceedsMaxElevationGain, elevationGainCandidates, flattest, opts.MaxElevationGain)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSuggestRejectsHillyCandidatesAboveMaxElevationGain(t *testing.T) {
+	hilly := squareLoop(1) // Climbs about 90 m on the north slope
+	flat := []TrackPoint{
+		{Latitude: 52.5, Longitude: 13.400},
+		{Latitude: 52.5, Longitude: 13.410},
+		{Latitude: 52.5, Longitude: 13.400},
+	}
+
+	// The first candidate OSRM routes is the hilly loop, later ones are flat unless onlyHilly is set
+	var requests atomic.Int32
+	var onlyHilly atomic.Bool
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		geometry := flat
+		if requests.Add(1) == 1 || onlyHilly.Load() {
+			geometry = hilly
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + encodePolyline(geometry, polyline6Precision) + `","distance":2000,"duration":1500}]}`))
+	})
+	withElevationService(t, northSlope)
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: hilly})
+
+	suggest := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		requests.Store(0)
+		osrmRouteCache.reset()
+		req := httptest.NewRequest(http.MethodGet, "/suggest"+query, nil)
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, req)
+		return rec
+	}
+
+	rec := suggest("?maxElevationGain=50")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var suggested []SuggestedRoute
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Unable to decode suggestions: %v", err)
+	}
+	if route := suggested[0]; route.TotalAscent > 50 || route.Points[2].Latitude != 52.5 {
+		t.Errorf("Expected the flat route to be suggested instead of the hilly one, got %+v", route)
+	}
+
+	// maxAscent caps the climb the same way
+	rec = suggest("?maxAscent=50")
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Unable to decode suggestions: %v", err)
+	}
+	if route := suggested[0]; route.TotalAscent > 50 || route.Points[2].Latitude != 52.5 {
+		t.Errorf("Expected maxAscent to suggest the flat route, got %+v", route)
+	}
+
+	// Without a cap the first, hilly candidate is fine
+	rec = suggest("")
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Unable to decode suggestions: %v", err)
+	}
+	if suggested[0].Points[2].Latitude == 52.5 {
+		t.Error("Expected the hilly route to be suggested without maxElevationGain")
+	}
+
+	// A cap no candidate meets is reported
+	onlyHilly.Store(true)
+	if rec := suggest("?maxElevationGain=50"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 when every candidate is too hilly, got %d", rec.Code)
+	}
+
+	cfg := config
+	cfg.ElevationURL = ""
+	withConfig(t, cfg)
+	if rec := suggest("?maxElevationGain=50"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without an elevation service, got %d", rec.Code)
+	}
+	if rec := suggest("?maxAscent=50"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "maxAscent") {
+		t.Errorf("Expected status 400 naming maxAscent without an elevation service, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// elevationCellSize is the size in degrees of latitude of the cells elevated points are
+// grouped in, so a point's neighbours within flatMaxElevationDistance are in adjacent cells
+const elevationCellSize = flatMaxElevationDistance * 1000 / metersPerDegreeLat
+
+// maxElevationCellSpan bounds the number of cells searched east and west of a point,
+// which grows towards the poles as degrees of longitude get shorter
+const maxElevationCellSpan = 20
+
+// elevationCell identifies a cell of an elevationIndex
+type elevationCell struct {
+	lat, lng int
+}
+
+// elevationIndex groups the points of the stored routes that have an elevation by cell,
+// so the elevation near a point is found without scanning all points
+type elevationIndex struct {
+	cells map[elevationCell][]TrackPoint
+}
+
+// buildElevationIndex indexes the points of the routes that have an elevation
+func buildElevationIndex(routes []RouteData) elevationIndex {
+	index := elevationIndex{cells: map[elevationCell][]TrackPoint{}}
+	for _, route := range routes {
+		for _, point := range route.TrackPoints {
+			if point.HasElevation {
+				cell := elevationCellOf(point)
+				index.cells[cell] = append(index.cells[cell], point)
+			}
+		}
+	}
+	return index
+}
+
+// elevationCellOf returns the cell containing the point
+func elevationCellOf(point TrackPoint) elevationCell {
+	return elevationCell{
+		lat: int(math.Floor(point.Latitude / elevationCellSize)),
+		lng: int(math.Floor(point.Longitude / elevationCellSize)),
+	}
+}
+
+// empty reports whether no point with an elevation is indexed
+func (index elevationIndex) empty() bool {
+	return len(index.cells) == 0
+}
+
+// nearestElevation returns the elevation of the indexed point closest to the point, and
+// false when none is within flatMaxElevationDistance
+func (index elevationIndex) nearestElevation(point TrackPoint) (float64, bool) {
+	cosLat := math.Max(math.Cos(point.Latitude*math.Pi/180), 0.01)
+	lngSpan := min(int(math.Ceil(1/cosLat)), maxElevationCellSpan)
+
+	center := elevationCellOf(point)
+	nearest, elevation := math.Inf(1), 0.0
+	for lat := center.lat - 1; lat <= center.lat+1; lat++ {
+		for lng := center.lng - lngSpan; lng <= center.lng+lngSpan; lng++ {
+			for _, candidate := range index.cells[elevationCell{lat: lat, lng: lng}] {
+				if d := haversineDistance(point.Latitude, point.Longitude, candidate.Latitude, candidate.Longitude); d < nearest {
+					nearest, elevation = d, candidate.Elevation
+				}
+			}
+		}
+	}
+	return elevation, nearest <= flatMaxElevationDistance
+}
+
+// elevationIndexCache keeps the elevation index built for a route store's current version
+type elevationIndexCache struct {
+	mu      sync.Mutex
+	version uint64
+	index   *elevationIndex
+	builds  int // Number of indexes built, for tests
+}
+
+// elevationIndex returns the elevation index of all stored routes, building it only when
+// the routes changed since it was last built
+func (s *RouteStore) elevationIndex() elevationIndex {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cache := &s.elevations
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.index == nil || cache.version != s.version {
+		index := buildElevationIndex(s.routes)
+		cache.index, cache.version = &index, s.version
+		cache.builds++
+	}
+	return *cache.index
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// withElevationService points the elevation configuration at a stub server and starts
+// with an empty cache. It returns the number of requests the stub has received.
+func withElevationService(t *testing.T, handler http.HandlerFunc) *atomic.Int32 {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config
+	cfg.ElevationURL = server.URL
+	cfg.ElevationSampleDistance = 50
+	withConfig(t, cfg)
+
+	elevationCacheMutex.Lock()
+	originalCache := elevationCache
+	elevationCache = map[[2]float64]float64{}
+	elevationCacheMutex.Unlock()
+	t.Cleanup(func() {
+		elevationCacheMutex.Lock()
+		elevationCache = originalCache
+		elevationCacheMutex.Unlock()
+	})
+
+	return &requests
+}
+
+// northSlope answers elevation lookups with one meter per 0.0001 degrees north of 52.5
+func northSlope(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Locations []openElevationLocation `json:"locations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Locations) > elevationBatchSize {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	for i := range request.Locations {
+		elevation := (request.Locations[i].Latitude - 52.5) * 10000
+		request.Locations[i].Elevation = &elevation
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": request.Locations})
+}
+
+// northLine returns count points walking north in steps of about 10 m
+func northLine(count int) []TrackPoint {
+	points := make([]TrackPoint, count)
+	for i := range points {
+		points[i] = TrackPoint{Latitude: 52.5 + float64(i)*0.0001, Longitude: 13.4}
+	}
+	return points
+}
+
+func TestEnrichElevation(t *testing.T) {
+	requests := withElevationService(t, northSlope)
+
+	// About 6 km with a sample every 50 m needs more than one batch
+	route := RouteData{Filename: "north.gpx", TrackPoints: northLine(600)}
+	enrichElevation(context.Background(), &route)
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Expected the lookups to be split into 2 batches, got %d requests", got)
+	}
+	for i, point := range route.TrackPoints {
+		if !point.HasElevation || math.Abs(point.Elevation-float64(i)) > 1e-6 {
+			t.Fatalf("Expected point %d at %d m, got %+v", i, i, point)
+		}
+	}
+	if math.Abs(route.TotalAscent-599) > 1e-6 || route.TotalDescent != 0 {
+		t.Errorf("Expected 599 m ascent and no descent, got %f and %f", route.TotalAscent, route.TotalDescent)
+	}
+
+	// The same points are answered from the cache
+	again := RouteData{Filename: "again.gpx", TrackPoints: northLine(600)}
+	enrichElevation(context.Background(), &again)
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Expected cached elevations to be reused, got %d requests", got)
+	}
+	if again.TotalAscent != route.TotalAscent {
+		t.Errorf("Expected the cached lookup to give the same ascent, got %f", again.TotalAscent)
+	}
+
+	// Tracks that already have elevation are left alone
+	recorded := RouteData{Filename: "recorded.gpx", TrackPoints: northLine(3)}
+	recorded.TrackPoints[0].Elevation, recorded.TrackPoints[0].HasElevation = 500, true
+	enrichElevation(context.Background(), &recorded)
+	if recorded.TrackPoints[1].HasElevation || recorded.TrackPoints[0].Elevation != 500 {
+		t.Errorf("Expected recorded elevations to be kept, got %+v", recorded.TrackPoints)
+	}
+}
+
+func TestEnrichElevationFailsSoft(t *testing.T) {
+	withElevationService(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+	})
+
+	route := RouteData{Filename: "north.gpx", TrackPoints: northLine(10)}
+	enrichElevation(context.Background(), &route)
+
+	for _, point := range route.TrackPoints {
+		if point.HasElevation || point.Elevation != 0 {
+			t.Fatalf("Expected no elevation when the lookup fails, got %+v", point)
+		}
+	}
+	if route.TotalAscent != 0 || route.TotalDescent != 0 {
+		t.Errorf("Expected no elevation change, got %f and %f", route.TotalAscent, route.TotalDescent)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+)
+
+// flatCandidates is the number of perimeters compared when the flattest one is preferred
+const flatCandidates = 5
+
+// flatSampleSpacing is the distance in kilometers between the points along a perimeter
+// whose elevation is estimated
+const flatSampleSpacing = 0.1
+
+// flatMaxElevationDistance is the distance in kilometers within which a recorded point's
+// elevation is used for a sample. Farther points say nothing about the sample's elevation.
+const flatMaxElevationDistance = 0.2
+
+// flatMinCoverage is the share of a perimeter's samples that need nearby elevation data
+// for the perimeter to be judged
+const flatMinCoverage = 0.5
+
+// estimatedElevationChange estimates the total climb and descent in meters along the
+// points. Every flatSampleSpacing kilometers the elevation is taken from the closest
+// indexed point, and samples without one nearby are skipped. It also returns the share of
+// samples that had nearby elevation data.
+func estimatedElevationChange(points []TrackPoint, index elevationIndex) (change, coverage float64) {
+	length := calculateRouteDistance(points)
+	samples, covered := 0, 0
+	previous := math.NaN()
+	for travelled := 0.0; travelled <= length; travelled += flatSampleSpacing {
+		sample, _ := pointAtDistance(points, travelled)
+		samples++
+		elevation, ok := index.nearestElevation(sample)
+		if !ok {
+			continue
+		}
+		covered++
+		if !math.IsNaN(previous) {
+			change += math.Abs(elevation - previous)
+		}
+		previous = elevation
+	}
+	if samples == 0 {
+		return 0, 0
+	}
+	return change, float64(covered) / float64(samples)
+}
+
+// flattestPerimeter returns the candidate with the least estimated elevation change, judged
+// by the elevation recorded along the routes. Candidates mostly outside the recorded area
+// aren't judged, and when none can be, the first candidate is returned.
+func flattestPerimeter(candidates [][]TrackPoint, index elevationIndex) []TrackPoint {
+	if index.empty() {
+		slog.Info("No elevation data in the stored routes, unable to prefer a flat route")
+		return candidates[0]
+	}
+
+	flattest, least := candidates[0], math.Inf(1)
+	for _, candidate := range candidates {
+		change, coverage := estimatedElevationChange(candidate, index)
+		if coverage < flatMinCoverage {
+			continue
+		}
+		// Scale the change up to the whole perimeter so partly covered candidates don't win
+		if score := change / coverage; score < least {
+			flattest, least = candidate, score
+		}
+	}
+	if math.IsInf(least, 1) {
+		slog.Info("Too little elevation data near the candidates, unable to prefer a flat route")
+		return candidates[0]
+	}
+	slog.Debug("Picked the flattest perimeter", "candidates", len(candidates), "elevationChange", least)
+	return flattest
+}
@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+// slopedRoute is a route along a line of latitude whose elevation rises by 100 m for
+// every 0.01 degrees east
+func slopedRoute() RouteData {
+	var points []TrackPoint
+	for i := 0; i <= 10; i++ {
+		points = append(points, TrackPoint{
+			Latitude:     52.5,
+			Longitude:    13.4 + float64(i)*0.01,
+			Elevation:    float64(i) * 100,
+			HasElevation: true,
+		})
+	}
+	return RouteData{ID: "sloped", TrackPoints: points}
+}
+
+func TestFlattestPerimeterFollowsContours(t *testing.T) {
+	index := buildElevationIndex([]RouteData{slopedRoute()})
+
+	// Going north stays at the same elevation, going east climbs
+	level := []TrackPoint{{Latitude: 52.5, Longitude: 13.45}, {Latitude: 52.501, Longitude: 13.45}, {Latitude: 52.5, Longitude: 13.45}}
+	steep := []TrackPoint{{Latitude: 52.5, Longitude: 13.4}, {Latitude: 52.5, Longitude: 13.47}, {Latitude: 52.5, Longitude: 13.4}}
+
+	if change, coverage := estimatedElevationChange(level, index); change != 0 || coverage != 1 {
+		t.Errorf("Expected no elevation change along a covered contour, got %.0f m over %.0f%%", change, coverage*100)
+	}
+	if change, _ := estimatedElevationChange(steep, index); change < 1000 || change > 1400 {
+		t.Errorf("Expected about 1400 m of elevation change up and down the slope, got %.0f m", change)
+	}
+
+	if flattest := flattestPerimeter([][]TrackPoint{steep, level}, index); &flattest[0] != &level[0] {
+		t.Errorf("Expected the level perimeter, got %v", flattest)
+	}
+
+	// Without elevation data there's nothing to compare
+	if flattest := flattestPerimeter([][]TrackPoint{steep, level}, buildElevationIndex([]RouteData{coverageTestRoute})); &flattest[0] != &steep[0] {
+		t.Errorf("Expected the first perimeter without elevation data, got %v", flattest)
+	}
+}
+
+func TestFlattestPerimeterIgnoresDistantElevation(t *testing.T) {
+	index := buildElevationIndex([]RouteData{slopedRoute()})
+
+	// A perimeter 5 km north of the recorded slope only has distant elevation data
+	distant := []TrackPoint{{Latitude: 52.545, Longitude: 13.4}, {Latitude: 52.545, Longitude: 13.47}, {Latitude: 52.545, Longitude: 13.4}}
+	steep := []TrackPoint{{Latitude: 52.5, Longitude: 13.4}, {Latitude: 52.5, Longitude: 13.47}, {Latitude: 52.5, Longitude: 13.4}}
+
+	if _, coverage := estimatedElevationChange(distant, index); coverage != 0 {
+		t.Errorf("Expected no samples covered far from the recorded points, got %.0f%%", coverage*100)
+	}
+	if flattest := flattestPerimeter([][]TrackPoint{steep, distant}, index); &flattest[0] != &steep[0] {
+		t.Errorf("Expected the covered perimeter rather than the distant one, got %v", flattest)
+	}
+	if flattest := flattestPerimeter([][]TrackPoint{distant, distant[1:]}, index); &flattest[0] != &distant[0] {
+		t.Errorf("Expected the first perimeter when none is covered, got %v", flattest)
+	}
+}
+
+func TestElevationIndexCachedPerVersion(t *testing.T) {
+	store := NewRouteStore(slopedRoute())
+
+	store.elevationIndex()
+	store.elevationIndex()
+	if got := store.elevations.builds; got != 1 {
+		t.Errorf("Expected the index to be built once for unchanged routes, got %d builds", got)
+	}
+
+	store.Add(RouteData{Filename: "other.gpx", TrackPoints: coverageTestRoute.TrackPoints})
+	if _, ok := store.elevationIndex().nearestElevation(TrackPoint{Latitude: 52.5, Longitude: 13.45}); !ok {
+		t.Error("Expected elevation near the sloped route")
+	}
+	if got := store.elevations.builds; got != 2 {
+		t.Errorf("Expected the index to be rebuilt after the routes changed, got %d builds", got)
+	}
+}
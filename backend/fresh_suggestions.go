@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+)
+
+// freshBearingCandidates is the number of evenly spaced outbound bearings considered
+// when steering a suggestion away from recent ones
+const freshBearingCandidates = 8
+
+// freshSuggestionBearing picks the outbound bearing whose seed loop stays farthest from
+// the recently returned suggestions, so repeated requests explore different directions.
+// It returns nil when there are no routes or no recent suggestions to avoid.
+func freshSuggestionBearing(store *RouteStore, recent []SuggestionRecord) *float64 {
+	var avoid []clusterRoute
+	for _, record := range recent {
+		if len(record.Route.Points) > 0 {
+			avoid = append(avoid, newClusterRoute(RouteData{TrackPoints: record.Route.Points}))
+		}
+	}
+	if len(avoid) == 0 {
+		return nil
+	}
+
+	box := store.BoundingBox()
+	if !box.hasPoints {
+		return nil
+	}
+
+	// Score each candidate loop by its mean distance to the closest recent suggestion
+	best, bestScore := 0.0, -1.0
+	for i := 0; i < freshBearingCandidates; i++ {
+		candidateBearing := 360 * float64(i) / freshBearingCandidates
+		candidate := newClusterRoute(RouteData{
+			TrackPoints: bearingLoop(box.center(), candidateBearing, box.perimeter()),
+		})
+
+		score := math.Inf(1)
+		for _, suggestion := range avoid {
+			score = math.Min(score, meanDistanceTo(candidate, suggestion))
+		}
+		if score > bestScore {
+			best, bestScore = candidateBearing, score
+		}
+	}
+
+	return &best
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAvoidRecentSuggestions(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	suggest := func() SuggestedRoute {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false&avoidRecent=true", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var suggested []SuggestedRoute
+		if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+			t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+		}
+		return suggested[0]
+	}
+
+	first := suggest()
+	second := suggest()
+	third := suggest()
+
+	// Each new suggestion should keep well away from the ones before it
+	pairs := []struct {
+		name string
+		a, b SuggestedRoute
+	}{
+		{"second vs first", second, first},
+		{"third vs first", third, first},
+		{"third vs second", third, second},
+	}
+	for _, pair := range pairs {
+		distance := meanDistanceTo(
+			newClusterRoute(RouteData{TrackPoints: pair.a.Points}),
+			newClusterRoute(RouteData{TrackPoints: pair.b.Points}),
+		)
+		if distance < 0.2 {
+			t.Errorf("%s: Expected substantially different geometry, mean distance is only %.0f m", pair.name, distance*1000)
+		}
+	}
+}
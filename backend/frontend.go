@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// fallbackPage is served at / when the frontend directory is missing, so it's
+// clear that the server is running and the API can still be used
+const fallbackPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Walk Assistant</title>
+</head>
+<body>
+<h1>Walk Assistant</h1>
+<p>The server is running, but the frontend files weren't found. Set <code>FRONTEND_DIR</code> to the directory containing <code>index.html</code>.</p>
+<p>The API is available, for example:</p>
+<ul>
+<li><a href="/routes">GET /routes</a> lists the stored routes</li>
+<li><a href="/suggest">GET /suggest</a> suggests a new route</li>
+<li>POST /upload uploads a GPX file</li>
+</ul>
+</body>
+</html>
+`
+
+// frontendHandler serves the static frontend files from dir. If the directory doesn't
+// exist, a warning is logged and a minimal page is served at / instead.
+func frontendHandler(dir string) http.Handler {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		slog.Warn("Frontend directory not found, serving a minimal page at / instead", "dir", dir)
+		return http.HandlerFunc(fallbackPageHandler)
+	}
+
+	return http.FileServer(http.Dir(dir))
+}
+
+// fallbackPageHandler serves fallbackPage at / and 404 for every other path
+func fallbackPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(fallbackPage))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingFrontendServesFallbackPage(t *testing.T) {
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+	cfg := config
+	cfg.FrontendDir = filepath.Join(t.TempDir(), "missing")
+	withConfig(t, cfg)
+
+	server := httptest.NewServer(newServeMux(store))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body := readBody(t, resp)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "frontend files weren't found") {
+		t.Errorf("Expected the fallback page, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get(server.URL + "/js/app.js")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for other frontend files, got %d", resp.StatusCode)
+	}
+
+	// The API still works
+	resp, err = http.Get(server.URL + "/routes")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if body := readBody(t, resp); resp.StatusCode != http.StatusOK || !strings.Contains(body, "park.gpx") {
+		t.Errorf("Expected /routes to list park.gpx, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestFrontendServesFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Walks</h1>"), 0644); err != nil {
+		t.Fatalf("Unable to write index.html: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	frontendHandler(dir).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>Walks</h1>" {
+		t.Errorf("Expected index.html, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// readBody reads and closes a response body
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var body strings.Builder
+	if _, err := io.Copy(&body, resp.Body); err != nil {
+		t.Fatalf("Unable to read response: %v", err)
+	}
+	return body.String()
+}
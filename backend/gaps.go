@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// TrackGap is a place where the recording dropped out between two consecutive points
+type TrackGap struct {
+	Index    int        `json:"index"` // Index of the point after the gap in the route's trackPoints
+	From     TrackPoint `json:"from"`
+	To       TrackPoint `json:"to"`
+	Distance float64    `json:"distance"` // Kilometers between the two points
+	Duration float64    `json:"duration"` // Seconds between the two points, 0 if unknown
+}
+
+// findGaps reports consecutive points of a segment that are more than minDistance meters
+// or minDuration apart. A long jump means the GPS lost its fix while the walker kept
+// moving; a long pause with little movement means the recording was interrupted.
+// Segment boundaries are deliberate breaks and aren't reported. Zero disables a criterion.
+func findGaps(gpxData *gpx.GPX, minDistance float64, minDuration time.Duration) []TrackGap {
+	gaps := []TrackGap{}
+	maxTimestamp := time.Now().Add(config.TimestampFutureTolerance)
+	validTime := func(timestamp time.Time) bool {
+		return !timestamp.Before(minValidTimestamp) && !timestamp.After(maxTimestamp)
+	}
+
+	index := 0
+	for _, track := range gpxData.Tracks {
+		for _, segment := range track.Segments {
+			for i := range segment.Points {
+				if i > 0 {
+					prev, point := segment.Points[i-1], segment.Points[i]
+					distance := haversineDistance(prev.Latitude, prev.Longitude, point.Latitude, point.Longitude)
+
+					var duration time.Duration
+					if validTime(prev.Timestamp) && validTime(point.Timestamp) {
+						duration = point.Timestamp.Sub(prev.Timestamp)
+					}
+
+					if (minDistance > 0 && distance*1000 > minDistance) || (minDuration > 0 && duration > minDuration) {
+						gaps = append(gaps, TrackGap{
+							Index:    index,
+							From:     TrackPoint{Latitude: prev.Latitude, Longitude: prev.Longitude},
+							To:       TrackPoint{Latitude: point.Latitude, Longitude: point.Longitude},
+							Distance: distance,
+							Duration: duration.Seconds(),
+						})
+					}
+				}
+				index++
+			}
+		}
+	}
+
+	return gaps
+}
+
+// routeGapsHandler lists the places where a route's recording dropped out
+func routeGapsHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		filename := r.PathValue("filename")
+
+		if _, ok := store.GetByFilename(filename); !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		// Timestamps aren't kept in memory, so the gaps are found in the GPX file itself
+		gpxData, err := parseGPX(r.Context(), filename)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Unable to parse GPX file")
+			return
+		}
+
+		gaps := findGaps(gpxData, config.GapDistance, config.GapDuration)
+		for i := range gaps {
+			gaps[i].Distance = roundTo(gaps[i].Distance, config.DistancePrecision)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"filename": filename,
+			"gaps":     gaps,
+		})
+	}
+}
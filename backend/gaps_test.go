@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// timedWalk writes a track walking east in 10 m steps every 5 seconds, with a 300 m
+// jump before the 5th point and a 5 minute pause before the 10th
+func timedWalk(t *testing.T, filename string) {
+	t.Helper()
+
+	const lat = 52.5
+	stepLng := 0.01 / (111.195 * math.Cos(lat*math.Pi/180))
+	lng := 13.4
+	timestamp := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	segment := gpx.GPXTrackSegment{}
+	for i := 0; i < 15; i++ {
+		switch i {
+		case 5:
+			lng += 30 * stepLng
+		case 10:
+			timestamp = timestamp.Add(5 * time.Minute)
+		}
+
+		segment.Points = append(segment.Points, gpx.GPXPoint{
+			Point:     gpx.Point{Latitude: lat, Longitude: lng},
+			Timestamp: timestamp,
+		})
+
+		lng += stepLng
+		timestamp = timestamp.Add(5 * time.Second)
+	}
+
+	gpxData := &gpx.GPX{Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}}}
+	if err := writeGPX(filename, gpxData); err != nil {
+		t.Fatalf("Unable to write test GPX: %v", err)
+	}
+}
+
+func TestRouteGapsHandler(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t, RouteData{Filename: "gappy.gpx"})
+	timedWalk(t, "gappy.gpx")
+
+	req := httptest.NewRequest(http.MethodGet, "/routes/gappy.gpx/gaps", nil)
+	req.SetPathValue("filename", "gappy.gpx")
+	rec := httptest.NewRecorder()
+	routeGapsHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Gaps []TrackGap `json:"gaps"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if len(response.Gaps) != 2 {
+		t.Fatalf("Expected 2 gaps, got %+v", response.Gaps)
+	}
+
+	jump, pause := response.Gaps[0], response.Gaps[1]
+	if jump.Index != 5 || math.Abs(jump.Distance-0.31) > 0.01 || jump.Duration != 5 {
+		t.Errorf("Expected a 0.31 km jump before point 5, got %+v", jump)
+	}
+	if pause.Index != 10 || pause.Duration != 305 || pause.Distance > 0.02 {
+		t.Errorf("Expected a 305 s pause before point 10, got %+v", pause)
+	}
+}
+
+func TestRouteGapsNotFound(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/routes/missing.gpx/gaps", nil)
+	req.SetPathValue("filename", "missing.gpx")
+	rec := httptest.NewRecorder()
+	routeGapsHandler(store)(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// geocoderClient is used for reverse geocoding requests, which are optional
+// and mustn't hold up suggestions for long
+var geocoderClient = &http.Client{Timeout: 5 * time.Second}
+
+// geocodeLimiter spaces reverse geocoding requests at least config.GeocoderInterval apart
+var geocodeLimiter struct {
+	mu   sync.Mutex
+	next time.Time // Earliest time the next request may be sent
+}
+
+// waitForGeocoder blocks until the next reverse geocoding request may be sent, or
+// returns the context's error once it's done
+func waitForGeocoder(ctx context.Context) error {
+	geocodeLimiter.mu.Lock()
+	now := time.Now()
+	start := geocodeLimiter.next
+	if start.Before(now) {
+		start = now
+	}
+	geocodeLimiter.next = start.Add(config.GeocoderInterval)
+	geocodeLimiter.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// NominatimResponse is the part of a Nominatim reverse geocoding response we use
+type NominatimResponse struct {
+	DisplayName string `json:"display_name"`
+	Address     struct {
+		Road          string `json:"road"`
+		Pedestrian    string `json:"pedestrian"`
+		Footway       string `json:"footway"`
+		Neighbourhood string `json:"neighbourhood"`
+		Suburb        string `json:"suburb"`
+	} `json:"address"`
+	Error string `json:"error"`
+}
+
+// reverseGeocode returns a short human-readable label for the location of a point,
+// such as "Main St", using a Nominatim-compatible reverse geocoding service
+func reverseGeocode(ctx context.Context, point TrackPoint) (string, error) {
+	url := fmt.Sprintf("%s/reverse?format=jsonv2&lat=%f&lon=%f", config.GeocoderURL, point.Latitude, point.Longitude)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	// Nominatim's usage policy requires identifying the application
+	req.Header.Set("User-Agent", "walkassistant")
+
+	if err := waitForGeocoder(ctx); err != nil {
+		return "", err
+	}
+	resp, err := geocoderClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoder returned status %d", resp.StatusCode)
+	}
+
+	var geocoded NominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&geocoded); err != nil {
+		return "", err
+	}
+	if geocoded.Error != "" {
+		return "", fmt.Errorf("geocoder error: %s", geocoded.Error)
+	}
+
+	// Prefer the street name, falling back to broader areas
+	for _, label := range []string{
+		geocoded.Address.Road,
+		geocoded.Address.Pedestrian,
+		geocoded.Address.Footway,
+		geocoded.Address.Neighbourhood,
+		geocoded.Address.Suburb,
+		geocoded.DisplayName,
+	} {
+		if label != "" {
+			return label, nil
+		}
+	}
+
+	return "", fmt.Errorf("geocoder returned no name for %f, %f", point.Latitude, point.Longitude)
+}
+
+// addLocationLabels attaches start and end location labels to the suggestions when
+// a geocoder is configured. Geocoding failures are logged and leave the labels empty,
+// and labelling stops once the context is done.
+func addLocationLabels(ctx context.Context, suggested []SuggestedRoute) {
+	if config.GeocoderURL == "" {
+		return
+	}
+
+	for i := range suggested {
+		points := suggested[i].Points
+		if len(points) == 0 || ctx.Err() != nil {
+			continue
+		}
+
+		start, err := reverseGeocode(ctx, points[0])
+		if err != nil {
+			slog.WarnContext(ctx, "Unable to geocode the suggestion start", "error", err)
+			continue
+		}
+		suggested[i].StartLabel = start
+
+		// Loops end where they start
+		end := points[len(points)-1]
+		if end == points[0] {
+			suggested[i].EndLabel = start
+			continue
+		}
+		if suggested[i].EndLabel, err = reverseGeocode(ctx, end); err != nil {
+			slog.WarnContext(ctx, "Unable to geocode the suggestion end", "error", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withGeocoder points the geocoder configuration at a stub server for the duration of a test
+func withGeocoder(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := config
+	cfg.GeocoderURL = server.URL
+	cfg.GeocoderInterval = 0
+	withConfig(t, cfg)
+}
+
+func TestAddLocationLabels(t *testing.T) {
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("lat") == "52.520000" {
+			w.Write([]byte(`{"display_name":"Main St, Berlin","address":{"road":"Main St"}}`))
+			return
+		}
+		w.Write([]byte(`{"display_name":"Somewhere, Berlin","address":{"suburb":"Mitte"}}`))
+	})
+
+	suggested := []SuggestedRoute{
+		{Points: []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}},
+		{Points: []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}, {Latitude: 52.52, Longitude: 13.40}}},
+	}
+	addLocationLabels(context.Background(), suggested)
+
+	if suggested[0].StartLabel != "Main St" || suggested[0].EndLabel != "Mitte" {
+		t.Errorf("Expected labels Main St and Mitte, got %q and %q", suggested[0].StartLabel, suggested[0].EndLabel)
+	}
+	if suggested[1].StartLabel != "Main St" || suggested[1].EndLabel != "Main St" {
+		t.Errorf("Expected a loop to start and end at Main St, got %q and %q", suggested[1].StartLabel, suggested[1].EndLabel)
+	}
+}
+
+func TestAddLocationLabelsFailsSoft(t *testing.T) {
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+	})
+
+	suggested := []SuggestedRoute{{Points: []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}}}
+	addLocationLabels(context.Background(), suggested)
+
+	if suggested[0].StartLabel != "" || suggested[0].EndLabel != "" {
+		t.Errorf("Expected no labels when geocoding fails, got %q and %q", suggested[0].StartLabel, suggested[0].EndLabel)
+	}
+	if len(suggested[0].Points) != 2 {
+		t.Error("The suggestion itself must be left untouched")
+	}
+}
+
+func TestAddLocationLabelsStopsWithContext(t *testing.T) {
+	requests := 0
+	withGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"address":{"road":"Main St"}}`))
+	})
+	cfg := config
+	cfg.GeocoderInterval = time.Second
+	withConfig(t, cfg)
+	t.Cleanup(func() { geocodeLimiter.next = time.Time{} })
+
+	line := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+	suggested := []SuggestedRoute{{Points: line}, {Points: line}, {Points: line}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	addLocationLabels(ctx, suggested)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected labelling to stop with the context, took %s", elapsed)
+	}
+	if requests != 1 || suggested[0].StartLabel != "Main St" || suggested[2].StartLabel != "" {
+		t.Errorf("Expected only the first lookup before the context was done, got %d requests and %+v", requests, suggested)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// geoJSONContentType is the media type of GeoJSON documents (RFC 7946)
+const geoJSONContentType = "application/geo+json"
+
+// GeoJSONFeatureCollection is a GeoJSON FeatureCollection (RFC 7946)
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is a single GeoJSON Feature
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry is a GeoJSON geometry. Positions are [lng, lat] as required by the spec.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// newFeatureCollection wraps features into a FeatureCollection
+func newFeatureCollection(features []GeoJSONFeature) GeoJSONFeatureCollection {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+	return GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// boxPolygon returns a closed, counter-clockwise GeoJSON polygon covering the box
+func boxPolygon(minLat, minLng, maxLat, maxLng float64) GeoJSONGeometry {
+	ring := [][]float64{
+		{minLng, minLat},
+		{maxLng, minLat},
+		{maxLng, maxLat},
+		{minLng, maxLat},
+		{minLng, minLat},
+	}
+	return GeoJSONGeometry{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
+
+// lineString returns a GeoJSON LineString through the points
+func lineString(points []TrackPoint) GeoJSONGeometry {
+	coordinates := make([][]float64, len(points))
+	for i, point := range points {
+		coordinates[i] = []float64{point.Longitude, point.Latitude}
+	}
+	return GeoJSONGeometry{Type: "LineString", Coordinates: coordinates}
+}
+
+// routesGeoJSON converts routes into a FeatureCollection with one LineString per route
+func routesGeoJSON(routes []RouteData) GeoJSONFeatureCollection {
+	features := make([]GeoJSONFeature, len(routes))
+	for i, route := range routes {
+		features[i] = GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: lineString(route.TrackPoints),
+			Properties: map[string]interface{}{
+				"id":       route.ID,
+				"filename": route.Filename,
+				"distance": route.Distance,
+			},
+		}
+	}
+	return newFeatureCollection(features)
+}
+
+// wantsGeoJSON reports whether the request asks for GeoJSON, either with ?format=geojson
+// or an Accept header naming application/geo+json. ?format=json forces the default shape.
+func wantsGeoJSON(r *http.Request) (bool, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "geojson":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), geoJSONContentType), nil
+	default:
+		return false, fmt.Errorf("unknown format %q, expected json or geojson", format)
+	}
+}
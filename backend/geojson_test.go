@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesGeoJSON(t *testing.T) {
+	store := withRoutes(t,
+		RouteData{ID: "a1", Filename: "park.gpx", Distance: 1.234, TrackPoints: squareLoop(1)},
+		RouteData{ID: "b2", Filename: "river.gpx", Distance: 2, TrackPoints: squareLoop(1)[:2], ActivityType: "hiking"},
+	)
+
+	tests := []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{"format parameter", "/routes?format=geojson&sort=name", ""},
+		{"accept header", "/routes?sort=name", "application/geo+json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			routesHandler(store)(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != geoJSONContentType {
+				t.Errorf("Expected content type %s, got %s", geoJSONContentType, contentType)
+			}
+
+			var collection struct {
+				Type     string `json:"type"`
+				Features []struct {
+					Geometry struct {
+						Type        string       `json:"type"`
+						Coordinates [][2]float64 `json:"coordinates"`
+					} `json:"geometry"`
+					Properties struct {
+						ID       string  `json:"id"`
+						Filename string  `json:"filename"`
+						Distance float64 `json:"distance"`
+					} `json:"properties"`
+				} `json:"features"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&collection); err != nil {
+				t.Fatalf("Unable to decode GeoJSON: %v", err)
+			}
+			if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+				t.Fatalf("Expected a FeatureCollection with 2 features, got %s with %d", collection.Type, len(collection.Features))
+			}
+
+			park := collection.Features[0]
+			if park.Geometry.Type != "LineString" || len(park.Geometry.Coordinates) != 5 {
+				t.Errorf("Expected a LineString with 5 positions, got %+v", park.Geometry)
+			}
+			start := squareLoop(1)[0]
+			if park.Geometry.Coordinates[0] != [2]float64{start.Longitude, start.Latitude} {
+				t.Errorf("Expected positions as [lng, lat], got %v", park.Geometry.Coordinates[0])
+			}
+			if park.Properties.ID != "a1" || park.Properties.Filename != "park.gpx" || park.Properties.Distance != 1.23 {
+				t.Errorf("Expected the rounded park.gpx properties, got %+v", park.Properties)
+			}
+		})
+	}
+
+	// Filters still apply and an unknown format is rejected
+	req := httptest.NewRequest(http.MethodGet, "/routes?format=geojson&activity=hiking", nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+	var filtered GeoJSONFeatureCollection
+	if err := json.NewDecoder(rec.Body).Decode(&filtered); err != nil || len(filtered.Features) != 1 {
+		t.Errorf("Expected only the hiking route, got %+v (%v)", filtered.Features, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/routes?format=kml", nil)
+	rec = httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", rec.Code)
+	}
+}
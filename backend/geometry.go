@@ -0,0 +1,212 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// pointAtDistance returns the point distanceKm kilometers along the track, interpolating
+// linearly within the segment where that distance is reached. It returns false, along
+// with the nearest end of the track, when the distance is negative or beyond the
+// track's length.
+func pointAtDistance(points []TrackPoint, distanceKm float64) (TrackPoint, bool) {
+	if len(points) == 0 {
+		return TrackPoint{}, false
+	}
+	if distanceKm < 0 {
+		return points[0], false
+	}
+
+	travelled := 0.0
+	for i := 0; i < len(points)-1; i++ {
+		a, b := points[i], points[i+1]
+		segment := haversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+
+		if travelled+segment >= distanceKm {
+			if segment == 0 {
+				return a, true
+			}
+			fraction := (distanceKm - travelled) / segment
+			return TrackPoint{
+				Latitude:  a.Latitude + (b.Latitude-a.Latitude)*fraction,
+				Longitude: a.Longitude + (b.Longitude-a.Longitude)*fraction,
+			}, true
+		}
+		travelled += segment
+	}
+
+	// A single point track has length zero
+	last := points[len(points)-1]
+	return last, distanceKm == 0
+}
+
+// bearing returns the initial compass bearing in degrees (0 = north, 90 = east) from a to b
+func bearing(a, b TrackPoint) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	lngDiff := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	y := math.Sin(lngDiff) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(lngDiff)
+
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// destinationPoint returns the point distanceKm kilometers from start along the given compass bearing
+func destinationPoint(start TrackPoint, bearingDegrees, distanceKm float64) TrackPoint {
+	// Earth's radius in kilometers
+	const R = 6371.0
+
+	lat1 := start.Latitude * math.Pi / 180
+	lng1 := start.Longitude * math.Pi / 180
+	theta := bearingDegrees * math.Pi / 180
+	delta := distanceKm / R
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lng2 := lng1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1), math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+
+	return TrackPoint{Latitude: lat2 * 180 / math.Pi, Longitude: lng2 * 180 / math.Pi}
+}
+
+// bearingLoop returns a triangular loop of roughly distanceKm kilometers that leaves
+// start along the given bearing and comes back from 60 degrees clockwise of it
+func bearingLoop(start TrackPoint, bearingDegrees, distanceKm float64) []TrackPoint {
+	side := distanceKm / 3
+	return []TrackPoint{
+		start,
+		destinationPoint(start, bearingDegrees, side),
+		destinationPoint(start, bearingDegrees+60, side),
+		start,
+	}
+}
+
+// clampToRadius moves the points farther than radiusKm kilometers from center onto the
+// circle of that radius, keeping their bearing from the center
+func clampToRadius(points []TrackPoint, center TrackPoint, radiusKm float64) []TrackPoint {
+	clamped := make([]TrackPoint, len(points))
+	for i, point := range points {
+		clamped[i] = point
+		if haversineDistance(center.Latitude, center.Longitude, point.Latitude, point.Longitude) > radiusKm {
+			clamped[i] = destinationPoint(center, bearing(center, point), radiusKm)
+		}
+	}
+	return clamped
+}
+
+// clampBoxToRadius shrinks a bounding box to the square inscribed in the circle of radiusKm
+// kilometers around center. If the box lies entirely outside that square, the square is returned.
+func clampBoxToRadius(center TrackPoint, radiusKm, minLat, maxLat, minLng, maxLng float64) (float64, float64, float64, float64) {
+	half := radiusKm / math.Sqrt2
+	north := destinationPoint(center, 0, half).Latitude
+	south := destinationPoint(center, 180, half).Latitude
+	east := destinationPoint(center, 90, half).Longitude
+	west := destinationPoint(center, 270, half).Longitude
+
+	minLat, maxLat = math.Max(minLat, south), math.Min(maxLat, north)
+	minLng, maxLng = math.Max(minLng, west), math.Min(maxLng, east)
+	if minLat >= maxLat || minLng >= maxLng {
+		return south, north, west, east
+	}
+	return minLat, maxLat, minLng, maxLng
+}
+
+// snapLoopClosure closes a nearly closed track exactly by moving its last point onto
+// the first when they are within toleranceKm kilometers. Open tracks are returned as is.
+func snapLoopClosure(points []TrackPoint, toleranceKm float64) []TrackPoint {
+	if len(points) < 3 {
+		return points
+	}
+
+	first, last := points[0], points[len(points)-1]
+	if first == last {
+		return points
+	}
+	if haversineDistance(first.Latitude, first.Longitude, last.Latitude, last.Longitude) > toleranceKm {
+		return points
+	}
+
+	points[len(points)-1] = first
+	return points
+}
+
+// routeDiameter returns the largest distance in kilometers between any two points of the
+// route, i.e. how far apart its farthest points are. Only points on the convex hull can
+// be farthest apart, so the hull is built first and its antipodal pairs are found with
+// rotating calipers instead of comparing every pair of points.
+func routeDiameter(points []TrackPoint) float64 {
+	hull := convexHull(points)
+	distance := func(i, j int) float64 {
+		a, b := hull[i%len(hull)], hull[j%len(hull)]
+		return haversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+	}
+
+	switch len(hull) {
+	case 0, 1:
+		return 0
+	case 2:
+		return distance(0, 1)
+	}
+
+	// Advance the opposite caliper while it moves away from the current hull edge
+	diameter := 0.0
+	j := 1
+	for i := range hull {
+		for hullCross(hull[i], hull[(i+1)%len(hull)], hull[(j+1)%len(hull)]) >
+			hullCross(hull[i], hull[(i+1)%len(hull)], hull[j%len(hull)]) {
+			j++
+		}
+		diameter = math.Max(diameter, math.Max(distance(i, j), distance(i+1, j)))
+	}
+
+	return diameter
+}
+
+// convexHull returns the points of the convex hull in counter-clockwise order using
+// Andrew's monotone chain. Longitudes are scaled by the cosine of the latitude so the
+// hull matches the shape on the ground.
+func convexHull(points []TrackPoint) []TrackPoint {
+	if len(points) == 0 {
+		return nil
+	}
+
+	cosLat := math.Cos(points[0].Latitude * math.Pi / 180)
+	projected := make([]TrackPoint, len(points))
+	for i, p := range points {
+		projected[i] = TrackPoint{Latitude: p.Latitude, Longitude: p.Longitude * cosLat}
+	}
+	sort.Slice(projected, func(i, j int) bool {
+		if projected[i].Longitude != projected[j].Longitude {
+			return projected[i].Longitude < projected[j].Longitude
+		}
+		return projected[i].Latitude < projected[j].Latitude
+	})
+
+	// Build the lower and then the upper hull, dropping points that don't turn left
+	hull := make([]TrackPoint, 0, 2*len(projected))
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, p := range projected {
+			for len(hull) >= start+2 && hullCross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, p)
+		}
+		// The last point is the first of the other half
+		hull = hull[:len(hull)-1]
+
+		for i, j := 0, len(projected)-1; i < j; i, j = i+1, j-1 {
+			projected[i], projected[j] = projected[j], projected[i]
+		}
+	}
+
+	for i := range hull {
+		hull[i].Longitude /= cosLat
+	}
+	return hull
+}
+
+// hullCross returns the cross product of the vectors o->a and o->b, positive when
+// o, a and b turn counter-clockwise
+func hullCross(o, a, b TrackPoint) float64 {
+	return (a.Longitude-o.Longitude)*(b.Latitude-o.Latitude) - (a.Latitude-o.Latitude)*(b.Longitude-o.Longitude)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestPointAtDistance(t *testing.T) {
+	// Two equal legs heading north, then east
+	points := []TrackPoint{
+		{Latitude: 52.50, Longitude: 13.40},
+		{Latitude: 52.51, Longitude: 13.40},
+		{Latitude: 52.51, Longitude: 13.42},
+	}
+	total := calculateRouteDistance(points)
+	firstLeg := calculateRouteDistance(points[:2])
+
+	closeTo := func(a, b TrackPoint) bool {
+		return math.Abs(a.Latitude-b.Latitude) < 1e-9 && math.Abs(a.Longitude-b.Longitude) < 1e-9
+	}
+
+	tests := []struct {
+		name     string
+		distance float64
+		want     TrackPoint
+		ok       bool
+	}{
+		{"start", 0, points[0], true},
+		{"middle of first leg", firstLeg / 2, TrackPoint{Latitude: 52.505, Longitude: 13.40}, true},
+		{"corner", firstLeg, points[1], true},
+		{"end", total, points[2], true},
+		{"beyond the end", total + 1, points[2], false},
+		{"negative", -1, points[0], false},
+	}
+
+	for _, tt := range tests {
+		got, ok := pointAtDistance(points, tt.distance)
+		if ok != tt.ok || !closeTo(got, tt.want) {
+			t.Errorf("%s: expected %v (%t), got %v (%t)", tt.name, tt.want, tt.ok, got, ok)
+		}
+	}
+
+	// The point at the midpoint lies half the total distance from the start
+	mid, ok := pointAtDistance(points, total/2)
+	if !ok {
+		t.Fatal("Expected the midpoint to be on the track")
+	}
+	along := firstLeg + haversineDistance(points[1].Latitude, points[1].Longitude, mid.Latitude, mid.Longitude)
+	if math.Abs(along-total/2) > 1e-3 {
+		t.Errorf("Expected the midpoint %f km along the track, got %f km", total/2, along)
+	}
+
+	if _, ok := pointAtDistance(nil, 0); ok {
+		t.Error("Expected no point on an empty track")
+	}
+}
+
+func TestBearingAndDestinationPoint(t *testing.T) {
+	start := TrackPoint{Latitude: 52.52, Longitude: 13.40}
+
+	for _, want := range []float64{0, 45, 90, 180, 270, 315} {
+		destination := destinationPoint(start, want, 2)
+
+		if got := bearing(start, destination); math.Abs(got-want) > 0.1 {
+			t.Errorf("Expected bearing %f, got %f", want, got)
+		}
+		if d := haversineDistance(start.Latitude, start.Longitude, destination.Latitude, destination.Longitude); math.Abs(d-2) > 1e-6 {
+			t.Errorf("Expected a destination 2 km away, got %f km", d)
+		}
+	}
+}
+
+// angleDiff returns the absolute difference between two compass bearings
+func angleDiff(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return math.Min(d, 360-d)
+}
+
+func TestSuggestionHeadsTowardsPreferredBearing(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	for _, preferred := range []float64{0, 135, 250} {
+		preferred := preferred
+		suggested, err := generateSuggestedRoutes(context.Background(), osrmRouter{}, store, SuggestOptions{PreferredBearing: &preferred})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		points := suggested[0].Points
+		if len(points) < 3 || points[0] != points[len(points)-1] {
+			t.Fatalf("Expected a loop back to the start, got %v", points)
+		}
+		if got := bearing(points[0], points[1]); angleDiff(got, preferred) > 1 {
+			t.Errorf("Expected the outbound seed point at bearing %f from the start, got %f", preferred, got)
+		}
+	}
+}
+
+func TestSuggestionStaysWithinMaxRadius(t *testing.T) {
+	// Routes spread over roughly 20 km
+	store := withRoutes(t, RouteData{
+		Filename: "wide.gpx",
+		TrackPoints: []TrackPoint{
+			{Latitude: 52.40, Longitude: 13.25},
+			{Latitude: 52.50, Longitude: 13.40},
+			{Latitude: 52.58, Longitude: 13.55},
+		},
+	})
+	center := TrackPoint{Latitude: 52.49, Longitude: 13.40}
+
+	preferred := 45.0
+	for _, opts := range []SuggestOptions{
+		{MaxRadiusKm: 2},
+		{MaxRadiusKm: 2, MinDistance: 30},
+		{MaxRadiusKm: 2, PreferredBearing: &preferred},
+	} {
+		for i := 0; i < 10; i++ {
+			suggested, err := generateSuggestedRoutes(context.Background(), osrmRouter{}, store, opts)
+			if err != nil || len(suggested) != 1 {
+				t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+			}
+
+			for _, point := range suggested[0].Points {
+				if d := haversineDistance(center.Latitude, center.Longitude, point.Latitude, point.Longitude); d > 2+1e-6 {
+					t.Fatalf("Point %v is %f km from the center, beyond the 2 km radius (options %+v)", point, d, opts)
+				}
+			}
+		}
+	}
+}
+
+func TestRouteDiameter(t *testing.T) {
+	// The farthest points of a square are opposite corners
+	square := squareLoop(1)
+	want := haversineDistance(square[0].Latitude, square[0].Longitude, square[2].Latitude, square[2].Longitude)
+	if got := routeDiameter(square); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected the square's diagonal of %.4f km, got %.4f km", want, got)
+	}
+
+	// Compare against every pair of points of an irregular out-and-back route
+	var wiggly []TrackPoint
+	for i := 0; i < 400; i++ {
+		angle := float64(i) * 0.05
+		wiggly = append(wiggly, TrackPoint{
+			Latitude:  52.5 + 0.02*math.Sin(angle) + 0.003*math.Sin(7*angle),
+			Longitude: 13.4 + 0.03*math.Cos(0.5*angle) + 0.002*math.Cos(11*angle),
+		})
+	}
+	bruteForce := 0.0
+	for i := range wiggly {
+		for j := i + 1; j < len(wiggly); j++ {
+			bruteForce = math.Max(bruteForce, haversineDistance(
+				wiggly[i].Latitude, wiggly[i].Longitude, wiggly[j].Latitude, wiggly[j].Longitude))
+		}
+	}
+	if got := routeDiameter(wiggly); math.Abs(got-bruteForce) > 0.001 {
+		t.Errorf("Expected a diameter of %.4f km, got %.4f km", bruteForce, got)
+	}
+
+	// Straight lines and single points have no area to span
+	line := jitteryLine(2)
+	if got, want := routeDiameter(line), calculateRouteDistance(line); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected a straight line's diameter to be its length %.4f km, got %.4f km", want, got)
+	}
+	if got := routeDiameter(square[:1]); got != 0 {
+		t.Errorf("Expected a single point to have no diameter, got %.4f km", got)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// splitGPXTracks writes every track with points of a GPX file in the data directory to a
+// file of its own, named after the original with the track's number appended, and removes
+// the original unless a route is stored from it. Names taken by a stored route or another
+// file get a further number, so no route is replaced. Files with fewer than two such tracks
+// are left alone. It returns the names of the files holding the tracks.
+func splitGPXTracks(store *RouteStore, filename string) ([]string, error) {
+	gpxData, err := gpx.ParseFile(filepath.Join(config.DataDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []gpx.GPXTrack
+	for _, track := range gpxData.Tracks {
+		if track.GetTrackPointsNo() > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	if len(tracks) < 2 {
+		return []string{filename}, nil
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	filenames := make([]string, 0, len(tracks))
+	for i, track := range tracks {
+		part := *gpxData
+		part.Tracks = []gpx.GPXTrack{track}
+		part.Routes, part.Waypoints = nil, nil
+
+		name, err := reserveFilename(store, fmt.Sprintf("%s-%d.gpx", base, i+1))
+		if err == nil {
+			filenames = append(filenames, name)
+			err = writeGPX(name, &part)
+		}
+		if err != nil {
+			removeSplitParts(store, filenames)
+			return nil, err
+		}
+	}
+
+	if _, stored := store.GetByFilename(filename); !stored {
+		if err := os.Remove(filepath.Join(config.DataDir, filename)); err != nil {
+			removeSplitParts(store, filenames)
+			return nil, err
+		}
+	}
+	return filenames, nil
+}
+
+// reserveFilename returns the name, or the name with a number appended, that neither a
+// stored route nor a file in the data directory uses. The file is created empty, so
+// concurrent uploads can't pick the same name.
+func reserveFilename(store *RouteStore, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		if _, stored := store.GetByFilename(candidate); stored {
+			continue
+		}
+
+		file, err := os.OpenFile(filepath.Join(config.DataDir, candidate), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return candidate, file.Close()
+	}
+}
+
+// removeSplitParts undoes storing the parts of a split upload: their routes, metadata,
+// sidecars and GPX files are removed
+func removeSplitParts(store *RouteStore, filenames []string) {
+	for _, name := range filenames {
+		store.DeleteByFilename(name)
+		if err := deleteRouteMeta(name); err != nil {
+			slog.Error("Unable to save the route index", "error", err)
+		}
+		if err := persister.Delete(name); err != nil {
+			slog.Error("Unable to remove a sidecar", "file", name, "error", err)
+		}
+		if err := os.Remove(filepath.Join(config.DataDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Unable to remove a split GPX file", "file", name, "error", err)
+		}
+	}
+}
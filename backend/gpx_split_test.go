@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// collectionGPX is a GPX file holding a track for each of the point lists, and an empty one
+func collectionGPX(t *testing.T, tracks ...[]TrackPoint) []byte {
+	t.Helper()
+
+	collection := &gpx.GPX{}
+	for _, points := range tracks {
+		collection.Tracks = append(collection.Tracks, buildTestGPX(points).Tracks[0])
+	}
+	collection.Tracks = append(collection.Tracks, gpx.GPXTrack{Name: "empty"})
+	return testGPXBytes(t, collection)
+}
+
+func TestUploadSplitsTracks(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	short, long := jitteryLine(5), jitteryLine(20)
+	content := collectionGPX(t, short, long)
+
+	req := newUploadRequest(t, "gpxfile", "export.gpx", content)
+	req.URL.RawQuery = "split=true"
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		IDs       []string `json:"ids"`
+		Filenames []string `json:"filenames"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if len(response.IDs) != 2 || len(response.Filenames) != 2 || response.Filenames[0] != "export-1.gpx" || response.Filenames[1] != "export-2.gpx" {
+		t.Fatalf("Expected a route for each track with points, got %+v", response)
+	}
+
+	// Each track is a route of its own, the combined file isn't kept
+	for i, points := range [][]TrackPoint{short, long} {
+		route, ok := store.GetByFilename(response.Filenames[i])
+		if !ok {
+			t.Fatalf("Expected %s to be stored", response.Filenames[i])
+		}
+		if route.ID != response.IDs[i] || len(route.TrackPoints) != len(points) {
+			t.Errorf("Expected %s with id %s and %d points, got %s with %d", route.Filename, response.IDs[i], len(points), route.ID, len(route.TrackPoints))
+		}
+		if expected := calculateRouteDistance(points); math.Abs(route.Distance-expected) > 1e-6 {
+			t.Errorf("Expected %s to be %f km, got %f", route.Filename, expected, route.Distance)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.DataDir, "export.gpx")); !os.IsNotExist(err) {
+		t.Errorf("Expected the combined file to be removed, got %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 routes, got %d", store.Len())
+	}
+
+	// Without split the tracks stay one route
+	rec = httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "joined.gpx", collectionGPX(t, long, short)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if route, ok := store.GetByFilename("joined.gpx"); !ok || len(route.TrackPoints) != len(short)+len(long) {
+		t.Errorf("Expected a single route with all points, got %+v", route)
+	}
+}
+
+func TestUploadSplitKeepsStoredRoutes(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	// Routes stored under the name of the upload and of its first part
+	original := uploadRoute(t, store, "export.gpx", jitteryLine(8))
+	firstPart := uploadRoute(t, store, "export-1.gpx", jitteryLine(9))
+
+	req := newUploadRequest(t, "gpxfile", "export.gpx", collectionGPX(t, jitteryLine(5), jitteryLine(20)))
+	req.URL.RawQuery = "split=true"
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Filenames []string `json:"filenames"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if len(response.Filenames) != 2 || response.Filenames[0] != "export-2-1.gpx" || response.Filenames[1] != "export-2-2.gpx" {
+		t.Fatalf("Expected the parts to get unused names, got %v", response.Filenames)
+	}
+
+	// The routes stored before are untouched, on disk too
+	for _, stored := range []map[string]string{original, firstPart} {
+		route, ok := store.GetByFilename(stored["filename"])
+		if !ok || route.ID != stored["id"] {
+			t.Errorf("Expected %s to keep its route, got %+v", stored["filename"], route)
+		}
+		if _, err := os.Stat(filepath.Join(dir, stored["filename"])); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", stored["filename"], err)
+		}
+	}
+	if store.Len() != 4 {
+		t.Errorf("Expected 4 routes, got %d", store.Len())
+	}
+}
+
+func TestRemoveSplitParts(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	req := newUploadRequest(t, "gpxfile", "export.gpx", collectionGPX(t, jitteryLine(5), jitteryLine(20)))
+	req.URL.RawQuery = "split=true"
+	uploadHandler(store)(httptest.NewRecorder(), req)
+	if store.Len() != 2 {
+		t.Fatalf("Expected 2 routes, got %d", store.Len())
+	}
+
+	removeSplitParts(store, []string{"export-1.gpx", "export-2.gpx"})
+	if store.Len() != 0 {
+		t.Errorf("Expected the parts to be removed from the store, %d left", store.Len())
+	}
+	for _, name := range []string{"export-1.gpx", "export-2.gpx"} {
+		if meta := getRouteMeta(name); meta.ContentHash != "" {
+			t.Errorf("Expected the metadata of %s to be removed, got %+v", name, meta)
+		}
+		for _, file := range []string{name, name + ".json"} {
+			if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed, got %v", file, err)
+			}
+		}
+	}
+}
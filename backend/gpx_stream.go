@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+	"golang.org/x/net/html/charset"
+)
+
+// streamGPXRoute builds route data from a GPX document using a streaming XML decoder.
+// Unlike gpx.Parse it never holds the document tree in memory: each track point is
+// fed to the route builder as soon as it has been read, so peak memory stays close
+// to the size of the resulting route.
+func streamGPXRoute(filename string, r io.Reader) (RouteData, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	builder := newRouteBuilder(filename)
+	// Points of <rte> elements are collected separately and only used without tracks
+	routeBuilder := newRouteBuilder(filename)
+	var point gpx.GPXPoint
+	inPoint := false
+	inTrack := false
+	inRoute := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return RouteData{}, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "trk":
+				builder.startTrack()
+				inTrack = true
+			case "trkseg":
+				builder.startSegment()
+			case "rte":
+				routeBuilder.startTrack()
+				routeBuilder.startSegment()
+				inRoute = true
+			case "trkpt", "rtept":
+				point = gpx.GPXPoint{}
+				if err := parseStreamedPoint(element, &point); err != nil {
+					return RouteData{}, err
+				}
+				inPoint = true
+			case "ele", "time":
+				if !inPoint {
+					continue
+				}
+
+				var text string
+				if err := decoder.DecodeElement(&text, &element); err != nil {
+					return RouteData{}, err
+				}
+				text = strings.TrimSpace(text)
+
+				if element.Name.Local == "ele" {
+					if elevation, err := strconv.ParseFloat(text, 64); err == nil {
+						point.Elevation.SetValue(elevation)
+					}
+				} else if timestamp, err := parseStreamedTime(text); err == nil {
+					point.Timestamp = timestamp
+				}
+			case "type":
+				if !(inTrack || inRoute) || inPoint {
+					continue
+				}
+
+				var text string
+				if err := decoder.DecodeElement(&text, &element); err != nil {
+					return RouteData{}, err
+				}
+				if inTrack {
+					builder.setActivityType(text)
+				} else {
+					routeBuilder.setActivityType(text)
+				}
+			default:
+				// Skip everything else inside a point (extensions, names, ...)
+				if inPoint {
+					if err := decoder.Skip(); err != nil {
+						return RouteData{}, err
+					}
+				}
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "trkpt":
+				if inPoint {
+					builder.addPoint(&point)
+					inPoint = false
+				}
+			case "rtept":
+				if inPoint {
+					routeBuilder.addPoint(&point)
+					inPoint = false
+				}
+			case "trk":
+				inTrack = false
+			case "rte":
+				inRoute = false
+			}
+		}
+	}
+
+	if builder.empty() {
+		builder = routeBuilder
+	}
+	if builder.empty() {
+		return RouteData{}, errNoTrackPoints
+	}
+
+	return builder.finish(), nil
+}
+
+// parseStreamedPoint reads the coordinates of a trkpt or rtept element
+func parseStreamedPoint(element xml.StartElement, point *gpx.GPXPoint) error {
+	for _, attr := range element.Attr {
+		var err error
+		switch attr.Name.Local {
+		case "lat":
+			point.Latitude, err = strconv.ParseFloat(attr.Value, 64)
+		case "lon":
+			point.Longitude, err = strconv.ParseFloat(attr.Value, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s attribute %q: %w", attr.Name.Local, attr.Value, err)
+		}
+	}
+	return nil
+}
+
+// parseStreamedTime parses a GPX timestamp, which may lack a time zone
+func parseStreamedTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02T15:04:05", value)
+}
+
+// contextReader fails reads once its context is done, so parsers reading from it
+// give up instead of running indefinitely
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// newContextReader wraps r so reads stop when ctx is done
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+// Read implements io.Reader
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// syntheticGPX builds a GPX document with the given number of timestamped track points
+func syntheticGPX(points int) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"><trk><name>Synthetic</name><trkseg>` + "\n")
+
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < points; i++ {
+		fmt.Fprintf(&b, `<trkpt lat="%f" lon="%f"><ele>%.1f</ele><time>%s</time><extensions><hr>120</hr></extensions></trkpt>`+"\n",
+			52.52+float64(i)*0.00001, 13.40+float64(i)*0.00001, 34.0+float64(i%10),
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339))
+	}
+
+	b.WriteString("</trkseg></trk></gpx>\n")
+	return []byte(b.String())
+}
+
+func TestStreamGPXRouteMatchesFullParser(t *testing.T) {
+	data := syntheticGPX(500)
+
+	full, err := gpx.Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Full parser failed: %v", err)
+	}
+	fullRoute, _ := processGPXData("synthetic.gpx", full)
+
+	streamedRoute, err := streamGPXRoute("synthetic.gpx", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Streaming parser failed: %v", err)
+	}
+
+	if len(streamedRoute.TrackPoints) != len(fullRoute.TrackPoints) {
+		t.Fatalf("Expected %d points, got %d", len(fullRoute.TrackPoints), len(streamedRoute.TrackPoints))
+	}
+	for i := range fullRoute.TrackPoints {
+		if !reflect.DeepEqual(streamedRoute.TrackPoints[i], fullRoute.TrackPoints[i]) {
+			t.Fatalf("Point %d differs: %v vs %v", i, streamedRoute.TrackPoints[i], fullRoute.TrackPoints[i])
+		}
+	}
+
+	if math.Abs(streamedRoute.Distance-fullRoute.Distance) > 1e-9 {
+		t.Errorf("Expected distance %f, got %f", fullRoute.Distance, streamedRoute.Distance)
+	}
+	if streamedRoute.Duration != fullRoute.Duration || streamedRoute.Duration != 499 {
+		t.Errorf("Expected duration %f, got %f", fullRoute.Duration, streamedRoute.Duration)
+	}
+}
+
+func TestLoadRouteStreamsLargeFiles(t *testing.T) {
+	withDataDir(t)
+	cfg := config
+	cfg.StreamingParseThreshold = 1024
+	withConfig(t, cfg)
+
+	points := jitteryLine(100)
+	writeTestGPX(t, "large.gpx", points)
+
+	route, err := loadRoute(context.Background(), "large.gpx")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(route.TrackPoints) != len(points) {
+		t.Errorf("Expected %d points, got %d", len(points), len(route.TrackPoints))
+	}
+	if expected := calculateRouteDistance(points); math.Abs(route.Distance-expected) > 1e-9 {
+		t.Errorf("Expected distance %f, got %f", expected, route.Distance)
+	}
+}
+
+// slowReader returns its data a few bytes at a time, pausing before each read
+type slowReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if len(s.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(s.delay)
+
+	n := copy(p[:min(len(p), 16)], s.data)
+	s.data = s.data[n:]
+	return n, nil
+}
+
+func TestDecodeGPXTimesOut(t *testing.T) {
+	// Reading the whole document this way would take tens of seconds
+	reader := &slowReader{data: syntheticGPX(1000), delay: time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := decodeGPX(ctx, reader)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Parsing wasn't aborted promptly, took %s", elapsed)
+	}
+}
+
+func TestUploadParseTimeout(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+	cfg := config
+	cfg.ParseTimeout = time.Nanosecond
+	withConfig(t, cfg)
+
+	req := newUploadRequest(t, "gpxfile", "slow.gpx", syntheticGPX(10))
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, req)
+
+	if rec.Code != http.StatusRequestTimeout {
+		t.Fatalf("Expected status 408, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if stored := store.All(); len(stored) != 0 {
+		t.Errorf("Expected no routes to be added, got %d", len(stored))
+	}
+}
+
+// benchmarkParser reports allocations and the peak heap observed while parsing
+func benchmarkParser(b *testing.B, parse func([]byte) (RouteData, error)) {
+	data := syntheticGPX(200000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var baseline runtime.MemStats
+		runtime.ReadMemStats(&baseline)
+
+		// Sample the heap while the parser runs
+		done := make(chan struct{})
+		sampled := make(chan uint64)
+		go func() {
+			var stats runtime.MemStats
+			var max uint64
+			for {
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > max {
+					max = stats.HeapAlloc
+				}
+				select {
+				case <-done:
+					sampled <- max
+					return
+				case <-time.After(5 * time.Millisecond):
+				}
+			}
+		}()
+
+		route, err := parse(data)
+		close(done)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if max := <-sampled - baseline.HeapAlloc; max > peak {
+			peak = max
+		}
+		runtime.KeepAlive(route)
+	}
+
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+}
+
+func BenchmarkParseGPXFull(b *testing.B) {
+	benchmarkParser(b, func(data []byte) (RouteData, error) {
+		gpxData, err := gpx.Parse(bytes.NewReader(data))
+		if err != nil {
+			return RouteData{}, err
+		}
+		return processGPXData("synthetic.gpx", gpxData)
+	})
+}
+
+func BenchmarkParseGPXStreaming(b *testing.B) {
+	benchmarkParser(b, func(data []byte) (RouteData, error) {
+		return streamGPXRoute("synthetic.gpx", bytes.NewReader(data))
+	})
+}
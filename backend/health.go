@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// HealthStatus is the body of /healthz and /readyz
+type HealthStatus struct {
+	Status     string `json:"status"` // "ok", or "unavailable" when OSRM can't be reached
+	OSRMServer string `json:"osrmServer"`
+	Routes     int    `json:"routes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// writeHealthStatus responds with the status and the server's configuration
+func writeHealthStatus(w http.ResponseWriter, store *RouteStore, err error) {
+	status := HealthStatus{Status: "ok", OSRMServer: config.OSRMServer, Routes: store.Len()}
+	code := http.StatusOK
+	if err != nil {
+		status.Status = "unavailable"
+		status.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// healthzHandler reports that the server is up, without checking its dependencies
+func healthzHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		writeHealthStatus(w, store, nil)
+	}
+}
+
+// readyzHandler reports whether the server can suggest street routes, i.e. whether OSRM
+// answers within config.ReadinessTimeout. It responds with 503 otherwise.
+func readyzHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), config.ReadinessTimeout)
+		defer cancel()
+		writeHealthStatus(w, store, checkOSRM(ctx, store.BoundingBox().center()))
+	}
+}
+
+// checkOSRM asks OSRM for the road nearest to the point, a cheap request confirming the
+// server is reachable and has a routing graph loaded. It bypasses the circuit breaker,
+// which would otherwise hide a recovered server until its cooldown passes.
+func checkOSRM(ctx context.Context, point TrackPoint) error {
+	url := fmt.Sprintf("%s/nearest/v1/%s/%s", config.OSRMServer, profileWalking, coordinatesParam([]TrackPoint{point}))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := osrmClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var nearest struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&nearest); err != nil {
+		return fmt.Errorf("unexpected OSRM response with status %d", resp.StatusCode)
+	}
+	if nearest.Code != "Ok" {
+		return fmt.Errorf("OSRM answered %q", nearest.Code)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getHealth calls a health handler and decodes its status
+func getHealth(t *testing.T, handler http.HandlerFunc, target string) (int, HealthStatus) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var status HealthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Unable to decode %s: %v", target, err)
+	}
+	return rec.Code, status
+}
+
+func TestReadyzPingsOSRM(t *testing.T) {
+	var paths []string
+	server := withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"code":"Ok","waypoints":[{"name":"Main St","location":[13.4,52.52],"distance":3.2}]}`))
+	})
+	store := withRoutes(t, coverageTestRoute)
+
+	code, status := getHealth(t, readyzHandler(store), "/readyz")
+	if code != http.StatusOK || status.Status != "ok" {
+		t.Fatalf("Expected OSRM to be reported ready, got %d: %+v", code, status)
+	}
+	if status.OSRMServer != server.URL || status.Routes != 1 {
+		t.Errorf("Expected the OSRM server and 1 route, got %+v", status)
+	}
+	if len(paths) != 1 || !strings.HasPrefix(paths[0], "/nearest/v1/walking/") {
+		t.Errorf("Expected a single nearest request, got %v", paths)
+	}
+}
+
+func TestReadyzReportsUnavailableOSRM(t *testing.T) {
+	store := withRoutes(t)
+
+	// An answer without a usable graph
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"InvalidService","message":"Service nearest not found!"}`))
+	})
+	if code, status := getHealth(t, readyzHandler(store), "/readyz"); code != http.StatusServiceUnavailable || status.Error == "" {
+		t.Errorf("Expected 503 with an error, got %d: %+v", code, status)
+	}
+
+	// A server too slow to answer within the readiness timeout
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	cfg := config
+	cfg.ReadinessTimeout = 50 * time.Millisecond
+	withConfig(t, cfg)
+
+	start := time.Now()
+	if code, _ := getHealth(t, readyzHandler(store), "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a hanging OSRM server, got %d", code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the probe to give up after the timeout, took %s", elapsed)
+	}
+
+	// The server itself is still healthy
+	if code, status := getHealth(t, healthzHandler(store), "/healthz"); code != http.StatusOK || status.Status != "ok" {
+		t.Errorf("Expected /healthz to report ok, got %d: %+v", code, status)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// kmlContentType is the media type of KML documents
+const kmlContentType = "application/vnd.google-earth.kml+xml"
+
+// kmlDocument is a KML 2.2 document holding one placemark per route
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+// kmlPlacemark is a named route drawn as a line
+type kmlPlacemark struct {
+	Name        string        `xml:"name"`
+	Description string        `xml:"description,omitempty"`
+	LineString  kmlLineString `xml:"LineString"`
+}
+
+// kmlLineString is a line through coordinates written as "lng,lat" tuples separated by
+// spaces. Tessellated lines follow the terrain instead of cutting through it.
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlCoordinates formats the points as the coordinates of a KML LineString
+func kmlCoordinates(points []TrackPoint) string {
+	tuples := make([]string, len(points))
+	for i, point := range points {
+		tuples[i] = strconv.FormatFloat(point.Longitude, 'f', -1, 64) + "," +
+			strconv.FormatFloat(point.Latitude, 'f', -1, 64)
+	}
+	return strings.Join(tuples, " ")
+}
+
+// suggestionsKML converts suggested routes into a KML document with a placemark each
+func suggestionsKML(suggested []SuggestedRoute) kmlDocument {
+	doc := kmlDocument{Name: "Suggested routes"}
+	for i, route := range suggested {
+		description := fmt.Sprintf("%s km", strconv.FormatFloat(route.Distance, 'f', -1, 64))
+		if route.StartLabel != "" {
+			description += ", starting at " + route.StartLabel
+		}
+
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:        fmt.Sprintf("Suggested route %d", i+1),
+			Description: description,
+			LineString:  kmlLineString{Tessellate: 1, Coordinates: kmlCoordinates(route.Points)},
+		})
+	}
+	return doc
+}
+
+// suggestKMLHandler generates suggestions like /suggest and serves them as KML, for
+// Google Earth and other tools that don't read JSON
+func suggestKMLHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		suggested, ok := suggestRoutes(store, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", kmlContentType)
+		w.Write([]byte(xml.Header))
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(suggestionsKML(roundSuggestions(suggested))); err != nil {
+			slog.Error("Unable to write KML", "error", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSuggestKMLServesSuggestionAsLineString(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	rec := httptest.NewRecorder()
+	suggestKMLHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest/kml?followStreets=false", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != kmlContentType {
+		t.Errorf("Expected content type %s, got %s", kmlContentType, contentType)
+	}
+
+	var doc kmlDocument
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Unable to parse KML: %v\n%s", err, rec.Body.String())
+	}
+	if doc.XMLName.Space != "http://www.opengis.net/kml/2.2" || len(doc.Placemarks) != 1 {
+		t.Fatalf("Expected a KML 2.2 document with one placemark, got %+v", doc)
+	}
+
+	// The suggestion is generated and remembered like one from /suggest
+	recent := suggestionLog.recent(time.Now(), time.Hour)
+	if len(recent) != 1 {
+		t.Fatalf("Expected the suggestion in the history, got %d", len(recent))
+	}
+	if expected := kmlCoordinates(recent[0].Route.Points); doc.Placemarks[0].LineString.Coordinates != expected {
+		t.Errorf("Expected the coordinates of the suggestion %q, got %q", expected, doc.Placemarks[0].LineString.Coordinates)
+	}
+
+	// Errors are reported as for /suggest
+	rec = httptest.NewRecorder()
+	suggestKMLHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest/kml?boundsStrictness=2", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid parameter, got %d", rec.Code)
+	}
+}
+
+func TestKMLCoordinatesAreLongitudeFirst(t *testing.T) {
+	points := []TrackPoint{{Latitude: 52.52, Longitude: 13.405}, {Latitude: -33.8568, Longitude: 151.2153}}
+	if got := kmlCoordinates(points); got != "13.405,52.52 151.2153,-33.8568" {
+		t.Errorf("Expected lng,lat tuples, got %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KnownPoint is a named place such as home or the office
+type KnownPoint struct {
+	Name string
+	TrackPoint
+}
+
+// parseKnownPoints reads named points given as "home=52.52,13.40;office=52.50,13.38"
+func parseKnownPoints(value string) ([]KnownPoint, error) {
+	var points []KnownPoint
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, coordinates, ok := strings.Cut(entry, "=")
+		lat, lng, okCoordinates := strings.Cut(coordinates, ",")
+		if !ok || !okCoordinates || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid known point %q, expected name=lat,lng", entry)
+		}
+
+		latitude, errLat := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		longitude, errLng := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		if errLat != nil || errLng != nil {
+			return nil, fmt.Errorf("invalid coordinates in known point %q", entry)
+		}
+
+		points = append(points, KnownPoint{
+			Name:       strings.TrimSpace(name),
+			TrackPoint: TrackPoint{Latitude: latitude, Longitude: longitude},
+		})
+	}
+
+	return points, nil
+}
+
+// nearestKnownPoint returns the name of the closest known point within config.KnownPointRadius
+// meters of the point, or an empty string if there is none
+func nearestKnownPoint(point TrackPoint) string {
+	name := ""
+	best := config.KnownPointRadius / 1000.0
+	for _, known := range config.KnownPoints {
+		distance := haversineDistance(point.Latitude, point.Longitude, known.Latitude, known.Longitude)
+		if distance <= best {
+			name, best = known.Name, distance
+		}
+	}
+	return name
+}
+
+// annotateKnownPoints records which known points the route starts and ends near
+func annotateKnownPoints(route *RouteData) {
+	route.StartPlace, route.EndPlace = "", ""
+	if len(route.TrackPoints) == 0 {
+		return
+	}
+
+	route.StartPlace = nearestKnownPoint(route.TrackPoints[0])
+	route.EndPlace = nearestKnownPoint(route.TrackPoints[len(route.TrackPoints)-1])
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseKnownPoints(t *testing.T) {
+	points, err := parseKnownPoints("home=52.52,13.40; office = 52.50,13.38")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(points) != 2 || points[1].Name != "office" || points[1].Longitude != 13.38 {
+		t.Errorf("Unexpected known points: %+v", points)
+	}
+
+	for _, invalid := range []string{"home", "home=52.52", "=52.52,13.40", "home=north,east"} {
+		if _, err := parseKnownPoints(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestRouteAnnotatedWithKnownPoints(t *testing.T) {
+	cfg := config
+	cfg.KnownPoints = []KnownPoint{
+		{Name: "Home", TrackPoint: TrackPoint{Latitude: 52.5200, Longitude: 13.4000}},
+		{Name: "Office", TrackPoint: TrackPoint{Latitude: 52.5000, Longitude: 13.3000}},
+	}
+	cfg.KnownPointRadius = 200
+	withConfig(t, cfg)
+
+	// Starts about 100 m from home and ends far from both known points
+	route, err := processGPXData("walk.gpx", buildTestGPX([]TrackPoint{
+		{Latitude: 52.5209, Longitude: 13.4000},
+		{Latitude: 52.5300, Longitude: 13.4200},
+		{Latitude: 52.5400, Longitude: 13.4400},
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if route.StartPlace != "Home" {
+		t.Errorf("Expected the route to start at Home, got %q", route.StartPlace)
+	}
+	if route.EndPlace != "" {
+		t.Errorf("Expected the route not to end at a known point, got %q", route.EndPlace)
+	}
+}
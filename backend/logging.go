@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+)
+
+// requestIDKey is the context key of the request ID added by withRequestID
+type requestIDKey struct{}
+
+// withRequestID returns a context carrying a new short request ID, which is added to every
+// record logged with it so the lines of one request can be told apart from the others
+func withRequestID(ctx context.Context) context.Context {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return context.WithValue(ctx, requestIDKey{}, hex.EncodeToString(id))
+}
+
+// requestID returns the request ID of the context, or "" if it has none
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDHandler adds the request ID of the context to the records it handles
+type requestIDHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request ID, if any, and passes the record on
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps adding request IDs to the records of the derived handler
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps adding request IDs to the records of the derived handler
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// newLogger returns a logger writing text records of the level and above to w
+func newLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(requestIDHandler{slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withLogger logs to a buffer at the level for the duration of the test
+func withLogger(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var buf bytes.Buffer
+	slog.SetDefault(newLogger(&buf, level))
+	return &buf
+}
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	buf := withLogger(t, slog.LevelInfo)
+
+	ctx := withRequestID(context.Background())
+	slog.InfoContext(ctx, "with request")
+	slog.Info("without request")
+	slog.DebugContext(ctx, "too detailed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines without the debug record, got %q", buf.String())
+	}
+	if id := requestID(ctx); len(id) != 8 || !strings.HasSuffix(lines[0], "request="+id) {
+		t.Errorf("Expected the first line to end with request ID %q, got %q", id, lines[0])
+	}
+	if strings.Contains(lines[1], "request=") {
+		t.Errorf("Expected no request ID without one in the context, got %q", lines[1])
+	}
+
+	// IDs tell requests apart
+	if requestID(withRequestID(context.Background())) == requestID(ctx) {
+		t.Error("Expected a new request ID for every request")
+	}
+}
+
+func TestLoadConfigReadsLogLevel(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	if level := loadConfig().LogLevel; level != slog.LevelDebug {
+		t.Errorf("Expected the debug level, got %s", level)
+	}
+
+	t.Setenv("LOG_LEVEL", "chatty")
+	if level := loadConfig().LogLevel; level != slog.LevelInfo {
+		t.Errorf("Expected the default level for an invalid one, got %s", level)
+	}
+}
+
+func TestSuggestLogsShareRequestID(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+	buf := withLogger(t, slog.LevelDebug)
+
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ids := map[string]bool{}
+	for _, match := range regexp.MustCompile(`request=(\w+)`).FindAllStringSubmatch(buf.String(), -1) {
+		ids[match[1]] = true
+	}
+	if len(ids) != 1 || !strings.Contains(buf.String(), `msg="Suggesting routes"`) {
+		t.Errorf("Expected the logs of the request to share one request ID, got %q", buf.String())
+	}
+}
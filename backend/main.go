@@ -1,34 +1,137 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math"
 	"math/rand"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
 	"github.com/tkrajina/gpxgo/gpx"
 )
 
 // RouteData represents a processed GPX track with additional metadata
 type RouteData struct {
+	ID          string       `json:"id"` // Derived from the filename and points, see routeID
 	Filename    string       `json:"filename"`
 	TrackPoints []TrackPoint `json:"trackPoints"`
 	Distance    float64      `json:"distance"`
-	Duration    float64      `json:"duration"`
+	Duration    float64      `json:"duration"`   // Elapsed seconds from the first to the last point
+	MovingTime  float64      `json:"movingTime"` // Seconds spent moving faster than movingSpeedThreshold
+
+	// TotalAscent and TotalDescent sum the elevation gained and lost in meters between
+	// consecutive points that both have an elevation
+	TotalAscent  float64 `json:"totalAscent"`
+	TotalDescent float64 `json:"totalDescent"`
+
+	// NetElevation is the end elevation minus the start elevation in meters, positive for
+	// routes that are net uphill. Zero when the track has no elevation.
+	NetElevation float64 `json:"netElevation"`
+
+	// Diameter is the largest distance in kilometers between any two points of the route,
+	// i.e. how far apart its farthest points are
+	Diameter float64 `json:"diameter"`
+
+	// IsLoop is set when the route ends within 100 m of its start. Type tells loops that
+	// come back the same way ("out-and-back") from others ("loop"), and is "point-to-point"
+	// for routes ending elsewhere.
+	IsLoop bool   `json:"isLoop"`
+	Type   string `json:"type"`
+
+	// DurationEstimated is set when the track's timestamps were unusable and
+	// Duration was derived from the distance at config.WalkingSpeed
+	DurationEstimated bool `json:"durationEstimated,omitempty"`
+
+	OffRoad   bool      `json:"offRoad"` // Set when the track can't be matched to the road network
+	WalkCount int       `json:"walkCount"`
+	CreatedAt time.Time `json:"createdAt"` // When the walk was recorded, or the file was saved if unknown
+
+	// Source tells recorded walks ("uploaded", "imported") apart from planned routes ("suggested")
+	Source string `json:"source"`
+
+	// ActivityType is the lowercased <type> of the first track that has one, e.g. "hiking"
+	ActivityType string `json:"activityType,omitempty"`
+
+	// CoordinatesSwapped is set when the GPX file appears to have latitude and longitude
+	// exchanged. The points are only corrected when FIX_SWAPPED_COORDINATES is enabled.
+	CoordinatesSwapped bool `json:"coordinatesSwapped"`
+
+	// Names of the known points (see KNOWN_POINTS) the route starts and ends near
+	StartPlace string `json:"startPlace,omitempty"`
+	EndPlace   string `json:"endPlace,omitempty"`
+
+	// Notes and Weather are set by the user through /routes/{filename}/meta
+	Notes   string `json:"notes,omitempty"`
+	Weather string `json:"weather,omitempty"`
+
+	// ContentHash is the hex encoded SHA-256 of the uploaded file, decompressed if it was
+	// gzipped. It's empty for routes that weren't uploaded.
+	ContentHash string `json:"contentHash,omitempty"`
 }
 
 // TrackPoint represents a single point in a GPX track
 type TrackPoint struct {
 	Latitude  float64 `json:"lat"`
 	Longitude float64 `json:"lng"`
+
+	// Elevation in meters is only meaningful when HasElevation is set, as GPX
+	// points may lack an <ele> element
+	Elevation    float64 `json:"-"`
+	HasElevation bool    `json:"-"`
+
+	// Time is when the point was recorded, nil for points without a valid timestamp
+	Time *time.Time `json:"-"`
+}
+
+// trackPointJSON is the serialized form of a TrackPoint, which only carries
+// an elevation and a time when the point has them
+type trackPointJSON struct {
+	Latitude  float64    `json:"lat"`
+	Longitude float64    `json:"lng"`
+	Elevation *float64   `json:"ele,omitempty"`
+	Time      *time.Time `json:"time,omitempty"`
+}
+
+// MarshalJSON writes the point's elevation as "ele" when it has one
+func (p TrackPoint) MarshalJSON() ([]byte, error) {
+	point := trackPointJSON{Latitude: p.Latitude, Longitude: p.Longitude, Time: p.Time}
+	if p.HasElevation {
+		point.Elevation = &p.Elevation
+	}
+	return json.Marshal(point)
+}
+
+// UnmarshalJSON reads a point written by MarshalJSON
+func (p *TrackPoint) UnmarshalJSON(data []byte) error {
+	var point trackPointJSON
+	if err := json.Unmarshal(data, &point); err != nil {
+		return err
+	}
+
+	*p = TrackPoint{Latitude: point.Latitude, Longitude: point.Longitude, Time: point.Time}
+	if point.Elevation != nil {
+		p.Elevation = *point.Elevation
+		p.HasElevation = true
+	}
+	return nil
 }
 
 // SuggestedRoute represents a suggested new route
@@ -36,140 +139,554 @@ type SuggestedRoute struct {
 	Points         []TrackPoint `json:"points"`
 	Distance       float64      `json:"distance"`
 	FollowsStreets bool         `json:"followsStreets"`
+
+	// DistanceIsEstimate is set when Distance isn't a routed walking distance, because the
+	// route doesn't follow streets or was scaled or extended geometrically
+	DistanceIsEstimate bool `json:"distanceIsEstimate"`
+
+	// Distances reported by OSRM and computed from the decoded geometry, kept for transparency
+	OSRMDistance     float64 `json:"osrmDistance,omitempty"`
+	GeometryDistance float64 `json:"geometryDistance,omitempty"`
+
+	// Reason explains why a fallback route was returned instead of what was asked for
+	Reason string `json:"reason,omitempty"`
+
+	// Notes explain in plain words everything the suggestion fell back on, e.g. why it
+	// doesn't follow streets or that it was scaled, so clients can show them next to it
+	Notes []string `json:"notes,omitempty"`
+
+	// Human-readable start and end locations, set when a geocoder is configured
+	StartLabel string `json:"startLabel,omitempty"`
+	EndLabel   string `json:"endLabel,omitempty"`
+
+	// Comparison describes the distance relative to the user's usual walk, set on request
+	Comparison string `json:"comparison,omitempty"`
+
+	// TotalAscent is the climb in meters, set when the suggestion was checked against maxElevationGain
+	TotalAscent float64 `json:"totalAscent,omitempty"`
+
+	// Bounds enclose all points of the route
+	Bounds *RouteBounds `json:"bounds,omitempty"`
+
+	// Directions are set for street routes with verbose=true. They're dropped when the
+	// points are scaled or extended geometrically, as the steps no longer match them.
+	Directions *RouteDirections `json:"directions,omitempty"`
+}
+
+// OSRMRoute is a route or trip in an OSRM response
+type OSRMRoute struct {
+	Geometry string  `json:"geometry"`
+	Distance float64 `json:"distance"`
+	Duration float64 `json:"duration"`
+	Legs     []struct {
+		Steps []OSRMStep `json:"steps"`
+	} `json:"legs"`
+}
+
+// SuggestOptions holds the parameters that control route suggestion
+type SuggestOptions struct {
+	MinDistance   float64
+	MaxDistance   float64
+	FollowStreets bool
+
+	// CoverageBias moves the suggestion towards the least explored part of the coverage grid
+	CoverageBias bool
+	CellSize     float64 // Coverage grid cell size in meters
+	GridPadding  float64 // Coverage grid padding in meters
+
+	// PreferFootpaths asks OSRM to avoid the road classes in FootpathExcludeClasses
+	PreferFootpaths bool
+
+	// Verbose asks OSRM for the steps of the route so directions can be returned
+	Verbose bool
+
+	// Profile is the OSRM routing profile: "walking", "cycling" or "driving".
+	// Empty means walking.
+	Profile string
+
+	// SnapAny lets OSRM snap waypoints to any walkable edge, including alleys and paths
+	// it wouldn't otherwise start a route on
+	SnapAny bool
+
+	// PreferredBearing is the compass bearing in degrees the outbound leg should head
+	// towards, e.g. into the wind. Nil means no preference.
+	PreferredBearing *float64
+
+	// BoundsStrictness is the share of a street route's points, from 0 to 1, that must lie
+	// within the padded bounding box of the existing routes. Nil means defaultBoundsStrictness.
+	BoundsStrictness *float64
+
+	// MaxElevationGain caps the total ascent of the suggestion in meters. It needs an
+	// elevation service (ELEVATION_URL). Zero means no cap.
+	MaxElevationGain float64
+
+	// PreferFlat picks the flattest of several candidate perimeters, judging their elevation
+	// by the stored routes nearby. It has no effect unless those have elevation data.
+	PreferFlat bool
+
+	// MaxRadiusKm keeps the seed points within this many kilometers of the center of the
+	// existing routes. Zero means the extent of the existing routes is used.
+	MaxRadiusKm float64
+
+	// Variant picks one of several different suggestions for the same request: the seed
+	// points are turned by Variant*variantRotation degrees around their center, and a
+	// perimeter starts at another corner. Zero is the unturned suggestion. Seed points
+	// heading towards a preferred bearing aren't turned.
+	Variant int
+}
+
+// defaultBoundsStrictness is the share of a street route's points that must be near the existing routes
+const defaultBoundsStrictness = 0.5
+
+// boundsStrictness returns the requested bounds strictness or the default
+func (o SuggestOptions) boundsStrictness() float64 {
+	if o.BoundsStrictness == nil {
+		return defaultBoundsStrictness
+	}
+	return *o.BoundsStrictness
 }
 
 // OSRMResponse represents the response from the OSRM API
 type OSRMResponse struct {
-	Code   string `json:"code"`
-	Routes []struct {
-		Geometry string  `json:"geometry"`
-		Distance float64 `json:"distance"`
-		Duration float64 `json:"duration"`
-	} `json:"routes"`
+	Code      string      `json:"code"`
+	Routes    []OSRMRoute `json:"routes"`
+	Trips     []OSRMRoute `json:"trips"` // Set instead of Routes by the trip service
 	Waypoints []struct {
 		Location []float64 `json:"location"`
 	} `json:"waypoints"`
 }
 
-// Global storage for processed routes
-var (
-	routes      []RouteData
-	routesMutex sync.RWMutex
-)
-
 func main() {
+	// Load configuration from the environment
+	config = loadConfig()
+	slog.SetDefault(newLogger(os.Stderr, config.LogLevel))
+	osrmClient = newOSRMClient()
+
 	// Create data directory if it doesn't exist
-	os.MkdirAll("data", os.ModePerm)
+	os.MkdirAll(config.DataDir, os.ModePerm)
 
-	// Load existing GPX files
-	loadExistingGPXFiles()
+	// Load the route metadata index and existing GPX files
+	if err := loadRouteIndex(); err != nil {
+		slog.Error("Unable to load the route index", "error", err)
+	}
+	store := NewRouteStore(loadExistingGPXFiles()...)
+
+	// Stop on SIGINT or SIGTERM, e.g. when a container is redeployed, letting the
+	// requests in flight finish first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Set up HTTP handlers
-	http.HandleFunc("/upload", uploadHandler)
-	http.HandleFunc("/routes", routesHandler)
-	http.HandleFunc("/suggest", suggestHandler)
+	listener, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		slog.Error("Unable to listen", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Starting server", "port", 8080)
+	if err := serve(ctx, &http.Server{Handler: newServeMux(store)}, listener, config.ShutdownTimeout); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Server stopped")
+}
+
+// newServeMux sets up the HTTP handlers of the API and the frontend, serving the routes of the store
+func newServeMux(store *RouteStore) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload", uploadHandler(store))
+	mux.HandleFunc("/routes", routesHandler(store))
+	mux.HandleFunc("/routes.csv", routesCSVHandler(store))
+	mux.HandleFunc("/routes/near", nearbyRoutesHandler(store))
+	mux.HandleFunc("/suggest", suggestHandler(store))
+	mux.HandleFunc("/suggest/kml", suggestKMLHandler(store))
+	mux.HandleFunc("/suggestions/history", suggestionHistoryHandler)
+	mux.HandleFunc("/suggestions/refresh", refreshSuggestionsHandler)
+	mux.HandleFunc("/routes/{filename}/simplify", simplifyRouteHandler(store))
+	mux.HandleFunc("/routes/{filename}/complete", completeRouteHandler(store))
+	mux.HandleFunc("/routes/{filename}/area", routeAreaHandler(store))
+	mux.HandleFunc("/routes/{filename}/meta", routeMetaHandler(store))
+	mux.HandleFunc("/routes/{filename}/gaps", routeGapsHandler(store))
+	mux.HandleFunc("/routes/{id}/track", routeTrackHandler(store))
+	mux.HandleFunc("/routes/{id}/bearings", routeBearingsHandler(store))
+	mux.HandleFunc("/routes/{id}/simplified", routeSimplifiedHandler(store))
+	mux.HandleFunc("/coverage", coverageHandler(store))
+	mux.HandleFunc("/coverage.geojson", coverageGeoJSONHandler(store))
+	mux.HandleFunc("/clusters", clustersHandler(store))
+	mux.HandleFunc("/debug/osrm-url", debugOSRMURLHandler)
+	mux.HandleFunc("/healthz", healthzHandler(store))
+	mux.HandleFunc("/readyz", readyzHandler(store))
 
 	// Serve static files
-	fs := http.FileServer(http.Dir("./frontend"))
-	http.Handle("/", fs)
+	mux.Handle("/", frontendHandler(config.FrontendDir))
 
-	fmt.Println("Starting server at port 8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatal(err)
-	}
+	return mux
 }
 
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// uploadFieldNames are the form fields checked for an uploaded file, in order of preference
+var uploadFieldNames = []string{"gpxfile", "file", "gpx"}
 
-	// Parse the multipart form
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
-		return
+// uploadedGPXFile picks the uploaded file from a multipart form. The known field names
+// are tried first, then any file part whose name looks like a GPX or TCX file.
+func uploadedGPXFile(form *multipart.Form) *multipart.FileHeader {
+	if form == nil {
+		return nil
 	}
 
-	// Get the file from the form
-	file, handler, err := r.FormFile("gpxfile")
-	if err != nil {
-		http.Error(w, "Unable to get file", http.StatusBadRequest)
-		return
+	for _, name := range uploadFieldNames {
+		if files := form.File[name]; len(files) > 0 {
+			return files[0]
+		}
 	}
-	defer file.Close()
 
-	// Check if file is a GPX file
-	if !strings.HasSuffix(strings.ToLower(handler.Filename), ".gpx") {
-		http.Error(w, "File must be a GPX file", http.StatusBadRequest)
-		return
+	// Sort the field names so the choice doesn't depend on map order
+	names := make([]string, 0, len(form.File))
+	for name := range form.File {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Save the file to the data directory
-	err = saveFile(file, handler.Filename)
-	if err != nil {
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
-		return
+	for _, name := range names {
+		for _, file := range form.File[name] {
+			if _, ok := gpxUploadFilename(file.Filename); ok {
+				return file
+			}
+			if _, ok := tcxUploadFilename(file.Filename); ok {
+				return file
+			}
+		}
 	}
 
-	// Parse the GPX file
-	gpxData, err := parseGPX(handler.Filename)
-	if err != nil {
-		http.Error(w, "Unable to parse GPX file", http.StatusInternalServerError)
-		return
+	return nil
+}
+
+func uploadHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Turn down large uploads before reading them if the client says how large they are,
+		// and stop reading the others once they pass the limit
+		if r.ContentLength > config.MaxUploadSize {
+			writeUploadTooLarge(w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, config.MaxUploadSize)
+
+		// Parse the multipart form
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeUploadTooLarge(w)
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "Unable to parse form")
+			return
+		}
+
+		// Get the file from the form
+		handler := uploadedGPXFile(r.MultipartForm)
+		if handler == nil {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("No GPX file found, upload it in the %q form field", uploadFieldNames[0]))
+			return
+		}
+		file, err := handler.Open()
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Unable to get file")
+			return
+		}
+		defer file.Close()
+
+		// Check if file is a GPX file, gzipped ones are stored decompressed without the .gz.
+		// TCX files are converted and stored as GPX files.
+		filename, ok := gpxUploadFilename(handler.Filename)
+		isTCX := false
+		if !ok {
+			filename, isTCX = tcxUploadFilename(handler.Filename)
+		}
+		if !ok && !isTCX {
+			writeJSONError(w, http.StatusBadRequest, "File must be a GPX or TCX file")
+			return
+		}
+
+		// The same content is only stored once, whatever the file is called
+		hash, err := uploadHash(file)
+		if err != nil {
+			writeUploadSaveError(w, err)
+			return
+		}
+		if existing, ok := store.FindByHash(hash); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"id":       existing.ID,
+				"filename": existing.Filename,
+				"message":  fmt.Sprintf("The file was uploaded before as %s", existing.Filename),
+			})
+			return
+		}
+
+		// Collection exports hold several tracks, which can be stored as separate routes.
+		// Their file is only split up, so it mustn't replace a stored route of the same name.
+		split := r.URL.Query().Get("split") == "true"
+		if split {
+			filename, err = reserveFilename(store, filename)
+			if err != nil {
+				writeUploadSaveError(w, err)
+				return
+			}
+		}
+
+		// Save the file to the data directory
+		if isTCX {
+			err = saveTCXFile(file, filename)
+		} else {
+			err = saveFile(file, filename)
+		}
+		if err != nil {
+			if split {
+				os.Remove(filepath.Join(config.DataDir, filename))
+			}
+			writeUploadSaveError(w, err)
+			return
+		}
+
+		filenames := []string{filename}
+		if split {
+			filenames, err = splitGPXTracks(store, filename)
+			if err != nil {
+				slog.Error("Unable to split a GPX file into its tracks", "file", filename, "error", err)
+				os.Remove(filepath.Join(config.DataDir, filename))
+				writeJSONError(w, http.StatusInternalServerError, "Unable to parse GPX file")
+				return
+			}
+		}
+
+		var routes []RouteData
+		for _, name := range filenames {
+			route, err := storeUploadedRoute(r.Context(), store, name, hash, isTCX)
+			if err != nil && split {
+				// Store all the tracks or none of them
+				removeSplitParts(store, filenames)
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				writeJSONError(w, http.StatusRequestTimeout, "Parsing the GPX file took too long")
+				return
+			}
+			if errors.Is(err, errNoTrackPoints) {
+				writeJSONError(w, http.StatusUnprocessableEntity, "The GPX file contains no track or route points")
+				return
+			}
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Unable to parse GPX file")
+				return
+			}
+			routes = append(routes, route)
+		}
+
+		// Return success response
+		w.Header().Set("Content-Type", "application/json")
+		if split {
+			ids := make([]string, len(routes))
+			for i, route := range routes {
+				ids[i] = route.ID
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ids":       ids,
+				"filenames": filenames,
+				"message":   fmt.Sprintf("File uploaded and processed successfully as %d routes", len(routes)),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":       routes[0].ID,
+			"filename": routes[0].Filename,
+			"message":  fmt.Sprintf("File uploaded and processed successfully: %s", filename),
+		})
 	}
+}
 
-	// Process and store the route data
-	route, err := processGPXData(handler.Filename, gpxData)
+// storeUploadedRoute parses an uploaded GPX file saved in the data directory and adds its
+// route to the store, replacing one uploaded under the same name before. Files without
+// any points are removed again.
+func storeUploadedRoute(ctx context.Context, store *RouteStore, filename, hash string, isTCX bool) (RouteData, error) {
+	route, err := loadRoute(ctx, filename)
+	if errors.Is(err, errNoTrackPoints) {
+		// Don't leave the unusable file behind to fail again on every start
+		os.Remove(filepath.Join(config.DataDir, filename))
+	}
 	if err != nil {
-		http.Error(w, "Unable to process GPX data", http.StatusInternalServerError)
-		return
+		return RouteData{}, err
 	}
 
-	// Add the route to our collection
-	routesMutex.Lock()
-	routes = append(routes, route)
-	routesMutex.Unlock()
+	// Tracks swapped into valid coordinates only stand out against the explored area
+	if !route.CoordinatesSwapped && swappedIntoExploredArea(route.TrackPoints, store.exploredBoundingBox()) {
+		if config.FixSwappedCoordinates {
+			slog.InfoContext(ctx, "Swapping latitude and longitude", "file", filename)
+			if err := swapGPXFile(ctx, filename); err != nil {
+				return RouteData{}, err
+			}
+			if route, err = loadRoute(ctx, filename); err != nil {
+				return RouteData{}, err
+			}
+		} else {
+			slog.WarnContext(ctx, "Route looks like it has latitude and longitude swapped", "file", filename)
+		}
+		route.CoordinatesSwapped = true
+	}
 
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": fmt.Sprintf("File uploaded and processed successfully: %s", handler.Filename),
+	// Optionally flag tracks that don't follow any walkable road
+	if config.OffRoadCheck {
+		offRoad, err := checkOffRoad(ctx, route.TrackPoints)
+		if err != nil {
+			slog.WarnContext(ctx, "Unable to check a route against the road network", "file", filename, "error", err)
+		}
+		route.OffRoad = offRoad
+	}
+	route.ContentHash = hash
+	saveRoute(route)
+
+	// Add the route to our collection, replacing it if the same file was uploaded before
+	store.upsert(filename, func(existing *RouteData) (RouteData, error) {
+		meta, err := updateRouteMeta(filename, func(meta *routeMeta) {
+			// Re-uploading a route counts as walking it again
+			if existing != nil {
+				meta.WalkCount = existing.WalkCount + 1
+			}
+			// An uploaded recording replaces a saved suggestion of the same name
+			meta.Source = ""
+			if isTCX {
+				meta.Source = sourceImported
+			}
+			meta.ContentHash = hash
+			meta.OffRoad = route.OffRoad
+			meta.CoordinatesSwapped = route.CoordinatesSwapped
+			meta.ID = ""
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Unable to save the route index", "error", err)
+		}
+		applyRouteMeta(&route, meta)
+		return route, nil
 	})
+	return route, nil
 }
 
+// writeUploadTooLarge responds to an upload larger than config.MaxUploadSize
+func writeUploadTooLarge(w http.ResponseWriter) {
+	limit := strconv.FormatFloat(float64(config.MaxUploadSize)/(1<<20), 'f', -1, 64)
+	writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Uploads are limited to %s MB", limit))
+}
+
+// writeUploadSaveError responds to an uploaded file that couldn't be read or stored
+func writeUploadSaveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF):
+		writeJSONError(w, http.StatusBadRequest, "Unable to decompress the gzipped file")
+	case errors.Is(err, errInvalidTCX):
+		writeJSONError(w, http.StatusBadRequest, "Unable to parse TCX file")
+	case errors.Is(err, errNoTrackPoints):
+		writeJSONError(w, http.StatusUnprocessableEntity, "The TCX file contains no trackpoints with a position")
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "Unable to save file")
+	}
+}
+
+// uploadHash returns the hex encoded SHA-256 of an uploaded file's content, decompressed
+// if it's gzipped, and rewinds the file so it can be saved afterwards
+func uploadHash(file multipart.File) (string, error) {
+	content, err := gunzipIfCompressed(file)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// saveFile stores an uploaded file in the data directory, decompressing it first if it's gzipped
 func saveFile(file multipart.File, filename string) error {
 	// Create the data directory if it doesn't exist
-	err := os.MkdirAll("data", os.ModePerm)
+	err := os.MkdirAll(config.DataDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	content, err := gunzipIfCompressed(file)
 	if err != nil {
 		return err
 	}
 
 	// Create the file in the data directory
-	dst, err := os.Create(fmt.Sprintf("data/%s", filename))
+	path := filepath.Join(config.DataDir, filename)
+	dst, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer dst.Close()
 
 	// Copy the uploaded file to the destination file
-	_, err = io.Copy(dst, file)
+	_, err = io.Copy(dst, content)
 	if err != nil {
+		// Don't leave a truncated file behind, e.g. from a corrupt gzip stream
+		os.Remove(path)
 		return err
 	}
 
 	return nil
 }
 
-func parseGPX(filename string) (*gpx.GPX, error) {
-	filePath := fmt.Sprintf("data/%s", filename)
+// gzipSuffix is the extension of gzip-compressed GPX files, e.g. walk.gpx.gz
+const gzipSuffix = ".gz"
+
+// gpxUploadFilename returns the name an uploaded file is stored under, dropping the
+// .gz of gzipped GPX files, and whether the file is a GPX file at all
+func gpxUploadFilename(filename string) (string, bool) {
+	if strings.HasSuffix(strings.ToLower(filename), ".gpx"+gzipSuffix) {
+		filename = filename[:len(filename)-len(gzipSuffix)]
+	}
+	return filename, strings.HasSuffix(strings.ToLower(filename), ".gpx")
+}
+
+// gunzipIfCompressed returns a reader of the decompressed content if r starts with the
+// gzip magic bytes, so compressed files are recognized whatever their name
+func gunzipIfCompressed(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
+
+func parseGPX(ctx context.Context, filename string) (*gpx.GPX, error) {
+	filePath := filepath.Join(config.DataDir, filename)
 	gpxFile, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer gpxFile.Close()
 
-	gpxData, err := gpx.Parse(gpxFile)
+	content, err := gunzipIfCompressed(gpxFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeGPX(ctx, content)
+}
+
+// decodeGPX parses a GPX document, giving up once the context is done
+func decodeGPX(ctx context.Context, r io.Reader) (*gpx.GPX, error) {
+	gpxData, err := gpx.Parse(newContextReader(ctx, r))
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -177,185 +694,392 @@ func parseGPX(filename string) (*gpx.GPX, error) {
 	return gpxData, nil
 }
 
+// loadRoute parses a GPX file from the data directory into route data, looking up
+// the elevation of tracks recorded without one if an elevation service is configured
+func loadRoute(ctx context.Context, filename string) (RouteData, error) {
+	route, err := parseRoute(ctx, filename)
+	if err != nil {
+		return RouteData{}, err
+	}
+
+	enrichElevation(ctx, &route)
+	return route, nil
+}
+
+// parseRoute parses a GPX file from the data directory into route data.
+// Very large files are parsed with the streaming decoder to keep memory bounded.
+// Parsing is aborted with context.DeadlineExceeded after config.ParseTimeout.
+func parseRoute(ctx context.Context, filename string) (RouteData, error) {
+	if config.ParseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.ParseTimeout)
+		defer cancel()
+	}
+
+	filePath := filepath.Join(config.DataDir, filename)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return RouteData{}, err
+	}
+
+	if info.Size() > config.StreamingParseThreshold {
+		slog.InfoContext(ctx, "Using the streaming parser", "file", filename, "bytes", info.Size())
+		gpxFile, err := os.Open(filePath)
+		if err != nil {
+			return RouteData{}, err
+		}
+		defer gpxFile.Close()
+
+		route, err := streamGPXRoute(filename, newContextReader(ctx, gpxFile))
+		if ctx.Err() != nil {
+			return RouteData{}, ctx.Err()
+		}
+		if err != nil {
+			return RouteData{}, err
+		}
+		setCreatedAtFallback(&route, info)
+		return route, nil
+	}
+
+	gpxData, err := parseGPX(ctx, filename)
+	if err != nil {
+		return RouteData{}, err
+	}
+
+	route, err := processGPXDataContext(ctx, filename, gpxData)
+	if err != nil {
+		return RouteData{}, err
+	}
+	setCreatedAtFallback(&route, info)
+	return route, nil
+}
+
+// setCreatedAtFallback uses the file's modification time for routes without any timestamps
+func setCreatedAtFallback(route *RouteData, info os.FileInfo) {
+	if route.CreatedAt.IsZero() {
+		route.CreatedAt = info.ModTime()
+	}
+}
+
+// writeGPX serializes GPX data back to a file in the data directory
+func writeGPX(filename string, gpxData *gpx.GPX) error {
+	xmlBytes, err := gpxData.ToXml(gpx.ToXmlParams{Version: "1.1", Indent: true})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(config.DataDir, filename), xmlBytes, 0644)
+}
+
+// errNoTrackPoints is returned for GPX files without any track or route points,
+// e.g. ones holding only waypoints
+var errNoTrackPoints = errors.New("GPX file contains no track or route points")
+
 func processGPXData(filename string, gpxData *gpx.GPX) (RouteData, error) {
-	var route RouteData
-	route.Filename = filename
+	return processGPXDataContext(context.Background(), filename, gpxData)
+}
+
+// processGPXDataContext is processGPXData that gives up once the context is done
+func processGPXDataContext(ctx context.Context, filename string, gpxData *gpx.GPX) (RouteData, error) {
+	builder := newRouteBuilder(filename)
 
 	// Process all tracks in the GPX file
 	for _, track := range gpxData.Tracks {
+		builder.startTrack()
+		builder.setActivityType(track.Type)
 		for _, segment := range track.Segments {
-			for _, point := range segment.Points {
-				route.TrackPoints = append(route.TrackPoints, TrackPoint{
-					Latitude:  point.Latitude,
-					Longitude: point.Longitude,
-				})
+			if err := ctx.Err(); err != nil {
+				return RouteData{}, err
+			}
+
+			builder.startSegment()
+			for i := range segment.Points {
+				builder.addPoint(&segment.Points[i])
 			}
 		}
 	}
 
-	// Calculate distance and duration if possible
-	if len(gpxData.Tracks) > 0 && len(gpxData.Tracks[0].Segments) > 0 {
-		// Calculate distance manually
-		for _, track := range gpxData.Tracks {
-			for _, segment := range track.Segments {
-				for i := 0; i < len(segment.Points)-1; i++ {
-					p1 := segment.Points[i]
-					p2 := segment.Points[i+1]
-					route.Distance += haversineDistance(
-						p1.Latitude, p1.Longitude,
-						p2.Latitude, p2.Longitude,
-					)
-				}
+	// Files planned rather than recorded may hold their path as <rte> elements instead
+	if builder.empty() {
+		for _, rte := range gpxData.Routes {
+			builder.startTrack()
+			builder.setActivityType(rte.Type)
+			builder.startSegment()
+			for i := range rte.Points {
+				builder.addPoint(&rte.Points[i])
 			}
 		}
+	}
+	if builder.empty() {
+		return RouteData{}, errNoTrackPoints
+	}
 
-		// Calculate duration if timestamps are available
-		if len(gpxData.Tracks[0].Segments) > 0 && len(gpxData.Tracks[0].Segments[0].Points) > 1 {
-			firstPoint := gpxData.Tracks[0].Segments[0].Points[0]
-			lastSegment := gpxData.Tracks[0].Segments[len(gpxData.Tracks[0].Segments)-1]
-			lastPoint := lastSegment.Points[len(lastSegment.Points)-1]
+	route := builder.finish()
 
-			if !firstPoint.Timestamp.IsZero() && !lastPoint.Timestamp.IsZero() {
-				route.Duration = lastPoint.Timestamp.Sub(firstPoint.Timestamp).Seconds()
-			}
-		}
+	// Fall back to the document's own timestamp when the points have none
+	if route.CreatedAt.IsZero() && gpxData.Time != nil {
+		route.CreatedAt = *gpxData.Time
 	}
 
 	return route, nil
 }
 
-func loadExistingGPXFiles() {
-	// Get all GPX files from the data directory
-	files, err := filepath.Glob("data/*.gpx")
+// loadExistingGPXFiles returns the routes of all GPX files in the data directory
+func loadExistingGPXFiles() []RouteData {
+	loaded, err := persister.LoadAll()
 	if err != nil {
-		log.Printf("Error loading existing GPX files: %v", err)
-		return
+		slog.Error("Unable to load the existing GPX files", "error", err)
+		return nil
 	}
 
-	// Process each file
-	for _, file := range files {
-		filename := filepath.Base(file)
-		gpxData, err := parseGPX(filename)
-		if err != nil {
-			log.Printf("Error parsing GPX file %s: %v", filename, err)
-			continue
-		}
+	for i := range loaded {
+		applyRouteMeta(&loaded[i], getRouteMeta(loaded[i].Filename))
+	}
 
-		route, err := processGPXData(filename, gpxData)
-		if err != nil {
-			log.Printf("Error processing GPX file %s: %v", filename, err)
-			continue
-		}
+	slog.Info("Loaded the existing GPX files", "count", len(loaded))
+	return loaded
+}
 
-		routesMutex.Lock()
-		routes = append(routes, route)
-		routesMutex.Unlock()
+func routesHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listRoutes(store, w, r)
+		case http.MethodPost:
+			saveSuggestedRoute(store, w, r)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
 	}
-
-	log.Printf("Loaded %d existing GPX files", len(routes))
 }
 
-func routesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// listRoutes returns a page of the stored routes, filtered and sorted by the query parameters.
+// GeoJSON responses aren't paginated so GIS tools get every matching route.
+func listRoutes(store *RouteStore, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseRouteFilter(query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	geoJSON, err := wantsGeoJSON(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, limit, err := parsePagination(query)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	unit, err := parseUnit(query.Get("unit"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	routesMutex.RLock()
-	defer routesMutex.RUnlock()
+	result := filterRoutes(store.All(), filter)
+	if err := sortRoutes(result, query.Get("sort"), query.Get("order")); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if geoJSON {
+		w.Header().Set("Content-Type", geoJSONContentType)
+		json.NewEncoder(w).Encode(routesGeoJSON(roundRoutes(routesIn(result, unit))))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(routes)
+	json.NewEncoder(w).Encode(RoutesPage{
+		Total:  len(result),
+		Offset: offset,
+		Limit:  limit,
+		Items:  roundRoutes(routesIn(paginate(result, offset, limit), unit)),
+	})
 }
 
-func suggestHandler(w http.ResponseWriter, r *http.Request) {
+func suggestHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		unit, err := parseUnit(r.URL.Query().Get("unit"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		suggested, ok := suggestRoutes(store, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roundSuggestions(suggestionsIn(suggested, unit)))
+	}
+}
+
+// suggestRoutes generates the suggestions asked for by a /suggest request, responding
+// with an error and returning false if the request is invalid or generating fails.
+// The suggestions are recorded in the history rounded, but returned at full precision
+// so the caller can round them in the unit it reports.
+func suggestRoutes(store *RouteStore, w http.ResponseWriter, r *http.Request) ([]SuggestedRoute, bool) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil, false
 	}
 
 	// Get query parameters for filtering
-	minDistance := 0.0
-	maxDistance := 0.0
-	followStreets := true // Default to following streets
+	opts := SuggestOptions{
+		FollowStreets: true, // Default to following streets
+	}
 
 	if r.URL.Query().Get("minDistance") != "" {
-		fmt.Sscanf(r.URL.Query().Get("minDistance"), "%f", &minDistance)
+		fmt.Sscanf(r.URL.Query().Get("minDistance"), "%f", &opts.MinDistance)
 	}
 	if r.URL.Query().Get("maxDistance") != "" {
-		fmt.Sscanf(r.URL.Query().Get("maxDistance"), "%f", &maxDistance)
+		fmt.Sscanf(r.URL.Query().Get("maxDistance"), "%f", &opts.MaxDistance)
 	}
 	if r.URL.Query().Get("followStreets") == "false" {
-		followStreets = false
+		opts.FollowStreets = false
+	}
+	if r.URL.Query().Get("coverage") == "true" {
+		opts.CoverageBias = true
+	}
+	if r.URL.Query().Get("preferFlat") == "true" {
+		opts.PreferFlat = true
+	}
+	if value := r.URL.Query().Get("maxRadiusKm"); value != "" {
+		maxRadius, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxRadius <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "maxRadiusKm must be a positive number of kilometers")
+			return nil, false
+		}
+		opts.MaxRadiusKm = maxRadius
+	}
+	if err := parseStreetOptions(r.URL.Query(), &opts); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	count := 1
+	if value := r.URL.Query().Get("count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSuggestionCount {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("count must be a whole number from 1 to %d", maxSuggestionCount))
+			return nil, false
+		}
+		count = parsed
+	}
+	if value := r.URL.Query().Get("boundsStrictness"); value != "" {
+		strictness, err := strconv.ParseFloat(value, 64)
+		if err != nil || strictness < 0 || strictness > 1 {
+			writeJSONError(w, http.StatusBadRequest, "boundsStrictness must be a number from 0 to 1")
+			return nil, false
+		}
+		opts.BoundsStrictness = &strictness
+	}
+	if value := r.URL.Query().Get("preferredBearing"); value != "" {
+		preferredBearing, err := strconv.ParseFloat(value, 64)
+		if err != nil || preferredBearing < 0 || preferredBearing >= 360 {
+			writeJSONError(w, http.StatusBadRequest, "preferredBearing must be a compass bearing from 0 to 360 degrees")
+			return nil, false
+		}
+		opts.PreferredBearing = &preferredBearing
 	}
 
-	// Log the parameters for debugging
-	log.Printf("Suggesting routes with parameters: minDistance=%f, maxDistance=%f, followStreets=%t",
-		minDistance, maxDistance, followStreets)
+	// maxAscent is another name for maxElevationGain
+	ascentParam := "maxElevationGain"
+	if !r.URL.Query().Has(ascentParam) && r.URL.Query().Has("maxAscent") {
+		ascentParam = "maxAscent"
+	}
+	if value := r.URL.Query().Get(ascentParam); value != "" {
+		maxElevationGain, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxElevationGain <= 0 {
+			writeJSONError(w, http.StatusBadRequest, ascentParam+" must be a positive number of meters")
+			return nil, false
+		}
+		if config.ElevationURL == "" {
+			writeJSONError(w, http.StatusBadRequest, ascentParam+" needs an elevation service, set ELEVATION_URL")
+			return nil, false
+		}
+		opts.MaxElevationGain = maxElevationGain
+	}
+
+	// Steer away from the suggestions returned recently, unless a direction was asked for
+	if r.URL.Query().Get("avoidRecent") == "true" && opts.PreferredBearing == nil {
+		opts.PreferredBearing = freshSuggestionBearing(store, suggestionLog.recent(time.Now(), config.SuggestionHistoryTTL))
+	}
 
-	// Generate suggested routes
-	var suggested []SuggestedRoute
+	// Coverage grid tuning for the coverage-biased mode
 	var err error
+	opts.CellSize, opts.GridPadding, err = parseCoverageParams(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
 
-	// If we need a route with a minimum distance and following streets, use a specialized function
-	if minDistance > 0 && followStreets {
-		log.Printf("Using specialized function to generate a route with minimum distance %f km that follows streets", minDistance)
-		suggested, err = generateRouteWithMinDistance(minDistance)
-	} else {
-		suggested, err = generateSuggestedRoutes(minDistance, maxDistance, followStreets)
+	// Generate suggested routes, giving up on OSRM once the client goes away. The logs of
+	// the request share its ID.
+	ctx := withRequestID(r.Context())
+	slog.InfoContext(ctx, "Suggesting routes", "minDistance", opts.MinDistance, "maxDistance", opts.MaxDistance,
+		"followStreets", opts.FollowStreets, "coverage", opts.CoverageBias, "count", count)
+
+	generate := func(opts SuggestOptions) ([]SuggestedRoute, error) {
+		// If we need a route with a minimum distance and following streets, use a specialized function
+		if opts.MinDistance > 0 && opts.FollowStreets {
+			slog.DebugContext(ctx, "Generating a street route with a minimum distance", "minDistance", opts.MinDistance)
+			return generateRouteWithMinDistance(ctx, streetRouter, store, opts)
+		}
+		return generateSuggestedRoutes(ctx, streetRouter, store, opts)
 	}
 
+	// Each of the requested suggestions is generated, and checked for elevation gain, on its own
+	suggested, err := suggestVariants(ctx, count, opts, func(opts SuggestOptions) ([]SuggestedRoute, error) {
+		if opts.MaxElevationGain > 0 {
+			return suggestWithinElevationGain(ctx, opts, generate)
+		}
+		return generate(opts)
+	})
+
+	if ctx.Err() != nil {
+		slog.InfoContext(ctx, "Client went away while suggesting routes", "error", ctx.Err())
+		return nil, false
+	}
 	if err != nil {
-		http.Error(w, "Unable to generate suggested routes", http.StatusInternalServerError)
-		return
+		slog.WarnContext(ctx, "Unable to generate suggested routes", "error", err)
+		writeSuggestionError(w, err)
+		return nil, false
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(suggested)
+	// Label where the suggestions start and end
+	addLocationLabels(ctx, suggested)
+	addBounds(suggested)
+
+	if r.URL.Query().Get("compare") == "true" {
+		addComparisons(store, suggested)
+	}
+
+	// Remember the suggestions so they can be revisited later
+	suggestionLog.add(time.Now(), roundSuggestions(suggested)...)
+
+	return suggested, true
 }
 
-func generateSuggestedRoutes(minDistance, maxDistance float64, followStreets bool) ([]SuggestedRoute, error) {
-	routesMutex.RLock()
-	defer routesMutex.RUnlock()
+// generateSuggestedRoutes suggests a route around the existing ones, routing it along
+// streets with the router if asked to
+func generateSuggestedRoutes(ctx context.Context, router Router, store *RouteStore, opts SuggestOptions) ([]SuggestedRoute, error) {
+	minDistance, maxDistance, followStreets := opts.MinDistance, opts.MaxDistance, opts.FollowStreets
 
-	// If no existing routes, return empty suggestions
-	if len(routes) == 0 {
-		return []SuggestedRoute{}, nil
+	if err := validateDistanceConstraints(opts); err != nil {
+		return nil, err
 	}
 
 	// For now, implement a simple algorithm that suggests routes
 	// by finding areas that haven't been explored yet
 
-	// Create a grid of the area covered by existing routes
-	var minLat, maxLat, minLng, maxLng float64
-	var allPoints []TrackPoint
-
 	// Find the bounding box of all existing routes
-	for i, route := range routes {
-		for j, point := range route.TrackPoints {
-			allPoints = append(allPoints, point)
-
-			// Initialize min/max on first point
-			if i == 0 && j == 0 {
-				minLat, maxLat = point.Latitude, point.Latitude
-				minLng, maxLng = point.Longitude, point.Longitude
-				continue
-			}
-
-			// Update min/max values
-			if point.Latitude < minLat {
-				minLat = point.Latitude
-			} else if point.Latitude > maxLat {
-				maxLat = point.Latitude
-			}
-
-			if point.Longitude < minLng {
-				minLng = point.Longitude
-			} else if point.Longitude > maxLng {
-				maxLng = point.Longitude
-			}
-		}
+	box := store.BoundingBox()
+	if !box.hasPoints {
+		return nil, errNoRoutes
 	}
+	minLat, maxLat, minLng, maxLng := box.minLat, box.maxLat, box.minLng, box.maxLng
 
 	// Create a simple suggested route by finding unexplored areas
 	// This is a placeholder algorithm - in a real implementation, you would use
@@ -364,23 +1088,58 @@ func generateSuggestedRoutes(minDistance, maxDistance float64, followStreets boo
 	// Add some randomization to the perimeter points to generate different routes each time
 	// We don't need to seed the random generator as it's already initialized
 
+	// The suggestion is seeded from the bounding box, optionally moved towards unexplored cells
+	seedMinLat, seedMaxLat, seedMinLng, seedMaxLng := minLat, maxLat, minLng, maxLng
+	if opts.CoverageBias {
+		grid, err := store.coverageGrid(opts.CellSize, opts.GridPadding)
+		if err != nil {
+			return nil, err
+		}
+		seedMinLat, seedMaxLat, seedMinLng, seedMaxLng = coverageBiasedBox(grid, minLat, maxLat, minLng, maxLng)
+	}
+
+	// Stay within walking distance of the center of the existing routes
+	center := box.center()
+	if opts.MaxRadiusKm > 0 {
+		seedMinLat, seedMaxLat, seedMinLng, seedMaxLng = clampBoxToRadius(center, opts.MaxRadiusKm,
+			seedMinLat, seedMaxLat, seedMinLng, seedMaxLng)
+	}
+
 	// Add some random variation to the bounding box (up to 10% of the size)
-	latRange := maxLat - minLat
-	lngRange := maxLng - minLng
+	latRange := seedMaxLat - seedMinLat
+	lngRange := seedMaxLng - seedMinLng
+
+	randomPerimeter := func() []TrackPoint {
+		// Random variation between -5% and +5%
+		minLatVar := seedMinLat + (rand.Float64()*0.1-0.05)*latRange
+		minLngVar := seedMinLng + (rand.Float64()*0.1-0.05)*lngRange
+		maxLatVar := seedMaxLat + (rand.Float64()*0.1-0.05)*latRange
+		maxLngVar := seedMaxLng + (rand.Float64()*0.1-0.05)*lngRange
+
+		// Create a perimeter with the randomized points
+		perimeter := []TrackPoint{
+			{Latitude: minLatVar, Longitude: minLngVar},
+			{Latitude: minLatVar, Longitude: maxLngVar},
+			{Latitude: maxLatVar, Longitude: maxLngVar},
+			{Latitude: maxLatVar, Longitude: minLngVar},
+			{Latitude: minLatVar, Longitude: minLngVar},
+		}
 
-	// Random variation between -5% and +5%
-	minLatVar := minLat + (rand.Float64()*0.1-0.05)*latRange
-	minLngVar := minLng + (rand.Float64()*0.1-0.05)*lngRange
-	maxLatVar := maxLat + (rand.Float64()*0.1-0.05)*latRange
-	maxLngVar := maxLng + (rand.Float64()*0.1-0.05)*lngRange
+		// With a preferred bearing, head out that way from the center and loop back instead
+		center := TrackPoint{Latitude: (minLatVar + maxLatVar) / 2, Longitude: (minLngVar + maxLngVar) / 2}
+		if opts.PreferredBearing != nil {
+			return bearingLoop(center, *opts.PreferredBearing, calculateRouteDistance(perimeter))
+		}
+		return variantPoints(perimeter, center, opts.Variant)
+	}
 
-	// Create a perimeter with the randomized points
-	perimeter := []TrackPoint{
-		{Latitude: minLatVar, Longitude: minLngVar},
-		{Latitude: minLatVar, Longitude: maxLngVar},
-		{Latitude: maxLatVar, Longitude: maxLngVar},
-		{Latitude: maxLatVar, Longitude: minLngVar},
-		{Latitude: minLatVar, Longitude: minLngVar},
+	perimeter := randomPerimeter()
+	if opts.PreferFlat {
+		candidates := [][]TrackPoint{perimeter}
+		for len(candidates) < flatCandidates {
+			candidates = append(candidates, randomPerimeter())
+		}
+		perimeter = flattestPerimeter(candidates, store.elevationIndex())
 	}
 
 	// Calculate approximate distance of the suggested route
@@ -390,373 +1149,121 @@ func generateSuggestedRoutes(minDistance, maxDistance float64, followStreets boo
 	if maxDistance > 0 && distance > maxDistance {
 		// If the route is too long, try to create a shorter route
 		// For simplicity, we'll just use a portion of the perimeter
-		log.Printf("Route exceeds max distance, scaling down from %f km to %f km", distance, maxDistance)
 		scaleFactor := maxDistance / distance
-		log.Printf("Using scale factor: %f for perimeter route", scaleFactor)
+		slog.DebugContext(ctx, "Perimeter exceeds max distance, scaling it down", "distance", distance,
+			"maxDistance", maxDistance, "scaleFactor", scaleFactor)
 		perimeter = adjustRouteDistance(perimeter, scaleFactor)
 		distance = calculateRouteDistance(perimeter)
-		log.Printf("After scaling, perimeter route distance is now: %f km", distance)
+		slog.DebugContext(ctx, "Scaled the perimeter", "distance", distance)
 	} else if minDistance > 0 && distance < minDistance {
 		// If the route is too short, try to create a longer route
 		// For simplicity, we'll add some zigzags to make it longer
-		log.Printf("Route is shorter than min distance, extending from %f km to %f km", distance, minDistance)
+		slog.DebugContext(ctx, "Perimeter is shorter than min distance, extending it", "distance", distance,
+			"minDistance", minDistance)
 		perimeter = extendRoute(perimeter, minDistance/distance)
 		distance = calculateRouteDistance(perimeter)
-		log.Printf("After extending, route distance is now: %f km", distance)
+		slog.DebugContext(ctx, "Extended the perimeter", "distance", distance)
+	}
+
+	// The random variation and extension may reach past the radius, pull those points back in
+	if opts.MaxRadiusKm > 0 {
+		perimeter = clampToRadius(perimeter, center, opts.MaxRadiusKm)
+		distance = calculateRouteDistance(perimeter)
 	}
 
 	// Create the suggested route
 	suggestedRoute := SuggestedRoute{
-		Points:         perimeter,
-		Distance:       distance,
-		FollowsStreets: false,
+		Points:             perimeter,
+		Distance:           distance,
+		FollowsStreets:     false,
+		DistanceIsEstimate: true,
 	}
 
-	// Log the initial route distance for debugging
-	log.Printf("Initial route distance: %f km, max distance: %f km", distance, maxDistance)
+	slog.DebugContext(ctx, "Generated the perimeter", "distance", distance, "maxDistance", maxDistance,
+		"followStreets", followStreets)
 
 	// If followStreets is true, try to get a route that follows streets
-	log.Printf("Attempting to create a route that follows streets (followStreets=%t)", followStreets)
 	if followStreets {
-		streetRoute, err := getRouteFollowingStreets(perimeter)
+		streetRoute, err := router.Route(ctx, perimeter, opts)
 		if err == nil {
 			// Verify that the street route is within a reasonable distance of the existing routes
-			if isRouteNearExistingRoutes(streetRoute.Points, minLat, maxLat, minLng, maxLng) {
+			if isRouteNearExistingRoutes(streetRoute.Points, minLat, maxLat, minLng, maxLng, opts.boundsStrictness()) {
 				// Check if the street route meets the distance criteria
 				streetDistance := streetRoute.Distance
-				log.Printf("Street route distance from OSRM: %f km, max distance: %f km", streetDistance, maxDistance)
+				slog.DebugContext(ctx, "Got a street route", "distance", streetDistance, "maxDistance", maxDistance)
 
 				// Make sure we have a valid distance
 				if streetDistance < 0.1 {
-					log.Printf("WARNING: Street route distance is too small (%f km), using estimated distance", streetDistance)
-
-					// Calculate the bounding box of the points to estimate a reasonable distance
-					var minLat, maxLat, minLng, maxLng float64
-					for i, point := range streetRoute.Points {
-						if i == 0 {
-							minLat, maxLat = point.Latitude, point.Latitude
-							minLng, maxLng = point.Longitude, point.Longitude
-							continue
-						}
-						if point.Latitude < minLat {
-							minLat = point.Latitude
-						} else if point.Latitude > maxLat {
-							maxLat = point.Latitude
-						}
-						if point.Longitude < minLng {
-							minLng = point.Longitude
-						} else if point.Longitude > maxLng {
-							maxLng = point.Longitude
-						}
-					}
+					slog.WarnContext(ctx, "Street route distance is too small, estimating it", "distance", streetDistance)
 
-					// Estimate the perimeter of the bounding box
-					width := haversineDistance(minLat, minLng, minLat, maxLng)
-					height := haversineDistance(minLat, minLng, maxLat, minLng)
-					estimatedDistance := 2 * (width + height)
+					// Estimate a reasonable distance from the perimeter of the points' bounding box
+					estimatedDistance := pointsBoundingBox(streetRoute.Points).perimeter()
 
 					streetDistance = estimatedDistance
 					streetRoute.Distance = streetDistance
-					log.Printf("Using estimated street route distance: %f km", streetDistance)
+					streetRoute.DistanceIsEstimate = true
+					streetRoute.addNote(noteEstimatedDistance)
+					slog.DebugContext(ctx, "Estimated the street route distance", "distance", streetDistance)
 				}
 
 				if maxDistance > 0 && streetDistance > maxDistance {
-					log.Printf("Street route exceeds max distance (%f km), scaling down to %f km", streetDistance, maxDistance)
-
-					// Try a completely different approach - use the original perimeter points
-					// but create a smaller perimeter that's approximately the right size
-					percentage := maxDistance / streetDistance
-					log.Printf("Need to keep approximately %.2f%% of the route", percentage*100)
-
-					// Get the original perimeter points (the ones we used to create the street route)
-					originalPoints := perimeter   // Use the perimeter points defined above
-					if len(originalPoints) >= 4 { // Need at least 4 points for a rectangle
-						// Calculate the center of the perimeter
-						var centerLat, centerLng float64
-						for _, p := range originalPoints {
-							centerLat += p.Latitude
-							centerLng += p.Longitude
-						}
-						centerLat /= float64(len(originalPoints))
-						centerLng /= float64(len(originalPoints))
-
-						// Create a smaller perimeter by scaling points toward the center
-						// Use a slightly smaller scale factor to account for street routing variations
-						scaleFactor := percentage * 0.8
-						log.Printf("Using scale factor %.4f to create smaller perimeter", scaleFactor)
-
-						var scaledPoints []TrackPoint
-						for _, p := range originalPoints {
-							// Scale the point toward the center
-							newLat := centerLat + (p.Latitude-centerLat)*scaleFactor
-							newLng := centerLng + (p.Longitude-centerLng)*scaleFactor
-							scaledPoints = append(scaledPoints, TrackPoint{Latitude: newLat, Longitude: newLng})
-						}
-
-						// Now get a new street route based on these scaled perimeter points
-						log.Printf("Getting new street route based on scaled perimeter points")
-						newStreetRoute, err := getRouteFollowingStreets(scaledPoints)
-
-						if err == nil {
-							newDistance := newStreetRoute.Distance
-							log.Printf("New street route created with distance: %f km", newDistance)
-
-							if newDistance <= maxDistance*1.1 { // Allow a small margin over max distance
-								// Success! Use the new route
-								streetRoute = newStreetRoute
-								log.Printf("Successfully created a street route within max distance")
-							} else {
-								// Try with an even smaller perimeter
-								log.Printf("New route still exceeds max distance (%f km), trying with smaller perimeter", newDistance)
-
-								// Use an even smaller scale factor
-								scaleFactor = percentage * 0.5
-								log.Printf("Using smaller scale factor %.4f", scaleFactor)
-
-								scaledPoints = []TrackPoint{}
-								for _, p := range originalPoints {
-									// Scale the point toward the center
-									newLat := centerLat + (p.Latitude-centerLat)*scaleFactor
-									newLng := centerLng + (p.Longitude-centerLng)*scaleFactor
-									scaledPoints = append(scaledPoints, TrackPoint{Latitude: newLat, Longitude: newLng})
-								}
-
-								// Try again with the smaller perimeter
-								newStreetRoute, err = getRouteFollowingStreets(scaledPoints)
-								if err == nil && newStreetRoute.Distance <= maxDistance*1.1 {
-									streetRoute = newStreetRoute
-									log.Printf("Created street route with smaller perimeter: %f km", newStreetRoute.Distance)
-								} else {
-									// Try with just a simple rectangle
-									log.Printf("Trying with a simple rectangle around the center")
-
-									// Calculate a small rectangle around the center
-									// Estimate how big it should be based on the max distance
-									// For a 5km max distance, a 0.5km x 0.5km rectangle would give roughly 2km perimeter
-									offset := maxDistance / 10.0 / 111.0 // Convert km to degrees (roughly)
-
-									rectPoints := []TrackPoint{
-										{Latitude: centerLat - offset, Longitude: centerLng - offset},
-										{Latitude: centerLat - offset, Longitude: centerLng + offset},
-										{Latitude: centerLat + offset, Longitude: centerLng + offset},
-										{Latitude: centerLat + offset, Longitude: centerLng - offset},
-										{Latitude: centerLat - offset, Longitude: centerLng - offset}, // Close the loop
-									}
-
-									simpleRoute, err := getRouteFollowingStreets(rectPoints)
-									if err == nil && simpleRoute.Distance <= maxDistance*1.1 {
-										streetRoute = simpleRoute
-										log.Printf("Created simple rectangular street route: %f km", simpleRoute.Distance)
-									} else {
-										// All attempts failed, fall back to mathematical scaling
-										log.Printf("All street routing attempts exceeded max distance, falling back to scaled route")
-										scaleFactor := maxDistance / streetDistance
-										log.Printf("Using scale factor: %f for street route", scaleFactor)
-										streetRoute.Points = adjustRouteDistance(streetRoute.Points, scaleFactor)
-										streetRoute.Distance = calculateRouteDistance(streetRoute.Points)
-										log.Printf("After scaling, street route distance is now: %f km", streetRoute.Distance)
-									}
-								}
-							}
-						} else {
-							log.Printf("Error getting new street route: %v, falling back to scaled route", err)
-							// Fall back to mathematical scaling if the street routing fails
-							scaleFactor := maxDistance / streetDistance
-							log.Printf("Using scale factor: %f for street route", scaleFactor)
-							streetRoute.Points = adjustRouteDistance(streetRoute.Points, scaleFactor)
-							streetRoute.Distance = calculateRouteDistance(streetRoute.Points)
-							log.Printf("After scaling, street route distance is now: %f km", streetRoute.Distance)
-						}
-					} else {
-						// Not enough points in the original perimeter, fall back to scaling
-						log.Printf("Not enough points in original perimeter, falling back to scaled route")
-						scaleFactor := maxDistance / streetDistance
-						log.Printf("Using scale factor: %f for street route", scaleFactor)
-						streetRoute.Points = adjustRouteDistance(streetRoute.Points, scaleFactor)
-						streetRoute.Distance = calculateRouteDistance(streetRoute.Points)
-						log.Printf("After scaling, street route distance is now: %f km", streetRoute.Distance)
-					}
+					slog.DebugContext(ctx, "Street route exceeds max distance, fitting it", "distance", streetDistance, "maxDistance", maxDistance)
+					streetRoute = fitRouteToMaxDistance(ctx, router, streetRoute,
+						perimeter, pointsCentroid(perimeter), maxDistance, opts)
 				} else if minDistance > 0 && streetDistance < minDistance {
-					log.Printf("Street route is shorter than min distance (%f km), extending to %f km", streetDistance, minDistance)
-
-					// Instead of using zigzags which break the street following,
-					// try to get a new street route with a larger perimeter
-
-					// Calculate the center of the existing routes
-					var centerLat, centerLng float64
-					totalPoints := 0
-
-					// First try to use existing routes for the center
-					routesMutex.RLock()
-					for _, route := range routes {
-						for _, point := range route.TrackPoints {
-							centerLat += point.Latitude
-							centerLng += point.Longitude
-							totalPoints++
-						}
-					}
-					routesMutex.RUnlock()
-
-					// If no existing routes, use the perimeter
-					if totalPoints == 0 {
-						for _, p := range perimeter {
-							centerLat += p.Latitude
-							centerLng += p.Longitude
-						}
-						centerLat /= float64(len(perimeter))
-						centerLng /= float64(len(perimeter))
-					} else {
-						centerLat /= float64(totalPoints)
-						centerLng /= float64(totalPoints)
-					}
-
-					// Create a polygon around the center point
-					// Estimate how far we need to go to get the desired distance
-					// 1 degree is roughly 111 km, so we calculate an appropriate offset
-					offset := math.Sqrt(minDistance/10.0) / 111.0 // Convert km to degrees
-
-					// Create a polygon with a small number of points (to avoid OSRM API limits)
-					numPoints := 5 // Use a pentagon
-					var polygonPoints []TrackPoint
-
-					// Create the polygon
-					for i := 0; i < numPoints; i++ {
-						angle := 2.0 * math.Pi * float64(i) / float64(numPoints)
-						polygonPoints = append(polygonPoints, TrackPoint{
-							Latitude:  centerLat + offset*math.Sin(angle),
-							Longitude: centerLng + offset*math.Cos(angle),
-						})
-					}
-
-					// Close the loop
-					polygonPoints = append(polygonPoints, polygonPoints[0])
-
-					// Try to get a street route with these polygon points
-					log.Printf("Trying to get a longer street route with %d polygon points", len(polygonPoints))
-					// Force the route to be near existing routes
-					newStreetRoute, err := getRouteFollowingStreets(polygonPoints)
-					// Skip the check for isRouteNearExistingRoutes since we're deliberately creating a route
-					// that might be outside the existing area
-
-					// If successful and meets the minimum distance
-					if err == nil && newStreetRoute.Distance >= minDistance {
-						// Success!
-						streetRoute = newStreetRoute
-						log.Printf("Created longer street route with polygon: %f km", newStreetRoute.Distance)
-					} else {
-						// If that didn't work, try with a larger polygon
-						log.Printf("First attempt failed, trying with a larger polygon")
-
-						// Double the offset for a larger polygon
-						offset *= 2.0
-						polygonPoints = []TrackPoint{}
-
-						// Create the larger polygon
-						for i := 0; i < numPoints; i++ {
-							angle := 2.0 * math.Pi * float64(i) / float64(numPoints)
-							polygonPoints = append(polygonPoints, TrackPoint{
-								Latitude:  centerLat + offset*math.Sin(angle),
-								Longitude: centerLng + offset*math.Cos(angle),
-							})
-						}
-
-						// Close the loop
-						polygonPoints = append(polygonPoints, polygonPoints[0])
-
-						// Try again with the larger polygon
-						log.Printf("Trying with a larger polygon of %d points", len(polygonPoints))
-						// Force the route to be near existing routes
-						newStreetRoute, err = getRouteFollowingStreets(polygonPoints)
-						// Skip the check for isRouteNearExistingRoutes since we're deliberately creating a route
-						// that might be outside the existing area
-
-						if err == nil && newStreetRoute.Distance >= minDistance {
-							// Success!
-							streetRoute = newStreetRoute
-							log.Printf("Created longer street route with larger polygon: %f km", newStreetRoute.Distance)
-						} else {
-							// If all else fails, create a simple route with just a few points
-							log.Printf("Polygon attempts failed, trying with a simple route")
-
-							// Create a simple route with just two points far enough apart
-							offset = math.Sqrt(minDistance/2.0) / 111.0
-							simplePoints := []TrackPoint{
-								{Latitude: centerLat - offset, Longitude: centerLng - offset},
-								{Latitude: centerLat + offset, Longitude: centerLng + offset},
-							}
-
-							// Try with the simple route
-							log.Printf("Trying with a simple 2-point route")
-							// Force the route to be near existing routes
-							newStreetRoute, err = getRouteFollowingStreets(simplePoints)
-							// Skip the check for isRouteNearExistingRoutes since we're deliberately creating a route
-							// that might be outside the existing area
-
-							if err == nil && newStreetRoute.Distance >= minDistance {
-								// Success!
-								streetRoute = newStreetRoute
-								log.Printf("Created longer street route with simple points: %f km", newStreetRoute.Distance)
-							} else {
-								// If all attempts fail, try one more time with a larger area
-								log.Printf("All street routing attempts failed, trying with a much larger area")
-
-								// Create a simple route with just two points far enough apart
-								offset = math.Sqrt(minDistance) / 111.0 // Use a larger offset
-								simplePoints := []TrackPoint{
-									{Latitude: centerLat - offset, Longitude: centerLng - offset},
-									{Latitude: centerLat + offset, Longitude: centerLng + offset},
-								}
-
-								// Try with the simple route
-								log.Printf("Trying with a simple 2-point route with large offset: %f", offset)
-								newStreetRoute, err = getRouteFollowingStreets(simplePoints)
-
-								if err == nil && newStreetRoute.Distance >= minDistance {
-									// Success!
-									streetRoute = newStreetRoute
-									log.Printf("Created longer street route with large offset: %f km", newStreetRoute.Distance)
-								} else {
-									// If all attempts fail, fall back to the zigzag method
-									log.Printf("All street routing attempts failed, falling back to zigzag extension")
-									streetRoute.Points = extendRoute(streetRoute.Points, minDistance/streetDistance)
-									streetRoute.Distance = calculateRouteDistance(streetRoute.Points)
-									log.Printf("After extending with zigzags, street route distance is now: %f km", streetRoute.Distance)
-									// Note that this will lose the street-following property
-									streetRoute.FollowsStreets = false
-								}
-							}
-						}
+					slog.DebugContext(ctx, "Street route is shorter than min distance, fitting it", "distance", streetDistance, "minDistance", minDistance)
+					// Center on the existing routes, or on the perimeter if they have no points
+					center, ok := routesCentroid(store.All())
+					if !ok {
+						center = pointsCentroid(perimeter)
 					}
-
+					streetRoute = fitRouteToMinDistance(ctx, router, streetRoute,
+						center, minDistance, opts)
 				}
 
 				// If we're extending to meet minimum distance, always use the street route
 				if minDistance > 0 && streetDistance < minDistance {
-					log.Printf("Using street route even though it's outside existing area because we're extending to meet minimum distance")
+					slog.DebugContext(ctx, "Using the street route outside the existing area to meet the minimum distance")
 					suggestedRoute.Points = streetRoute.Points
 					suggestedRoute.Distance = streetRoute.Distance
 					suggestedRoute.FollowsStreets = true
-				} else if isRouteNearExistingRoutes(streetRoute.Points, minLat, maxLat, minLng, maxLng) {
+					suggestedRoute.DistanceIsEstimate = streetRoute.DistanceIsEstimate
+					suggestedRoute.Directions = streetRoute.Directions
+					suggestedRoute.Notes = streetRoute.Notes
+				} else if isRouteNearExistingRoutes(streetRoute.Points, minLat, maxLat, minLng, maxLng, opts.boundsStrictness()) {
 					suggestedRoute.Points = streetRoute.Points
 					suggestedRoute.Distance = streetRoute.Distance
 					suggestedRoute.FollowsStreets = true
+					suggestedRoute.DistanceIsEstimate = streetRoute.DistanceIsEstimate
+					suggestedRoute.Directions = streetRoute.Directions
+					suggestedRoute.Notes = streetRoute.Notes
 				} else {
-					log.Printf("Street route is too far from existing routes, using perimeter route instead")
+					slog.DebugContext(ctx, "Street route is too far from existing routes, using the perimeter instead")
+					suggestedRoute.addNote(noteOutsideExplored)
 				}
+			} else {
+				slog.DebugContext(ctx, "Street route is too far from existing routes, using the perimeter instead")
+				suggestedRoute.addNote(noteOutsideExplored)
 			}
 		} else {
-			log.Printf("Error getting street route: %v", err)
+			slog.WarnContext(ctx, "Unable to get a street route", "error", err)
+			suggestedRoute.Reason = fmt.Sprintf("street routing failed: %v", err)
+			suggestedRoute.addNote(streetRoutingNote(err))
 		}
 	}
 
-	// Log the final route that will be returned
-	log.Printf("FINAL ROUTE: Distance=%f km, FollowsStreets=%t, MaxDistance=%f km",
-		suggestedRoute.Distance, suggestedRoute.FollowsStreets, maxDistance)
+	slog.InfoContext(ctx, "Suggested a route", "distance", suggestedRoute.Distance,
+		"followsStreets", suggestedRoute.FollowsStreets, "maxDistance", maxDistance)
 
-	// Verify that the route respects the max distance constraint
+	// Verify that the route respects the max distance constraint, allowing the same small
+	// margin as the street routing attempts
 	if maxDistance > 0 && suggestedRoute.Distance > maxDistance {
-		log.Printf("WARNING: Final route distance (%f km) still exceeds max distance (%f km)",
-			suggestedRoute.Distance, maxDistance)
+		slog.WarnContext(ctx, "Suggested route exceeds max distance", "distance", suggestedRoute.Distance,
+			"maxDistance", maxDistance)
+		if suggestedRoute.Distance > maxDistance*maxDistanceTolerance {
+			return nil, fmt.Errorf("%w: the closest is %.2f km, more than %.2f km",
+				errExceedsMaxDistance, suggestedRoute.Distance, maxDistance)
+		}
 	}
 
 	return []SuggestedRoute{suggestedRoute}, nil
@@ -769,8 +1276,7 @@ func calculateRouteDistance(points []TrackPoint) float64 {
 
 	var distance float64
 	for i := 0; i < len(points)-1; i++ {
-		// Use Haversine formula to calculate distance between points
-		distance += haversineDistance(
+		distance += pointDistance(
 			points[i].Latitude, points[i].Longitude,
 			points[i+1].Latitude, points[i+1].Longitude,
 		)
@@ -829,113 +1335,110 @@ func adjustRouteDistance(points []TrackPoint, scaleFactor float64) []TrackPoint
 	return adjustedPoints
 }
 
-// getRouteFollowingStreets uses the OSRM API to get a route that follows streets
-func getRouteFollowingStreets(points []TrackPoint) (SuggestedRoute, error) {
-	// Use the OSRM API to get a route that follows streets
-	// We'll use the public OSRM demo server for this example
-	// In a production environment, you would want to host your own OSRM server
-	osrmServer := "https://router.project-osrm.org"
-
-	// OSRM API has a limit of 500 waypoints
-	// If we have more than 100 points, sample them to reduce the number
-	if len(points) > 100 {
-		log.Printf("Too many points (%d), sampling to reduce", len(points))
-		// Sample the points to reduce the number
-		sampledPoints := []TrackPoint{}
-		step := len(points) / 100
-		if step < 1 {
-			step = 1
-		}
+// getRouteFollowingStreets uses the OSRM API to get a route that follows streets.
+// Routes are cached, so asking for the same waypoints again doesn't contact OSRM.
+func getRouteFollowingStreets(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	key := osrmCacheKey(points, opts)
+	if route, ok := osrmRouteCache.get(key); ok {
+		slog.DebugContext(ctx, "Using a cached street route", "waypoints", len(points))
+		return route, nil
+	}
 
-		for i := 0; i < len(points); i += step {
-			sampledPoints = append(sampledPoints, points[i])
-		}
+	route, err := fetchRouteFollowingStreets(ctx, osrmServiceRoute, points, opts)
+	if err != nil {
+		return SuggestedRoute{}, err
+	}
 
-		// Make sure we include the last point
-		if len(sampledPoints) > 0 && sampledPoints[len(sampledPoints)-1] != points[len(points)-1] {
-			sampledPoints = append(sampledPoints, points[len(points)-1])
-		}
+	osrmRouteCache.put(key, route)
+	return route, nil
+}
 
-		points = sampledPoints
-		log.Printf("Reduced to %d points", len(points))
+// getOptimizedLoop uses the OSRM trip service to get a loop through the waypoints that
+// follows streets, visiting them in the order that makes the shortest round trip from the
+// first one, so the loop doesn't cross itself. If the trip service fails, e.g. because
+// the server doesn't offer it, the waypoints are routed in order instead.
+func getOptimizedLoop(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	// The trip returns to the first waypoint by itself, the route service has to be told
+	open, closed := points, points
+	if len(points) > 2 && points[0] == points[len(points)-1] {
+		open = points[:len(points)-1]
+	} else {
+		closed = append(points[:len(points):len(points)], points[0])
 	}
 
-	// Log the input points for debugging
-	log.Printf("Input points for street routing: %+v", points)
+	key := osrmServiceTrip + "|" + osrmCacheKey(open, opts)
+	if route, ok := osrmRouteCache.get(key); ok {
+		slog.DebugContext(ctx, "Using a cached loop", "waypoints", len(open))
+		return route, nil
+	}
 
-	// Build the coordinates string for the OSRM API
-	// Format: lon1,lat1;lon2,lat2;...
-	// OSRM API expects coordinates in [longitude, latitude] order
-	var coordsBuilder strings.Builder
-	for i, point := range points {
-		if i > 0 {
-			coordsBuilder.WriteString(";")
-		}
-		coordsBuilder.WriteString(fmt.Sprintf("%f,%f", point.Longitude, point.Latitude))
+	route, err := fetchRouteFollowingStreets(ctx, osrmServiceTrip, open, opts)
+	if err != nil {
+		slog.InfoContext(ctx, "Unable to get an optimized loop, routing the waypoints in order", "error", err)
+		return getRouteFollowingStreets(ctx, closed, opts)
 	}
 
-	// Build the OSRM API URL
-	// We're using the "route" service with the "walking" profile
-	url := fmt.Sprintf("%s/route/v1/walking/%s?overview=full&geometries=polyline",
-		osrmServer, coordsBuilder.String())
+	osrmRouteCache.put(key, route)
+	return route, nil
+}
 
-	// Log the URL for debugging
-	log.Printf("OSRM API URL: %s", url)
+// fetchRouteFollowingStreets requests a route that follows streets from the OSRM service
+func fetchRouteFollowingStreets(ctx context.Context, service string, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	// Use the OSRM API to get a route that follows streets
+	osrmServer := config.OSRMServer
 
-	// Make the request to the OSRM API
-	resp, err := http.Get(url)
+	url, points, err := buildOSRMRouteURL(service, points, opts)
 	if err != nil {
-		log.Printf("Error making OSRM API request: %v", err)
 		return SuggestedRoute{}, err
 	}
-	defer resp.Body.Close()
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	slog.DebugContext(ctx, "Routing along streets", "waypoints", points)
+
+	// Make the request to the OSRM API
+	osrmResp, err := requestOSRMRoute(ctx, url)
 	if err != nil {
-		log.Printf("Error reading OSRM API response: %v", err)
 		return SuggestedRoute{}, err
 	}
 
-	// Log the response for debugging
-	log.Printf("OSRM API response: %s", string(body))
-
-	// Log the distance from OSRM directly
-	var osrmDistance float64
-	if resp.StatusCode == http.StatusOK {
-		var respMap map[string]interface{}
-		if err := json.Unmarshal(body, &respMap); err == nil {
-			if routes, ok := respMap["routes"].([]interface{}); ok && len(routes) > 0 {
-				if route, ok := routes[0].(map[string]interface{}); ok {
-					if dist, ok := route["distance"].(float64); ok {
-						osrmDistance = dist / 1000.0 // Convert from meters to kilometers
-						log.Printf("OSRM reported distance: %f km", osrmDistance)
-					}
-				}
-			}
+	// Servers whose profile doesn't define the excluded classes reject the request,
+	// so fall back to plain walking directions
+	if osrmResp.Code == "InvalidValue" && opts.PreferFootpaths && config.FootpathExcludeClasses != "" {
+		slog.WarnContext(ctx, "OSRM server does not support the excluded classes, retrying without preferring footpaths",
+			"exclude", config.FootpathExcludeClasses)
+		opts.PreferFootpaths = false
+		url = osrmRouteURL(osrmServer, service, points, opts)
+		osrmResp, err = requestOSRMRoute(ctx, url)
+		if err != nil {
+			return SuggestedRoute{}, err
 		}
 	}
 
-	// Parse the response
-	var osrmResp OSRMResponse
-	if err := json.Unmarshal(body, &osrmResp); err != nil {
-		log.Printf("Error parsing OSRM API response: %v", err)
-		return SuggestedRoute{}, err
+	// If some waypoints could not be snapped to a road (e.g. they lie in a park
+	// or on water), retry with progressively larger snapping radiuses
+	for _, radius := range snapRadiuses {
+		if osrmResp.Code != "NoSegment" {
+			break
+		}
+
+		slog.DebugContext(ctx, "OSRM could not snap waypoints to the road network, retrying with a larger radius", "radius", radius)
+		osrmResp, err = requestOSRMRoute(ctx, url+"&radiuses="+radiusesParam(len(points), radius))
+		if err != nil {
+			return SuggestedRoute{}, err
+		}
 	}
 
 	// Check if the OSRM API returned a route
-	if osrmResp.Code != "Ok" || len(osrmResp.Routes) == 0 {
-		log.Printf("OSRM API did not return a valid route: %s", osrmResp.Code)
-		return SuggestedRoute{}, fmt.Errorf("OSRM API did not return a valid route")
+	if osrmResp.Code != "Ok" {
+		slog.WarnContext(ctx, "OSRM did not return a valid route", "code", osrmResp.Code)
+		return SuggestedRoute{}, fmt.Errorf("OSRM API did not return a valid route: %s", osrmResp.Code)
 	}
 
 	// Decode the polyline geometry
-	decodedPoints := decodePolyline(osrmResp.Routes[0].Geometry)
+	decodedPoints := decodePolyline(osrmResp.Routes[0].Geometry, polyline6Precision)
 
-	// Log the decoded points for debugging
-	log.Printf("Decoded %d points from polyline", len(decodedPoints))
+	slog.DebugContext(ctx, "Decoded the route geometry", "points", len(decodedPoints))
 	if len(decodedPoints) > 0 {
-		log.Printf("First point: %v, Last point: %v", decodedPoints[0], decodedPoints[len(decodedPoints)-1])
+		slog.DebugContext(ctx, "Route geometry ends", "first", decodedPoints[0], "last", decodedPoints[len(decodedPoints)-1])
 	}
 
 	// Convert the decoded points to TrackPoints
@@ -944,78 +1447,83 @@ func getRouteFollowingStreets(points []TrackPoint) (SuggestedRoute, error) {
 	var trackPoints []TrackPoint
 	for _, point := range decodedPoints {
 		// Create a new TrackPoint with the correct coordinates
-		trackPoint := TrackPoint{
+		trackPoint := canonicalPoint(TrackPoint{
 			Latitude:  point[0],
 			Longitude: point[1],
-		}
+		})
 
-		// Log each track point for debugging
-		log.Printf("Adding track point: %+v", trackPoint)
+		slog.DebugContext(ctx, "Adding track point", "point", trackPoint)
 
 		trackPoints = append(trackPoints, trackPoint)
 	}
 
+	// Loops may come back with slightly different start and end points
+	trackPoints = snapLoopClosure(trackPoints, loopSnapTolerance)
+
 	// Calculate the actual distance using our haversine function to ensure consistency
 	actualDistance := 0.0
 	if len(trackPoints) >= 2 {
 		actualDistance = calculateRouteDistance(trackPoints)
-		log.Printf("Calculated street route distance: %f km with %d points", actualDistance, len(trackPoints))
+		slog.DebugContext(ctx, "Calculated the street route distance", "distance", actualDistance, "points", len(trackPoints))
 	} else {
-		log.Printf("WARNING: Not enough points to calculate distance. Only %d points available.", len(trackPoints))
+		slog.WarnContext(ctx, "Not enough points to calculate the street route distance", "points", len(trackPoints))
 	}
 
+	// Use the distance from the configured source
+	osrmDistance := osrmResp.Routes[0].Distance / 1000.0
+	geometryDistance := actualDistance
+	actualDistance = streetRouteDistance(osrmDistance, geometryDistance)
+
 	// Use the OSRM distance as a fallback if our calculation is zero or very small
 	if actualDistance < 0.1 && len(osrmResp.Routes) > 0 {
 		// Get the distance directly from the OSRM response (already in meters)
 		actualDistance = osrmResp.Routes[0].Distance / 1000.0
-		log.Printf("Using OSRM distance as fallback: %f km", actualDistance)
+		slog.DebugContext(ctx, "Using the OSRM distance as fallback", "distance", actualDistance)
 
 		// If the distance is still too small, use a reasonable default based on the perimeter
 		if actualDistance < 0.1 {
-			// Calculate the bounding box of the points to estimate a reasonable distance
-			var minLat, maxLat, minLng, maxLng float64
-			for i, point := range trackPoints {
-				if i == 0 {
-					minLat, maxLat = point.Latitude, point.Latitude
-					minLng, maxLng = point.Longitude, point.Longitude
-					continue
-				}
-				if point.Latitude < minLat {
-					minLat = point.Latitude
-				} else if point.Latitude > maxLat {
-					maxLat = point.Latitude
-				}
-				if point.Longitude < minLng {
-					minLng = point.Longitude
-				} else if point.Longitude > maxLng {
-					maxLng = point.Longitude
-				}
-			}
-
-			// Estimate the perimeter of the bounding box
-			width := haversineDistance(minLat, minLng, minLat, maxLng)
-			height := haversineDistance(minLat, minLng, maxLat, minLng)
-			estimatedDistance := 2 * (width + height)
+			// Estimate a reasonable distance from the perimeter of the points' bounding box
+			estimatedDistance := pointsBoundingBox(trackPoints).perimeter()
 
 			actualDistance = estimatedDistance
-			log.Printf("Using estimated distance based on bounding box: %f km", actualDistance)
+			slog.DebugContext(ctx, "Estimated the distance from the bounding box", "distance", actualDistance)
+		}
+	}
+
+	route := SuggestedRoute{
+		Points:           trackPoints,
+		Distance:         actualDistance,
+		FollowsStreets:   true,
+		OSRMDistance:     osrmDistance,
+		GeometryDistance: geometryDistance,
+	}
+
+	if opts.Verbose {
+		var steps []OSRMStep
+		for _, leg := range osrmResp.Routes[0].Legs {
+			steps = append(steps, leg.Steps...)
 		}
+		route.Directions = buildDirections(steps, actualDistance, osrmResp.Routes[0].Duration)
 	}
 
-	return SuggestedRoute{
-		Points:         trackPoints,
-		Distance:       actualDistance, // Use our calculated distance instead of OSRM's
-		FollowsStreets: true,
-	}, nil
+	return route, nil
 }
 
-// decodePolyline decodes a polyline string into a slice of [lat, lng] coordinates
-func decodePolyline(polyline string) [][]float64 {
+// Precisions of the polylines OSRM encodes geometries with, in decimal places
+const (
+	polylinePrecision  = 5 // geometries=polyline
+	polyline6Precision = 6 // geometries=polyline6
+)
+
+// decodePolyline decodes a polyline string encoded with the given precision into a
+// slice of [lat, lng] coordinates
+func decodePolyline(polyline string, precision int) [][]float64 {
 	// Implementation of the Google polyline algorithm
 	// See: https://developers.google.com/maps/documentation/utilities/polylinealgorithm
 	var coordinates [][]float64
 	index := 0
 	lat, lng := 0, 0
+	factor := math.Pow10(precision)
 
 	for index < len(polyline) {
 		// Decode latitude
@@ -1070,13 +1578,12 @@ func decodePolyline(polyline string) [][]float64 {
 		lng += lngChange
 
 		// Convert to floating point and add to coordinates
-		lat_f := float64(lat) / 1e5
-		lng_f := float64(lng) / 1e5
+		lat_f := float64(lat) / factor
+		lng_f := float64(lng) / factor
 
 		// No need to fix negative coordinates anymore - our decoder is working correctly now
 
-		// Log each coordinate for debugging
-		log.Printf("Decoded coordinate: [%f, %f]", lat_f, lng_f)
+		slog.Debug("Decoded coordinate", "lat", lat_f, "lng", lng_f)
 
 		// OSRM returns coordinates in [longitude, latitude] order, but we need [latitude, longitude]
 		coordinates = append(coordinates, []float64{lat_f, lng_f})
@@ -1085,8 +1592,9 @@ func decodePolyline(polyline string) [][]float64 {
 	return coordinates
 }
 
-// isRouteNearExistingRoutes checks if a route is within a reasonable distance of existing routes
-func isRouteNearExistingRoutes(points []TrackPoint, minLat, maxLat, minLng, maxLng float64) bool {
+// isRouteNearExistingRoutes checks if a route is within a reasonable distance of existing routes:
+// at least the minInBounds share of its points must lie within their padded bounding box
+func isRouteNearExistingRoutes(points []TrackPoint, minLat, maxLat, minLng, maxLng, minInBounds float64) bool {
 	// Calculate the bounding box of the existing routes with some padding
 	latPadding := (maxLat - minLat) * 0.5 // 50% padding
 	lngPadding := (maxLng - minLng) * 0.5 // 50% padding
@@ -1096,11 +1604,10 @@ func isRouteNearExistingRoutes(points []TrackPoint, minLat, maxLat, minLng, maxL
 	minLngWithPadding := minLng - lngPadding
 	maxLngWithPadding := maxLng + lngPadding
 
-	// Log the bounding box for debugging
-	log.Printf("Existing routes bounding box with padding: [%f,%f,%f,%f]",
-		minLatWithPadding, maxLatWithPadding, minLngWithPadding, maxLngWithPadding)
+	slog.Debug("Existing routes bounding box with padding", "minLat", minLatWithPadding, "maxLat", maxLatWithPadding,
+		"minLng", minLngWithPadding, "maxLng", maxLngWithPadding)
 
-	// Check if at least 50% of the points are within the padded bounding box
+	// Count the points within the padded bounding box
 	pointsInBounds := 0
 	for _, point := range points {
 		if point.Latitude >= minLatWithPadding && point.Latitude <= maxLatWithPadding &&
@@ -1111,12 +1618,14 @@ func isRouteNearExistingRoutes(points []TrackPoint, minLat, maxLat, minLng, maxL
 
 	// Calculate the percentage of points in bounds
 	percentageInBounds := float64(pointsInBounds) / float64(len(points))
-	log.Printf("Percentage of points in bounds: %f%%", percentageInBounds*100)
+	slog.Debug("Share of the route near the existing routes", "percent", percentageInBounds*100)
 
-	// Return true if at least 50% of the points are within the padded bounding box
-	return percentageInBounds >= 0.5
+	return percentageInBounds >= minInBounds
 }
 
+// zigzagAmplitudeRatio is how far extendRoute's zigzags reach from a segment, relative to its length
+const zigzagAmplitudeRatio = 0.6
+
 // extendRoute makes a route longer by adding zigzags
 func extendRoute(points []TrackPoint, extensionFactor float64) []TrackPoint {
 	// For simplicity, we'll add zigzags to the route
@@ -1143,18 +1652,17 @@ func extendRoute(points []TrackPoint, extensionFactor float64) []TrackPoint {
 		newPoints = append(newPoints, p1)
 
 		// Calculate the midpoint
-		midLat := (p1.Latitude + p2.Latitude) / 2
-		midLng := (p1.Longitude + p2.Longitude) / 2
-
-		// Calculate perpendicular direction
-		dLat := p2.Latitude - p1.Latitude
-		dLng := p2.Longitude - p1.Longitude
+		mid := TrackPoint{
+			Latitude:  (p1.Latitude + p2.Latitude) / 2,
+			Longitude: (p1.Longitude + p2.Longitude) / 2,
+		}
 
-		// Normalize and rotate 90 degrees
-		length := math.Sqrt(dLat*dLat + dLng*dLng)
-		if length > 0 {
-			perpLat := -dLng / length * 0.01 // Scale factor for zigzag size
-			perpLng := dLat / length * 0.01  // Scale factor for zigzag size
+		// Zigzag perpendicular to the segment, by an amount bounded in meters so
+		// short segments and low latitudes don't get absurd spikes
+		segmentLength := haversineDistance(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
+		if segmentLength > 0 {
+			amplitude := math.Min(segmentLength*zigzagAmplitudeRatio, config.MaxZigzagMeters/1000)
+			heading := bearing(p1, p2)
 
 			// Add zigzags
 			for j := 0; j < numZigzags; j++ {
@@ -1165,11 +1673,7 @@ func extendRoute(points []TrackPoint, extensionFactor float64) []TrackPoint {
 				}
 
 				// Add a point in the zigzag
-				zigzagPoint := TrackPoint{
-					Latitude:  midLat + perpLat*direction,
-					Longitude: midLng + perpLng*direction,
-				}
-				newPoints = append(newPoints, zigzagPoint)
+				newPoints = append(newPoints, destinationPoint(mid, heading+90*direction, amplitude))
 			}
 		}
 	}
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/tkrajina/gpxgo/gpx"
 )
 
 func TestHaversineDistance(t *testing.T) {
@@ -121,7 +133,7 @@ func TestDecodePolyline(t *testing.T) {
 	// This encodes the points: (38.5, -120.2), (40.7, -120.95), (43.252, -126.453)
 	polyline := "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
 
-	points := decodePolyline(polyline)
+	points := decodePolyline(polyline, polylinePrecision)
 
 	// Check that we got the right number of points
 	if len(points) != 3 {
@@ -147,16 +159,40 @@ func TestDecodePolyline(t *testing.T) {
 	}
 
 	// Test with empty polyline
-	emptyPoints := decodePolyline("")
+	emptyPoints := decodePolyline("", polylinePrecision)
 	if len(emptyPoints) != 0 {
 		t.Errorf("Expected 0 points for empty polyline, got %d", len(emptyPoints))
 	}
 }
 
+func TestDecodePolyline6(t *testing.T) {
+	expected := [][]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+
+	// Decoded at precision 5 the same string would be off by a factor of ten
+	points := decodePolyline(testPolyline, polyline6Precision)
+	if len(points) != len(expected) {
+		t.Fatalf("Expected %d points, got %d", len(expected), len(points))
+	}
+	for i, point := range points {
+		if math.Abs(point[0]-expected[i][0]) > 1e-9 || math.Abs(point[1]-expected[i][1]) > 1e-9 {
+			t.Errorf("Point %d: Expected %v, got %v", i, expected[i], point)
+		}
+	}
+
+	// Points at full six decimal precision survive the round trip
+	precise := []TrackPoint{{Latitude: 52.520008, Longitude: 13.404954}, {Latitude: -33.856784, Longitude: 151.215297}}
+	decoded := decodePolyline(encodePolyline(precise, polyline6Precision), polyline6Precision)
+	for i, point := range precise {
+		if math.Abs(decoded[i][0]-point.Latitude) > 1e-9 || math.Abs(decoded[i][1]-point.Longitude) > 1e-9 {
+			t.Errorf("Point %d: Expected %v, got %v", i, point, decoded[i])
+		}
+	}
+}
+
 // Add new tests for route generation and manipulation
 func TestGenerateSuggestedRoutes(t *testing.T) {
 	// We need to set up some test data first
-	// Create a test route to populate the routes slice
+	// Create a test route to suggest routes around
 	testRoute := RouteData{
 		Filename: "test.gpx",
 		TrackPoints: []TrackPoint{
@@ -169,20 +205,10 @@ func TestGenerateSuggestedRoutes(t *testing.T) {
 		Distance: 5.0,
 	}
 
-	// Add the test route to the routes slice
-	routesMutex.Lock()
-	// Save the original routes and restore them after the test
-	originalRoutes := routes
-	routes = []RouteData{testRoute}
-	defer func() {
-		routesMutex.Lock()
-		routes = originalRoutes
-		routesMutex.Unlock()
-	}()
-	routesMutex.Unlock()
+	store := withRoutes(t, testRoute)
 
 	// Test case 1: Generate a route with reasonable constraints
-	generatedRoutes, err := generateSuggestedRoutes(1.0, 10.0, false)
+	generatedRoutes, err := generateSuggestedRoutes(context.Background(), osrmRouter{}, store, SuggestOptions{MinDistance: 1.0, MaxDistance: 10.0})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	} else if len(generatedRoutes) == 0 {
@@ -197,7 +223,7 @@ func TestGenerateSuggestedRoutes(t *testing.T) {
 	}
 
 	// Test case 2: Generate a route with very large constraints
-	generatedRoutes, err = generateSuggestedRoutes(1.0, 1000.0, false)
+	generatedRoutes, err = generateSuggestedRoutes(context.Background(), osrmRouter{}, store, SuggestOptions{MinDistance: 1.0, MaxDistance: 1000.0})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	} else if len(generatedRoutes) == 0 {
@@ -205,7 +231,7 @@ func TestGenerateSuggestedRoutes(t *testing.T) {
 	}
 
 	// Test case 3: Generate a route with impossible constraints
-	generatedRoutes, err = generateSuggestedRoutes(1000.0, 2000.0, false)
+	generatedRoutes, err = generateSuggestedRoutes(context.Background(), osrmRouter{}, store, SuggestOptions{MinDistance: 1000.0, MaxDistance: 2000.0})
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	} else if len(generatedRoutes) > 0 {
@@ -265,6 +291,44 @@ func TestExtendRoute(t *testing.T) {
 	}
 }
 
+func TestExtendRouteBoundsZigzags(t *testing.T) {
+	cfg := config
+	cfg.MaxZigzagMeters = 200
+	withConfig(t, cfg)
+
+	// Long segments on the equator, where the old fixed offset in degrees was largest,
+	// and a short one where the zigzag must stay relative to the segment length
+	route := []TrackPoint{
+		{Latitude: 0, Longitude: 10},
+		{Latitude: 0, Longitude: 10.1},
+		{Latitude: 0.1, Longitude: 10.1},
+		{Latitude: 0.1001, Longitude: 10.1001},
+	}
+
+	extended := extendRoute(route, 4)
+	if len(extended) <= len(route) {
+		t.Fatalf("Expected zigzags to be added, got %d points", len(extended))
+	}
+
+	// Every inserted point sits between two original points
+	segment := 0
+	for _, point := range extended[1 : len(extended)-1] {
+		if segment+1 < len(route) && point == route[segment+1] {
+			segment++
+			continue
+		}
+
+		a, b := route[segment], route[segment+1]
+		distance := perpendicularDistance(point, a, b) * 1000
+		if distance > cfg.MaxZigzagMeters+1 {
+			t.Errorf("Zigzag point %v is %.0f m from its segment, more than the %.0f m maximum", point, distance, cfg.MaxZigzagMeters)
+		}
+		if limit := haversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude) * 1000 * zigzagAmplitudeRatio; distance > limit+1 {
+			t.Errorf("Zigzag point %v is %.0f m from its segment, more than %.0f m relative to its length", point, distance, limit)
+		}
+	}
+}
+
 func TestGetRouteFollowingStreets(t *testing.T) {
 	// Skip this test if we're running in a CI environment or without internet
 	if os.Getenv("CI") != "" {
@@ -278,7 +342,7 @@ func TestGetRouteFollowingStreets(t *testing.T) {
 	}
 
 	// Get a route that follows streets
-	streetRoute, err := getRouteFollowingStreets(testRoute)
+	streetRoute, err := getRouteFollowingStreets(context.Background(), testRoute, SuggestOptions{})
 
 	// This test might fail if the OSRM API is down or rate-limited
 	// So we'll just log the error and skip the test in that case
@@ -352,10 +416,441 @@ func TestIsRouteNearExistingRoutes(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		result := isRouteNearExistingRoutes(tc.route, minLat, maxLat, minLng, maxLng)
+		result := isRouteNearExistingRoutes(tc.route, minLat, maxLat, minLng, maxLng, defaultBoundsStrictness)
 
 		if result != tc.expected {
 			t.Errorf("Test case %d: Expected %v, got %v", i, tc.expected, result)
 		}
 	}
 }
+
+// withRoutes returns a route store holding the given routes
+func withRoutes(t *testing.T, testRoutes ...RouteData) *RouteStore {
+	t.Helper()
+	return NewRouteStore(testRoutes...)
+}
+
+// withConfig replaces the global config for the duration of a test
+func withConfig(t *testing.T, cfg Config) {
+	t.Helper()
+
+	originalConfig := config
+	config = cfg
+	t.Cleanup(func() {
+		config = originalConfig
+	})
+}
+
+// withDataDir points the data directory at a fresh temporary directory for the duration of a test
+func withDataDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config
+	cfg.DataDir = dir
+	withConfig(t, cfg)
+
+	// Start with an empty sidecar index for the new directory
+	routeIndexMutex.Lock()
+	originalIndex := routeIndex
+	routeIndex = map[string]routeMeta{}
+	routeIndexMutex.Unlock()
+	t.Cleanup(func() {
+		routeIndexMutex.Lock()
+		routeIndex = originalIndex
+		routeIndexMutex.Unlock()
+	})
+
+	return dir
+}
+
+// buildTestGPX creates a single-segment GPX document with the given points
+func buildTestGPX(points []TrackPoint) *gpx.GPX {
+	segment := gpx.GPXTrackSegment{}
+	for _, p := range points {
+		segment.Points = append(segment.Points, gpx.GPXPoint{
+			Point: gpx.Point{Latitude: p.Latitude, Longitude: p.Longitude},
+		})
+	}
+
+	return &gpx.GPX{
+		Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}},
+	}
+}
+
+// writeTestGPX writes a single-segment GPX file with the given points to the data directory
+func writeTestGPX(t *testing.T, filename string, points []TrackPoint) *gpx.GPX {
+	t.Helper()
+
+	gpxData := buildTestGPX(points)
+	if err := writeGPX(filename, gpxData); err != nil {
+		t.Fatalf("Unable to write test GPX: %v", err)
+	}
+
+	return gpxData
+}
+
+// testGPXBytes serializes a GPX document for use as upload content
+func testGPXBytes(t *testing.T, gpxData *gpx.GPX) []byte {
+	t.Helper()
+
+	xmlBytes, err := gpxData.ToXml(gpx.ToXmlParams{Version: "1.1", Indent: true})
+	if err != nil {
+		t.Fatalf("Unable to serialize test GPX: %v", err)
+	}
+	return xmlBytes
+}
+
+// newUploadRequest builds a multipart upload request with a single file part
+func newUploadRequest(t *testing.T, field, filename string, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatalf("Unable to create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestSuggestionDistanceIsEstimate(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + encodePolyline(coverageTestRoute.TrackPoints, polyline6Precision) +
+			`","distance":1200,"duration":900}]}`))
+	})
+
+	testCases := []struct {
+		name     string
+		opts     SuggestOptions
+		streets  bool
+		estimate bool
+	}{
+		{"street route", SuggestOptions{FollowStreets: true}, true, false},
+		{"straight lines", SuggestOptions{FollowStreets: false}, false, true},
+		{"scaled street route", SuggestOptions{FollowStreets: true, MaxDistance: 0.5}, true, true},
+	}
+
+	for _, tc := range testCases {
+		suggested, err := generateSuggestedRoutes(context.Background(), osrmRouter{}, store, tc.opts)
+		if err != nil || len(suggested) != 1 {
+			t.Fatalf("%s: Expected one suggestion, got %v, %v", tc.name, suggested, err)
+		}
+
+		if suggested[0].FollowsStreets != tc.streets {
+			t.Errorf("%s: Expected followsStreets %t, got %t", tc.name, tc.streets, suggested[0].FollowsStreets)
+		}
+		if suggested[0].DistanceIsEstimate != tc.estimate {
+			t.Errorf("%s: Expected distanceIsEstimate %t, got %t", tc.name, tc.estimate, suggested[0].DistanceIsEstimate)
+		}
+	}
+}
+
+func TestUploadAcceptsAlternateFieldNames(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	for i, field := range []string{"file", "gpx", "upload"} {
+		// Distinct content each time, identical uploads are turned down
+		content := testGPXBytes(t, buildTestGPX(jitteryLine(10+i)))
+		filename := field + ".gpx"
+		rec := httptest.NewRecorder()
+		uploadHandler(store)(rec, newUploadRequest(t, field, filename, content))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Field %q: Expected status 200, got %d: %s", field, rec.Code, rec.Body.String())
+			continue
+		}
+		if _, ok := store.GetByFilename(filename); !ok {
+			t.Errorf("Field %q: Expected %s to be stored", field, filename)
+		}
+	}
+
+	// Without a GPX-looking part the error names the expected field
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "attachment", "notes.txt", []byte("hello")))
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(body["error"], `"gpxfile"`) {
+		t.Errorf("Expected a 400 naming the gpxfile field, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// uploadRoute uploads a GPX file and returns the decoded response
+func uploadRoute(t *testing.T, store *RouteStore, filename string, points []TrackPoint) map[string]string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", filename, testGPXBytes(t, buildTestGPX(points))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestUploadReturnsStableRouteID(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	first := uploadRoute(t, store, "walk.gpx", coverageTestRoute.TrackPoints)
+	if first["id"] == "" || first["filename"] != "walk.gpx" {
+		t.Fatalf("Expected an ID and the filename, got %v", first)
+	}
+
+	// The same content under the same name is turned down, pointing to the stored route
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "walk.gpx", testGPXBytes(t, buildTestGPX(coverageTestRoute.TrackPoints))))
+	var again map[string]string
+	json.NewDecoder(rec.Body).Decode(&again)
+	if rec.Code != http.StatusConflict || again["id"] != first["id"] {
+		t.Errorf("Expected a 409 with ID %s for the same file, got %d with %v", first["id"], rec.Code, again)
+	}
+
+	// Different content under the same name gets a new ID
+	changed := uploadRoute(t, store, "walk.gpx", jitteryLine(10))
+	if changed["id"] == first["id"] {
+		t.Errorf("Expected a different ID for different content, got %s again", changed["id"])
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+	rec = httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+
+	var page RoutesPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	listed := page.Items
+	if len(listed) != 1 || listed[0].ID != changed["id"] {
+		t.Errorf("Expected /routes to list ID %s, got %+v", changed["id"], listed)
+	}
+}
+
+func TestBoundsStrictnessAcceptsExploratoryRoutes(t *testing.T) {
+	// OSRM answers with a route far away from the existing ones
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	suggest := func(query string) SuggestedRoute {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true"+query, nil)
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var suggested []SuggestedRoute
+		if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) == 0 {
+			t.Fatalf("Unable to decode suggestions: %v", err)
+		}
+		return suggested[0]
+	}
+
+	if route := suggest(""); route.FollowsStreets {
+		t.Error("Expected the default strictness to reject the far away street route")
+	}
+	if route := suggest("&boundsStrictness=0"); !route.FollowsStreets {
+		t.Error("Expected boundsStrictness=0 to accept the far away street route")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/suggest?boundsStrictness=1.5", nil)
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for boundsStrictness above 1, got %d", rec.Code)
+	}
+}
+
+func TestUploadRejectsGPXWithoutTrackPoints(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	waypointsOnly := &gpx.GPX{Waypoints: []gpx.GPXPoint{
+		{Point: gpx.Point{Latitude: 52.52, Longitude: 13.40}},
+	}}
+
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "waypoints.gpx", testGPXBytes(t, waypointsOnly)))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "no track or route points") {
+		t.Errorf("Expected the error to explain what's missing, got %q", rec.Body.String())
+	}
+	if stored := store.All(); len(stored) != 0 {
+		t.Errorf("Expected no route to be stored, got %d", len(stored))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "waypoints.gpx")); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected file to be removed, got %v", err)
+	}
+}
+
+func TestProcessGPXDataFallsBackToRoutePoints(t *testing.T) {
+	planned := &gpx.GPX{Routes: []gpx.GPXRoute{{Type: "Hiking"}}}
+	for _, p := range coverageTestRoute.TrackPoints {
+		planned.Routes[0].Points = append(planned.Routes[0].Points, gpx.GPXPoint{
+			Point: gpx.Point{Latitude: p.Latitude, Longitude: p.Longitude},
+		})
+	}
+
+	parsed, err := processGPXData("planned.gpx", planned)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	streamed, err := streamGPXRoute("planned.gpx", bytes.NewReader(testGPXBytes(t, planned)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+
+	want := calculateRouteDistance(coverageTestRoute.TrackPoints)
+	for name, route := range map[string]RouteData{"parsed": parsed, "streamed": streamed} {
+		if len(route.TrackPoints) != len(coverageTestRoute.TrackPoints) || math.Abs(route.Distance-want) > 1e-9 {
+			t.Errorf("%s: Expected %d points over %.3f km, got %d over %.3f km",
+				name, len(coverageTestRoute.TrackPoints), want, len(route.TrackPoints), route.Distance)
+		}
+		if route.ActivityType != "hiking" {
+			t.Errorf("%s: Expected the route type to be used, got %q", name, route.ActivityType)
+		}
+	}
+
+	// Tracks take precedence over routes
+	withTrack := buildTestGPX(jitteryLine(5))
+	withTrack.Routes = planned.Routes
+	if route, _ := processGPXData("both.gpx", withTrack); len(route.TrackPoints) != 5 {
+		t.Errorf("Expected the 5 track points to be used, got %d points", len(route.TrackPoints))
+	}
+
+	if _, err := streamGPXRoute("empty.gpx", bytes.NewReader(testGPXBytes(t, &gpx.GPX{}))); !errors.Is(err, errNoTrackPoints) {
+		t.Errorf("Expected errNoTrackPoints from the streaming parser, got %v", err)
+	}
+}
+
+func TestUploadRejectsDuplicateContent(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	content := testGPXBytes(t, buildTestGPX(coverageTestRoute.TrackPoints))
+	first := uploadRoute(t, store, "walk.gpx", coverageTestRoute.TrackPoints)
+
+	// Compressing the file or renaming it doesn't make it a different walk
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(content)
+	gz.Close()
+
+	uploadDuplicate := func(store *RouteStore) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "copy.gpx.gz", compressed.Bytes()))
+		var resp map[string]string
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusConflict || resp["id"] != first["id"] || resp["filename"] != "walk.gpx" {
+			t.Errorf("Expected a 409 pointing to walk.gpx, got %d with %v", rec.Code, resp)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "copy.gpx")); !os.IsNotExist(err) {
+			t.Errorf("Expected the duplicate not to be stored, got %v", err)
+		}
+	}
+	uploadDuplicate(store)
+
+	// The hash is kept in the index, so duplicates are noticed after a restart too
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload the route index: %v", err)
+	}
+	restarted := NewRouteStore(loadExistingGPXFiles()...)
+	if route, ok := restarted.GetByFilename("walk.gpx"); !ok || route.ContentHash == "" {
+		t.Fatalf("Expected walk.gpx to be reloaded with its hash, got %+v", route)
+	}
+	uploadDuplicate(restarted)
+}
+
+func TestUploadRejectsLargeFiles(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+	cfg := config
+	cfg.MaxUploadSize = 4 << 10
+	withConfig(t, cfg)
+
+	content := testGPXBytes(t, buildTestGPX(jitteryLine(100)))
+	if len(content) <= 4<<10 {
+		t.Fatalf("Expected the test file to exceed the limit, got %d bytes", len(content))
+	}
+
+	// A declared length is turned down before reading the body, an undeclared one once
+	// the limit is passed
+	for _, declared := range []bool{true, false} {
+		req := newUploadRequest(t, "gpxfile", "large.gpx", content)
+		if !declared {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		uploadHandler(store)(rec, req)
+
+		var resp map[string]string
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.HasPrefix(resp["error"], "Uploads are limited to") {
+			t.Errorf("Declared length %t: Expected a 413 naming the limit, got %d with %v", declared, rec.Code, resp)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "large.gpx")); !os.IsNotExist(err) {
+		t.Errorf("Expected the large file not to be stored, got %v", err)
+	}
+
+	// Smaller files are still accepted
+	uploadRoute(t, store, "small.gpx", jitteryLine(5))
+}
+
+func TestUploadAcceptsGzippedGPX(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(testGPXBytes(t, buildTestGPX(coverageTestRoute.TrackPoints)))
+	gz.Close()
+
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "walk.gpx.gz", compressed.Bytes()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The file is stored decompressed under its .gpx name
+	stored, err := os.ReadFile(filepath.Join(dir, "walk.gpx"))
+	if err != nil || !bytes.HasPrefix(stored, []byte("<?xml")) {
+		t.Fatalf("Expected walk.gpx to be stored decompressed, got %v", err)
+	}
+	route, ok := store.GetByFilename("walk.gpx")
+	if !ok || len(route.TrackPoints) != len(coverageTestRoute.TrackPoints) {
+		t.Errorf("Expected the route to be loaded from walk.gpx, got %+v", store.All())
+	}
+
+	// Truncated archives are rejected without leaving a file behind
+	rec = httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "broken.gpx.gz", compressed.Bytes()[:compressed.Len()/2]))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a truncated archive, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.gpx")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file for the truncated archive, got %v", err)
+	}
+}
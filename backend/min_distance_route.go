@@ -1,164 +1,138 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"math"
 )
 
-// generateRouteWithMinDistance creates a route that follows streets and meets the minimum distance requirement
-func generateRouteWithMinDistance(minDistance float64) ([]SuggestedRoute, error) {
-	// Lock the routes mutex to safely access the routes
-	routesMutex.RLock()
-	defer routesMutex.RUnlock()
+// Limits on the attempts made by generateRouteWithMinDistance
+const (
+	maxMinDistanceAttempts = 4
+	maxMinDistanceOffset   = 0.5 // degrees, roughly 55 km
+)
 
-	// Find the bounding box of all existing routes
-	var minLat, maxLat, minLng, maxLng float64
-	hasPoints := false
-
-	// Iterate through all routes and their points
-	for _, route := range routes {
-		for _, point := range route.TrackPoints {
-			// Initialize min/max on first point
-			if !hasPoints {
-				minLat, maxLat = point.Latitude, point.Latitude
-				minLng, maxLng = point.Longitude, point.Longitude
-				hasPoints = true
-				continue
-			}
-
-			// Update min/max values
-			if point.Latitude < minLat {
-				minLat = point.Latitude
-			} else if point.Latitude > maxLat {
-				maxLat = point.Latitude
-			}
-
-			if point.Longitude < minLng {
-				minLng = point.Longitude
-			} else if point.Longitude > maxLng {
-				maxLng = point.Longitude
-			}
-		}
+// generateRouteWithMinDistance creates a route that follows streets, as routed by the router,
+// and meets the minimum distance requirement
+func generateRouteWithMinDistance(ctx context.Context, router Router, store *RouteStore, opts SuggestOptions) ([]SuggestedRoute, error) {
+	minDistance := opts.MinDistance
+	if err := validateDistanceConstraints(opts); err != nil {
+		return nil, err
 	}
 
+	// Find the bounding box of all existing routes
+	box := store.BoundingBox()
+	minLat, maxLat, minLng, maxLng := box.minLat, box.maxLat, box.minLng, box.maxLng
+
 	// Calculate the center of the existing routes
 	centerLat := (minLat + maxLat) / 2
 	centerLng := (minLng + maxLng) / 2
+	routesCenter := TrackPoint{Latitude: centerLat, Longitude: centerLng}
 
 	// If we don't have enough existing routes, use a default location
-	if minLat == 0 && maxLat == 0 {
+	if !box.hasPoints {
 		// Use a default location (Berlin, Germany)
 		centerLat = 52.52
 		centerLng = 13.405
+		routesCenter = TrackPoint{Latitude: centerLat, Longitude: centerLng}
+	} else if opts.CoverageBias {
+		// Move the center towards the least explored part of the coverage grid
+		grid, err := store.coverageGrid(opts.CellSize, opts.GridPadding)
+		if err != nil {
+			return nil, err
+		}
+		seedMinLat, seedMaxLat, seedMinLng, seedMaxLng := coverageBiasedBox(grid, minLat, maxLat, minLng, maxLng)
+		centerLat = (seedMinLat + seedMaxLat) / 2
+		centerLng = (seedMinLng + seedMaxLng) / 2
 	}
 
-	log.Printf("Using center point: [%f, %f] to generate route with min distance %f km",
-		centerLat, centerLng, minDistance)
+	slog.DebugContext(ctx, "Generating a route around the center", "lat", centerLat, "lng", centerLng,
+		"minDistance", minDistance)
 
-	// Create a simple route with just two points far enough apart
 	// Estimate how far we need to go to get the desired distance
 	// 1 degree is roughly 111 km, so we calculate an appropriate offset
 	offset := math.Sqrt(minDistance/2.0) / 111.0 // Convert km to degrees
 
-	// Create a simple route with just two points
-	simplePoints := []TrackPoint{
-		{Latitude: centerLat - offset, Longitude: centerLng - offset},
-		{Latitude: centerLat + offset, Longitude: centerLng + offset},
-	}
-
-	// Try to get a street route with these points
-	log.Printf("Trying to get a street route with 2 points and offset %f", offset)
-	streetRoute, err := getRouteFollowingStreets(simplePoints)
-
-	// If successful and meets the minimum distance
-	if err == nil && streetRoute.Distance >= minDistance {
-		// Success!
-		log.Printf("Created street route with distance: %f km", streetRoute.Distance)
-		return []SuggestedRoute{streetRoute}, nil
-	}
+	// Keep doubling the offset until the street route is long enough,
+	// remembering the longest street route in case none is
+	var longest SuggestedRoute
+	hasStreetRoute := false
+	// Seed points are either a diagonal across the center or, with a preferred bearing,
+	// a loop heading out that way. Both are kept within the maximum radius, if any.
+	seedPoints := func(offset float64) []TrackPoint {
+		var points []TrackPoint
+		if opts.PreferredBearing != nil {
+			center := TrackPoint{Latitude: centerLat, Longitude: centerLng}
+			points = bearingLoop(center, *opts.PreferredBearing, 3*offset*111.0)
+		} else {
+			center := TrackPoint{Latitude: centerLat, Longitude: centerLng}
+			points = variantPoints(diagonalPoints(centerLat, centerLng, offset), center, opts.Variant)
+		}
 
-	// If that didn't work, try with a larger offset
-	log.Printf("First attempt failed, trying with a larger offset")
-	offset *= 2.0
-	simplePoints = []TrackPoint{
-		{Latitude: centerLat - offset, Longitude: centerLng - offset},
-		{Latitude: centerLat + offset, Longitude: centerLng + offset},
+		if opts.MaxRadiusKm > 0 {
+			points = clampToRadius(points, routesCenter, opts.MaxRadiusKm)
+		}
+		return points
 	}
 
-	// Try again with the larger offset
-	log.Printf("Trying with offset %f", offset)
-	streetRoute, err = getRouteFollowingStreets(simplePoints)
+	points := seedPoints(offset)
+	reason := "OSRM could not find a street route"
+	var lastErr error
+	for attempt := 1; attempt <= maxMinDistanceAttempts && offset <= maxMinDistanceOffset; attempt++ {
+		slog.DebugContext(ctx, "Trying a street route", "attempt", attempt, "offset", offset)
+		points = seedPoints(offset)
+		streetRoute, err := router.Route(ctx, points, opts)
+		if err != nil {
+			lastErr = err
+		}
+		if errors.Is(err, errOSRMUnavailable) {
+			// Further attempts would fail the same way
+			reason = err.Error()
+			break
+		} else if err != nil {
+			slog.DebugContext(ctx, "Street route attempt failed", "attempt", attempt, "error", err)
+		} else if streetRoute.Distance >= minDistance {
+			slog.DebugContext(ctx, "Created a street route", "distance", streetRoute.Distance)
+			return []SuggestedRoute{streetRoute}, nil
+		} else if !hasStreetRoute || streetRoute.Distance > longest.Distance {
+			longest = streetRoute
+			hasStreetRoute = true
+		}
 
-	// If successful and meets the minimum distance
-	if err == nil && streetRoute.Distance >= minDistance {
-		// Success!
-		log.Printf("Created street route with larger offset: %f km", streetRoute.Distance)
-		return []SuggestedRoute{streetRoute}, nil
+		offset *= 2.0
 	}
 
-	// If that didn't work, try with a polygon
-	log.Printf("Simple route attempts failed, trying with a polygon")
-
-	// Create a polygon around the center point
-	numPoints := 4 // Use a square
-	var polygonPoints []TrackPoint
-
-	// Create the polygon
-	for i := 0; i < numPoints; i++ {
-		angle := 2.0 * math.Pi * float64(i) / float64(numPoints)
-		polygonPoints = append(polygonPoints, TrackPoint{
-			Latitude:  centerLat + offset*math.Sin(angle),
-			Longitude: centerLng + offset*math.Cos(angle),
-		})
+	// Use the longest street route we got, but say that it's too short
+	if hasStreetRoute {
+		slog.InfoContext(ctx, "No street route reached the minimum distance, returning the longest one",
+			"minDistance", minDistance, "distance", longest.Distance)
+		longest.Reason = fmt.Sprintf("no street route reached the minimum distance of %.2f km", minDistance)
+		longest.addNote(noteShorterThanMinimum)
+		return []SuggestedRoute{longest}, nil
 	}
 
-	// Close the loop
-	polygonPoints = append(polygonPoints, polygonPoints[0])
-
-	// Try to get a street route with the polygon
-	log.Printf("Trying with a polygon of %d points", len(polygonPoints))
-	streetRoute, err = getRouteFollowingStreets(polygonPoints)
-
-	// If successful and meets the minimum distance
-	if err == nil && streetRoute.Distance >= minDistance {
-		// Success!
-		log.Printf("Created street route with polygon: %f km", streetRoute.Distance)
-		return []SuggestedRoute{streetRoute}, nil
+	// If everything fails, return a straight line that doesn't follow streets
+	slog.InfoContext(ctx, "All street routes failed, returning a route that doesn't follow streets")
+	simpleRoute := SuggestedRoute{
+		Points:             points,
+		Distance:           calculateRouteDistance(points),
+		FollowsStreets:     false,
+		DistanceIsEstimate: true,
+		Reason:             reason,
+	}
+	if lastErr != nil {
+		simpleRoute.addNote(streetRoutingNote(lastErr))
 	}
 
-	// If all else fails, fall back to a simple approach
-	log.Printf("All specialized attempts failed, falling back to simple approach")
+	return []SuggestedRoute{simpleRoute}, nil
+}
 
-	// Create a simple route with a large offset
-	offset = math.Sqrt(minDistance) * 2 / 111.0 // Use a much larger offset
-	simplePoints = []TrackPoint{
+// diagonalPoints returns two points offset degrees south-west and north-east of the center
+func diagonalPoints(centerLat, centerLng, offset float64) []TrackPoint {
+	return []TrackPoint{
 		{Latitude: centerLat - offset, Longitude: centerLng - offset},
 		{Latitude: centerLat + offset, Longitude: centerLng + offset},
 	}
-
-	// Try with the simple route one last time
-	log.Printf("Trying with a simple 2-point route with very large offset: %f", offset)
-	streetRoute, err = getRouteFollowingStreets(simplePoints)
-
-	if err == nil {
-		// Use whatever we got, even if it doesn't meet the minimum distance
-		log.Printf("Created street route with very large offset: %f km", streetRoute.Distance)
-		return []SuggestedRoute{streetRoute}, nil
-	}
-
-	// If everything fails, return a simple route that doesn't follow streets
-	log.Printf("All attempts failed, returning a simple route that doesn't follow streets")
-	simpleRoute := SuggestedRoute{
-		Points: []TrackPoint{
-			{Latitude: centerLat - offset, Longitude: centerLng - offset},
-			{Latitude: centerLat + offset, Longitude: centerLng + offset},
-		},
-		Distance: calculateRouteDistance([]TrackPoint{
-			{Latitude: centerLat - offset, Longitude: centerLng - offset},
-			{Latitude: centerLat + offset, Longitude: centerLng + offset},
-		}),
-		FollowsStreets: false,
-	}
-
-	return []SuggestedRoute{simpleRoute}, nil
 }
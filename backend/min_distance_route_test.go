@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestGenerateRouteWithMinDistanceGivesUp(t *testing.T) {
+	store := withRoutes(t)
+
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"NoRoute","message":"Impossible route between points"}`))
+	})
+
+	suggested, err := generateRouteWithMinDistance(context.Background(), osrmRouter{}, store, SuggestOptions{MinDistance: 5, FollowStreets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if requests != maxMinDistanceAttempts {
+		t.Errorf("Expected %d OSRM requests, got %d", maxMinDistanceAttempts, requests)
+	}
+	if len(suggested) != 1 {
+		t.Fatalf("Expected 1 fallback route, got %d", len(suggested))
+	}
+	if suggested[0].FollowsStreets {
+		t.Error("The fallback route must not claim to follow streets")
+	}
+	if suggested[0].Reason == "" {
+		t.Error("Expected the fallback route to explain why it was returned")
+	}
+}
+
+func TestGenerateRouteWithMinDistanceSucceeds(t *testing.T) {
+	store := withRoutes(t)
+
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":900000,"duration":600}]}`))
+	})
+
+	suggested, err := generateRouteWithMinDistance(context.Background(), osrmRouter{}, store, SuggestOptions{MinDistance: 5, FollowStreets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected a single OSRM request, got %d", requests)
+	}
+	if len(suggested) != 1 || !suggested[0].FollowsStreets || suggested[0].Reason != "" {
+		t.Errorf("Expected a plain street route, got %+v", suggested)
+	}
+}
+
+func TestGenerateRouteWithMinDistanceKeepsLongestRoute(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	router, calls := stubRouter(1.0, 3.0, -1, 2.0)
+
+	suggested, err := generateRouteWithMinDistance(context.Background(), router, store, SuggestOptions{MinDistance: 5, FollowStreets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(*calls) != maxMinDistanceAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxMinDistanceAttempts, len(*calls))
+	}
+	if len(suggested) != 1 || suggested[0].Distance != 3.0 || suggested[0].Reason == "" {
+		t.Errorf("Expected the longest street route with a reason, got %+v", suggested)
+	}
+}
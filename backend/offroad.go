@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	// maxMatchPoints is the number of points sent to the OSRM match service
+	maxMatchPoints = 100
+
+	// minMatchedFraction is the share of points that must snap to a road for a track to count as on-road
+	minMatchedFraction = 0.5
+
+	// minMatchConfidence is the average matching confidence below which a track counts as off-road
+	minMatchConfidence = 0.2
+)
+
+// OSRMMatchResponse represents the response from the OSRM match service
+type OSRMMatchResponse struct {
+	Code      string `json:"code"`
+	Matchings []struct {
+		Confidence float64 `json:"confidence"`
+	} `json:"matchings"`
+	// Tracepoints are null for input points that could not be matched
+	Tracepoints []*struct {
+		MatchingsIndex int `json:"matchings_index"`
+	} `json:"tracepoints"`
+}
+
+// checkOffRoad map-matches a track against the road network and reports whether
+// matching failed broadly, e.g. for boat trips, flights or tracks with bad GPS. The
+// request goes through the circuit breaker and is retried like route requests.
+func checkOffRoad(ctx context.Context, points []TrackPoint) (bool, error) {
+	if len(points) < 2 {
+		return false, nil
+	}
+
+	points, err := fitWaypointsToURL(samplePoints(points, maxMatchPoints), func(points []TrackPoint) int {
+		return len(osrmMatchURL(points))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	matchResp, err := callOSRM(ctx, func(ctx context.Context) (OSRMMatchResponse, error) {
+		body, err := getOSRM(ctx, osrmMatchURL(points))
+		if err != nil {
+			return OSRMMatchResponse{}, err
+		}
+		var matchResp OSRMMatchResponse
+		return matchResp, json.Unmarshal(body, &matchResp)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch matchResp.Code {
+	case "Ok":
+	case "NoMatch", "NoSegment":
+		// None of the points could be matched to a road
+		return true, nil
+	default:
+		return false, fmt.Errorf("OSRM match service returned %q", matchResp.Code)
+	}
+
+	matched := 0
+	for _, tracepoint := range matchResp.Tracepoints {
+		if tracepoint != nil {
+			matched++
+		}
+	}
+	matchedFraction := float64(matched) / float64(len(points))
+
+	confidence := 0.0
+	for _, matching := range matchResp.Matchings {
+		confidence += matching.Confidence
+	}
+	if len(matchResp.Matchings) > 0 {
+		confidence /= float64(len(matchResp.Matchings))
+	}
+
+	slog.DebugContext(ctx, "Matched a route to the road network", "percent", matchedFraction*100, "confidence", confidence)
+
+	return matchedFraction < minMatchedFraction || confidence < minMatchConfidence, nil
+}
+
+// osrmMatchURL returns the request to the OSRM match service for the points
+func osrmMatchURL(points []TrackPoint) string {
+	return fmt.Sprintf("%s/match/v1/%s/%s?overview=false", config.OSRMServer, profileWalking, coordinatesParam(points))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lakeTrack crosses the middle of the Müggelsee, far from any road
+var lakeTrack = []TrackPoint{
+	{Latitude: 52.4380, Longitude: 13.6300},
+	{Latitude: 52.4400, Longitude: 13.6400},
+	{Latitude: 52.4420, Longitude: 13.6500},
+	{Latitude: 52.4440, Longitude: 13.6600},
+}
+
+func TestUploadFlagsOffRoadTrack(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/match/") {
+			t.Errorf("Unexpected OSRM request: %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"NoMatch","message":"Could not match the trace."}`))
+	})
+
+	cfg := config
+	cfg.OffRoadCheck = true
+	withConfig(t, cfg)
+
+	req := newUploadRequest(t, "gpxfile", "lake.gpx", testGPXBytes(t, buildTestGPX(lakeTrack)))
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if route, ok := store.GetByFilename("lake.gpx"); !ok || !route.OffRoad {
+		t.Errorf("Expected the lake track to be flagged as off-road, got %+v", store.All())
+	}
+
+	// The flag is kept in the index, so it survives the sidecar being recomputed
+	if err := persister.Delete("lake.gpx"); err != nil {
+		t.Fatalf("Unable to remove the sidecar: %v", err)
+	}
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload the route index: %v", err)
+	}
+	restarted := NewRouteStore(loadExistingGPXFiles()...)
+	if route, ok := restarted.GetByFilename("lake.gpx"); !ok || !route.OffRoad {
+		t.Errorf("Expected the lake track to stay flagged after a restart, got %+v", route)
+	}
+}
+
+func TestCheckOffRoad(t *testing.T) {
+	testCases := []struct {
+		response string
+		expected bool
+	}{
+		// Every point matched with high confidence
+		{`{"code":"Ok","matchings":[{"confidence":0.9}],"tracepoints":[{},{},{},{}]}`, false},
+		// Only one of four points matched
+		{`{"code":"Ok","matchings":[{"confidence":0.9}],"tracepoints":[{},null,null,null]}`, true},
+		// Matched, but with very low confidence
+		{`{"code":"Ok","matchings":[{"confidence":0.05}],"tracepoints":[{},{},{},{}]}`, true},
+		{`{"code":"NoMatch"}`, true},
+	}
+
+	for i, tc := range testCases {
+		withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tc.response))
+		})
+
+		offRoad, err := checkOffRoad(context.Background(), lakeTrack)
+		if err != nil {
+			t.Errorf("Test case %d: Unexpected error: %v", i, err)
+		}
+		if offRoad != tc.expected {
+			t.Errorf("Test case %d: Expected offRoad=%t, got %t", i, tc.expected, offRoad)
+		}
+	}
+}
+
+func TestUploadSkipsOffRoadCheckByDefault(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("OSRM must not be called when the off-road check is disabled")
+	})
+
+	req := newUploadRequest(t, "gpxfile", "lake.gpx", testGPXBytes(t, buildTestGPX(lakeTrack)))
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if route, _ := store.GetByFilename("lake.gpx"); route.OffRoad {
+		t.Errorf("Expected route not to be flagged without the check")
+	}
+}
+
+func TestCheckOffRoadGoesThroughRetriesAndBreaker(t *testing.T) {
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":"NoMatch"}`))
+	})
+
+	// A transient failure is retried
+	if offRoad, err := checkOffRoad(context.Background(), lakeTrack); err != nil || !offRoad || requests != 2 {
+		t.Fatalf("Expected the retry to flag the track, got %t, %v after %d requests", offRoad, err, requests)
+	}
+
+	// An open breaker fails fast
+	cfg := config
+	cfg.OSRMBreakerThreshold = 1
+	cfg.OSRMAttempts = 1
+	withConfig(t, cfg)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	checkOffRoad(context.Background(), lakeTrack)
+	if _, err := checkOffRoad(context.Background(), lakeTrack); !errors.Is(err, errOSRMUnavailable) {
+		t.Errorf("Expected errOSRMUnavailable while the breaker is open, got %v", err)
+	}
+}
+
+func TestCheckOffRoadFitsURL(t *testing.T) {
+	var paths []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.String())
+		w.Write([]byte(`{"code":"NoMatch"}`))
+	})
+	cfg := config
+	cfg.MaxOSRMURLLength = 600
+	withConfig(t, cfg)
+
+	if _, err := checkOffRoad(context.Background(), jitteryLine(80)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(paths) != 1 || len(config.OSRMServer)+len(paths[0]) > cfg.MaxOSRMURLLength {
+		t.Errorf("Expected one request within %d characters, got %v", cfg.MaxOSRMURLLength, paths)
+	}
+}
+
+func TestCheckOffRoadStopsWithContext(t *testing.T) {
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := checkOffRoad(ctx, lakeTrack); err == nil {
+		t.Error("Expected an error once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the check to give up with the context, took %s", elapsed)
+	}
+}
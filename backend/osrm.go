@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// snapRadiuses are the progressively larger snapping radiuses (in meters) tried
+// when OSRM cannot snap one of the waypoints to the road network
+var snapRadiuses = []int{100, 500, 2000}
+
+// loopSnapTolerance is the distance in kilometers within which the ends of a decoded
+// geometry are treated as the same point, closing the loop exactly
+const loopSnapTolerance = 0.05
+
+// osrmClient is shared by all OSRM calls so connections are kept alive and reused
+// between requests. OSRM's route service has no batch endpoint, so generating several
+// suggestions still means several requests, but they no longer each pay for a new
+// TCP and TLS handshake. It is rebuilt by main once the configuration is loaded.
+var osrmClient = newOSRMClient()
+
+// newOSRMClient creates the OSRM client using the configured timeout and connection
+// pool settings
+func newOSRMClient() *http.Client {
+	return &http.Client{Timeout: config.OSRMTimeout, Transport: newOSRMTransport()}
+}
+
+// newOSRMTransport returns a transport that keeps enough idle connections to the
+// OSRM server around for concurrent suggestion requests
+func newOSRMTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   config.OSRMDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.MaxIdleConns = 0 // No limit across hosts, OSRM is the only one
+	transport.MaxIdleConnsPerHost = config.OSRMMaxIdleConnsPerHost
+	transport.IdleConnTimeout = config.OSRMIdleConnTimeout
+	return transport
+}
+
+// OSRM routing profiles accepted by /suggest
+const (
+	profileWalking = "walking"
+	profileCycling = "cycling"
+	profileDriving = "driving"
+)
+
+// OSRM services street routes are requested from
+const (
+	osrmServiceRoute = "route" // Visits the waypoints in the given order
+	osrmServiceTrip  = "trip"  // Visits the waypoints in the shortest order, returning to the first
+)
+
+// osrmRouteURL builds the URL of an OSRM request through the given points, using the
+// walking profile unless another is requested. The route service visits the points in
+// order, the trip service solves for the shortest round trip starting at the first one.
+func osrmRouteURL(server, service string, points []TrackPoint, opts SuggestOptions) string {
+	profile := opts.Profile
+	if profile == "" {
+		profile = profileWalking
+	}
+
+	url := fmt.Sprintf("%s/%s/v1/%s/%s?overview=full&geometries=polyline6",
+		server, service, profile, coordinatesParam(points))
+	if service == osrmServiceTrip {
+		url += "&roundtrip=true&source=first"
+	}
+
+	// Excluding road classes only works if the server's profile declares them as
+	// excludable, which the stock foot profile doesn't
+	if opts.PreferFootpaths && config.FootpathExcludeClasses != "" {
+		url += "&exclude=" + config.FootpathExcludeClasses
+	}
+
+	// The snapping option needs OSRM 5.19 or later, older servers reject it
+	if opts.SnapAny {
+		url += "&snapping=any"
+	}
+
+	if opts.Verbose {
+		url += "&steps=true"
+	}
+
+	return url
+}
+
+// buildOSRMRouteURL returns the request to the OSRM service for the waypoints, together with
+// the waypoints actually used after sampling and fitting them into the URL length limit
+func buildOSRMRouteURL(service string, points []TrackPoint, opts SuggestOptions) (string, []TrackPoint, error) {
+	// OSRM API has a limit of 500 waypoints, and fewer make for faster requests
+	points = sampleWaypoints(points, config.OSRMMaxWaypoints)
+
+	// Drop further waypoints if the URL would exceed the server's limit,
+	// leaving room for the longest radiuses parameter of the retries
+	points, err := fitWaypointsToURL(points, func(points []TrackPoint) int {
+		return len(osrmRouteURL(config.OSRMServer, service, points, opts)) +
+			len("&radiuses=") + len(radiusesParam(len(points), snapRadiuses[len(snapRadiuses)-1]))
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return osrmRouteURL(config.OSRMServer, service, points, opts), points, nil
+}
+
+// parseStreetOptions reads the query parameters that control how OSRM routes along streets
+func parseStreetOptions(query url.Values, opts *SuggestOptions) error {
+	opts.PreferFootpaths = query.Get("preferFootpaths") == "true"
+	opts.Verbose = query.Get("verbose") == "true"
+
+	switch profile := query.Get("profile"); profile {
+	case "":
+		opts.Profile = profileWalking
+	case profileWalking, profileCycling, profileDriving:
+		opts.Profile = profile
+	default:
+		return errors.New("profile must be walking, cycling or driving")
+	}
+
+	switch query.Get("snapping") {
+	case "", "default":
+		opts.SnapAny = false
+	case "any":
+		opts.SnapAny = true
+	default:
+		return errors.New("snapping must be default or any")
+	}
+
+	return nil
+}
+
+// fitWaypointsToURL thins out the waypoints until the request URL, whose length is
+// computed by urlLength, fits within the configured maximum. The first and last
+// points are always kept.
+func fitWaypointsToURL(points []TrackPoint, urlLength func([]TrackPoint) int) ([]TrackPoint, error) {
+	if config.MaxOSRMURLLength <= 0 {
+		return points, nil
+	}
+
+	for urlLength(points) > config.MaxOSRMURLLength {
+		if len(points) <= 2 {
+			return nil, fmt.Errorf("OSRM request URL exceeds the maximum length of %d even with 2 waypoints",
+				config.MaxOSRMURLLength)
+		}
+
+		// Shrink by a quarter at a time so we don't drop more points than needed
+		count := len(points) * 3 / 4
+		if count < 2 {
+			count = 2
+		}
+		slog.Debug("OSRM request URL too long, reducing the waypoints", "waypoints", len(points), "count", count)
+		points = evenlySpacedPoints(points, count)
+	}
+
+	return points, nil
+}
+
+// evenlySpacedPoints picks count points spread evenly along the track, including both ends
+func evenlySpacedPoints(points []TrackPoint, count int) []TrackPoint {
+	if count >= len(points) {
+		return points
+	}
+	if count < 2 {
+		count = 2
+	}
+
+	selected := make([]TrackPoint, count)
+	for i := range selected {
+		selected[i] = points[i*(len(points)-1)/(count-1)]
+	}
+	return selected
+}
+
+// requestOSRMRoute performs a request against the OSRM route service and parses the response.
+// Transient failures are retried; the circuit breaker only sees the final outcome.
+func requestOSRMRoute(ctx context.Context, url string) (OSRMResponse, error) {
+	return callOSRM(ctx, func(ctx context.Context) (OSRMResponse, error) {
+		return doOSRMRequest(ctx, url)
+	})
+}
+
+// callOSRM sends a request to any OSRM service through the circuit breaker, retrying
+// transient failures. Only the final outcome is recorded by the breaker.
+func callOSRM[T any](ctx context.Context, request func(ctx context.Context) (T, error)) (T, error) {
+	// Fail fast while OSRM keeps failing
+	if err := osrmBreaker.allow(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	resp, err := withOSRMRetries(ctx, request)
+	osrmBreaker.record(err)
+	return resp, err
+}
+
+// doOSRMRequest sends a route request to OSRM once and decodes the response
+func doOSRMRequest(ctx context.Context, url string) (OSRMResponse, error) {
+	body, err := getOSRM(ctx, url)
+	if err != nil {
+		return OSRMResponse{}, err
+	}
+
+	osrmResp, err := decodeOSRMResponse(body)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to parse the OSRM response", "error", err)
+		return OSRMResponse{}, err
+	}
+
+	if osrmResp.Code == "Ok" {
+		slog.DebugContext(ctx, "OSRM reported a distance", "distance", osrmResp.Routes[0].Distance/1000.0)
+	}
+
+	return osrmResp, nil
+}
+
+// getOSRM sends a request to an OSRM service once and returns the response body.
+// Transient statuses are returned as an *osrmStatusError.
+func getOSRM(ctx context.Context, url string) ([]byte, error) {
+	slog.DebugContext(ctx, "Requesting OSRM", "url", url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := osrmClient.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "OSRM request failed", "error", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// OSRM reports errors such as NoRoute with a JSON body, overload and outages without one
+	if transientOSRMStatus(resp.StatusCode) {
+		statusErr := &osrmStatusError{status: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			statusErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, statusErr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to read the OSRM response", "error", err)
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "OSRM response", "body", string(body))
+	return body, nil
+}
+
+// decodeOSRMResponse parses an OSRM route response and validates its shape.
+// Responses with a non-Ok code are returned as-is so callers can react to the code;
+// Ok responses are guaranteed to contain at least one route with a geometry.
+func decodeOSRMResponse(body []byte) (OSRMResponse, error) {
+	var osrmResp OSRMResponse
+	if err := json.Unmarshal(body, &osrmResp); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return OSRMResponse{}, fmt.Errorf("unexpected %s value for %q in OSRM response", typeErr.Value, typeErr.Field)
+		}
+		return OSRMResponse{}, fmt.Errorf("malformed or truncated OSRM response: %w", err)
+	}
+
+	if osrmResp.Code == "" {
+		return OSRMResponse{}, fmt.Errorf("OSRM response is missing the code field")
+	}
+	if osrmResp.Code != "Ok" {
+		return osrmResp, nil
+	}
+
+	// The trip service answers with trips, which are shaped like routes
+	if len(osrmResp.Routes) == 0 {
+		osrmResp.Routes = osrmResp.Trips
+	}
+	if len(osrmResp.Routes) == 0 {
+		return OSRMResponse{}, fmt.Errorf("OSRM response contains no routes")
+	}
+	if osrmResp.Routes[0].Geometry == "" {
+		return OSRMResponse{}, fmt.Errorf("OSRM route has an empty geometry")
+	}
+	if osrmResp.Routes[0].Distance < 0 {
+		return OSRMResponse{}, fmt.Errorf("OSRM route has a negative distance: %f", osrmResp.Routes[0].Distance)
+	}
+
+	return osrmResp, nil
+}
+
+// Waypoint sampling strategies for OSRM requests
+const (
+	samplingStride         = "stride"          // Keep every Nth point
+	samplingDouglasPeucker = "douglas-peucker" // Keep the points that shape the route most
+)
+
+// sampleWaypoints reduces the waypoints of an OSRM request to at most maxPoints using
+// the configured sampling strategy. Zero or less keeps every point.
+func sampleWaypoints(points []TrackPoint, maxPoints int) []TrackPoint {
+	if maxPoints <= 0 || len(points) <= maxPoints {
+		return points
+	}
+
+	if config.OSRMSampling == samplingStride {
+		return samplePoints(points, maxPoints)
+	}
+
+	sampled := simplifyToCount(points, maxPoints)
+	slog.Debug("Simplified the waypoints", "from", len(points), "to", len(sampled))
+	return sampled
+}
+
+// samplePoints reduces a list of points to roughly maxPoints by keeping every Nth point.
+// The last point is always kept.
+func samplePoints(points []TrackPoint, maxPoints int) []TrackPoint {
+	if len(points) <= maxPoints {
+		return points
+	}
+
+	slog.Debug("Too many waypoints, sampling them", "waypoints", len(points))
+	// Sample the points to reduce the number
+	sampledPoints := []TrackPoint{}
+	step := len(points) / maxPoints
+	if step < 1 {
+		step = 1
+	}
+
+	for i := 0; i < len(points); i += step {
+		sampledPoints = append(sampledPoints, points[i])
+	}
+
+	// Make sure we include the last point
+	if len(sampledPoints) > 0 && !samePoint(sampledPoints[len(sampledPoints)-1], points[len(points)-1]) {
+		sampledPoints = append(sampledPoints, points[len(points)-1])
+	}
+
+	slog.Debug("Sampled the waypoints", "waypoints", len(sampledPoints))
+	return sampledPoints
+}
+
+// coordinatesParam formats points as an OSRM coordinate list
+// Format: lon1,lat1;lon2,lat2;...
+// OSRM API expects coordinates in [longitude, latitude] order
+func coordinatesParam(points []TrackPoint) string {
+	var coordsBuilder strings.Builder
+	for i, point := range points {
+		if i > 0 {
+			coordsBuilder.WriteString(";")
+		}
+		coordsBuilder.WriteString(fmt.Sprintf("%f,%f", point.Longitude, point.Latitude))
+	}
+	return coordsBuilder.String()
+}
+
+// radiusesParam builds the OSRM radiuses parameter using the same radius for every waypoint
+func radiusesParam(count int, radius int) string {
+	radiuses := make([]string, count)
+	for i := range radiuses {
+		radiuses[i] = fmt.Sprintf("%d", radius)
+	}
+	return strings.Join(radiuses, ";")
+}
+
+// Sources of the distance of street routes
+const (
+	distanceSourceOSRM      = "osrm"      // The distance OSRM reports
+	distanceSourceGeometry  = "geometry"  // The distance along the decoded geometry
+	distanceSourceReconcile = "reconcile" // The geometry unless it disagrees with OSRM, see reconcileDistances
+)
+
+// streetRouteDistance returns the distance of a street route from the configured source,
+// so every scaling and extending decision within a suggestion compares the same kind of
+// distance. A missing OSRM distance falls back to the geometry.
+func streetRouteDistance(osrmDistance, geometryDistance float64) float64 {
+	switch config.DistanceSource {
+	case distanceSourceGeometry:
+		return geometryDistance
+	case distanceSourceReconcile:
+		return reconcileDistances(osrmDistance, geometryDistance)
+	default:
+		if osrmDistance <= 0 {
+			return geometryDistance
+		}
+		return osrmDistance
+	}
+}
+
+// reconcileDistances picks the distance to report for a street route. The distance computed
+// from the decoded geometry is used unless it differs from the OSRM distance by more than the
+// configured percentage, in which case the OSRM value is preferred.
+func reconcileDistances(osrmDistance, geometryDistance float64) float64 {
+	if osrmDistance <= 0 || geometryDistance <= 0 {
+		return geometryDistance
+	}
+
+	difference := math.Abs(osrmDistance-geometryDistance) / osrmDistance * 100
+	if difference > config.DistanceMismatchPercent {
+		slog.Warn("OSRM and geometry distances differ, using the OSRM distance", "osrmDistance", osrmDistance,
+			"geometryDistance", geometryDistance, "percent", difference)
+		return osrmDistance
+	}
+
+	return geometryDistance
+}
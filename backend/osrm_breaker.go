@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errOSRMUnavailable is returned without contacting OSRM while the circuit breaker is open
+var errOSRMUnavailable = errors.New("OSRM is temporarily unavailable after repeated failures")
+
+// circuitBreaker stops calling a failing service for a while. After
+// config.OSRMBreakerThreshold consecutive failures it opens and rejects calls for
+// config.OSRMBreakerCooldown. Once the cooldown has passed it half-opens and lets a
+// single call through: if that call succeeds the breaker closes again, otherwise it
+// reopens for another cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool // A half-open trial call is in flight
+
+	now func() time.Time
+}
+
+// osrmBreaker guards every request to the OSRM server
+var osrmBreaker = newCircuitBreaker()
+
+// newCircuitBreaker creates a closed circuit breaker
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{now: time.Now}
+}
+
+// allow reports whether a call may be made, returning errOSRMUnavailable if not.
+// Every allowed call must be followed by a call to record.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return errOSRMUnavailable
+	}
+
+	// The cooldown has passed, let one call through to test recovery
+	slog.Info("OSRM circuit breaker half-open, trying a request")
+	b.probing = true
+	return nil
+}
+
+// record reports the outcome of an allowed call
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbing := b.probing
+	b.probing = false
+
+	// A call abandoned by its caller says nothing about the service
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if err == nil {
+		if !b.openUntil.IsZero() {
+			slog.Info("OSRM circuit breaker closed")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if wasProbing || (config.OSRMBreakerThreshold > 0 && b.failures >= config.OSRMBreakerThreshold) {
+		slog.Warn("OSRM circuit breaker open", "cooldown", config.OSRMBreakerCooldown, "failures", b.failures)
+		b.openUntil = b.now().Add(config.OSRMBreakerCooldown)
+	}
+}
+
+// reset closes the breaker and forgets past failures
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
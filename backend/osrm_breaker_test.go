@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOSRMCircuitBreaker(t *testing.T) {
+	healthy := false
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>Bad Gateway</html>"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	cfg := config
+	cfg.OSRMBreakerThreshold = 3
+	cfg.OSRMBreakerCooldown = time.Minute
+	cfg.OSRMAttempts = 1 // Count each request once, the breaker only sees the outcome after retries
+	withConfig(t, cfg)
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	osrmBreaker.now = func() time.Time { return now }
+	t.Cleanup(func() { osrmBreaker.now = time.Now })
+
+	url := config.OSRMServer + "/route/v1/walking/13.4,52.52;13.41,52.53"
+
+	// Drive enough failures to open the breaker
+	for i := 0; i < cfg.OSRMBreakerThreshold; i++ {
+		if _, err := requestOSRMRoute(context.Background(), url); err == nil || errors.Is(err, errOSRMUnavailable) {
+			t.Fatalf("Expected request %d to reach the failing server, got %v", i+1, err)
+		}
+	}
+	if requests != cfg.OSRMBreakerThreshold {
+		t.Fatalf("Expected %d requests, got %d", cfg.OSRMBreakerThreshold, requests)
+	}
+
+	// During the cooldown requests fail fast without contacting OSRM
+	if _, err := requestOSRMRoute(context.Background(), url); !errors.Is(err, errOSRMUnavailable) {
+		t.Errorf("Expected errOSRMUnavailable while open, got %v", err)
+	}
+
+	// Suggestions fall back to geometry immediately and say why
+	suggested, err := generateRouteWithMinDistance(context.Background(), osrmRouter{}, NewRouteStore(), SuggestOptions{MinDistance: 5, FollowStreets: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if suggested[0].FollowsStreets || !strings.Contains(suggested[0].Reason, "temporarily unavailable") {
+		t.Errorf("Expected a flagged geometric fallback, got %+v", suggested[0])
+	}
+	if requests != cfg.OSRMBreakerThreshold {
+		t.Errorf("Expected no requests while the breaker is open, got %d", requests-cfg.OSRMBreakerThreshold)
+	}
+
+	// A failed trial after the cooldown reopens the breaker
+	now = now.Add(cfg.OSRMBreakerCooldown + time.Second)
+	if _, err := requestOSRMRoute(context.Background(), url); err == nil || errors.Is(err, errOSRMUnavailable) {
+		t.Fatalf("Expected the half-open trial to reach the server, got %v", err)
+	}
+	if _, err := requestOSRMRoute(context.Background(), url); !errors.Is(err, errOSRMUnavailable) {
+		t.Errorf("Expected the breaker to reopen after a failed trial, got %v", err)
+	}
+
+	// A successful trial closes it again
+	healthy = true
+	now = now.Add(cfg.OSRMBreakerCooldown + time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := requestOSRMRoute(context.Background(), url); err != nil {
+			t.Fatalf("Expected request to succeed after recovery, got %v", err)
+		}
+	}
+	if requests != cfg.OSRMBreakerThreshold+3 {
+		t.Errorf("Expected %d requests in total, got %d", cfg.OSRMBreakerThreshold+3, requests)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// osrmCache keeps the most recently used street routes so identical waypoint sets,
+// which the distance-fitting retries in generateSuggestedRoutes produce often, don't
+// hit the OSRM server again. Its size is config.OSRMCacheSize; zero or less disables it.
+type osrmCache struct {
+	mu      sync.Mutex
+	order   *list.List // Most recently used at the front
+	entries map[string]*list.Element
+}
+
+// osrmCacheEntry is a cached route together with its key, so evicting it from
+// the back of the list can remove it from the map too
+type osrmCacheEntry struct {
+	key   string
+	route SuggestedRoute
+}
+
+// osrmRouteCache caches the results of getRouteFollowingStreets
+var osrmRouteCache = newOSRMCache()
+
+// newOSRMCache creates an empty cache
+func newOSRMCache() *osrmCache {
+	return &osrmCache{order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// osrmCacheKey fingerprints the waypoints, rounded to 5 decimals (about a meter),
+// together with the options that change the OSRM request
+func osrmCacheKey(points []TrackPoint, opts SuggestOptions) string {
+	profile := opts.Profile
+	if profile == "" {
+		profile = profileWalking
+	}
+
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s|%t|%t|%t|", profile, opts.PreferFootpaths, opts.SnapAny, opts.Verbose)
+	for _, point := range points {
+		fmt.Fprintf(&key, "%.5f,%.5f;", point.Latitude, point.Longitude)
+	}
+	return key.String()
+}
+
+// get returns a copy of the cached route for the key
+func (c *osrmCache) get(key string) (SuggestedRoute, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return SuggestedRoute{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return copySuggestedRoute(element.Value.(*osrmCacheEntry).route), true
+}
+
+// put stores a copy of the route, evicting the least recently used ones beyond the configured size
+func (c *osrmCache) put(key string, route SuggestedRoute) {
+	size := config.OSRMCacheSize
+	if size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*osrmCacheEntry).route = copySuggestedRoute(route)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&osrmCacheEntry{key: key, route: copySuggestedRoute(route)})
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*osrmCacheEntry).key)
+	}
+}
+
+// reset empties the cache
+func (c *osrmCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+// copySuggestedRoute returns the route with its own copy of the points and directions, so callers
+// modifying a route can't change the cached one
+func copySuggestedRoute(route SuggestedRoute) SuggestedRoute {
+	route.Points = append([]TrackPoint(nil), route.Points...)
+	if route.Directions != nil {
+		directions := *route.Directions
+		directions.Steps = append([]RouteStep(nil), directions.Steps...)
+		directions.Summary.MainStreets = append([]string(nil), directions.Summary.MainStreets...)
+		route.Directions = &directions
+	}
+	return route
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// maxOSRMRetryAfter caps how long a Retry-After header can make a request wait.
+// A server asking for a longer pause is treated as failing.
+const maxOSRMRetryAfter = 10 * time.Second
+
+// osrmStatusError is returned for OSRM responses whose status says the request may
+// succeed when sent again: 429 Too Many Requests and 5xx server errors
+type osrmStatusError struct {
+	status     int
+	retryAfter time.Duration // From the Retry-After header of a 429, zero if absent
+}
+
+func (e *osrmStatusError) Error() string {
+	return fmt.Sprintf("OSRM returned status %d", e.status)
+}
+
+// transientOSRMStatus reports whether a response status is worth retrying
+func transientOSRMStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// retryableOSRMError reports whether a failed request may succeed when sent again.
+// Connection failures and transient statuses are; responses OSRM answered in full,
+// such as NoRoute, and cancelled requests aren't.
+func retryableOSRMError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var statusErr *osrmStatusError
+	var transportErr *url.Error
+	return errors.As(err, &statusErr) || errors.As(err, &transportErr)
+}
+
+// osrmRetryDelay returns the wait before the given retry, counting from 1. It doubles
+// from config.OSRMRetryBackoff, unless a 429 said how long to wait.
+func osrmRetryDelay(retry int, err error) time.Duration {
+	var statusErr *osrmStatusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > 0 {
+		return statusErr.retryAfter
+	}
+	return config.OSRMRetryBackoff << (retry - 1)
+}
+
+// withOSRMRetries calls request, retrying transient failures up to config.OSRMAttempts
+// times in total. It stops early when the context is done or its deadline would pass
+// before the next attempt.
+func withOSRMRetries[T any](ctx context.Context, request func(ctx context.Context) (T, error)) (T, error) {
+	resp, err := request(ctx)
+	for attempt := 2; err != nil && attempt <= config.OSRMAttempts; attempt++ {
+		if !retryableOSRMError(ctx, err) {
+			break
+		}
+
+		delay := osrmRetryDelay(attempt-1, err)
+		if delay > maxOSRMRetryAfter {
+			slog.WarnContext(ctx, "OSRM asked to wait too long before retrying, giving up", "delay", delay)
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			break
+		}
+
+		slog.InfoContext(ctx, "OSRM request failed, retrying", "error", err, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var zero T
+			return zero, err
+		case <-timer.C:
+		}
+
+		resp, err = request(ctx)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// osrmOkResponse is a minimal successful route response
+const osrmOkResponse = `{"code":"Ok","routes":[{"geometry":"_ajccBcvwqX{pP??bz[zpP??cz[","distance":1000,"duration":600}]}`
+
+func TestOSRMRequestRetriesTransientFailures(t *testing.T) {
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(osrmOkResponse))
+	})
+
+	if _, err := requestOSRMRoute(context.Background(), config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53"); err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+
+	// After the last attempt the error is returned
+	requests = 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err := requestOSRMRoute(context.Background(), config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53")
+	var statusErr *osrmStatusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the 503 after all attempts failed, got %v", err)
+	}
+	if requests != config.OSRMAttempts {
+		t.Errorf("Expected %d requests, got %d", config.OSRMAttempts, requests)
+	}
+}
+
+func TestOSRMRequestDoesNotRetryAnsweredRequests(t *testing.T) {
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"NoRoute","message":"Impossible route between points"}`))
+	})
+
+	resp, err := requestOSRMRoute(context.Background(), config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53")
+	if err != nil || resp.Code != "NoRoute" {
+		t.Fatalf("Expected the NoRoute response, got %+v, %v", resp, err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single request, got %d", requests)
+	}
+}
+
+func TestOSRMRequestHonorsRetryAfter(t *testing.T) {
+	var times []time.Time
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(osrmOkResponse))
+	})
+
+	if _, err := requestOSRMRoute(context.Background(), config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53"); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+	if len(times) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(times))
+	}
+	if wait := times[1].Sub(times[0]); wait < time.Second {
+		t.Errorf("Expected to wait the second asked for by Retry-After, waited %s", wait)
+	}
+}
+
+func TestOSRMRequestStopsRetryingAtDeadline(t *testing.T) {
+	requests := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	cfg := config
+	cfg.OSRMRetryBackoff = time.Second
+	withConfig(t, cfg)
+
+	// The backoff would outlast the deadline, so there's no point waiting for it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := requestOSRMRoute(ctx, config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53"); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+	if requests != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected to give up after 1 request without waiting, got %d requests in %s", requests, time.Since(start))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"3", 3 * time.Second},
+		{now.Add(5 * time.Second).Format(http.TimeFormat), 5 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q): Expected %s, got %s", tt.value, tt.expected, got)
+		}
+	}
+}
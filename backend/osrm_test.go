@@ -0,0 +1,782 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPolyline encodes the points (38.5, -120.2), (40.7, -120.95), (43.252, -126.453)
+// at the precision of OSRM's polyline6 geometries
+const testPolyline = "_izlhA~rlgdF_{geC~ywl@_kwzCn`{nI"
+
+// withOSRMServer points the OSRM configuration at a stub server for the duration of a test
+func withOSRMServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := config
+	cfg.OSRMServer = server.URL
+	cfg.OSRMRetryBackoff = time.Millisecond
+	withConfig(t, cfg)
+
+	// Failures and routes from earlier tests must not short-circuit this one
+	osrmBreaker.reset()
+	t.Cleanup(osrmBreaker.reset)
+	osrmRouteCache.reset()
+	t.Cleanup(osrmRouteCache.reset)
+
+	return server
+}
+
+func TestGetRouteFollowingStreetsRetriesWithLargerRadius(t *testing.T) {
+	var requests []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+
+		// OSRM separates per-waypoint values with semicolons, which url.ParseQuery rejects
+		if !strings.Contains(r.URL.RawQuery, "radiuses=") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"NoSegment","message":"Could not find a matching segment for any coordinate."}`))
+			return
+		}
+
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	points := []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.51, Longitude: 13.38},
+	}
+
+	route, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{})
+	if err != nil {
+		t.Fatalf("Expected retry to succeed, got error: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 OSRM requests, got %d", len(requests))
+	}
+
+	radiuses := strings.Split(strings.SplitN(requests[1], "radiuses=", 2)[1], ";")
+	if len(radiuses) != len(points) {
+		t.Errorf("Expected %d radiuses, got %d", len(points), len(radiuses))
+	}
+
+	if !route.FollowsStreets || len(route.Points) != 3 {
+		t.Errorf("Expected a street route with 3 points, got %+v", route)
+	}
+}
+
+func TestGetRouteFollowingStreetsGivesUpAfterAllRadiuses(t *testing.T) {
+	requestCount := 0
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"NoSegment"}`))
+	})
+
+	_, err := getRouteFollowingStreets(context.Background(), []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.51, Longitude: 13.38},
+	}, SuggestOptions{})
+	if err == nil {
+		t.Fatal("Expected an error when no radius can snap the waypoints")
+	}
+
+	if requestCount != len(snapRadiuses)+1 {
+		t.Errorf("Expected %d requests, got %d", len(snapRadiuses)+1, requestCount)
+	}
+}
+
+func TestReconcileDistances(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.DistanceMismatchPercent = 10
+	withConfig(t, cfg)
+
+	testCases := []struct {
+		osrm, geometry, expected float64
+	}{
+		{10.0, 10.5, 10.5}, // Within tolerance, keep the geometry distance
+		{10.0, 12.0, 10.0}, // Diverging, prefer OSRM
+		{0, 12.0, 12.0},    // No OSRM distance to compare against
+	}
+
+	for i, tc := range testCases {
+		if got := reconcileDistances(tc.osrm, tc.geometry); got != tc.expected {
+			t.Errorf("Test case %d: Expected %f, got %f", i, tc.expected, got)
+		}
+	}
+}
+
+func TestGetRouteFollowingStreetsPrefersOSRMDistanceOnMismatch(t *testing.T) {
+	// The test polyline spans several hundred kilometers, while OSRM claims 5 km
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":5000,"duration":3600}]}`))
+	})
+
+	cfg := config
+	cfg.DistanceSource = distanceSourceReconcile
+	withConfig(t, cfg)
+
+	route, err := getRouteFollowingStreets(context.Background(), []TrackPoint{
+		{Latitude: 38.5, Longitude: -120.2},
+		{Latitude: 43.252, Longitude: -126.453},
+	}, SuggestOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if route.Distance != 5.0 {
+		t.Errorf("Expected OSRM distance 5 km to be preferred, got %f km", route.Distance)
+	}
+	if route.OSRMDistance != 5.0 {
+		t.Errorf("Expected OSRM distance 5 km to be attached, got %f km", route.OSRMDistance)
+	}
+
+	expectedGeometry := calculateRouteDistance(route.Points)
+	if route.GeometryDistance != expectedGeometry {
+		t.Errorf("Expected geometry distance %f km to be attached, got %f km", expectedGeometry, route.GeometryDistance)
+	}
+}
+
+func TestDecodeOSRMResponseRejectsUnexpectedShapes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"truncated", `{"code":"Ok","routes":[{"geometry":"_p~iF`, "malformed or truncated"},
+		{"html error page", `<html><body>502 Bad Gateway</body></html>`, "malformed or truncated"},
+		{"array", `[1,2,3]`, "unexpected array"},
+		{"missing code", `{"routes":[]}`, "missing the code"},
+		{"missing routes", `{"code":"Ok"}`, "no routes"},
+		{"empty geometry", `{"code":"Ok","routes":[{"geometry":"","distance":1000}]}`, "empty geometry"},
+		{"non-numeric distance", `{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":"far"}]}`, "unexpected string value"},
+	}
+
+	for _, tc := range testCases {
+		_, err := decodeOSRMResponse([]byte(tc.body))
+		if err == nil {
+			t.Errorf("%s: Expected an error", tc.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%s: Expected error containing %q, got %q", tc.name, tc.message, err.Error())
+		}
+	}
+
+	// Non-Ok codes are passed through for the caller to handle
+	resp, err := decodeOSRMResponse([]byte(`{"code":"NoRoute"}`))
+	if err != nil || resp.Code != "NoRoute" {
+		t.Errorf("Expected NoRoute response without error, got %+v, %v", resp, err)
+	}
+}
+
+func TestGetRouteFollowingStreetsHandlesTruncatedBody(t *testing.T) {
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":"Ok","rou`))
+	})
+
+	_, err := getRouteFollowingStreets(context.Background(), []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.51, Longitude: 13.38},
+	}, SuggestOptions{})
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected a truncated response error, got %v", err)
+	}
+}
+
+// benchmarkOSRMSuggestions measures generating five street-following suggestions
+// against a TLS stub server, the way /suggest talks to the public OSRM server
+func benchmarkOSRMSuggestions(b *testing.B, newTransport func() *http.Transport) {
+	var connections atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// Trust the stub server's certificate
+	transport := newTransport()
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	originalClient := osrmClient
+	osrmClient = &http.Client{Transport: transport}
+	defer func() { osrmClient = originalClient }()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	const count = 5
+	url := server.URL + "/route/v1/walking/13.4,52.52;13.41,52.53?overview=full&geometries=polyline"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < count; j++ {
+			if _, err := requestOSRMRoute(context.Background(), url); err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(connections.Load())/float64(b.N), "conns/op")
+	transport.CloseIdleConnections()
+}
+
+// BenchmarkOSRMSharedClient reuses kept-alive connections through the shared transport
+func BenchmarkOSRMSharedClient(b *testing.B) {
+	benchmarkOSRMSuggestions(b, newOSRMTransport)
+}
+
+// BenchmarkOSRMPerRequestClient opens a new connection for every request,
+// like a fresh client per call would
+func BenchmarkOSRMPerRequestClient(b *testing.B) {
+	benchmarkOSRMSuggestions(b, func() *http.Transport {
+		return &http.Transport{DisableKeepAlives: true}
+	})
+}
+
+func TestGetRouteFollowingStreetsReducesWaypointsForLongURLs(t *testing.T) {
+	var waypoints []int
+	var urlLengths []int
+	server := withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		coordinates := strings.TrimPrefix(r.URL.Path, "/route/v1/walking/")
+		waypoints = append(waypoints, strings.Count(coordinates, ";")+1)
+		urlLengths = append(urlLengths, len(r.URL.RequestURI()))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	cfg := config
+	cfg.MaxOSRMURLLength = 1000
+	withConfig(t, cfg)
+
+	var points []TrackPoint
+	for i := 0; i < 100; i++ {
+		points = append(points, TrackPoint{Latitude: 52.5 + float64(i)*0.001, Longitude: 13.4 + float64(i)*0.001})
+	}
+
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(waypoints) != 1 {
+		t.Fatalf("Expected a single request, got %d", len(waypoints))
+	}
+	if waypoints[0] >= len(points) || waypoints[0] < 2 {
+		t.Errorf("Expected the waypoints to be reduced, got %d", waypoints[0])
+	}
+	if length := len(server.URL) + urlLengths[0]; length > cfg.MaxOSRMURLLength {
+		t.Errorf("Expected the URL to fit in %d characters, got %d", cfg.MaxOSRMURLLength, length)
+	}
+}
+
+func TestFitWaypointsToURLKeepsEndpoints(t *testing.T) {
+	cfg := config
+	cfg.MaxOSRMURLLength = 10
+	withConfig(t, cfg)
+
+	points := []TrackPoint{{Latitude: 1, Longitude: 1}, {Latitude: 2, Longitude: 2}, {Latitude: 3, Longitude: 3}, {Latitude: 4, Longitude: 4}, {Latitude: 5, Longitude: 5}}
+	fitted, err := fitWaypointsToURL(points, func(points []TrackPoint) int { return len(points) * 4 })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(fitted) != 2 || fitted[0] != points[0] || fitted[1] != points[4] {
+		t.Errorf("Expected only the endpoints to remain, got %v", fitted)
+	}
+
+	// If even the endpoints don't fit, the request can't be made
+	if _, err := fitWaypointsToURL(points, func([]TrackPoint) int { return 100 }); err == nil {
+		t.Error("Expected an error when no number of waypoints fits")
+	}
+}
+
+func TestPreferFootpathsExcludesRoadClasses(t *testing.T) {
+	var requests []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	cfg := config
+	cfg.FootpathExcludeClasses = "motorway,primary"
+	withConfig(t, cfg)
+
+	points := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{PreferFootpaths: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	if !strings.Contains(requests[0], "exclude=motorway,primary") {
+		t.Errorf("Expected the excluded classes in the query, got %s", requests[0])
+	}
+	if strings.Contains(requests[1], "exclude=") {
+		t.Errorf("Expected no excluded classes without preferFootpaths, got %s", requests[1])
+	}
+}
+
+func TestSnapAnyAddsSnappingParameter(t *testing.T) {
+	var requests []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	points := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{SnapAny: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := getRouteFollowingStreets(context.Background(), points, SuggestOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	if !strings.Contains(requests[0], "snapping=any") {
+		t.Errorf("Expected snapping=any in the query, got %s", requests[0])
+	}
+	if strings.Contains(requests[1], "snapping=") {
+		t.Errorf("Expected no snapping option by default, got %s", requests[1])
+	}
+}
+
+func TestPreferFootpathsFallsBackWhenUnsupported(t *testing.T) {
+	var requests []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+
+		if strings.Contains(r.URL.RawQuery, "exclude=") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"InvalidValue","message":"Exclude flag combination is not supported."}`))
+			return
+		}
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	cfg := config
+	cfg.FootpathExcludeClasses = "motorway"
+	withConfig(t, cfg)
+
+	route, err := getRouteFollowingStreets(context.Background(), []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.53, Longitude: 13.41},
+	}, SuggestOptions{PreferFootpaths: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !route.FollowsStreets || len(requests) != 2 {
+		t.Errorf("Expected a street route after 2 requests, got %d requests", len(requests))
+	}
+}
+
+func TestOSRMClientReusesConnectionsUnderConcurrentLoad(t *testing.T) {
+	var connections atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	const workers, requestsPerWorker = 8, 10
+	cfg := config
+	cfg.OSRMMaxIdleConnsPerHost = workers
+	withConfig(t, cfg)
+	osrmBreaker.reset()
+
+	originalClient := osrmClient
+	osrmClient = newOSRMClient()
+	t.Cleanup(func() {
+		osrmClient.CloseIdleConnections()
+		osrmClient = originalClient
+	})
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	url := server.URL + "/route/v1/walking/13.4,52.52;13.41,52.53?overview=full&geometries=polyline"
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*requestsPerWorker)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requestsPerWorker; j++ {
+				if _, err := requestOSRMRoute(context.Background(), url); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Every worker keeps reusing its connection instead of opening one per request
+	if got := connections.Load(); got > workers {
+		t.Errorf("Expected at most %d connections for %d requests, got %d", workers, workers*requestsPerWorker, got)
+	}
+}
+
+// encodePolyline encodes points with the polyline algorithm at the given precision
+func encodePolyline(points []TrackPoint, precision int) string {
+	var encoded strings.Builder
+	encodeValue := func(value int) {
+		value <<= 1
+		if value < 0 {
+			value = ^value
+		}
+		for value >= 0x20 {
+			encoded.WriteByte(byte((0x20 | (value & 0x1f)) + 63))
+			value >>= 5
+		}
+		encoded.WriteByte(byte(value + 63))
+	}
+
+	factor := math.Pow10(precision)
+	prevLat, prevLng := 0, 0
+	for _, point := range points {
+		lat := int(math.Round(point.Latitude * factor))
+		lng := int(math.Round(point.Longitude * factor))
+		encodeValue(lat - prevLat)
+		encodeValue(lng - prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return encoded.String()
+}
+
+func TestGetRouteFollowingStreetsClosesNearlyClosedLoops(t *testing.T) {
+	loop := []TrackPoint{
+		{Latitude: 52.52000, Longitude: 13.40000},
+		{Latitude: 52.53000, Longitude: 13.40000},
+		{Latitude: 52.53000, Longitude: 13.42000},
+		{Latitude: 52.52010, Longitude: 13.40010}, // About 13 m short of the start
+	}
+	geometry := encodePolyline(loop, polyline6Precision)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + geometry + `","distance":3700,"duration":2600}]}`))
+	})
+
+	route, err := getRouteFollowingStreets(context.Background(), loop, SuggestOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first, last := route.Points[0], route.Points[len(route.Points)-1]; first != last {
+		t.Errorf("Expected the loop to be closed exactly, got %v and %v", first, last)
+	}
+	if !isLoop(route.Points) {
+		t.Error("Expected the decoded route to count as a loop")
+	}
+
+	// Open routes are left untouched
+	open := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}, {Latitude: 52.54, Longitude: 13.42}}
+	if got := snapLoopClosure(append([]TrackPoint(nil), open...), loopSnapTolerance); got[2] != open[2] {
+		t.Errorf("Expected the open route's end to stay at %v, got %v", open[2], got[2])
+	}
+}
+
+// staircase returns a route of alternating east and north legs of legLength steps of
+// about 10 m, together with the indices of its corners
+func staircase(legs, legLength int) ([]TrackPoint, []int) {
+	points := []TrackPoint{{Latitude: 52.5, Longitude: 13.4}}
+	var corners []int
+	for leg := 0; leg < legs; leg++ {
+		for step := 0; step < legLength; step++ {
+			last := points[len(points)-1]
+			if leg%2 == 0 {
+				last.Longitude += 0.00015
+			} else {
+				last.Latitude += 0.0001
+			}
+			points = append(points, last)
+		}
+		corners = append(corners, len(points)-1)
+	}
+	return points, corners[:len(corners)-1]
+}
+
+func TestSampleWaypointsStrategies(t *testing.T) {
+	points, corners := staircase(10, 37)
+
+	keptCorners := func(sampled []TrackPoint) int {
+		kept := 0
+		for _, corner := range corners {
+			for _, point := range sampled {
+				if point == points[corner] {
+					kept++
+					break
+				}
+			}
+		}
+		return kept
+	}
+
+	tests := []struct {
+		strategy string
+		corners  int
+	}{
+		// Every corner deviates more than any point on a straight leg
+		{samplingDouglasPeucker, len(corners)},
+		// Only corners that happen to fall on the stride survive
+		{samplingStride, 0},
+	}
+
+	for _, tc := range tests {
+		cfg := config
+		cfg.OSRMSampling = tc.strategy
+		withConfig(t, cfg)
+
+		// Stride sampling only roughly meets the target
+		sampled := sampleWaypoints(points, 20)
+		if len(sampled) < 15 || len(sampled) > 25 {
+			t.Errorf("%s: Expected about 20 waypoints, got %d", tc.strategy, len(sampled))
+		}
+		if sampled[0] != points[0] || sampled[len(sampled)-1] != points[len(points)-1] {
+			t.Errorf("%s: Expected the endpoints to be kept", tc.strategy)
+		}
+		if kept := keptCorners(sampled); kept != tc.corners {
+			t.Errorf("%s: Expected %d of %d corners to be kept, got %d", tc.strategy, tc.corners, len(corners), kept)
+		}
+	}
+}
+
+func TestSuggestProfileSelectsOSRMProfile(t *testing.T) {
+	var paths []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	tests := []struct {
+		query   string
+		status  int
+		profile string
+	}{
+		{"", http.StatusOK, "/route/v1/walking/"},
+		{"&profile=cycling", http.StatusOK, "/route/v1/cycling/"},
+		{"&profile=driving", http.StatusOK, "/route/v1/driving/"},
+		{"&profile=flying", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range tests {
+		paths = nil
+		req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true"+tc.query, nil)
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%q: Expected status %d, got %d: %s", tc.query, tc.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if tc.profile == "" {
+			if len(paths) != 0 {
+				t.Errorf("%q: Expected no OSRM requests, got %v", tc.query, paths)
+			}
+			continue
+		}
+		if len(paths) == 0 || !strings.HasPrefix(paths[0], tc.profile) {
+			t.Errorf("%q: Expected OSRM requests to %s, got %v", tc.query, tc.profile, paths)
+		}
+	}
+}
+
+func TestGetRouteFollowingStreetsCachesRoutes(t *testing.T) {
+	var requests atomic.Int32
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+	cfg := config
+	cfg.OSRMCacheSize = 2
+	withConfig(t, cfg)
+
+	route := func(points []TrackPoint, opts SuggestOptions) SuggestedRoute {
+		t.Helper()
+		suggested, err := getRouteFollowingStreets(context.Background(), points, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return suggested
+	}
+
+	park := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+	first := route(park, SuggestOptions{})
+
+	// Changing the returned points must not change the cached route
+	first.Points[0].Latitude = 0
+
+	// Differences below the fifth decimal hit the cache
+	nearby := []TrackPoint{{Latitude: 52.520001, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+	if cached := route(nearby, SuggestOptions{}); cached.Points[0].Latitude == 0 || cached.Distance != first.Distance {
+		t.Errorf("Expected an unmodified copy of the cached route, got %+v", cached)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected the second request to be cached, got %d requests", got)
+	}
+
+	// Another profile is a different route
+	route(park, SuggestOptions{Profile: profileCycling})
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Expected another profile to reach OSRM, got %d requests", got)
+	}
+
+	// A third route evicts the least recently used walking route
+	route([]TrackPoint{{Latitude: 52.54, Longitude: 13.40}, {Latitude: 52.55, Longitude: 13.41}}, SuggestOptions{})
+	route(park, SuggestOptions{Profile: profileCycling})
+	route(park, SuggestOptions{})
+	if got := requests.Load(); got != 4 {
+		t.Errorf("Expected the evicted route to be requested again, got %d requests", got)
+	}
+}
+
+func TestDistanceSourceDrivesScaling(t *testing.T) {
+	// OSRM claims 2 km for a loop whose geometry is about 4 km long
+	loop := squareLoop(1)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + encodePolyline(loop, polyline6Precision) + `","distance":2000,"duration":1500}]}`))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: loop})
+
+	suggest := func(source string) SuggestedRoute {
+		t.Helper()
+
+		cfg := config
+		cfg.DistanceSource = source
+		withConfig(t, cfg)
+		osrmRouteCache.reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true&maxDistance=3", nil)
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: Expected status 200, got %d: %s", source, rec.Code, rec.Body.String())
+		}
+
+		var suggested []SuggestedRoute
+		if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+			t.Fatalf("%s: Unable to decode suggestions: %v", source, err)
+		}
+		return suggested[0]
+	}
+
+	// By OSRM's distance the route fits, so it's returned as routed
+	if route := suggest(distanceSourceOSRM); route.Distance != 2 || route.DistanceIsEstimate || !route.FollowsStreets {
+		t.Errorf("Expected the unscaled 2 km street route, got %.2f km (estimate %t, streets %t)",
+			route.Distance, route.DistanceIsEstimate, route.FollowsStreets)
+	}
+
+	// By the geometry's distance it's too long and must be scaled down
+	if route := suggest(distanceSourceGeometry); !route.DistanceIsEstimate || route.Distance > 3.3 {
+		t.Errorf("Expected a route scaled down to about 3 km, got %.2f km (estimate %t)", route.Distance, route.DistanceIsEstimate)
+	}
+}
+
+func TestOSRMClientTimesOut(t *testing.T) {
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+
+	cfg := config
+	cfg.OSRMTimeout = 50 * time.Millisecond
+	cfg.OSRMAttempts = 1
+	withConfig(t, cfg)
+
+	originalClient := osrmClient
+	osrmClient = newOSRMClient()
+	t.Cleanup(func() { osrmClient = originalClient })
+
+	start := time.Now()
+	if _, err := requestOSRMRoute(context.Background(), config.OSRMServer+"/route/v1/walking/13.4,52.52;13.41,52.53"); err == nil {
+		t.Fatal("Expected the slow request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected to give up after the 50ms timeout, took %s", elapsed)
+	}
+}
+
+func TestSuggestHandlerCancelsOSRMWhenClientGoesAway(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan struct{}, 1)
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// The client hangs up while OSRM is still working on the route
+		cancel()
+		select {
+		case <-r.Context().Done():
+			select {
+			case cancelled <- struct{}{}:
+			default:
+			}
+		case <-time.After(2 * time.Second):
+		}
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	suggestHandler(store)(rec, req)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the OSRM request to be cancelled with the client's")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the handler to stop once the client went away, took %s", elapsed)
+	}
+
+	// Cancelled requests don't count as OSRM failures
+	if err := osrmBreaker.allow(); err != nil {
+		t.Errorf("Expected the circuit breaker to stay closed, got %v", err)
+	}
+	osrmBreaker.record(nil)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetOptimizedLoopUsesTripService(t *testing.T) {
+	var urls []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		urls = append(urls, r.URL.String())
+		w.Write([]byte(`{"code":"Ok","trips":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}],"waypoints":[]}`))
+	})
+
+	pentagon := regularPolygon(TrackPoint{Latitude: 52.52, Longitude: 13.4}, 0.01, 5)
+	route, err := getOptimizedLoop(context.Background(), pentagon, SuggestOptions{})
+	if err != nil || !route.FollowsStreets || len(route.Points) == 0 {
+		t.Fatalf("Expected a loop following streets, got %+v, %v", route, err)
+	}
+	if len(urls) != 1 || !strings.HasPrefix(urls[0], "/trip/v1/walking/") ||
+		!strings.Contains(urls[0], "roundtrip=true&source=first") {
+		t.Fatalf("Expected a single round trip request from the first waypoint, got %v", urls)
+	}
+
+	// The closing waypoint is left to the trip service
+	coordinates := strings.TrimPrefix(strings.SplitN(urls[0], "?", 2)[0], "/trip/v1/walking/")
+	if count := len(strings.Split(coordinates, ";")); count != 5 {
+		t.Errorf("Expected the 5 corners without the closing one, got %d waypoints", count)
+	}
+
+	// Asking again is answered from the cache
+	if _, err := getOptimizedLoop(context.Background(), pentagon, SuggestOptions{}); err != nil || len(urls) != 1 {
+		t.Errorf("Expected the cached loop, got %v after %d requests", err, len(urls))
+	}
+}
+
+func TestGetOptimizedLoopFallsBackToRouteService(t *testing.T) {
+	var paths []string
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/trip/") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"InvalidService","message":"Service trip not found!"}`))
+			return
+		}
+		w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"` + testPolyline + `","distance":1000,"duration":600}]}`))
+	})
+
+	corners := regularPolygon(TrackPoint{Latitude: 52.52, Longitude: 13.4}, 0.01, 4)
+	corners = corners[:len(corners)-1]
+	route, err := getOptimizedLoop(context.Background(), corners, SuggestOptions{})
+	if err != nil || route.Distance != 1 {
+		t.Fatalf("Expected the in-order route, got %+v, %v", route, err)
+	}
+	if len(paths) != 2 || !strings.HasPrefix(paths[1], "/route/v1/walking/") {
+		t.Fatalf("Expected a trip and then a route request, got %v", paths)
+	}
+
+	// The route service is told to come back to the start
+	if count := len(strings.Split(strings.TrimPrefix(paths[1], "/route/v1/walking/"), ";")); count != 5 {
+		t.Errorf("Expected the 4 corners and the closing waypoint, got %d waypoints", count)
+	}
+	if len(corners) != 4 {
+		t.Errorf("Expected the waypoints to be left alone, got %v", corners)
+	}
+}
+
+// loopStub is a LoopRouter recording which waypoints it routed in order and which as loops
+type loopStub struct {
+	routes, loops int
+}
+
+func (s *loopStub) Route(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	s.routes++
+	return SuggestedRoute{Points: points, Distance: 1, FollowsStreets: true}, nil
+}
+
+func (s *loopStub) Loop(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	s.loops++
+	return SuggestedRoute{Points: points, Distance: 1, FollowsStreets: true}, nil
+}
+
+func TestFitRouteToMinDistanceRoutesPolygonsAsLoops(t *testing.T) {
+	route := fittingTestRoute()
+	stub := &loopStub{}
+
+	fitRouteToMinDistance(context.Background(), stub, route, pointsCentroid(route.Points), 10.0, SuggestOptions{})
+	if stub.loops != 2 || stub.routes != 2 {
+		t.Errorf("Expected the pentagons as loops and the diagonals as routes, got %d loops and %d routes", stub.loops, stub.routes)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+)
+
+// writeJSONError responds with the status code and a JSON body {"error": message}, so
+// clients parsing every response as JSON can show the message
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// roundTo rounds a value to the given number of decimal places
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+// roundRoute returns a copy of the route with reported values rounded
+// to the configured precision. The stored route is left untouched.
+func roundRoute(route RouteData) RouteData {
+	route.Distance = roundTo(route.Distance, config.DistancePrecision)
+	route.Duration = roundTo(route.Duration, config.DistancePrecision)
+	route.MovingTime = roundTo(route.MovingTime, config.DistancePrecision)
+	route.TotalAscent = roundTo(route.TotalAscent, config.DistancePrecision)
+	route.TotalDescent = roundTo(route.TotalDescent, config.DistancePrecision)
+	route.NetElevation = roundTo(route.NetElevation, config.DistancePrecision)
+	route.Diameter = roundTo(route.Diameter, config.DistancePrecision)
+	return route
+}
+
+// roundRoutes applies roundRoute to every route in the slice
+func roundRoutes(routes []RouteData) []RouteData {
+	rounded := make([]RouteData, len(routes))
+	for i, route := range routes {
+		rounded[i] = roundRoute(route)
+	}
+	return rounded
+}
+
+// roundSuggestions returns copies of the suggested routes with rounded distances
+func roundSuggestions(suggested []SuggestedRoute) []SuggestedRoute {
+	rounded := make([]SuggestedRoute, len(suggested))
+	for i, route := range suggested {
+		route.Distance = roundTo(route.Distance, config.DistancePrecision)
+		route.OSRMDistance = roundTo(route.OSRMDistance, config.DistancePrecision)
+		route.GeometryDistance = roundTo(route.GeometryDistance, config.DistancePrecision)
+		route.TotalAscent = roundTo(route.TotalAscent, config.DistancePrecision)
+		if route.Directions != nil {
+			route.Directions = roundDirections(*route.Directions)
+		}
+		rounded[i] = route
+	}
+	return rounded
+}
+
+// roundDirections returns a copy of the directions with rounded distances and durations
+func roundDirections(directions RouteDirections) *RouteDirections {
+	steps := make([]RouteStep, len(directions.Steps))
+	for i, step := range directions.Steps {
+		step.Distance = roundTo(step.Distance, config.DistancePrecision)
+		step.Duration = roundTo(step.Duration, config.DistancePrecision)
+		steps[i] = step
+	}
+	directions.Steps = steps
+	directions.Summary.Distance = roundTo(directions.Summary.Distance, config.DistancePrecision)
+	directions.Summary.Duration = roundTo(directions.Summary.Duration, config.DistancePrecision)
+	return &directions
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoundTo(t *testing.T) {
+	testCases := []struct {
+		value    float64
+		places   int
+		expected float64
+	}{
+		{5.283719, 2, 5.28},
+		{5.283719, 1, 5.3},
+		{5.283719, 0, 5},
+		{0.005, 2, 0.01},
+	}
+
+	for i, tc := range testCases {
+		if got := roundTo(tc.value, tc.places); got != tc.expected {
+			t.Errorf("Test case %d: Expected %v, got %v", i, tc.expected, got)
+		}
+	}
+}
+
+func TestRoutesHandlerRoundsDistances(t *testing.T) {
+	store := withRoutes(t, RouteData{
+		Filename: "test.gpx",
+		TrackPoints: []TrackPoint{
+			{Latitude: 52.52, Longitude: 13.40},
+			{Latitude: 52.53, Longitude: 13.41},
+		},
+		Distance: 5.283719,
+		Duration: 1234.5678,
+	})
+
+	cfg := defaultConfig()
+	cfg.DistancePrecision = 1
+	withConfig(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var page RoutesPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	got := page.Items
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 route, got %d", len(got))
+	}
+	if got[0].Distance != 5.3 {
+		t.Errorf("Expected distance 5.3, got %v", got[0].Distance)
+	}
+	if got[0].Duration != 1234.6 {
+		t.Errorf("Expected duration 1234.6, got %v", got[0].Duration)
+	}
+
+	// The stored route must keep full precision
+	if stored := store.All(); stored[0].Distance != 5.283719 {
+		t.Errorf("Stored distance was modified: %v", stored[0].Distance)
+	}
+}
+
+func TestHandlerErrorsAreJSON(t *testing.T) {
+	store := withRoutes(t)
+
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		request *http.Request
+		status  int
+	}{
+		{"upload method", uploadHandler(store), httptest.NewRequest(http.MethodGet, "/upload", nil), http.StatusMethodNotAllowed},
+		{"routes filter", routesHandler(store), httptest.NewRequest(http.MethodGet, "/routes?limit=-1", nil), http.StatusBadRequest},
+		{"suggest parameter", suggestHandler(store), httptest.NewRequest(http.MethodGet, "/suggest?boundsStrictness=2", nil), http.StatusBadRequest},
+		{"coverage parameter", coverageHandler(store), httptest.NewRequest(http.MethodGet, "/coverage?cellSize=1", nil), http.StatusBadRequest},
+		{"coverage GeoJSON method", coverageGeoJSONHandler(store), httptest.NewRequest(http.MethodPost, "/coverage.geojson", nil), http.StatusMethodNotAllowed},
+		{"complete route", completeRouteHandler(store), pathRequest(http.MethodPost, "/routes/missing.gpx/complete", "filename", "missing.gpx"), http.StatusNotFound},
+		{"route meta", routeMetaHandler(store), pathRequest(http.MethodPut, "/routes/missing.gpx/meta", "filename", "missing.gpx"), http.StatusBadRequest},
+		{"simplify", simplifyRouteHandler(store), pathRequest(http.MethodPost, "/routes/missing.gpx/simplify", "filename", "missing.gpx"), http.StatusBadRequest},
+		{"route track", routeTrackHandler(store), pathRequest(http.MethodGet, "/routes/missing/track", "id", "missing"), http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		tc.handler(rec, tc.request)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: Expected status %d, got %d", tc.name, tc.status, rec.Code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%s: Expected a JSON error, got %s", tc.name, contentType)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Errorf("%s: Expected an error message, got %q", tc.name, rec.Body.String())
+		}
+	}
+}
+
+// pathRequest builds a request to a route with a path value, as the mux would set it
+func pathRequest(method, target, name, value string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.SetPathValue(name, value)
+	return req
+}
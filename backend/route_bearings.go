@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SegmentBearing is the heading and length of the segment between two consecutive points
+type SegmentBearing struct {
+	Bearing float64 `json:"bearing"` // Compass degrees from 0 (north) to 360, clockwise
+	Length  float64 `json:"length"`  // Meters
+}
+
+// segmentBearings returns the bearing and length of every segment of the track. Segments
+// between points at the same position have no heading and are left out.
+func segmentBearings(points []TrackPoint) []SegmentBearing {
+	segments := []SegmentBearing{}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		if a.Latitude == b.Latitude && a.Longitude == b.Longitude {
+			continue
+		}
+		segments = append(segments, SegmentBearing{
+			Bearing: roundTo(bearing(a, b), 1),
+			Length:  roundTo(haversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude)*1000, 1),
+		})
+	}
+	return segments
+}
+
+// routeBearingsHandler returns the heading of each segment of the route with the given ID,
+// for compass based navigation
+func routeBearingsHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		route, ok := store.FindByID(r.PathValue("id"))
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":       route.ID,
+			"filename": route.Filename,
+			"segments": segmentBearings(route.TrackPoints),
+		})
+	}
+}
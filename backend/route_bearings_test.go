@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearingOfCardinalDirections(t *testing.T) {
+	origin := TrackPoint{Latitude: 52.52, Longitude: 13.40}
+	testCases := []struct {
+		name     string
+		to       TrackPoint
+		expected float64
+	}{
+		{"north", TrackPoint{Latitude: 52.53, Longitude: 13.40}, 0},
+		{"east", TrackPoint{Latitude: 52.52, Longitude: 13.41}, 90},
+		{"south", TrackPoint{Latitude: 52.51, Longitude: 13.40}, 180},
+		{"west", TrackPoint{Latitude: 52.52, Longitude: 13.39}, 270},
+	}
+
+	for _, tc := range testCases {
+		// Heading east or west along a parallel starts slightly poleward of the parallel
+		if got := bearing(origin, tc.to); math.Abs(got-tc.expected) > 0.01 {
+			t.Errorf("%s: Expected a bearing of %.0f, got %f", tc.name, tc.expected, got)
+		}
+	}
+
+	// Along the equator there's no such deviation
+	if got := bearing(TrackPoint{}, TrackPoint{Longitude: 1}); got != 90 {
+		t.Errorf("Expected due east along the equator, got %f", got)
+	}
+}
+
+func TestRouteBearingsHandler(t *testing.T) {
+	route := RouteData{ID: "abc", Filename: "corner.gpx", TrackPoints: []TrackPoint{
+		{Latitude: 0, Longitude: 0},
+		{Latitude: 0.001, Longitude: 0},
+		{Latitude: 0.001, Longitude: 0}, // Standing still
+		{Latitude: 0.001, Longitude: 0.001},
+	}}
+	store := withRoutes(t, route)
+
+	rec := httptest.NewRecorder()
+	newServeMux(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes/abc/bearings", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Segments []SegmentBearing `json:"segments"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to decode bearings: %v", err)
+	}
+	expected := []SegmentBearing{{Bearing: 0, Length: 111.2}, {Bearing: 90, Length: 111.2}}
+	if len(response.Segments) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, response.Segments)
+	}
+	for i := range expected {
+		if response.Segments[i] != expected[i] {
+			t.Errorf("Segment %d: Expected %v, got %v", i, expected[i], response.Segments[i])
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	newServeMux(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes/unknown/bearings", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown ID, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// movingSpeedThreshold is the speed in km/h above which the walker counts as moving
+const movingSpeedThreshold = 0.5
+
+// minValidTimestamp is the earliest timestamp trusted from a GPS device. Earlier ones
+// are typically the Unix epoch written by devices without a fix.
+var minValidTimestamp = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// routeBuilder accumulates GPX track points into a RouteData one point at a time,
+// so the same processing can be fed from a parsed GPX document or a streaming decoder
+type routeBuilder struct {
+	route RouteData
+
+	tracks        int        // Number of tracks started so far
+	trackStarts   []int      // Index of the first point of each track
+	segmentStarts []int      // Index of the first point of each segment
+	prev          TrackPoint // Previous point in the current segment
+	prevTime      time.Time  // Timestamp of the previous point in the current segment
+	hasPrev       bool
+	anchor        TrackPoint // Last point counted towards the distance in the current segment
+	firstTrack    struct {
+		distance   float64
+		timestamps int // Number of points with a valid timestamp
+		firstTime  time.Time
+		lastTime   time.Time
+	}
+
+	maxTimestamp      time.Time // Timestamps after this are in the future
+	invalidTimestamps int
+}
+
+// newRouteBuilder creates a builder for the route stored in filename
+func newRouteBuilder(filename string) *routeBuilder {
+	return &routeBuilder{
+		route:        RouteData{Filename: filename},
+		maxTimestamp: time.Now().Add(config.TimestampFutureTolerance),
+	}
+}
+
+// validTimestamp returns the point's timestamp, or the zero time if it is missing
+// or outside the range a real recording can have
+func (b *routeBuilder) validTimestamp(timestamp time.Time) time.Time {
+	if timestamp.IsZero() {
+		return timestamp
+	}
+	if timestamp.Before(minValidTimestamp) || timestamp.After(b.maxTimestamp) {
+		b.invalidTimestamps++
+		return time.Time{}
+	}
+	return timestamp
+}
+
+// startTrack marks the beginning of a new <trk> element
+func (b *routeBuilder) startTrack() {
+	b.tracks++
+	b.hasPrev = false
+	b.trackStarts = append(b.trackStarts, len(b.route.TrackPoints))
+}
+
+// startSegment marks the beginning of a new <trkseg> element
+func (b *routeBuilder) startSegment() {
+	b.hasPrev = false
+	b.segmentStarts = append(b.segmentStarts, len(b.route.TrackPoints))
+}
+
+// setActivityType records the <type> of a track unless an earlier track already had one
+func (b *routeBuilder) setActivityType(activityType string) {
+	if b.route.ActivityType == "" {
+		b.route.ActivityType = strings.ToLower(strings.TrimSpace(activityType))
+	}
+}
+
+// empty reports whether no points have been added yet
+func (b *routeBuilder) empty() bool {
+	return len(b.route.TrackPoints) == 0
+}
+
+// addPoint adds a track point to the current segment
+func (b *routeBuilder) addPoint(point *gpx.GPXPoint) {
+	trackPoint := canonicalPoint(TrackPoint{
+		Latitude:  point.Latitude,
+		Longitude: point.Longitude,
+	})
+	if point.Elevation.NotNull() {
+		trackPoint.Elevation = point.Elevation.Value()
+		trackPoint.HasElevation = true
+	}
+	if timestamp := b.validTimestamp(point.Timestamp); !timestamp.IsZero() {
+		trackPoint.Time = &timestamp
+	}
+	b.addTrackPoint(trackPoint)
+}
+
+// addTrackPoint adds a point whose coordinates and timestamp have been checked to the
+// current segment, accumulating the values derived from it
+func (b *routeBuilder) addTrackPoint(trackPoint TrackPoint) {
+	var timestamp time.Time
+	if trackPoint.Time != nil {
+		timestamp = *trackPoint.Time
+	}
+	b.route.TrackPoints = append(b.route.TrackPoints, trackPoint)
+
+	// Distance is only accumulated within a segment
+	if !b.hasPrev {
+		b.anchor = trackPoint
+	} else {
+		distance := pointDistance(
+			b.prev.Latitude, b.prev.Longitude,
+			trackPoint.Latitude, trackPoint.Longitude,
+		)
+
+		// Points closer than the minimum segment distance to the last counted point are
+		// GPS jitter around a stationary position. Measuring from that point rather than
+		// the previous one keeps slow but real movement from being dropped.
+		counted := pointDistance(
+			b.anchor.Latitude, b.anchor.Longitude,
+			trackPoint.Latitude, trackPoint.Longitude,
+		)
+		if counted*1000 >= config.MinSegmentDistance {
+			b.anchor = trackPoint
+		} else {
+			counted = 0
+		}
+		b.route.Distance += counted
+
+		if b.prev.HasElevation && trackPoint.HasElevation {
+			if climb := trackPoint.Elevation - b.prev.Elevation; climb > 0 {
+				b.route.TotalAscent += climb
+			} else {
+				b.route.TotalDescent -= climb
+			}
+		}
+
+		// Like Duration, moving time is measured across the first track
+		if b.tracks <= 1 {
+			b.firstTrack.distance += counted
+
+			if !b.prevTime.IsZero() && !timestamp.IsZero() {
+				interval := timestamp.Sub(b.prevTime).Hours()
+				if interval > 0 && distance/interval > movingSpeedThreshold {
+					b.route.MovingTime += interval * 3600
+				}
+			}
+		}
+	}
+	b.prev = trackPoint
+	b.prevTime = timestamp
+	b.hasPrev = true
+
+	// The walk was recorded when its first timestamped point was
+	if b.route.CreatedAt.IsZero() && !timestamp.IsZero() {
+		b.route.CreatedAt = timestamp
+	}
+
+	// Duration is measured across the first track
+	if b.tracks <= 1 && !timestamp.IsZero() {
+		if b.firstTrack.timestamps == 0 {
+			b.firstTrack.firstTime = timestamp
+		}
+		b.firstTrack.lastTime = timestamp
+		b.firstTrack.timestamps++
+	}
+}
+
+// finish computes the remaining derived values and returns the route
+func (b *routeBuilder) finish() RouteData {
+	// Flag tracks whose exporter swapped latitude and longitude, fixing them if enabled.
+	// Fixed tracks are built again, so every value is derived from the swapped points.
+	if coordinatesLookSwapped(b.route.TrackPoints) {
+		if config.FixSwappedCoordinates {
+			slog.Info("Swapping latitude and longitude", "file", b.route.Filename)
+			b = b.swapped()
+		} else {
+			slog.Warn("Route looks like it has latitude and longitude swapped", "file", b.route.Filename)
+		}
+		b.route.CoordinatesSwapped = true
+	}
+
+	// Calculate duration if timestamps are available
+	if b.firstTrack.timestamps > 1 {
+		b.route.Duration = b.firstTrack.lastTime.Sub(b.firstTrack.firstTime).Seconds()
+	}
+
+	// If the device wrote nonsense timestamps, estimate the duration from the distance instead
+	if b.invalidTimestamps > 0 {
+		slog.Info("Ignored invalid timestamps", "file", b.route.Filename, "count", b.invalidTimestamps)
+		if b.route.Duration <= 0 && config.WalkingSpeed > 0 {
+			b.route.Duration = b.firstTrack.distance / config.WalkingSpeed * 3600
+			b.route.DurationEstimated = true
+		}
+	}
+
+	b.route.NetElevation = netElevationChange(b.route.TrackPoints)
+	b.route.Diameter = routeDiameter(b.route.TrackPoints)
+	b.route.IsLoop = isLoop(b.route.TrackPoints)
+	b.route.Type = routeType(b.route.TrackPoints)
+	annotateKnownPoints(&b.route)
+	b.route.ID = routeID(b.route.Filename, b.route.TrackPoints)
+
+	return b.route
+}
+
+// routeID derives a stable identifier from the route's filename and points, so the
+// same file always gets the same ID while different content under one name doesn't
+func routeID(filename string, points []TrackPoint) string {
+	hash := sha256.New()
+	hash.Write([]byte(filename))
+	hash.Write([]byte{0})
+
+	var buf [16]byte
+	for _, point := range points {
+		binary.LittleEndian.PutUint64(buf[:8], math.Float64bits(point.Latitude))
+		binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(point.Longitude))
+		hash.Write(buf[:])
+	}
+
+	// 64 bits are plenty to tell a personal collection of routes apart
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// swapped returns a builder fed the same points with latitude and longitude exchanged,
+// in the same tracks and segments
+func (b *routeBuilder) swapped() *routeBuilder {
+	swapped := newRouteBuilder(b.route.Filename)
+	swapped.maxTimestamp = b.maxTimestamp
+	swapped.invalidTimestamps = b.invalidTimestamps
+	swapped.route.ActivityType = b.route.ActivityType
+
+	tracks, segments := b.trackStarts, b.segmentStarts
+	for i, point := range b.route.TrackPoints {
+		for len(tracks) > 0 && tracks[0] == i {
+			swapped.startTrack()
+			tracks = tracks[1:]
+		}
+		for len(segments) > 0 && segments[0] == i {
+			swapped.startSegment()
+			segments = segments[1:]
+		}
+		point.Latitude, point.Longitude = point.Longitude, point.Latitude
+		swapped.addTrackPoint(point)
+	}
+	return swapped
+}
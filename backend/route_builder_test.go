@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+func TestMovingTimeExcludesPauses(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	point := func(lat float64, minutes int) gpx.GPXPoint {
+		return gpx.GPXPoint{
+			Point:     gpx.Point{Latitude: lat, Longitude: 13.40},
+			Timestamp: start.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+
+	// Walk for 10 minutes, stop for a 30 minute coffee, then walk for 10 more
+	segment := gpx.GPXTrackSegment{}
+	for i := 0; i <= 10; i++ {
+		segment.Points = append(segment.Points, point(52.500+float64(i)*0.001, i))
+	}
+	for i := 1; i <= 30; i++ {
+		segment.Points = append(segment.Points, point(52.510, 10+i))
+	}
+	for i := 1; i <= 10; i++ {
+		segment.Points = append(segment.Points, point(52.510+float64(i)*0.001, 40+i))
+	}
+	gpxData := &gpx.GPX{Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}}}
+
+	route, err := processGPXData("coffee.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if route.Duration != 50*60 {
+		t.Errorf("Expected an elapsed duration of 3000 s, got %f", route.Duration)
+	}
+	if math.Abs(route.MovingTime-20*60) > 1e-6 {
+		t.Errorf("Expected a moving time of 1200 s, got %f", route.MovingTime)
+	}
+
+	// The streaming parser must agree
+	streamed, err := streamGPXRoute("coffee.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if math.Abs(streamed.MovingTime-route.MovingTime) > 1e-6 {
+		t.Errorf("Expected streamed moving time %f, got %f", route.MovingTime, streamed.MovingTime)
+	}
+}
+
+func TestInvalidTimestampsAreIgnored(t *testing.T) {
+	start := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	epoch := time.Unix(0, 0).UTC()
+	future := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	track := func(timestamps ...time.Time) *gpx.GPX {
+		segment := gpx.GPXTrackSegment{}
+		for i, timestamp := range timestamps {
+			segment.Points = append(segment.Points, gpx.GPXPoint{
+				Point:     gpx.Point{Latitude: 52.50 + float64(i)*0.005, Longitude: 13.40},
+				Timestamp: timestamp,
+			})
+		}
+		return &gpx.GPX{Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}}}
+	}
+
+	// The valid timestamps in between still give the duration
+	gpxData := track(epoch, start, start.Add(10*time.Minute), future)
+	route, err := processGPXData("mixed.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if route.Duration != 600 || route.DurationEstimated {
+		t.Errorf("Expected a measured duration of 600 s, got %f (estimated %t)", route.Duration, route.DurationEstimated)
+	}
+	if !route.CreatedAt.Equal(start) {
+		t.Errorf("Expected CreatedAt to skip the epoch timestamp, got %v", route.CreatedAt)
+	}
+
+	streamed, err := streamGPXRoute("mixed.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if streamed.Duration != route.Duration {
+		t.Errorf("Expected streamed duration %f, got %f", route.Duration, streamed.Duration)
+	}
+
+	// Without any usable timestamps the duration is estimated from the distance
+	route, err = processGPXData("broken.gpx", track(epoch, epoch, future))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := route.Distance / config.WalkingSpeed * 3600
+	if !route.DurationEstimated || math.Abs(route.Duration-want) > 1e-6 {
+		t.Errorf("Expected an estimated duration of %f s, got %f (estimated %t)", want, route.Duration, route.DurationEstimated)
+	}
+}
+
+func TestMinSegmentDistanceIgnoresJitter(t *testing.T) {
+	// Walk 100 m north, stand still while the fix wanders by up to half a meter, then walk on
+	var points []TrackPoint
+	for i := 0; i <= 10; i++ {
+		points = append(points, TrackPoint{Latitude: 52.5000 + float64(i)*0.00009, Longitude: 13.40})
+	}
+	for i := 0; i < 200; i++ {
+		offset := 0.000004
+		if i%2 == 1 {
+			offset = -offset
+		}
+		points = append(points, TrackPoint{Latitude: 52.5009 + offset, Longitude: 13.40 - offset})
+	}
+	for i := 1; i <= 10; i++ {
+		points = append(points, TrackPoint{Latitude: 52.5009 + float64(i)*0.00009, Longitude: 13.40})
+	}
+	gpxData := buildTestGPX(points)
+
+	cfg := config
+	cfg.MinSegmentDistance = 0
+	withConfig(t, cfg)
+	unfiltered, _ := processGPXData("jitter.gpx", gpxData)
+
+	cfg.MinSegmentDistance = 1
+	withConfig(t, cfg)
+	filtered, _ := processGPXData("jitter.gpx", gpxData)
+
+	// The 200 jitter steps alone add well over 100 m
+	if unfiltered.Distance < 0.3 {
+		t.Fatalf("Expected jitter to inflate the unfiltered distance, got %f km", unfiltered.Distance)
+	}
+	if math.Abs(filtered.Distance-0.2) > 0.005 {
+		t.Errorf("Expected a filtered distance of about 0.2 km, got %f km", filtered.Distance)
+	}
+
+	// The streaming parser must agree
+	streamed, err := streamGPXRoute("jitter.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if math.Abs(streamed.Distance-filtered.Distance) > 1e-9 {
+		t.Errorf("Expected streamed distance %f, got %f", filtered.Distance, streamed.Distance)
+	}
+}
+
+func TestElevationAscentDescent(t *testing.T) {
+	// Climb 30 m, descend 10 m, cross a point without elevation, then climb 5 m
+	segment := gpx.GPXTrackSegment{}
+	for i, elevation := range []float64{100, 120, 130, 120, -1, 125} {
+		point := gpx.GPXPoint{Point: gpx.Point{Latitude: 52.5 + float64(i)*0.001, Longitude: 13.4}}
+		if elevation >= 0 {
+			point.Elevation.SetValue(elevation)
+		}
+		segment.Points = append(segment.Points, point)
+	}
+	gpxData := &gpx.GPX{Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}}}
+
+	route, err := processGPXData("hill.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The missing elevation breaks the pairs around it, so the last 5 m aren't counted
+	if route.TotalAscent != 30 || route.TotalDescent != 10 {
+		t.Errorf("Expected 30 m ascent and 10 m descent, got %f and %f", route.TotalAscent, route.TotalDescent)
+	}
+	if !route.TrackPoints[0].HasElevation || route.TrackPoints[0].Elevation != 100 || route.TrackPoints[4].HasElevation {
+		t.Errorf("Expected elevations to be kept only where present, got %+v", route.TrackPoints)
+	}
+
+	// The streaming parser must agree
+	streamed, err := streamGPXRoute("hill.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if streamed.TotalAscent != route.TotalAscent || streamed.TotalDescent != route.TotalDescent {
+		t.Errorf("Expected the streaming parser to report %f/%f, got %f/%f",
+			route.TotalAscent, route.TotalDescent, streamed.TotalAscent, streamed.TotalDescent)
+	}
+
+	// Points are serialized with "ele" only when they have an elevation
+	data, err := json.Marshal(route.TrackPoints[3:5])
+	if err != nil {
+		t.Fatalf("Unable to marshal points: %v", err)
+	}
+	if !strings.Contains(string(data), `"ele":120`) || strings.Count(string(data), "ele") != 1 {
+		t.Errorf("Expected only the first point to carry an elevation, got %s", data)
+	}
+
+	var decoded []TrackPoint
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unable to unmarshal points: %v", err)
+	}
+	if decoded[0] != route.TrackPoints[3] || decoded[1] != route.TrackPoints[4] {
+		t.Errorf("Expected points to survive a round trip, got %+v", decoded)
+	}
+}
+
+func TestNetElevation(t *testing.T) {
+	build := func(elevations ...float64) RouteData {
+		t.Helper()
+
+		segment := gpx.GPXTrackSegment{}
+		for i, elevation := range elevations {
+			point := gpx.GPXPoint{Point: gpx.Point{Latitude: 52.5 + float64(i)*0.001, Longitude: 13.4}}
+			if elevation >= 0 {
+				point.Elevation.SetValue(elevation)
+			}
+			segment.Points = append(segment.Points, point)
+		}
+
+		route, err := processGPXData("net.gpx", &gpx.GPX{Tracks: []gpx.GPXTrack{{Segments: []gpx.GPXTrackSegment{segment}}}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return route
+	}
+
+	// Net uphill despite a dip, with the missing ends skipped
+	if route := build(-1, 100, 80, 140, -1); route.NetElevation != 40 {
+		t.Errorf("Expected a net elevation of 40 m, got %f", route.NetElevation)
+	}
+	if route := build(140, 100); route.NetElevation != -40 {
+		t.Errorf("Expected a net elevation of -40 m, got %f", route.NetElevation)
+	}
+	if route := build(-1, -1); route.NetElevation != 0 {
+		t.Errorf("Expected no net elevation without elevation data, got %f", route.NetElevation)
+	}
+}
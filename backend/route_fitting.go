@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+)
+
+// maxDistanceTolerance is how much longer than the maximum distance a street route may be,
+// as a factor, since street routing never hits a distance exactly
+const maxDistanceTolerance = 1.1
+
+// fitRouteToMaxDistance shrinks a street route that's longer than maxDistance. The perimeter
+// it was routed through is scaled towards the center and routed again, first to 80% and then
+// to 50% of the share that should be kept, before a small square around the center is tried.
+// If no street route fits, the street route itself is scaled down.
+func fitRouteToMaxDistance(ctx context.Context, router Router, streetRoute SuggestedRoute,
+	perimeter []TrackPoint, center TrackPoint, maxDistance float64, opts SuggestOptions) SuggestedRoute {
+	percentage := maxDistance / streetRoute.Distance
+	slog.DebugContext(ctx, "Shrinking the street route", "percent", percentage*100)
+
+	// Need at least 4 points for a rectangle
+	if len(perimeter) < 4 {
+		slog.DebugContext(ctx, "Not enough points in the perimeter, falling back to the scaled route")
+		return scaleStreetRoute(streetRoute, percentage)
+	}
+
+	// Use a slightly smaller scale factor to account for street routing variations
+	shrunk, err := router.Route(ctx, scaleTowards(perimeter, center, percentage*0.8), opts)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to get a shorter street route, falling back to the scaled route", "error", err)
+		return scaleStreetRoute(streetRoute, percentage)
+	}
+	if shrunk.Distance <= maxDistance*maxDistanceTolerance {
+		slog.DebugContext(ctx, "Created a street route within max distance", "distance", shrunk.Distance)
+		return shrunk
+	}
+	slog.DebugContext(ctx, "Street route still exceeds max distance, trying a smaller perimeter", "distance", shrunk.Distance)
+
+	// For a 5 km max distance, a 1 km by 1 km square gives roughly 4 km
+	offset := maxDistance / 10.0 / 111.0 // Convert km to degrees (roughly)
+	square := []TrackPoint{
+		{Latitude: center.Latitude - offset, Longitude: center.Longitude - offset},
+		{Latitude: center.Latitude - offset, Longitude: center.Longitude + offset},
+		{Latitude: center.Latitude + offset, Longitude: center.Longitude + offset},
+		{Latitude: center.Latitude + offset, Longitude: center.Longitude - offset},
+		{Latitude: center.Latitude - offset, Longitude: center.Longitude - offset}, // Close the loop
+	}
+
+	for _, points := range [][]TrackPoint{scaleTowards(perimeter, center, percentage*0.5), square} {
+		candidate, err := router.Route(ctx, points, opts)
+		if err == nil && candidate.Distance <= maxDistance*maxDistanceTolerance {
+			slog.DebugContext(ctx, "Created a street route within max distance", "distance", candidate.Distance)
+			return candidate
+		}
+	}
+
+	slog.DebugContext(ctx, "All street routes exceeded max distance, falling back to the scaled route")
+	return scaleStreetRoute(streetRoute, percentage)
+}
+
+// fitRouteToMinDistance lengthens a street route that's shorter than minDistance. Two
+// pentagons around the center are routed as loops, then two ever longer diagonals across
+// it. Only if none of them is long enough the street route is extended with zigzags, so
+// it no longer follows streets.
+func fitRouteToMinDistance(ctx context.Context, router Router, streetRoute SuggestedRoute,
+	center TrackPoint, minDistance float64, opts SuggestOptions) SuggestedRoute {
+	// Few waypoints stay within OSRM's limits. 1 degree is roughly 111 km.
+	polygonOffset := math.Sqrt(minDistance/10.0) / 111.0
+	attempts := []struct {
+		points []TrackPoint
+		loop   bool // Visiting the corners in the best order keeps the loop from crossing itself
+	}{
+		{regularPolygon(center, polygonOffset, 5), true},
+		{regularPolygon(center, 2*polygonOffset, 5), true},
+		{diagonalPoints(center.Latitude, center.Longitude, math.Sqrt(minDistance/2.0)/111.0), false},
+		{diagonalPoints(center.Latitude, center.Longitude, math.Sqrt(minDistance)/111.0), false},
+	}
+
+	// The longer routes may leave the area of the existing ones, which is deliberate
+	for i, attempt := range attempts {
+		var candidate SuggestedRoute
+		var err error
+		if attempt.loop {
+			candidate, err = routeLoop(ctx, router, attempt.points, opts)
+		} else {
+			candidate, err = router.Route(ctx, attempt.points, opts)
+		}
+		if err == nil && candidate.Distance >= minDistance {
+			slog.DebugContext(ctx, "Created a longer street route", "attempt", i+1, "distance", candidate.Distance)
+			return candidate
+		}
+	}
+
+	slog.DebugContext(ctx, "No street route was long enough, falling back to zigzags")
+	streetRoute.Points = extendRoute(streetRoute.Points, minDistance/streetRoute.Distance)
+	streetRoute.Directions = nil
+	streetRoute.Distance = calculateRouteDistance(streetRoute.Points)
+	streetRoute.DistanceIsEstimate = true
+	streetRoute.FollowsStreets = false
+	streetRoute.addNote(noteZigzags)
+	return streetRoute
+}
+
+// scaleStreetRoute scales the points of a street route by the factor, for when no street
+// route of the right length could be found. The distance becomes an estimate.
+func scaleStreetRoute(route SuggestedRoute, factor float64) SuggestedRoute {
+	route.Points = adjustRouteDistance(route.Points, factor)
+	route.Directions = nil
+	route.Distance = calculateRouteDistance(route.Points)
+	route.DistanceIsEstimate = true
+	route.addNote(noteScaled)
+	slog.Debug("Scaled the street route", "factor", factor, "distance", route.Distance)
+	return route
+}
+
+// scaleTowards moves the points towards the center, keeping the given share of their distance
+func scaleTowards(points []TrackPoint, center TrackPoint, factor float64) []TrackPoint {
+	scaled := make([]TrackPoint, len(points))
+	for i, p := range points {
+		scaled[i] = TrackPoint{
+			Latitude:  center.Latitude + (p.Latitude-center.Latitude)*factor,
+			Longitude: center.Longitude + (p.Longitude-center.Longitude)*factor,
+		}
+	}
+	return scaled
+}
+
+// regularPolygon returns a closed polygon with its corners offset degrees around the center
+func regularPolygon(center TrackPoint, offset float64, corners int) []TrackPoint {
+	polygon := make([]TrackPoint, 0, corners+1)
+	for i := 0; i < corners; i++ {
+		angle := 2.0 * math.Pi * float64(i) / float64(corners)
+		polygon = append(polygon, TrackPoint{
+			Latitude:  center.Latitude + offset*math.Sin(angle),
+			Longitude: center.Longitude + offset*math.Cos(angle),
+		})
+	}
+	return append(polygon, polygon[0])
+}
+
+// pointsCentroid returns the average position of the points
+func pointsCentroid(points []TrackPoint) TrackPoint {
+	var centroid TrackPoint
+	for _, p := range points {
+		centroid.Latitude += p.Latitude
+		centroid.Longitude += p.Longitude
+	}
+	centroid.Latitude /= float64(len(points))
+	centroid.Longitude /= float64(len(points))
+	return centroid
+}
+
+// routesCentroid returns the average position of the points of all routes, or false if
+// they have no points
+func routesCentroid(routes []RouteData) (TrackPoint, bool) {
+	var points []TrackPoint
+	for _, route := range routes {
+		points = append(points, route.TrackPoints...)
+	}
+	if len(points) == 0 {
+		return TrackPoint{}, false
+	}
+	return pointsCentroid(points), true
+}
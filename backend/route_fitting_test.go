@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+// stubRouter returns a router answering with the given distances in
+// turn, or an error for a negative one, and recording the waypoints it was called with
+func stubRouter(distances ...float64) (Router, *[][]TrackPoint) {
+	var calls [][]TrackPoint
+	return routerFunc(func(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+		calls = append(calls, points)
+		distance := distances[len(calls)-1]
+		if distance < 0 {
+			return SuggestedRoute{}, errors.New("no route")
+		}
+		return SuggestedRoute{Points: points, Distance: distance, FollowsStreets: true}, nil
+	}), &calls
+}
+
+// fittingTestRoute is a street route of 4 km around a square
+func fittingTestRoute() SuggestedRoute {
+	points := squareLoop(1)
+	return SuggestedRoute{Points: points, Distance: calculateRouteDistance(points), FollowsStreets: true}
+}
+
+func TestFitRouteToMaxDistanceShrinksPerimeter(t *testing.T) {
+	route := fittingTestRoute()
+	center := pointsCentroid(route.Points)
+	router, calls := stubRouter(2.1)
+
+	fitted := fitRouteToMaxDistance(context.Background(), router, route, route.Points, center, 2.0, SuggestOptions{})
+	if len(*calls) != 1 || fitted.Distance != 2.1 || !fitted.FollowsStreets {
+		t.Fatalf("Expected the first street route to be used, got %+v after %d attempts", fitted, len(*calls))
+	}
+
+	// The perimeter is scaled towards its center
+	percentage := 2.0 / route.Distance
+	for i, p := range (*calls)[0] {
+		expected := center.Latitude + (route.Points[i].Latitude-center.Latitude)*percentage*0.8
+		if math.Abs(p.Latitude-expected) > 1e-9 {
+			t.Fatalf("Expected waypoint %d at latitude %f, got %f", i, expected, p.Latitude)
+		}
+	}
+}
+
+func TestFitRouteToMaxDistanceFallsBackToScaledRoute(t *testing.T) {
+	route := fittingTestRoute()
+	center := pointsCentroid(route.Points)
+
+	// The smaller perimeter and then the square are tried
+	router, calls := stubRouter(3.0, 3.0, 2.1)
+	fitted := fitRouteToMaxDistance(context.Background(), router, route, route.Points, center, 2.0, SuggestOptions{})
+	if len(*calls) != 3 || fitted.Distance != 2.1 || len((*calls)[2]) != 5 {
+		t.Fatalf("Expected the square to be used, got %+v after %d attempts", fitted, len(*calls))
+	}
+
+	// Without a fitting street route the route itself is scaled down
+	router, calls = stubRouter(3.0, -1, 3.0)
+	fitted = fitRouteToMaxDistance(context.Background(), router, route, route.Points, center, 2.0, SuggestOptions{})
+	if len(*calls) != 3 || !fitted.DistanceIsEstimate || fitted.Distance > 2.0*maxDistanceTolerance {
+		t.Errorf("Expected a scaled route of about 2 km, got %+v after %d attempts", fitted, len(*calls))
+	}
+
+	// An error on the first attempt gives up straight away
+	router, calls = stubRouter(-1)
+	fitted = fitRouteToMaxDistance(context.Background(), router, route, route.Points, center, 2.0, SuggestOptions{})
+	if len(*calls) != 1 || !fitted.DistanceIsEstimate {
+		t.Errorf("Expected a scaled route after a routing error, got %+v after %d attempts", fitted, len(*calls))
+	}
+}
+
+func TestFitRouteToMinDistanceTriesLargerShapes(t *testing.T) {
+	route := fittingTestRoute()
+	center := pointsCentroid(route.Points)
+
+	router, calls := stubRouter(5.0, -1, 9.0, 12.0)
+	fitted := fitRouteToMinDistance(context.Background(), router, route, center, 10.0, SuggestOptions{})
+	if len(*calls) != 4 || fitted.Distance != 12.0 || !fitted.FollowsStreets {
+		t.Fatalf("Expected the fourth street route to be used, got %+v after %d attempts", fitted, len(*calls))
+	}
+
+	// Two closed pentagons, then two diagonals
+	for i, expected := range []int{6, 6, 2, 2} {
+		if len((*calls)[i]) != expected {
+			t.Errorf("Expected %d waypoints on attempt %d, got %d", expected, i+1, len((*calls)[i]))
+		}
+	}
+	pentagon := (*calls)[0]
+	if pentagon[0] != pentagon[5] {
+		t.Errorf("Expected the pentagon to be closed, got %v", pentagon)
+	}
+	if first, second := (*calls)[0][0], (*calls)[1][0]; math.Abs((second.Longitude-center.Longitude)-2*(first.Longitude-center.Longitude)) > 1e-9 {
+		t.Errorf("Expected the second pentagon to be twice as large, got %v and %v", first, second)
+	}
+}
+
+func TestFitRouteToMinDistanceFallsBackToZigzags(t *testing.T) {
+	route := fittingTestRoute()
+	router, calls := stubRouter(5.0, 5.0, -1, 5.0)
+
+	fitted := fitRouteToMinDistance(context.Background(), router, route, pointsCentroid(route.Points), 10.0, SuggestOptions{})
+	if len(*calls) != 4 {
+		t.Errorf("Expected 4 attempts, got %d", len(*calls))
+	}
+	if fitted.FollowsStreets || !fitted.DistanceIsEstimate || fitted.Distance <= route.Distance {
+		t.Errorf("Expected a longer zigzag route that no longer follows streets, got %+v", fitted)
+	}
+}
+
+func TestRoutesCentroid(t *testing.T) {
+	if _, ok := routesCentroid([]RouteData{{ID: "empty"}}); ok {
+		t.Error("Expected no centroid for routes without points")
+	}
+
+	routes := []RouteData{
+		{TrackPoints: []TrackPoint{{Latitude: 1, Longitude: 2}}},
+		{TrackPoints: []TrackPoint{{Latitude: 3, Longitude: 4}, {Latitude: 5, Longitude: 6}}},
+	}
+	if centroid, ok := routesCentroid(routes); !ok || centroid != (TrackPoint{Latitude: 3, Longitude: 4}) {
+		t.Errorf("Expected the centroid of all points, got %+v", centroid)
+	}
+}
+
+func TestGenerateSuggestedRoutesFitsStreetRoute(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+
+	// The perimeter is too long, its scaled down version fits
+	router, calls := stubRouter(5.0, 1.9)
+	suggested, err := generateSuggestedRoutes(context.Background(), router, store, SuggestOptions{FollowStreets: true, MaxDistance: 2})
+	if err != nil || len(suggested) != 1 {
+		t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+	}
+	if len(*calls) != 2 || suggested[0].Distance != 1.9 || !suggested[0].FollowsStreets || suggested[0].DistanceIsEstimate {
+		t.Errorf("Expected the second street route, got %+v after %d attempts", suggested[0], len(*calls))
+	}
+
+	// The perimeter is too short, the first pentagon is long enough
+	router, calls = stubRouter(0.5, 3.0)
+	suggested, err = generateSuggestedRoutes(context.Background(), router, store, SuggestOptions{FollowStreets: true, MinDistance: 2})
+	if err != nil || len(suggested) != 1 {
+		t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+	}
+	if len(*calls) != 2 || suggested[0].Distance != 3.0 || !suggested[0].FollowsStreets {
+		t.Errorf("Expected the pentagon street route, got %+v after %d attempts", suggested[0], len(*calls))
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// routeIndexFilename is the sidecar index stored next to the GPX files
+const routeIndexFilename = "index.json"
+
+// routeMeta holds user-maintained information about a route that can't be derived from its GPX file
+type routeMeta struct {
+	WalkCount int    `json:"walkCount"`
+	Source    string `json:"source,omitempty"` // Empty for uploaded routes
+	Notes     string `json:"notes,omitempty"`
+	Weather   string `json:"weather,omitempty"` // Lowercased free-form tag such as "rainy"
+
+	// ContentHash identifies the uploaded file, so uploading it again is noticed after a restart
+	ContentHash string `json:"contentHash,omitempty"`
+
+	// OffRoad is the result of the off-road check on upload, which needs OSRM and so
+	// isn't repeated when the route is derived from its GPX file again
+	OffRoad bool `json:"offRoad,omitempty"`
+
+	// CoordinatesSwapped records that the upload was judged swapped against the routes
+	// stored at the time, which the file alone can't tell again
+	CoordinatesSwapped bool `json:"coordinatesSwapped,omitempty"`
+
+	// ID overrides the ID derived from the GPX file, for routes whose points were changed
+	// in place by simplifying them
+	ID string `json:"id,omitempty"`
+}
+
+// maxRouteNotesLength limits the size of route notes in bytes
+const maxRouteNotesLength = 4096
+
+// Route sources
+const (
+	sourceUploaded  = "uploaded"  // Recorded walk uploaded as a GPX file
+	sourceSuggested = "suggested" // Suggestion saved by the user
+	sourceImported  = "imported"  // Recorded walk imported from another format
+)
+
+// The sidecar index maps GPX filenames to their metadata.
+// When both are locked, the RouteStore must be locked first.
+var (
+	routeIndex      = map[string]routeMeta{}
+	routeIndexMutex sync.Mutex
+)
+
+// loadRouteIndex reads the sidecar index from the data directory
+func loadRouteIndex() error {
+	routeIndexMutex.Lock()
+	defer routeIndexMutex.Unlock()
+
+	routeIndex = map[string]routeMeta{}
+
+	data, err := os.ReadFile(filepath.Join(config.DataDir, routeIndexFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &routeIndex)
+}
+
+// saveRouteIndexLocked writes the sidecar index to the data directory.
+// The caller must hold routeIndexMutex.
+func saveRouteIndexLocked() error {
+	data, err := json.MarshalIndent(routeIndex, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't leave a truncated index behind
+	path := filepath.Join(config.DataDir, routeIndexFilename)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// getRouteMeta returns the stored metadata for a route
+func getRouteMeta(filename string) routeMeta {
+	routeIndexMutex.Lock()
+	defer routeIndexMutex.Unlock()
+
+	return routeIndex[filename]
+}
+
+// updateRouteMeta applies a change to a route's metadata and persists the index
+func updateRouteMeta(filename string, update func(meta *routeMeta)) (routeMeta, error) {
+	routeIndexMutex.Lock()
+	defer routeIndexMutex.Unlock()
+
+	meta := routeIndex[filename]
+	update(&meta)
+	routeIndex[filename] = meta
+
+	return meta, saveRouteIndexLocked()
+}
+
+// deleteRouteMeta removes a route's metadata from the index and persists it
+func deleteRouteMeta(filename string) error {
+	routeIndexMutex.Lock()
+	defer routeIndexMutex.Unlock()
+
+	delete(routeIndex, filename)
+	return saveRouteIndexLocked()
+}
+
+// applyRouteMeta copies the stored metadata onto a route
+func applyRouteMeta(route *RouteData, meta routeMeta) {
+	route.WalkCount = meta.WalkCount
+	route.Source = meta.Source
+	route.Notes = meta.Notes
+	route.Weather = meta.Weather
+	route.ContentHash = meta.ContentHash
+	route.OffRoad = meta.OffRoad
+	route.CoordinatesSwapped = route.CoordinatesSwapped || meta.CoordinatesSwapped
+	if meta.ID != "" {
+		route.ID = meta.ID
+	}
+	if route.Source == "" {
+		route.Source = sourceUploaded
+	}
+
+	// Every recorded route has been walked at least once, planned ones maybe not yet
+	if route.WalkCount < 1 && route.Source != sourceSuggested {
+		route.WalkCount = 1
+	}
+}
+
+// completeRouteHandler records that a route has been walked again
+func completeRouteHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		filename := r.PathValue("filename")
+
+		var walkCount int
+		err := store.update(filename, func(route RouteData) (RouteData, error) {
+			meta, err := updateRouteMeta(filename, func(meta *routeMeta) {
+				meta.WalkCount = route.WalkCount + 1
+			})
+			if err != nil {
+				return RouteData{}, err
+			}
+			applyRouteMeta(&route, meta)
+			walkCount = route.WalkCount
+			return route, nil
+		})
+		if errors.Is(err, errRouteNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Unable to save route metadata")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"filename":  filename,
+			"walkCount": walkCount,
+		})
+	}
+}
+
+// normalizeWeather trims and lowercases a weather tag so filtering ignores case
+func normalizeWeather(weather string) string {
+	return strings.ToLower(strings.TrimSpace(weather))
+}
+
+// routeMetaHandler replaces the notes and weather tag of a route
+func routeMetaHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		filename := r.PathValue("filename")
+
+		var body struct {
+			Notes   string `json:"notes"`
+			Weather string `json:"weather"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+		if len(body.Notes) > maxRouteNotesLength {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Notes must not be longer than %d bytes", maxRouteNotesLength))
+			return
+		}
+
+		var updated RouteData
+		err := store.update(filename, func(route RouteData) (RouteData, error) {
+			meta, err := updateRouteMeta(filename, func(meta *routeMeta) {
+				meta.Notes = strings.TrimSpace(body.Notes)
+				meta.Weather = normalizeWeather(body.Weather)
+			})
+			if err != nil {
+				return RouteData{}, err
+			}
+			applyRouteMeta(&route, meta)
+			updated = route
+			return route, nil
+		})
+		if errors.Is(err, errRouteNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Unable to save route metadata")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"filename": filename,
+			"notes":    updated.Notes,
+			"weather":  updated.Weather,
+		})
+	}
+}
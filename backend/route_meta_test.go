@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// completeRoute posts to the complete endpoint and returns the reported walk count
+func completeRoute(t *testing.T, store *RouteStore, filename string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/routes/"+filename+"/complete", nil)
+	req.SetPathValue("filename", filename)
+	rec := httptest.NewRecorder()
+	completeRouteHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		WalkCount int `json:"walkCount"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	return resp.WalkCount
+}
+
+func TestCompleteRouteIncrementsWalkCount(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t,
+		RouteData{Filename: "park.gpx", WalkCount: 1},
+		RouteData{Filename: "river.gpx", WalkCount: 1},
+	)
+
+	if count := completeRoute(t, store, "river.gpx"); count != 2 {
+		t.Errorf("Expected walk count 2, got %d", count)
+	}
+	if count := completeRoute(t, store, "river.gpx"); count != 3 {
+		t.Errorf("Expected walk count 3, got %d", count)
+	}
+
+	// The count must survive reloading the sidecar index
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload route index: %v", err)
+	}
+	if meta := getRouteMeta("river.gpx"); meta.WalkCount != 3 {
+		t.Errorf("Expected persisted walk count 3, got %d", meta.WalkCount)
+	}
+
+	// Sorting by walk count puts the most walked route first
+	req := httptest.NewRequest(http.MethodGet, "/routes?sort=walkcount", nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+
+	var page RoutesPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	got := page.Items
+	if len(got) != 2 || got[0].Filename != "river.gpx" || got[0].WalkCount != 3 {
+		t.Errorf("Expected river.gpx with 3 walks first, got %+v", got)
+	}
+}
+
+func TestCompleteRouteNotFound(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/routes/missing.gpx/complete", nil)
+	req.SetPathValue("filename", "missing.gpx")
+	rec := httptest.NewRecorder()
+	completeRouteHandler(store)(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestReuploadIncrementsWalkCount(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	// A new recording of the walk uploaded under the same name
+	for i := 0; i < 2; i++ {
+		content := testGPXBytes(t, buildTestGPX(jitteryLine(10+i)))
+		rec := httptest.NewRecorder()
+		uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "loop.gpx", content))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	stored := store.All()
+	if len(stored) != 1 {
+		t.Fatalf("Expected the re-upload to replace the route, got %d routes", len(stored))
+	}
+	if stored[0].WalkCount != 2 {
+		t.Errorf("Expected walk count 2 after re-upload, got %d", stored[0].WalkCount)
+	}
+}
+
+// putRouteMeta sends a metadata update and returns the response
+func putRouteMeta(t *testing.T, store *RouteStore, filename, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPut, "/routes/"+filename+"/meta", strings.NewReader(body))
+	req.SetPathValue("filename", filename)
+	rec := httptest.NewRecorder()
+	routeMetaHandler(store)(rec, req)
+	return rec
+}
+
+func TestRouteMetaSetsNotesAndWeather(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t,
+		RouteData{Filename: "park.gpx", WalkCount: 1},
+		RouteData{Filename: "river.gpx", WalkCount: 1},
+	)
+
+	rec := putRouteMeta(t, store, "river.gpx", `{"notes": "Muddy after the bridge", "weather": " Rainy "}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The metadata must survive reloading the sidecar index
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload route index: %v", err)
+	}
+	meta := getRouteMeta("river.gpx")
+	if meta.Notes != "Muddy after the bridge" || meta.Weather != "rainy" {
+		t.Errorf("Expected persisted notes and weather rainy, got %+v", meta)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/routes?weather=RAINY", nil)
+	rec = httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+
+	var page RoutesPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	got := page.Items
+	if len(got) != 1 || got[0].Filename != "river.gpx" || got[0].Notes != "Muddy after the bridge" {
+		t.Errorf("Expected only river.gpx with its notes, got %+v", got)
+	}
+	if got[0].WalkCount != 1 {
+		t.Errorf("Expected walk count 1 to be kept, got %d", got[0].WalkCount)
+	}
+}
+
+func TestRouteMetaErrors(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t, RouteData{Filename: "park.gpx"})
+
+	tests := []struct {
+		name     string
+		filename string
+		body     string
+		expected int
+	}{
+		{"missing route", "missing.gpx", `{"notes": "x"}`, http.StatusNotFound},
+		{"invalid json", "park.gpx", `{"notes":`, http.StatusBadRequest},
+		{"notes too long", "park.gpx", `{"notes": "` + strings.Repeat("a", maxRouteNotesLength+1) + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := putRouteMeta(t, store, tc.filename, tc.body); rec.Code != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+// Route types, telling how a route gets back to its start
+const (
+	routeTypeLoop         = "loop"           // Ends where it started, by another way
+	routeTypeOutAndBack   = "out-and-back"   // Ends where it started, by the same way
+	routeTypePointToPoint = "point-to-point" // Ends somewhere else
+)
+
+// Out-and-back routes are told apart from loops by sampling the way back, which has to
+// stay close to the way out
+const (
+	retraceSamples   = 20
+	retraceTolerance = 0.05 // Kilometers from the closest point of the way out
+	retraceShare     = 0.8  // Share of the samples that have to be close
+)
+
+// routeType classifies the route as a loop, an out-and-back or a point-to-point route,
+// using isLoop to tell whether it returns to its start. It's empty for routes with fewer
+// than two points.
+func routeType(points []TrackPoint) string {
+	if len(points) < 2 {
+		return ""
+	}
+	if !isLoop(points) {
+		return routeTypePointToPoint
+	}
+	if retracesItself(points) {
+		return routeTypeOutAndBack
+	}
+	return routeTypeLoop
+}
+
+// retracesItself reports whether the second half of the route, by distance, runs close
+// to the first half all along
+func retracesItself(points []TrackPoint) bool {
+	length := calculateRouteDistance(points)
+	if length == 0 {
+		return false
+	}
+
+	// The way out ends with the point where half the distance is reached
+	half, travelled := len(points)-1, 0.0
+	for i := 1; i < len(points); i++ {
+		travelled += haversineDistance(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+		if travelled >= length/2 {
+			half = i
+			break
+		}
+	}
+	wayOut := points[:half+1]
+
+	nearby := 0
+	for i := 0; i < retraceSamples; i++ {
+		sample, _ := pointAtDistance(points, length/2+length/2*float64(i)/retraceSamples)
+		if nearestPoint(wayOut, sample) <= retraceTolerance {
+			nearby++
+		}
+	}
+	return float64(nearby) >= retraceShare*retraceSamples
+}
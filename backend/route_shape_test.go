@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// outAndBack returns a track heading east and returning along the other side of the street
+func outAndBack() []TrackPoint {
+	out := jitteryLine(20)
+	points := append([]TrackPoint{}, out...)
+	for i := len(out) - 2; i >= 0; i-- {
+		points = append(points, TrackPoint{Latitude: out[i].Latitude + 0.0002, Longitude: out[i].Longitude})
+	}
+	return append(points, out[0])
+}
+
+func TestRouteType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		points   []TrackPoint
+		expected string
+	}{
+		{"square", squareLoop(1), routeTypeLoop},
+		{"there and back", outAndBack(), routeTypeOutAndBack},
+		{"one way", jitteryLine(20), routeTypePointToPoint},
+		{"single point", jitteryLine(1), ""},
+	}
+
+	for _, tc := range testCases {
+		if got := routeType(tc.points); got != tc.expected {
+			t.Errorf("%s: Expected type %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestProcessGPXDataClassifiesRoute(t *testing.T) {
+	loop, err := processGPXData("loop.gpx", buildTestGPX(outAndBack()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !loop.IsLoop || loop.Type != routeTypeOutAndBack {
+		t.Errorf("Expected an out-and-back loop, got isLoop %t and type %q", loop.IsLoop, loop.Type)
+	}
+
+	line, err := processGPXData("line.gpx", buildTestGPX(jitteryLine(20)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if line.IsLoop || line.Type != routeTypePointToPoint {
+		t.Errorf("Expected a point-to-point route, got isLoop %t and type %q", line.IsLoop, line.Type)
+	}
+}
+
+func TestRoutesHandlerTypeFilter(t *testing.T) {
+	store := withRoutes(t,
+		RouteData{Filename: "canal.gpx", Type: routeTypeOutAndBack, IsLoop: true},
+		RouteData{Filename: "park.gpx", Type: routeTypeLoop, IsLoop: true},
+		RouteData{Filename: "commute.gpx", Type: routeTypePointToPoint},
+	)
+
+	if got := getRouteOrder(t, store, "?type=loop"); len(got) != 1 || got[0] != "park.gpx" {
+		t.Errorf("Expected only the loop, got %v", got)
+	}
+	if got := getRouteOrder(t, store, "?type=Out-And-Back"); len(got) != 1 || got[0] != "canal.gpx" {
+		t.Errorf("Expected only the out-and-back route, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/routes?type=circle", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown type, got %d", rec.Code)
+	}
+}
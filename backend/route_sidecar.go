@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// routeSidecarVersion is bumped whenever the way routes are derived from GPX files
+// changes, so sidecars written by older versions are recomputed
+const routeSidecarVersion = 8
+
+// routePersister persists processed routes so they don't have to be recomputed from
+// their GPX files on every start
+type routePersister interface {
+	Save(route RouteData) error
+	Delete(filename string) error
+	LoadAll() ([]RouteData, error)
+}
+
+// persister is the active route persister
+var persister routePersister = sidecarStore{}
+
+// routeSidecar is the content of a route's JSON sidecar
+type routeSidecar struct {
+	Version    int             `json:"version"`
+	Derivation routeDerivation `json:"derivation"` // The settings the route was derived with
+	Route      RouteData       `json:"route"`
+}
+
+// routeDerivation holds the settings that change the routes derived from GPX files.
+// Sidecars written with other settings are recomputed.
+type routeDerivation struct {
+	DistanceModel           string  `json:"distanceModel"`
+	MinSegmentDistance      float64 `json:"minSegmentDistance"`
+	CoordinatePrecision     int     `json:"coordinatePrecision"`
+	FixSwappedCoordinates   bool    `json:"fixSwappedCoordinates"`
+	WalkingSpeed            float64 `json:"walkingSpeed"`
+	ElevationURL            string  `json:"elevationUrl"`
+	ElevationSampleDistance float64 `json:"elevationSampleDistance"`
+}
+
+// currentRouteDerivation returns the derivation settings of the active configuration
+func currentRouteDerivation() routeDerivation {
+	return routeDerivation{
+		DistanceModel:           config.DistanceModel,
+		MinSegmentDistance:      config.MinSegmentDistance,
+		CoordinatePrecision:     config.CoordinatePrecision,
+		FixSwappedCoordinates:   config.FixSwappedCoordinates,
+		WalkingSpeed:            config.WalkingSpeed,
+		ElevationURL:            config.ElevationURL,
+		ElevationSampleDistance: config.ElevationSampleDistance,
+	}
+}
+
+// sidecarStore keeps each route as a JSON sidecar next to its GPX file in the data
+// directory, e.g. walk.gpx.json for walk.gpx
+type sidecarStore struct{}
+
+// sidecarPath returns the path of the JSON sidecar of a GPX file
+func (sidecarStore) sidecarPath(filename string) string {
+	return filepath.Join(config.DataDir, filename+".json")
+}
+
+// Save writes the route's sidecar
+func (s sidecarStore) Save(route RouteData) error {
+	data, err := json.Marshal(routeSidecar{Version: routeSidecarVersion, Derivation: currentRouteDerivation(), Route: route})
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash can't leave a truncated sidecar behind
+	path := s.sidecarPath(route.Filename)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Delete removes the sidecar of a GPX file, if it has one
+func (s sidecarStore) Delete(filename string) error {
+	if err := os.Remove(s.sidecarPath(filename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// load returns the route from its sidecar if the sidecar is newer than the GPX file and
+// was derived with the current settings
+func (s sidecarStore) load(filename string, gpxInfo os.FileInfo) (RouteData, bool) {
+	info, err := os.Stat(s.sidecarPath(filename))
+	if err != nil || !info.ModTime().After(gpxInfo.ModTime()) {
+		return RouteData{}, false
+	}
+
+	data, err := os.ReadFile(s.sidecarPath(filename))
+	if err != nil {
+		return RouteData{}, false
+	}
+
+	var sidecar routeSidecar
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		slog.Warn("Ignoring an unreadable sidecar", "file", filename, "error", err)
+		return RouteData{}, false
+	}
+	if sidecar.Version != routeSidecarVersion || sidecar.Derivation != currentRouteDerivation() ||
+		sidecar.Route.Filename != filename {
+		return RouteData{}, false
+	}
+
+	// Known points are configuration, not derived from the file
+	annotateKnownPoints(&sidecar.Route)
+	return sidecar.Route, true
+}
+
+// LoadAll returns the routes of all GPX files in the data directory. Up to date sidecars
+// are used as is, other files are parsed and their sidecars rewritten. Files that
+// can't be parsed are skipped.
+func (s sidecarStore) LoadAll() ([]RouteData, error) {
+	files, err := filepath.Glob(filepath.Join(config.DataDir, "*.gpx"))
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded []RouteData
+	cached := 0
+	for _, file := range files {
+		filename := filepath.Base(file)
+		info, err := os.Stat(file)
+		if err != nil {
+			slog.Error("Unable to read a GPX file", "file", filename, "error", err)
+			continue
+		}
+
+		if route, ok := s.load(filename, info); ok {
+			loaded = append(loaded, route)
+			cached++
+			continue
+		}
+
+		route, err := loadRoute(context.Background(), filename)
+		if err != nil {
+			slog.Error("Unable to parse a GPX file", "file", filename, "error", err)
+			continue
+		}
+		if err := s.Save(route); err != nil {
+			slog.Error("Unable to save a sidecar", "file", filename, "error", err)
+		}
+		loaded = append(loaded, route)
+	}
+
+	slog.Info("Loaded routes", "count", len(loaded), "fromSidecars", cached)
+	return loaded, nil
+}
+
+// saveRoute persists a processed route, logging failures since the GPX file remains
+// the source of truth
+func saveRoute(route RouteData) {
+	if err := persister.Save(route); err != nil {
+		slog.Error("Unable to save the processed route", "file", route.Filename, "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSidecarStoreLoadAll(t *testing.T) {
+	dir := withDataDir(t)
+	points := jitteryLine(20)
+	writeTestGPX(t, "walk.gpx", points)
+
+	// The first load parses the GPX file and writes its sidecar
+	loaded, err := persister.LoadAll()
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("Expected one route, got %v, %v", loaded, err)
+	}
+	sidecarPath := filepath.Join(dir, "walk.gpx.json")
+	if _, err := os.Stat(sidecarPath); err != nil {
+		t.Fatalf("Expected a sidecar to be written: %v", err)
+	}
+
+	// A sidecar newer than its GPX file is used instead of parsing
+	var sidecar routeSidecar
+	data, _ := os.ReadFile(sidecarPath)
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatalf("Unable to read sidecar: %v", err)
+	}
+	sidecar.Route.Distance = 123
+	sidecar.Route.OffRoad = true
+	data, _ = json.Marshal(sidecar)
+	os.WriteFile(sidecarPath, data, 0644)
+
+	loaded, _ = persister.LoadAll()
+	if len(loaded) != 1 || loaded[0].Distance != 123 || !loaded[0].OffRoad {
+		t.Errorf("Expected the cached route to be loaded, got %+v", loaded)
+	}
+
+	// Once the GPX file changes, it's parsed again
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "walk.gpx"), future, future); err != nil {
+		t.Fatalf("Unable to touch GPX file: %v", err)
+	}
+
+	loaded, _ = persister.LoadAll()
+	if len(loaded) != 1 || math.Abs(loaded[0].Distance-calculateRouteDistance(points)) > 1e-9 {
+		t.Errorf("Expected the route to be parsed again, got %+v", loaded)
+	}
+}
+
+func TestSidecarStoreRecomputesAfterSettingsChange(t *testing.T) {
+	withDataDir(t)
+	points := jitteryLine(20)
+	writeTestGPX(t, "walk.gpx", points)
+	if _, err := persister.LoadAll(); err != nil {
+		t.Fatalf("Unable to load routes: %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		change func(cfg *Config)
+	}{
+		{"MIN_SEGMENT_DISTANCE", func(cfg *Config) { cfg.MinSegmentDistance = 50 }},
+		{"COORDINATE_PRECISION", func(cfg *Config) { cfg.CoordinatePrecision = 3 }},
+		{"FIX_SWAPPED_COORDINATES", func(cfg *Config) { cfg.FixSwappedCoordinates = !cfg.FixSwappedCoordinates }},
+		{"WALKING_SPEED", func(cfg *Config) { cfg.WalkingSpeed = 2 }},
+		{"DISTANCE_MODEL", func(cfg *Config) { cfg.DistanceModel = distanceModelVincenty }},
+	}
+
+	for _, tc := range testCases {
+		original := config
+		cfg := config
+		tc.change(&cfg)
+		config = cfg
+
+		if _, ok := (sidecarStore{}).load("walk.gpx", gpxFileInfo(t, "walk.gpx")); ok {
+			t.Errorf("%s: Expected the sidecar to be stale", tc.name)
+		}
+		config = original
+	}
+
+	if _, ok := (sidecarStore{}).load("walk.gpx", gpxFileInfo(t, "walk.gpx")); !ok {
+		t.Error("Expected the sidecar to be used with the settings it was written with")
+	}
+}
+
+// gpxFileInfo stats a GPX file in the data directory
+func gpxFileInfo(t *testing.T, filename string) os.FileInfo {
+	t.Helper()
+
+	info, err := os.Stat(filepath.Join(config.DataDir, filename))
+	if err != nil {
+		t.Fatalf("Unable to stat %s: %v", filename, err)
+	}
+	return info
+}
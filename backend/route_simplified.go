@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// defaultSimplifiedTolerance is the tolerance of /routes/{id}/simplified in degrees, about 11 m
+const defaultSimplifiedTolerance = 0.0001
+
+// SimplifiedRoute is a reduced version of a route's track for drawing overviews
+type SimplifiedRoute struct {
+	ID             string       `json:"id"`
+	Filename       string       `json:"filename"`
+	Tolerance      float64      `json:"tolerance"` // Degrees
+	OriginalPoints int          `json:"originalPoints"`
+	Points         []TrackPoint `json:"points"`
+
+	// ReductionRatio is the share of the points left out, e.g. 0.9 when 1 in 10 is kept
+	ReductionRatio float64 `json:"reductionRatio"`
+}
+
+// routeSimplifiedHandler returns the track of the route with the given ID simplified with
+// the Ramer-Douglas-Peucker algorithm, for map clients that don't need every point. The
+// stored route is left as it is, unlike with /routes/{filename}/simplify.
+func routeSimplifiedHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Tolerance is given in degrees, like the coordinates it's compared with
+		tolerance := defaultSimplifiedTolerance
+		if value := r.URL.Query().Get("tolerance"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 || parsed > 1 {
+				writeJSONError(w, http.StatusBadRequest, "Tolerance must be a positive number of degrees up to 1")
+				return
+			}
+			tolerance = parsed
+		}
+
+		route, ok := store.FindByID(r.PathValue("id"))
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		simplified := SimplifiedRoute{
+			ID:             route.ID,
+			Filename:       route.Filename,
+			Tolerance:      tolerance,
+			OriginalPoints: len(route.TrackPoints),
+			Points:         simplifyTrack(route.TrackPoints, tolerance*metersPerDegreeLat/1000),
+		}
+		if simplified.OriginalPoints > 0 {
+			simplified.ReductionRatio = 1 - float64(len(simplified.Points))/float64(simplified.OriginalPoints)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(simplified)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteSimplifiedHandler(t *testing.T) {
+	route := RouteData{ID: "abc", Filename: "line.gpx", TrackPoints: jitteryLine(50)}
+	store := withRoutes(t, route)
+
+	get := func(target string) (*httptest.ResponseRecorder, SimplifiedRoute) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		newServeMux(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		var simplified SimplifiedRoute
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &simplified); err != nil {
+				t.Fatalf("Unable to decode the simplified route: %v", err)
+			}
+		}
+		return rec, simplified
+	}
+
+	// The default tolerance of about 11 m smooths out the 2 m jitter
+	rec, simplified := get("/routes/abc/simplified")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if simplified.Filename != "line.gpx" || simplified.OriginalPoints != 50 || len(simplified.Points) != 2 ||
+		simplified.Tolerance != defaultSimplifiedTolerance || simplified.ReductionRatio != 0.96 {
+		t.Errorf("Expected the line reduced to its endpoints, got %+v", simplified)
+	}
+
+	// A tolerance below the jitter keeps every point
+	if _, simplified := get("/routes/abc/simplified?tolerance=0.00001"); len(simplified.Points) != 50 || simplified.ReductionRatio != 0 {
+		t.Errorf("Expected all 50 points, got %d with ratio %f", len(simplified.Points), simplified.ReductionRatio)
+	}
+
+	// The stored route keeps its points
+	if stored, _ := store.GetByFilename("line.gpx"); len(stored.TrackPoints) != 50 {
+		t.Errorf("Expected the stored route to keep its 50 points, got %d", len(stored.TrackPoints))
+	}
+
+	for target, code := range map[string]int{
+		"/routes/abc/simplified?tolerance=0":    http.StatusBadRequest,
+		"/routes/abc/simplified?tolerance=fine": http.StatusBadRequest,
+		"/routes/missing/simplified":            http.StatusNotFound,
+	} {
+		if rec, _ := get(target); rec.Code != code {
+			t.Errorf("Expected status %d for %s, got %d", code, target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// Errors of RouteStore updates
+var (
+	errRouteNotFound = errors.New("route not found")      // No stored route has the filename
+	errRouteExists   = errors.New("route already exists") // A route with the filename is stored already
+)
+
+// RouteStore holds the processed routes in memory. Routes are identified by the name
+// of their GPX file, which is unique within the data directory. It's safe for
+// concurrent use.
+type RouteStore struct {
+	mu     sync.RWMutex
+	routes []RouteData
+
+	// version is bumped whenever the route set is modified, so data derived from it
+	// can be cached. Guarded by mu.
+	version uint64
+
+	// box is the bounding box of the points of all routes, kept up to date by every
+	// update so suggestions don't scan all points. Guarded by mu.
+	box boundingBox
+
+	// grids caches the coverage grids of the current version
+	grids coverageCache
+
+	// elevations caches the elevation index of the current version
+	elevations elevationIndexCache
+}
+
+// NewRouteStore creates a store holding the given routes
+func NewRouteStore(routes ...RouteData) *RouteStore {
+	routes = append([]RouteData(nil), routes...)
+	return &RouteStore{routes: routes, box: routesBoundingBox(routes)}
+}
+
+// Add stores the route, replacing a stored route with the same filename
+func (s *RouteStore) Add(route RouteData) {
+	s.upsert(route.Filename, func(*RouteData) (RouteData, error) {
+		return route, nil
+	})
+}
+
+// All returns a copy of the stored routes, in the order they were added
+func (s *RouteStore) All() []RouteData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]RouteData(nil), s.routes...)
+}
+
+// Len returns the number of stored routes
+func (s *RouteStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.routes)
+}
+
+// GetByFilename returns the route stored from the given file. Use FindByID to look a
+// route up by the ID clients see.
+func (s *RouteStore) GetByFilename(filename string) (RouteData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.indexOf(filename)
+	if index == -1 {
+		return RouteData{}, false
+	}
+	return s.routes[index], true
+}
+
+// FindByHash returns the route uploaded from a file with the given content hash
+func (s *RouteStore) FindByHash(hash string) (RouteData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, route := range s.routes {
+		if route.ContentHash == hash {
+			return route, true
+		}
+	}
+	return RouteData{}, false
+}
+
+// FindByID returns the route with the given ID
+func (s *RouteStore) FindByID(id string) (RouteData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, route := range s.routes {
+		if route.ID == id {
+			return route, true
+		}
+	}
+	return RouteData{}, false
+}
+
+// DeleteByFilename removes the route stored from the given file, reporting whether it
+// was stored
+func (s *RouteStore) DeleteByFilename(filename string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.indexOf(filename)
+	if index == -1 {
+		return false
+	}
+	s.routes = append(s.routes[:index:index], s.routes[index+1:]...)
+	s.version++
+
+	// The box can't be shrunk incrementally, the deleted route may have defined its edges
+	s.box = routesBoundingBox(s.routes)
+	return true
+}
+
+// BoundingBox returns the bounding box of the points of all stored routes
+func (s *RouteStore) BoundingBox() boundingBox {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.box
+}
+
+// exploredBoundingBox returns the bounding box of the points of the stored routes that
+// aren't flagged as having their coordinates swapped, which may lie far from where they
+// were walked
+func (s *RouteStore) exploredBoundingBox() boundingBox {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var box boundingBox
+	for _, route := range s.routes {
+		if route.CoordinatesSwapped {
+			continue
+		}
+		for _, point := range route.TrackPoints {
+			box.extend(point)
+		}
+	}
+	return box
+}
+
+// indexOf returns the position of the route with the given filename, or -1.
+// The caller must hold mu.
+func (s *RouteStore) indexOf(filename string) int {
+	for i, route := range s.routes {
+		if route.Filename == filename {
+			return i
+		}
+	}
+	return -1
+}
+
+// upsert stores the route returned by fn under the filename, replacing the stored route
+// if there is one. fn is called with the stored route, or nil, while the store is locked
+// for writing, so checks and file changes in it can't interleave with other updates.
+// Nothing is stored if fn fails.
+func (s *RouteStore) upsert(filename string, fn func(existing *RouteData) (RouteData, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.indexOf(filename)
+	var existing *RouteData
+	if index != -1 {
+		existing = &s.routes[index]
+	}
+
+	route, err := fn(existing)
+	if err != nil {
+		return err
+	}
+
+	if index != -1 {
+		// The replaced route may have defined the edges of the box
+		s.routes[index] = route
+		s.box = routesBoundingBox(s.routes)
+	} else {
+		s.routes = append(s.routes, route)
+		for _, point := range route.TrackPoints {
+			s.box.extend(point)
+		}
+	}
+	s.version++
+	return nil
+}
+
+// update replaces the stored route with the given filename by the one returned by fn,
+// failing with errRouteNotFound if there is none
+func (s *RouteStore) update(filename string, fn func(route RouteData) (RouteData, error)) error {
+	return s.upsert(filename, func(existing *RouteData) (RouteData, error) {
+		if existing == nil {
+			return RouteData{}, errRouteNotFound
+		}
+		return fn(*existing)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRouteStore(t *testing.T) {
+	store := NewRouteStore(RouteData{Filename: "park.gpx", Distance: 1, TrackPoints: []TrackPoint{{Latitude: 52.5, Longitude: 13.4}}})
+
+	// Adding a route under a stored filename replaces it
+	store.Add(RouteData{Filename: "river.gpx", TrackPoints: []TrackPoint{{Latitude: 52.6, Longitude: 13.3}}})
+	store.Add(RouteData{Filename: "park.gpx", Distance: 2, TrackPoints: []TrackPoint{{Latitude: 52.4, Longitude: 13.5}}})
+
+	all := store.All()
+	if len(all) != 2 || all[0].Filename != "park.gpx" || all[1].Filename != "river.gpx" {
+		t.Fatalf("Expected park.gpx and river.gpx in the order they were added, got %+v", all)
+	}
+	if route, ok := store.GetByFilename("park.gpx"); !ok || route.Distance != 2 {
+		t.Errorf("Expected the replaced park.gpx, got %+v, %t", route, ok)
+	}
+
+	// All returns a copy
+	all[0].Distance = 99
+	if route, _ := store.GetByFilename("park.gpx"); route.Distance != 2 {
+		t.Errorf("Changing the returned routes must not change the store, got %v", route.Distance)
+	}
+
+	box := store.BoundingBox()
+	expected := boundingBox{minLat: 52.4, maxLat: 52.6, minLng: 13.3, maxLng: 13.5, hasPoints: true}
+	if box != expected {
+		t.Errorf("Expected %+v, got %+v", expected, box)
+	}
+
+	if !store.DeleteByFilename("park.gpx") || store.DeleteByFilename("park.gpx") {
+		t.Errorf("Expected park.gpx to be deleted exactly once")
+	}
+	if _, ok := store.GetByFilename("park.gpx"); ok {
+		t.Errorf("Expected park.gpx to be gone")
+	}
+	if all := store.All(); len(all) != 1 || all[0].Filename != "river.gpx" {
+		t.Errorf("Expected only river.gpx to be left, got %+v", all)
+	}
+
+	// Updates of missing routes fail without adding them
+	err := store.update("missing.gpx", func(route RouteData) (RouteData, error) { return route, nil })
+	if err != errRouteNotFound || len(store.All()) != 1 {
+		t.Errorf("Expected errRouteNotFound and no new route, got %v", err)
+	}
+}
+
+func TestRouteStoreBoundingBoxFollowsUpdates(t *testing.T) {
+	store := NewRouteStore(RouteData{Filename: "park.gpx", TrackPoints: []TrackPoint{{Latitude: 52.5, Longitude: 13.4}}})
+	check := func(action string, expected boundingBox) {
+		t.Helper()
+		if box := store.BoundingBox(); box != expected {
+			t.Errorf("Expected %+v after %s, got %+v", expected, action, box)
+		}
+	}
+	check("creating the store", boundingBox{minLat: 52.5, maxLat: 52.5, minLng: 13.4, maxLng: 13.4, hasPoints: true})
+
+	// A new route extends the box
+	store.Add(RouteData{Filename: "river.gpx", TrackPoints: []TrackPoint{{Latitude: 52.6, Longitude: 13.3}}})
+	check("adding a route", boundingBox{minLat: 52.5, maxLat: 52.6, minLng: 13.3, maxLng: 13.4, hasPoints: true})
+
+	// Replacing or deleting a route on the edge shrinks it again
+	store.Add(RouteData{Filename: "river.gpx", TrackPoints: []TrackPoint{{Latitude: 52.55, Longitude: 13.35}}})
+	check("replacing a route", boundingBox{minLat: 52.5, maxLat: 52.55, minLng: 13.35, maxLng: 13.4, hasPoints: true})
+	store.DeleteByFilename("park.gpx")
+	check("deleting a route", boundingBox{minLat: 52.55, maxLat: 52.55, minLng: 13.35, maxLng: 13.35, hasPoints: true})
+	store.DeleteByFilename("river.gpx")
+	check("deleting all routes", boundingBox{})
+}
+
+func TestRouteStoreBoundingBoxUnderConcurrentUpdates(t *testing.T) {
+	store := NewRouteStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			store.Add(RouteData{
+				Filename:    fmt.Sprintf("route-%d.gpx", i),
+				TrackPoints: []TrackPoint{{Latitude: 52 + float64(i)/100, Longitude: 13}},
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			store.BoundingBox()
+		}()
+	}
+	wg.Wait()
+
+	if box, expected := store.BoundingBox(), routesBoundingBox(store.All()); box != expected {
+		t.Errorf("Expected the box of all routes %+v, got %+v", expected, box)
+	}
+}
+
+// benchmarkRouteStore returns a store of 500 routes with 1000 points each
+func benchmarkRouteStore() *RouteStore {
+	routes := make([]RouteData, 500)
+	for i := range routes {
+		routes[i] = RouteData{Filename: fmt.Sprintf("route-%d.gpx", i), TrackPoints: jitteryLine(1000)}
+	}
+	return NewRouteStore(routes...)
+}
+
+func BenchmarkRouteStoreBoundingBox(b *testing.B) {
+	store := benchmarkRouteStore()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.BoundingBox()
+	}
+}
+
+// BenchmarkRoutesBoundingBoxScan is how the box was found before the store kept it up to date
+func BenchmarkRoutesBoundingBoxScan(b *testing.B) {
+	store := benchmarkRouteStore()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		routesBoundingBox(store.All())
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RouteTrack is the full track of a route, with each point's elevation and time
+type RouteTrack struct {
+	ID       string       `json:"id"`
+	Filename string       `json:"filename"`
+	Points   []TrackPoint `json:"points"`
+}
+
+// routeTrackHandler returns every point of the route with the given ID, including the
+// elevation and timestamp each was recorded with, so clients can chart pace over time
+func routeTrackHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		route, ok := store.FindByID(r.PathValue("id"))
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(RouteTrack{ID: route.ID, Filename: route.Filename, Points: route.TrackPoints})
+	}
+}
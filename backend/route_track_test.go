@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+func TestRouteTrackIncludesTimeAndElevation(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	gpxData := buildTestGPX(jitteryLine(3))
+	points := gpxData.Tracks[0].Segments[0].Points
+	points[0].Timestamp = start
+	points[0].Elevation = *gpx.NewNullableFloat64(34)
+	points[1].Timestamp = start.Add(time.Minute)
+
+	route, err := processGPXData("timed.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store := withRoutes(t, route)
+
+	rec := httptest.NewRecorder()
+	newServeMux(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes/"+route.ID+"/track", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var track RouteTrack
+	if err := json.Unmarshal(rec.Body.Bytes(), &track); err != nil {
+		t.Fatalf("Unable to decode track: %v", err)
+	}
+	if track.ID != route.ID || track.Filename != "timed.gpx" || len(track.Points) != 3 {
+		t.Fatalf("Expected the 3 points of timed.gpx, got %+v", track)
+	}
+	if p := track.Points[0]; p.Time == nil || !p.Time.Equal(start) || !p.HasElevation || p.Elevation != 34 {
+		t.Errorf("Expected the first point at 34 m recorded at %s, got %+v", start, p)
+	}
+	if p := track.Points[1]; p.Time == nil || !p.Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the second point's time, got %+v", p)
+	}
+
+	// Points without a timestamp leave it out
+	if track.Points[2].Time != nil || strings.Count(rec.Body.String(), `"time"`) != 2 {
+		t.Errorf("Expected only 2 points with a time, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	newServeMux(store).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes/unknown/track", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown ID, got %d", rec.Code)
+	}
+}
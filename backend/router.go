@@ -0,0 +1,48 @@
+package main
+
+import "context"
+
+// Router routes through waypoints along streets. The options pick the profile and the
+// other settings of the request, e.g. preferring footpaths.
+type Router interface {
+	Route(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error)
+}
+
+// LoopRouter is a Router that can also route a loop through waypoints in the order that
+// makes it shortest, instead of the given one
+type LoopRouter interface {
+	Router
+	Loop(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error)
+}
+
+// routeLoop routes a loop through the waypoints, in the shortest order if the router can
+func routeLoop(ctx context.Context, router Router, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	if loopRouter, ok := router.(LoopRouter); ok {
+		return loopRouter.Loop(ctx, points, opts)
+	}
+	return router.Route(ctx, points, opts)
+}
+
+// routerFunc adapts a function to the Router interface
+type routerFunc func(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error)
+
+// Route calls the function
+func (f routerFunc) Route(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	return f(ctx, points, opts)
+}
+
+// osrmRouter asks the configured OSRM server, through the route cache and circuit breaker
+type osrmRouter struct{}
+
+// Route calls getRouteFollowingStreets
+func (osrmRouter) Route(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	return getRouteFollowingStreets(ctx, points, opts)
+}
+
+// Loop calls getOptimizedLoop
+func (osrmRouter) Loop(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+	return getOptimizedLoop(ctx, points, opts)
+}
+
+// streetRouter is the router the handlers generate suggestions with
+var streetRouter Router = osrmRouter{}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// routesCSVHeader names the columns of the CSV export
+var routesCSVHeader = []string{
+	"filename", "distance", "duration", "points", "createdAt",
+	"minLat", "minLng", "maxLat", "maxLng",
+}
+
+// routeCSVRecord formats a route as a row of the CSV export
+func routeCSVRecord(route RouteData) []string {
+	route = roundRoute(route)
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	createdAt := ""
+	if !route.CreatedAt.IsZero() {
+		createdAt = route.CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	// Routes without points have an empty bounding box
+	bounds := make([]string, 4)
+	if box := pointsBoundingBox(route.TrackPoints); box.hasPoints {
+		bounds = []string{formatFloat(box.minLat), formatFloat(box.minLng), formatFloat(box.maxLat), formatFloat(box.maxLng)}
+	}
+
+	return append([]string{
+		route.Filename,
+		formatFloat(route.Distance),
+		formatFloat(route.Duration),
+		strconv.Itoa(len(route.TrackPoints)),
+		createdAt,
+	}, bounds...)
+}
+
+// routesCSVHandler exports the statistics of all routes as CSV for spreadsheet analysis
+func routesCSVHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		all := store.All()
+		records := make([][]string, len(all))
+		for i, route := range all {
+			records[i] = routeCSVRecord(route)
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="routes.csv"`)
+
+		writer := csv.NewWriter(w)
+		writer.Write(routesCSVHeader)
+		writer.WriteAll(records)
+		if err := writer.Error(); err != nil {
+			slog.Error("Unable to write the routes CSV", "error", err)
+		}
+	}
+}
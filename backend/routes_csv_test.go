@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRoutesCSV(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	store := withRoutes(t,
+		RouteData{
+			Filename:  "park.gpx",
+			Distance:  2.345678,
+			Duration:  1800,
+			CreatedAt: createdAt,
+			TrackPoints: []TrackPoint{
+				{Latitude: 52.52, Longitude: 13.41},
+				{Latitude: 52.51, Longitude: 13.40},
+				{Latitude: 52.53, Longitude: 13.42},
+			},
+		},
+		RouteData{Filename: "empty.gpx"},
+	)
+
+	rec := httptest.NewRecorder()
+	routesCSVHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/routes.csv", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected Content-Type text/csv, got %q", contentType)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d records", len(records))
+	}
+
+	expectedHeader := []string{"filename", "distance", "duration", "points", "createdAt", "minLat", "minLng", "maxLat", "maxLng"}
+	if !reflect.DeepEqual(records[0], expectedHeader) {
+		t.Errorf("Expected header %v, got %v", expectedHeader, records[0])
+	}
+
+	expectedRow := []string{"park.gpx", "2.35", "1800", "3", "2024-05-01T08:30:00Z", "52.51", "13.4", "52.53", "13.42"}
+	if !reflect.DeepEqual(records[1], expectedRow) {
+		t.Errorf("Expected row %v, got %v", expectedRow, records[1])
+	}
+
+	expectedEmpty := []string{"empty.gpx", "0", "0", "0", "", "", "", "", ""}
+	if !reflect.DeepEqual(records[2], expectedEmpty) {
+		t.Errorf("Expected row %v, got %v", expectedEmpty, records[2])
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// NearbyRoute is a stored route passing within the radius of a query point
+type NearbyRoute struct {
+	ID       string  `json:"id"`
+	Filename string  `json:"filename"`
+	Distance float64 `json:"distance"` // Kilometers from the query point to the closest track point
+}
+
+// nearestPoint returns the distance in kilometers from the target to the closest point of
+// the track. Every point has to be measured, since the first one within a radius isn't
+// necessarily the closest.
+func nearestPoint(points []TrackPoint, target TrackPoint) float64 {
+	nearest := math.Inf(1)
+	for _, point := range points {
+		nearest = math.Min(nearest, haversineDistance(target.Latitude, target.Longitude, point.Latitude, point.Longitude))
+	}
+	return nearest
+}
+
+// nearbyRoutesHandler lists the routes with a track point within radius kilometers of
+// lat, lng, closest first
+func nearbyRoutesHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		query := r.URL.Query()
+		lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+		if err != nil || lat < -90 || lat > 90 {
+			writeJSONError(w, http.StatusBadRequest, "lat must be a latitude from -90 to 90")
+			return
+		}
+		lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+		if err != nil || lng < -180 || lng > 180 {
+			writeJSONError(w, http.StatusBadRequest, "lng must be a longitude from -180 to 180")
+			return
+		}
+		radius, err := strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil || radius <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "radius must be a positive number of kilometers")
+			return
+		}
+		target := TrackPoint{Latitude: lat, Longitude: lng}
+
+		nearby := []NearbyRoute{}
+		for _, route := range store.All() {
+			if distance := nearestPoint(route.TrackPoints, target); distance <= radius {
+				nearby = append(nearby, NearbyRoute{ID: route.ID, Filename: route.Filename, Distance: distance})
+			}
+		}
+
+		sort.SliceStable(nearby, func(i, j int) bool { return nearby[i].Distance < nearby[j].Distance })
+		for i := range nearby {
+			nearby[i].Distance = roundTo(nearby[i].Distance, config.DistancePrecision)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(nearby)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNearbyRoutesHandler(t *testing.T) {
+	cafe := TrackPoint{Latitude: 52.52, Longitude: 13.40}
+	store := withRoutes(t,
+		RouteData{ID: "a1", Filename: "past-the-cafe.gpx", TrackPoints: []TrackPoint{
+			{Latitude: 52.50, Longitude: 13.40},
+			{Latitude: 52.519, Longitude: 13.40},  // About 110 m south of the cafe
+			{Latitude: 52.5199, Longitude: 13.40}, // About 11 m, further along
+			{Latitude: 52.54, Longitude: 13.40},
+		}},
+		RouteData{ID: "b2", Filename: "right-outside.gpx", TrackPoints: []TrackPoint{cafe}},
+		RouteData{ID: "c3", Filename: "across-town.gpx", TrackPoints: squareLoop(1)},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/routes/near?lat=52.52&lng=13.40&radius=0.2", nil)
+	rec := httptest.NewRecorder()
+	nearbyRoutesHandler(store)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var nearby []NearbyRoute
+	if err := json.NewDecoder(rec.Body).Decode(&nearby); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if len(nearby) != 2 || nearby[0].ID != "b2" || nearby[1].Filename != "past-the-cafe.gpx" {
+		t.Fatalf("Expected the two routes passing the cafe, closest first, got %+v", nearby)
+	}
+	if nearby[0].Distance != 0 || nearby[1].Distance != 0.01 {
+		t.Errorf("Expected distances of 0 and 0.01 km to the closest points, got %+v", nearby)
+	}
+
+	for _, query := range []string{"lat=52.52&lng=13.40", "lat=95&lng=13.40&radius=1", "lat=52.52&lng=x&radius=1", "lat=52.52&lng=13.40&radius=-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/routes/near?"+query, nil)
+		rec := httptest.NewRecorder()
+		nearbyRoutesHandler(store)(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knownActivityTypes are the activity types accepted by the activity filter
+var knownActivityTypes = map[string]bool{
+	"walking": true,
+	"hiking":  true,
+	"running": true,
+	"cycling": true,
+}
+
+// parseActivityType validates the activity query parameter, ignoring case.
+// An empty value means no filtering.
+func parseActivityType(value string) (string, error) {
+	activity := strings.ToLower(strings.TrimSpace(value))
+	if activity != "" && !knownActivityTypes[activity] {
+		return "", fmt.Errorf("unknown activity %q, expected walking, hiking, running or cycling", value)
+	}
+	return activity, nil
+}
+
+// knownSources are the route origins accepted by the source filter
+var knownSources = map[string]bool{
+	sourceUploaded:  true,
+	sourceSuggested: true,
+	sourceImported:  true,
+}
+
+// knownRouteTypes are the route types accepted by the type filter
+var knownRouteTypes = map[string]bool{
+	routeTypeLoop:         true,
+	routeTypeOutAndBack:   true,
+	routeTypePointToPoint: true,
+}
+
+// routeFilter selects routes by their properties. Empty fields match every route.
+type routeFilter struct {
+	Activity string
+	Source   string
+	Weather  string
+	Type     string
+}
+
+// parseRouteFilter reads and validates the filter query parameters of /routes
+func parseRouteFilter(query url.Values) (routeFilter, error) {
+	activity, err := parseActivityType(query.Get("activity"))
+	if err != nil {
+		return routeFilter{}, err
+	}
+
+	source := strings.ToLower(strings.TrimSpace(query.Get("source")))
+	if source != "" && !knownSources[source] {
+		return routeFilter{}, fmt.Errorf("unknown source %q, expected uploaded, suggested or imported", query.Get("source"))
+	}
+
+	routeType := strings.ToLower(strings.TrimSpace(query.Get("type")))
+	if routeType != "" && !knownRouteTypes[routeType] {
+		return routeFilter{}, fmt.Errorf("unknown type %q, expected loop, out-and-back or point-to-point", query.Get("type"))
+	}
+
+	return routeFilter{
+		Activity: activity,
+		Source:   source,
+		Weather:  normalizeWeather(query.Get("weather")),
+		Type:     routeType,
+	}, nil
+}
+
+// matches reports whether the route passes the filter
+func (f routeFilter) matches(route RouteData) bool {
+	if f.Activity != "" && route.ActivityType != f.Activity {
+		return false
+	}
+	if f.Source != "" && route.Source != f.Source {
+		return false
+	}
+	if f.Weather != "" && route.Weather != f.Weather {
+		return false
+	}
+	if f.Type != "" && route.Type != f.Type {
+		return false
+	}
+	return true
+}
+
+// filterRoutes returns the routes matching the filter
+func filterRoutes(routes []RouteData, filter routeFilter) []RouteData {
+	if filter == (routeFilter{}) {
+		return routes
+	}
+
+	var filtered []RouteData
+	for _, route := range routes {
+		if filter.matches(route) {
+			filtered = append(filtered, route)
+		}
+	}
+	return filtered
+}
+
+// defaultSortOrder is the direction used when a sort key is given without an order.
+// Names read naturally A to Z; everything else puts the biggest, longest or newest first.
+var defaultSortOrder = map[string]string{
+	"filename":  "asc",
+	"distance":  "desc",
+	"duration":  "desc",
+	"created":   "desc",
+	"walkcount": "desc",
+}
+
+// sortRoutes orders routes in place by the given key ("filename", "distance", "duration",
+// "created" or "walkcount") and order ("asc" or "desc"). "name" is accepted for "filename".
+// Without a key, routes are sorted by filename. Routes with equal keys are ordered by filename.
+func sortRoutes(routes []RouteData, key, order string) error {
+	if key == "" || key == "name" {
+		key = "filename"
+	}
+
+	order = strings.ToLower(order)
+	if order == "" {
+		order = defaultSortOrder[key]
+	}
+	if order != "asc" && order != "desc" {
+		return fmt.Errorf("unknown order %q, expected asc or desc", order)
+	}
+
+	var less func(a, b RouteData) bool
+	switch key {
+	case "filename":
+		less = func(a, b RouteData) bool { return a.Filename < b.Filename }
+	case "distance":
+		less = func(a, b RouteData) bool { return a.Distance < b.Distance }
+	case "duration":
+		less = func(a, b RouteData) bool { return a.Duration < b.Duration }
+	case "created":
+		less = func(a, b RouteData) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	case "walkcount":
+		less = func(a, b RouteData) bool { return a.WalkCount < b.WalkCount }
+	default:
+		return fmt.Errorf("unknown sort %q, expected filename, distance, duration, created or walkcount", key)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if order == "desc" {
+			a, b = b, a
+		}
+		switch {
+		case less(a, b):
+			return true
+		case less(b, a):
+			return false
+		}
+		// Ties go by filename, ascending in either order, so they don't depend on the stored order
+		return routes[i].Filename < routes[j].Filename
+	})
+
+	return nil
+}
+
+// Page sizes of the /routes listing
+const (
+	defaultRoutesPageSize = 50
+	maxRoutesPageSize     = 500
+)
+
+// RoutesPage is one page of the /routes listing
+type RoutesPage struct {
+	Total  int         `json:"total"` // Number of routes matching the filter across all pages
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  []RouteData `json:"items"`
+}
+
+// parsePagination reads and validates the limit and offset query parameters of /routes
+func parsePagination(query url.Values) (offset, limit int, err error) {
+	limit = defaultRoutesPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxRoutesPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxRoutesPageSize)
+		}
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+	}
+
+	return offset, limit, nil
+}
+
+// paginate returns the page of routes starting at offset with at most limit routes
+func paginate(routes []RouteData, offset, limit int) []RouteData {
+	if offset >= len(routes) {
+		return []RouteData{}
+	}
+	return routes[offset:min(offset+limit, len(routes))]
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sortTestRoutes returns routes whose name, distance and creation order all differ
+func sortTestRoutes() []RouteData {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 8, 0, 0, 0, time.UTC) }
+	return []RouteData{
+		{Filename: "bravo.gpx", Distance: 3, Duration: 1800, CreatedAt: day(1), WalkCount: 2},
+		{Filename: "charlie.gpx", Distance: 1, Duration: 3600, CreatedAt: day(3), WalkCount: 1},
+		{Filename: "alpha.gpx", Distance: 2, Duration: 900, CreatedAt: day(2), WalkCount: 5},
+	}
+}
+
+// getRouteOrder requests /routes with the given query and returns the filenames in order
+func getRouteOrder(t *testing.T, store *RouteStore, query string) []string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/routes"+query, nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %q, got %d: %s", query, rec.Code, rec.Body.String())
+	}
+
+	var page RoutesPage
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	got := page.Items
+
+	names := make([]string, len(got))
+	for i, route := range got {
+		names[i] = route.Filename
+	}
+	return names
+}
+
+func TestRoutesHandlerSortOrders(t *testing.T) {
+	store := withRoutes(t, sortTestRoutes()...)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"alpha.gpx", "bravo.gpx", "charlie.gpx"}},
+		{"?sort=filename&order=desc", []string{"charlie.gpx", "bravo.gpx", "alpha.gpx"}},
+		{"?sort=created", []string{"charlie.gpx", "alpha.gpx", "bravo.gpx"}},
+		{"?sort=created&order=asc", []string{"bravo.gpx", "alpha.gpx", "charlie.gpx"}},
+		{"?sort=name", []string{"alpha.gpx", "bravo.gpx", "charlie.gpx"}},
+		{"?sort=name&order=desc", []string{"charlie.gpx", "bravo.gpx", "alpha.gpx"}},
+		{"?sort=distance", []string{"bravo.gpx", "alpha.gpx", "charlie.gpx"}},
+		{"?sort=distance&order=asc", []string{"charlie.gpx", "alpha.gpx", "bravo.gpx"}},
+		{"?sort=duration", []string{"charlie.gpx", "bravo.gpx", "alpha.gpx"}},
+		{"?sort=walkcount", []string{"alpha.gpx", "bravo.gpx", "charlie.gpx"}},
+	}
+
+	for _, tt := range tests {
+		got := getRouteOrder(t, store, tt.query)
+		if len(got) != len(tt.want) {
+			t.Fatalf("Expected %d routes for %q, got %v", len(tt.want), tt.query, got)
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("Expected order %v for %q, got %v", tt.want, tt.query, got)
+				break
+			}
+		}
+	}
+
+	// The stored routes keep their original order
+	if first := store.All()[0]; first.Filename != "bravo.gpx" {
+		t.Errorf("Sorting must not reorder the stored routes, got %s first", first.Filename)
+	}
+}
+
+func TestRoutesHandlerBreaksTiesByFilename(t *testing.T) {
+	day := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	store := withRoutes(t,
+		RouteData{Filename: "river.gpx", Distance: 2, CreatedAt: day},
+		RouteData{Filename: "long.gpx", Distance: 5, CreatedAt: day.Add(time.Hour)},
+		RouteData{Filename: "park.gpx", Distance: 2, CreatedAt: day},
+	)
+
+	// Equal distances and creation times come out by filename in either order
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?sort=distance", []string{"long.gpx", "park.gpx", "river.gpx"}},
+		{"?sort=distance&order=asc", []string{"park.gpx", "river.gpx", "long.gpx"}},
+		{"?sort=created", []string{"long.gpx", "park.gpx", "river.gpx"}},
+		{"?sort=created&order=asc", []string{"park.gpx", "river.gpx", "long.gpx"}},
+	}
+
+	for _, tt := range tests {
+		got := getRouteOrder(t, store, tt.query)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Expected order %v for %q, got %v", tt.want, tt.query, got)
+		}
+	}
+}
+
+func TestRoutesHandlerPaginates(t *testing.T) {
+	var many []RouteData
+	for i := 0; i < 120; i++ {
+		many = append(many, RouteData{Filename: fmt.Sprintf("walk-%03d.gpx", 119-i), Distance: float64(i)})
+	}
+	store := withRoutes(t, many...)
+
+	listPage := func(query string) RoutesPage {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/routes"+query, nil)
+		rec := httptest.NewRecorder()
+		routesHandler(store)(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+
+		var page RoutesPage
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("Unable to decode response: %v", err)
+		}
+		return page
+	}
+
+	// By default the first 50 routes by filename are returned
+	page := listPage("")
+	if page.Total != 120 || page.Limit != 50 || len(page.Items) != 50 ||
+		page.Items[0].Filename != "walk-000.gpx" || page.Items[49].Filename != "walk-049.gpx" {
+		t.Errorf("Expected walk-000 to walk-049 of 120 routes, got %d items of %d", len(page.Items), page.Total)
+	}
+
+	page = listPage("?sort=distance&order=asc&limit=10&offset=100")
+	if page.Total != 120 || page.Offset != 100 || len(page.Items) != 10 || page.Items[0].Distance != 100 {
+		t.Errorf("Expected the routes of 100 to 109 km, got %d items starting at %v", len(page.Items), page.Items)
+	}
+
+	// The last page is short and pages past the end are empty, not null
+	if page := listPage("?offset=110"); len(page.Items) != 10 {
+		t.Errorf("Expected 10 routes on the last page, got %d", len(page.Items))
+	}
+	if page := listPage("?offset=500"); page.Items == nil || len(page.Items) != 0 || page.Total != 120 {
+		t.Errorf("Expected an empty page past the end, got %+v", page)
+	}
+
+	// The stored routes keep their original order
+	if first := store.All()[0]; first.Filename != "walk-119.gpx" {
+		t.Errorf("Sorting must not reorder the stored routes, got %s first", first.Filename)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?limit=ten", "?offset=-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/routes"+query, nil)
+		rec := httptest.NewRecorder()
+		routesHandler(store)(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestRoutesHandlerRejectsUnknownSort(t *testing.T) {
+	store := withRoutes(t, sortTestRoutes()...)
+
+	for _, query := range []string{"?sort=color", "?sort=name&order=sideways"} {
+		req := httptest.NewRequest(http.MethodGet, "/routes"+query, nil)
+		rec := httptest.NewRecorder()
+		routesHandler(store)(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestRouteCreatedAt(t *testing.T) {
+	withDataDir(t)
+
+	start := time.Date(2024, 6, 1, 9, 30, 0, 0, time.UTC)
+	points := []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}}
+
+	// The first timestamped point wins
+	gpxData := buildTestGPX(points)
+	gpxData.Tracks[0].Segments[0].Points[0].Timestamp = start
+	route, err := processGPXData("timed.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !route.CreatedAt.Equal(start) {
+		t.Errorf("Expected CreatedAt %v, got %v", start, route.CreatedAt)
+	}
+
+	// The streaming parser must agree
+	streamed, err := streamGPXRoute("timed.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if !streamed.CreatedAt.Equal(start) {
+		t.Errorf("Expected streamed CreatedAt %v, got %v", start, streamed.CreatedAt)
+	}
+
+	// Without timestamps, the file's modification time is used
+	writeTestGPX(t, "untimed.gpx", points)
+	before := time.Now().Add(-time.Minute)
+	route, err = loadRoute(context.Background(), "untimed.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load route: %v", err)
+	}
+	if route.CreatedAt.Before(before) {
+		t.Errorf("Expected CreatedAt from the file modification time, got %v", route.CreatedAt)
+	}
+
+	// Metadata time is used before the file modification time
+	gpxData = buildTestGPX(points)
+	gpxData.Time = &start
+	route, err = processGPXData("metadata.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !route.CreatedAt.Equal(start) {
+		t.Errorf("Expected CreatedAt from metadata %v, got %v", start, route.CreatedAt)
+	}
+}
+
+func TestRoutesHandlerActivityFilter(t *testing.T) {
+	store := withRoutes(t,
+		RouteData{Filename: "forest.gpx", ActivityType: "hiking"},
+		RouteData{Filename: "park.gpx", ActivityType: "running"},
+		RouteData{Filename: "ridge.gpx", ActivityType: "hiking"},
+		RouteData{Filename: "untyped.gpx"},
+	)
+
+	got := getRouteOrder(t, store, "?activity=HIKING&sort=name")
+	if len(got) != 2 || got[0] != "forest.gpx" || got[1] != "ridge.gpx" {
+		t.Errorf("Expected only the hiking routes, got %v", got)
+	}
+
+	if got := getRouteOrder(t, store, "?activity=cycling"); len(got) != 0 {
+		t.Errorf("Expected no cycling routes, got %v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/routes?activity=swimming", nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown activity, got %d", rec.Code)
+	}
+}
+
+func TestActivityTypeParsing(t *testing.T) {
+	gpxData := buildTestGPX([]TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}})
+	gpxData.Tracks[0].Type = " Hiking "
+
+	route, err := processGPXData("typed.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if route.ActivityType != "hiking" {
+		t.Errorf("Expected activity type hiking, got %q", route.ActivityType)
+	}
+
+	streamed, err := streamGPXRoute("typed.gpx", bytes.NewReader(testGPXBytes(t, gpxData)))
+	if err != nil {
+		t.Fatalf("Unexpected streaming error: %v", err)
+	}
+	if streamed.ActivityType != "hiking" {
+		t.Errorf("Expected streamed activity type hiking, got %q", streamed.ActivityType)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// SaveRouteRequest is the body of POST /routes, typically a suggestion the user wants to keep
+type SaveRouteRequest struct {
+	Filename string       `json:"filename"` // Optional, generated from the current time if empty
+	Points   []TrackPoint `json:"points"`
+}
+
+// newTrackGPX builds a GPX document with a single track through the points
+func newTrackGPX(name string, points []TrackPoint) *gpx.GPX {
+	segment := gpx.GPXTrackSegment{}
+	for _, p := range points {
+		segment.Points = append(segment.Points, gpx.GPXPoint{
+			Point: gpx.Point{Latitude: p.Latitude, Longitude: p.Longitude},
+		})
+	}
+
+	return &gpx.GPX{
+		Creator: "walkassistant",
+		Tracks: []gpx.GPXTrack{{
+			Name:     name,
+			Segments: []gpx.GPXTrackSegment{segment},
+		}},
+	}
+}
+
+// saveSuggestedRoute stores a suggested route as a GPX file so it can be
+// walked later. The route is marked with the "suggested" source.
+func saveSuggestedRoute(store *RouteStore, w http.ResponseWriter, r *http.Request) {
+	var body SaveRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(body.Points) < 2 {
+		writeJSONError(w, http.StatusBadRequest, "A route needs at least 2 points")
+		return
+	}
+
+	filename := body.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("suggested-%s.gpx", time.Now().Format("20060102-150405"))
+	}
+	if filepath.Base(filename) != filename || !strings.HasSuffix(strings.ToLower(filename), ".gpx") {
+		writeJSONError(w, http.StatusBadRequest, "Filename must be a plain .gpx file name")
+		return
+	}
+
+	var route RouteData
+	failure := "Unable to save route"
+	err := store.upsert(filename, func(existing *RouteData) (RouteData, error) {
+		if existing != nil {
+			return RouteData{}, errRouteExists
+		}
+		if err := os.MkdirAll(config.DataDir, os.ModePerm); err != nil {
+			return RouteData{}, err
+		}
+
+		name := strings.TrimSuffix(filename, filepath.Ext(filename))
+		if err := writeGPX(filename, newTrackGPX(name, body.Points)); err != nil {
+			return RouteData{}, err
+		}
+
+		var err error
+		route, err = loadRoute(r.Context(), filename)
+		if err != nil {
+			failure = "Unable to process saved route"
+			return RouteData{}, err
+		}
+
+		meta, err := updateRouteMeta(filename, func(meta *routeMeta) {
+			meta.Source = sourceSuggested
+			meta.WalkCount = 0
+			meta.OffRoad = false
+			meta.CoordinatesSwapped = false
+			meta.ID = ""
+		})
+		if err != nil {
+			slog.Error("Unable to save the route index", "error", err)
+		}
+		applyRouteMeta(&route, meta)
+		saveRoute(route)
+		return route, nil
+	})
+	if errors.Is(err, errRouteExists) {
+		writeJSONError(w, http.StatusConflict, "A route with this filename already exists")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, failure)
+		return
+	}
+
+	slog.Info("Saved a suggested route", "file", filename, "points", len(route.TrackPoints))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(roundRoute(route))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postRoute sends a POST /routes request with the given JSON body
+func postRoute(t *testing.T, store *RouteStore, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+	return rec
+}
+
+func TestSaveSuggestedRoute(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t, RouteData{Filename: "walk.gpx", Source: sourceUploaded, WalkCount: 1})
+
+	rec := postRoute(t, store, `{"filename":"plan.gpx","points":[{"lat":52.52,"lng":13.40},{"lat":52.53,"lng":13.41}]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var saved RouteData
+	if err := json.NewDecoder(rec.Body).Decode(&saved); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+	if saved.Source != sourceSuggested || saved.WalkCount != 0 || len(saved.TrackPoints) != 2 {
+		t.Errorf("Expected an unwalked suggested route with 2 points, got %+v", saved)
+	}
+
+	// The source filter tells planned routes from recorded ones
+	if got := getRouteOrder(t, store, "?source=suggested"); len(got) != 1 || got[0] != "plan.gpx" {
+		t.Errorf("Expected only plan.gpx for source=suggested, got %v", got)
+	}
+	if got := getRouteOrder(t, store, "?source=uploaded"); len(got) != 1 || got[0] != "walk.gpx" {
+		t.Errorf("Expected only walk.gpx for source=uploaded, got %v", got)
+	}
+
+	// The source survives a restart
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload route index: %v", err)
+	}
+	if meta := getRouteMeta("plan.gpx"); meta.Source != sourceSuggested {
+		t.Errorf("Expected the persisted source to be suggested, got %q", meta.Source)
+	}
+
+	// Saving over an existing route is refused
+	rec = postRoute(t, store, `{"filename":"plan.gpx","points":[{"lat":52.52,"lng":13.40},{"lat":52.53,"lng":13.41}]}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate filename, got %d", rec.Code)
+	}
+}
+
+func TestSaveSuggestedRouteValidation(t *testing.T) {
+	withDataDir(t)
+	store := withRoutes(t)
+
+	for _, body := range []string{
+		`not json`,
+		`{"points":[{"lat":52.52,"lng":13.40}]}`,
+		`{"filename":"../escape.gpx","points":[{"lat":52.52,"lng":13.40},{"lat":52.53,"lng":13.41}]}`,
+		`{"filename":"plan.txt","points":[{"lat":52.52,"lng":13.40},{"lat":52.53,"lng":13.41}]}`,
+	} {
+		if rec := postRoute(t, store, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/routes?source=dreamed", nil)
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown source, got %d", rec.Code)
+	}
+}
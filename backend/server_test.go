@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startServer serves the handler on a local port until the returned cancel is called,
+// with serve's result sent on the channel
+func startServer(t *testing.T, handler http.HandlerFunc, timeout time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: handler}, listener, timeout)
+	}()
+	return "http://" + listener.Addr().String(), cancel, done
+}
+
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	url, cancel, done := startServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("uploaded"))
+	}, time.Second)
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+
+	// Stop while the request is still being handled
+	<-started
+	cancel()
+
+	if body := <-response; body != "uploaded" {
+		t.Errorf("Expected the request in flight to finish, got %q", body)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+
+	if _, err := http.Get(url); err == nil {
+		t.Error("Expected no new connections after shutting down")
+	}
+}
+
+func TestServeGivesUpAfterTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	url, cancel, done := startServer(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}, 50*time.Millisecond)
+
+	go http.Get(url)
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error for a request outlasting the timeout")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the server to stop after the timeout")
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/tkrajina/gpxgo/gpx"
+)
+
+// simplifyTrack reduces the number of points in a track using the Ramer-Douglas-Peucker
+// algorithm. epsilon is the maximum allowed deviation from the original track in kilometers.
+// The first and last points are always kept, so closed loops stay closed.
+func simplifyTrack(points []TrackPoint, epsilon float64) []TrackPoint {
+	indices := simplifyIndices(points, epsilon)
+
+	simplified := make([]TrackPoint, len(indices))
+	for i, index := range indices {
+		simplified[i] = points[index]
+	}
+
+	return simplified
+}
+
+// simplifyIndices returns the indices of the points kept by the Ramer-Douglas-Peucker algorithm
+func simplifyIndices(points []TrackPoint, epsilon float64) []int {
+	if len(points) <= 2 {
+		indices := make([]int, len(points))
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices
+	}
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	// Use an explicit stack instead of recursion so very long tracks can't blow the stack
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		start, end := span[0], span[1]
+
+		// Find the point farthest from the segment between start and end
+		maxDistance := 0.0
+		farthest := -1
+		for i := start + 1; i < end; i++ {
+			d := perpendicularDistance(points[i], points[start], points[end])
+			if d > maxDistance {
+				maxDistance = d
+				farthest = i
+			}
+		}
+
+		// Keep the farthest point if it deviates too much and split the span around it
+		if farthest != -1 && maxDistance > epsilon {
+			keep[farthest] = true
+			stack = append(stack, [2]int{start, farthest}, [2]int{farthest, end})
+		}
+	}
+
+	var indices []int
+	for i, kept := range keep {
+		if kept {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// simplifyToCount reduces a track to at most maxPoints points with a ranked variant of
+// the Ramer-Douglas-Peucker algorithm: starting from the endpoints, the point deviating
+// most from the simplified track is added until maxPoints are kept, so sharp turns are
+// kept before points on straight stretches.
+func simplifyToCount(points []TrackPoint, maxPoints int) []TrackPoint {
+	if len(points) <= maxPoints || len(points) <= 2 {
+		return points
+	}
+	maxPoints = max(maxPoints, 2)
+
+	keep := make([]bool, len(points))
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	spans := &spanHeap{}
+	pushSpan := func(start, end int) {
+		span := deviatingSpan{start: start, end: end, farthest: -1}
+		for i := start + 1; i < end; i++ {
+			if d := perpendicularDistance(points[i], points[start], points[end]); d > span.deviation {
+				span.deviation = d
+				span.farthest = i
+			}
+		}
+		if span.farthest != -1 {
+			heap.Push(spans, span)
+		}
+	}
+	pushSpan(0, len(points)-1)
+
+	for kept := 2; kept < maxPoints && spans.Len() > 0; kept++ {
+		span := heap.Pop(spans).(deviatingSpan)
+		keep[span.farthest] = true
+		pushSpan(span.start, span.farthest)
+		pushSpan(span.farthest, span.end)
+	}
+
+	var simplified []TrackPoint
+	for i, kept := range keep {
+		if kept {
+			simplified = append(simplified, points[i])
+		}
+	}
+
+	return simplified
+}
+
+// deviatingSpan is a stretch of a track between two kept points together with
+// the point between them that deviates most from the straight line
+type deviatingSpan struct {
+	start, end int
+	farthest   int
+	deviation  float64
+}
+
+// spanHeap is a max-heap of spans ordered by deviation
+type spanHeap []deviatingSpan
+
+func (h spanHeap) Len() int           { return len(h) }
+func (h spanHeap) Less(i, j int) bool { return h[i].deviation > h[j].deviation }
+func (h spanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *spanHeap) Push(x any)        { *h = append(*h, x.(deviatingSpan)) }
+func (h *spanHeap) Pop() any {
+	old := *h
+	span := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return span
+}
+
+// perpendicularDistance returns the distance in kilometers from p to the segment a-b.
+// Coordinates are projected onto a local plane, which is accurate enough for the short
+// segments found in walking tracks.
+func perpendicularDistance(p, a, b TrackPoint) float64 {
+	// Earth's radius in kilometers
+	const R = 6371.0
+
+	// Project to kilometers relative to a
+	cosLat := math.Cos(a.Latitude * math.Pi / 180)
+	toXY := func(point TrackPoint) (float64, float64) {
+		x := (point.Longitude - a.Longitude) * math.Pi / 180 * R * cosLat
+		y := (point.Latitude - a.Latitude) * math.Pi / 180 * R
+		return x, y
+	}
+
+	px, py := toXY(p)
+	bx, by := toXY(b)
+
+	// Degenerate segment (e.g. the start and end of a closed loop)
+	lengthSquared := bx*bx + by*by
+	if lengthSquared == 0 {
+		return math.Hypot(px, py)
+	}
+
+	// Project p onto the segment, clamping to its endpoints
+	t := (px*bx + py*by) / lengthSquared
+	t = math.Max(0, math.Min(1, t))
+
+	return math.Hypot(px-t*bx, py-t*by)
+}
+
+// errRouteChanged is returned when a route is modified while it's being simplified
+var errRouteChanged = errors.New("route changed while simplifying")
+
+// simplifyRouteHandler simplifies a stored route in place, updating both the in-memory
+// route and its GPX file. The route keeps its ID, which is kept in the route index since
+// it can no longer be derived from the points.
+func simplifyRouteHandler(store *RouteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		filename := r.PathValue("filename")
+
+		// Tolerance is given in meters
+		tolerance, err := strconv.ParseFloat(r.URL.Query().Get("tolerance"), 64)
+		if err != nil || tolerance <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Tolerance must be a positive number of meters")
+			return
+		}
+
+		stored, ok := store.GetByFilename(filename)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		}
+
+		// The file is parsed, simplified and written next to the original without holding
+		// the store's lock, only swapping them is done under it
+		route, tmpPath, failure, err := simplifyGPXFile(r.Context(), filename, tolerance)
+		if err != nil {
+			slog.ErrorContext(r.Context(), failure, "file", filename, "error", err)
+			writeJSONError(w, http.StatusInternalServerError, failure)
+			return
+		}
+
+		defer os.Remove(tmpPath)
+
+		err = store.update(filename, func(current RouteData) (RouteData, error) {
+			if current.ID != stored.ID || len(current.TrackPoints) != len(stored.TrackPoints) {
+				return RouteData{}, errRouteChanged
+			}
+			if err := os.Rename(tmpPath, filepath.Join(config.DataDir, filename)); err != nil {
+				return RouteData{}, err
+			}
+
+			// Keep the ID and metadata that don't come from the GPX file
+			meta, err := updateRouteMeta(filename, func(meta *routeMeta) {
+				meta.ID = stored.ID
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Unable to save the route index", "error", err)
+			}
+			route.CreatedAt = stored.CreatedAt
+			applyRouteMeta(&route, meta)
+			return route, nil
+		})
+		switch {
+		case errors.Is(err, errRouteNotFound):
+			writeJSONError(w, http.StatusNotFound, "Route not found")
+			return
+		case errors.Is(err, errRouteChanged):
+			writeJSONError(w, http.StatusConflict, "The route was changed meanwhile, try again")
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "Unable to save simplified GPX file")
+			return
+		}
+		saveRoute(route)
+
+		slog.Info("Simplified a route", "file", filename, "from", len(stored.TrackPoints), "to", len(route.TrackPoints))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"filename":       filename,
+			"originalPoints": len(stored.TrackPoints),
+			"points":         len(route.TrackPoints),
+			"distance":       roundTo(route.Distance, config.DistancePrecision),
+		})
+	}
+}
+
+// simplifyGPXFile simplifies each segment of a GPX file in the data directory on its own,
+// so segment boundaries are preserved, and writes the result to a temporary file next to
+// it. It returns the route of the simplified file and the path of the temporary file, or
+// a message for the client with the error.
+func simplifyGPXFile(ctx context.Context, filename string, tolerance float64) (RouteData, string, string, error) {
+	gpxData, err := parseGPX(ctx, filename)
+	if err != nil {
+		return RouteData{}, "", "Unable to parse GPX file", err
+	}
+
+	for t := range gpxData.Tracks {
+		for s := range gpxData.Tracks[t].Segments {
+			segment := &gpxData.Tracks[t].Segments[s]
+
+			points := make([]TrackPoint, len(segment.Points))
+			for i, point := range segment.Points {
+				points[i] = TrackPoint{Latitude: point.Latitude, Longitude: point.Longitude}
+			}
+
+			indices := simplifyIndices(points, tolerance/1000.0)
+			kept := segment.Points[:0]
+			for _, i := range indices {
+				kept = append(kept, segment.Points[i])
+			}
+			segment.Points = kept
+		}
+	}
+
+	route, err := processGPXData(filename, gpxData)
+	if err != nil {
+		return RouteData{}, "", "Unable to process GPX data", err
+	}
+	enrichElevation(ctx, &route) // Like loadRoute, so looked up elevation isn't lost
+
+	// Concurrent requests each get a file of their own
+	xmlBytes, err := gpxData.ToXml(gpx.ToXmlParams{Version: "1.1", Indent: true})
+	if err != nil {
+		return RouteData{}, "", "Unable to save simplified GPX file", err
+	}
+	tmp, err := os.CreateTemp(config.DataDir, filename+".*.tmp")
+	if err != nil {
+		return RouteData{}, "", "Unable to save simplified GPX file", err
+	}
+	_, err = tmp.Write(xmlBytes)
+	if err == nil {
+		err = tmp.Chmod(0644) // Like the other GPX files
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return RouteData{}, "", "Unable to save simplified GPX file", err
+	}
+	return route, tmp.Name(), "", nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// jitteryLine returns a roughly straight track heading east with small sideways noise
+func jitteryLine(count int) []TrackPoint {
+	var points []TrackPoint
+	for i := 0; i < count; i++ {
+		// Alternate about 2 meters north and south of the line
+		offset := 0.00002
+		if i%2 == 1 {
+			offset = -offset
+		}
+		points = append(points, TrackPoint{
+			Latitude:  52.52 + offset,
+			Longitude: 13.40 + float64(i)*0.001,
+		})
+	}
+	return points
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	points := jitteryLine(50)
+
+	simplified := simplifyTrack(points, 0.01) // 10 meters
+	if len(simplified) >= len(points) {
+		t.Errorf("Expected fewer points after simplification, got %d (original %d)", len(simplified), len(points))
+	}
+
+	// Endpoints must be preserved
+	if simplified[0] != points[0] || simplified[len(simplified)-1] != points[len(points)-1] {
+		t.Errorf("Simplification must preserve the first and last points")
+	}
+
+	// A loop must stay closed
+	loop := []TrackPoint{
+		{Latitude: 52.52, Longitude: 13.40},
+		{Latitude: 52.52, Longitude: 13.45},
+		{Latitude: 52.5201, Longitude: 13.4501},
+		{Latitude: 52.56, Longitude: 13.45},
+		{Latitude: 52.56, Longitude: 13.40},
+		{Latitude: 52.52, Longitude: 13.40},
+	}
+	simplifiedLoop := simplifyTrack(loop, 0.05)
+	if simplifiedLoop[0] != simplifiedLoop[len(simplifiedLoop)-1] {
+		t.Errorf("Expected simplified loop to stay closed, got %v", simplifiedLoop)
+	}
+	if len(simplifiedLoop) != 5 {
+		t.Errorf("Expected the near-duplicate corner to be removed, got %d points", len(simplifiedLoop))
+	}
+}
+
+// windingLoop returns a closed loop of count points around a circle with about a 1 km
+// radius whose edge winds in and out, like a walk along curving streets
+func windingLoop(count int) []TrackPoint {
+	const lat, lng = 52.52, 13.40
+	points := make([]TrackPoint, count)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / float64(count-1)
+		radius := 1 + 0.15*math.Sin(12*angle)
+		points[i] = TrackPoint{
+			Latitude:  lat + radius/111.195*math.Sin(angle),
+			Longitude: lng + radius/(111.195*math.Cos(lat*math.Pi/180))*math.Cos(angle),
+		}
+	}
+	return points
+}
+
+func TestSimplificationPreservesDistance(t *testing.T) {
+	points := windingLoop(1000)
+	original := calculateRouteDistance(points)
+
+	tests := []struct {
+		name       string
+		simplified []TrackPoint
+		maxPoints  int
+	}{
+		{"simplifyTrack", simplifyTrack(points, 0.005), len(points)},
+		{"simplifyToCount", simplifyToCount(points, 100), 100},
+	}
+
+	for _, tc := range tests {
+		if len(tc.simplified) > tc.maxPoints || len(tc.simplified) >= len(points) {
+			t.Errorf("%s: Expected at most %d points, got %d", tc.name, tc.maxPoints, len(tc.simplified))
+		}
+
+		// Cutting corners only ever shortens a track, but not by much
+		distance := calculateRouteDistance(tc.simplified)
+		if distance > original || distance < original*0.98 {
+			t.Errorf("%s: Expected a distance within 2%% below %f km, got %f km with %d points",
+				tc.name, original, distance, len(tc.simplified))
+		}
+	}
+}
+
+func TestPerpendicularDistance(t *testing.T) {
+	a := TrackPoint{Latitude: 0, Longitude: 0}
+	b := TrackPoint{Latitude: 0, Longitude: 1}
+	p := TrackPoint{Latitude: 0.01, Longitude: 0.5}
+
+	// 0.01 degrees of latitude is about 1.11 km
+	if d := perpendicularDistance(p, a, b); math.Abs(d-1.11) > 0.01 {
+		t.Errorf("Expected distance around 1.11 km, got %f km", d)
+	}
+
+	// Points beyond the segment are measured to the nearest endpoint
+	beyond := TrackPoint{Latitude: 0, Longitude: 1.01}
+	if d := perpendicularDistance(beyond, a, b); math.Abs(d-1.11) > 0.01 {
+		t.Errorf("Expected distance to endpoint around 1.11 km, got %f km", d)
+	}
+}
+
+func TestSimplifyRouteHandler(t *testing.T) {
+	dir := withDataDir(t)
+
+	points := jitteryLine(50)
+	gpxData := writeTestGPX(t, "jittery.gpx", points)
+	route, err := processGPXData("jittery.gpx", gpxData)
+	if err != nil {
+		t.Fatalf("Unable to process test GPX: %v", err)
+	}
+	store := withRoutes(t, route)
+
+	req := httptest.NewRequest(http.MethodPost, "/routes/jittery.gpx/simplify?tolerance=10", nil)
+	req.SetPathValue("filename", "jittery.gpx")
+	rec := httptest.NewRecorder()
+	simplifyRouteHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Points   int     `json:"points"`
+		Distance float64 `json:"distance"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Unable to decode response: %v", err)
+	}
+
+	if resp.Points >= len(points) {
+		t.Errorf("Expected point count to drop below %d, got %d", len(points), resp.Points)
+	}
+
+	// Removing the jitter can only shorten the route slightly
+	if math.Abs(resp.Distance-route.Distance) > route.Distance*0.01 {
+		t.Errorf("Expected distance to stay within 1%% of %f km, got %f km", route.Distance, resp.Distance)
+	}
+
+	// The stored route and GPX file must both be updated
+	stored, _ := store.GetByFilename("jittery.gpx")
+	storedPoints := len(stored.TrackPoints)
+	if storedPoints != resp.Points {
+		t.Errorf("Expected stored route to have %d points, got %d", resp.Points, storedPoints)
+	}
+
+	reparsed, err := parseGPX(context.Background(), "jittery.gpx")
+	if err != nil {
+		t.Fatalf("Unable to parse simplified GPX: %v", err)
+	}
+	if n := reparsed.GetTrackPointsNo(); n != resp.Points {
+		t.Errorf("Expected GPX file to have %d points, got %d", resp.Points, n)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Expected no temporary files to be left, got %v", leftovers)
+	}
+
+	// The ID is kept in the index, so it survives the route being derived again
+	if stored.ID != route.ID {
+		t.Errorf("Expected the route to keep ID %s, got %s", route.ID, stored.ID)
+	}
+	if err := persister.Delete("jittery.gpx"); err != nil {
+		t.Fatalf("Unable to remove the sidecar: %v", err)
+	}
+	if err := loadRouteIndex(); err != nil {
+		t.Fatalf("Unable to reload the route index: %v", err)
+	}
+	restarted := NewRouteStore(loadExistingGPXFiles()...)
+	if reloaded, ok := restarted.GetByFilename("jittery.gpx"); !ok || reloaded.ID != route.ID || len(reloaded.TrackPoints) != resp.Points {
+		t.Errorf("Expected the simplified route with ID %s after a restart, got %+v", route.ID, reloaded)
+	}
+}
+
+func TestSimplifyRouteHandlerKeepsLookedUpElevation(t *testing.T) {
+	withElevationService(t, northSlope)
+	withDataDir(t)
+
+	// Recorded without elevation, so it's looked up when loaded
+	writeTestGPX(t, "north.gpx", northLine(100))
+	route, err := loadRoute(context.Background(), "north.gpx")
+	if err != nil {
+		t.Fatalf("Unable to load test route: %v", err)
+	}
+	store := withRoutes(t, route)
+
+	req := httptest.NewRequest(http.MethodPost, "/routes/north.gpx/simplify?tolerance=10", nil)
+	req.SetPathValue("filename", "north.gpx")
+	rec := httptest.NewRecorder()
+	simplifyRouteHandler(store)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, _ := store.GetByFilename("north.gpx")
+	if len(stored.TrackPoints) >= len(route.TrackPoints) {
+		t.Errorf("Expected the straight line to be simplified, got %d points", len(stored.TrackPoints))
+	}
+	for i, point := range stored.TrackPoints {
+		if !point.HasElevation {
+			t.Fatalf("Expected point %d to keep its looked up elevation, got %+v", i, point)
+		}
+	}
+	if math.Abs(stored.TotalAscent-route.TotalAscent) > 1e-6 || math.Abs(stored.NetElevation-route.NetElevation) > 1e-6 {
+		t.Errorf("Expected %.0f m ascent and %.0f m net elevation, got %.0f m and %.0f m",
+			route.TotalAscent, route.NetElevation, stored.TotalAscent, stored.NetElevation)
+	}
+}
+
+func TestSimplifyRouteHandlerErrors(t *testing.T) {
+	store := withRoutes(t)
+
+	testCases := []struct {
+		url      string
+		expected int
+	}{
+		{"/routes/missing.gpx/simplify?tolerance=10", http.StatusNotFound},
+		{"/routes/missing.gpx/simplify?tolerance=-1", http.StatusBadRequest},
+		{"/routes/missing.gpx/simplify", http.StatusBadRequest},
+	}
+
+	for i, tc := range testCases {
+		req := httptest.NewRequest(http.MethodPost, tc.url, nil)
+		req.SetPathValue("filename", "missing.gpx")
+		rec := httptest.NewRecorder()
+		simplifyRouteHandler(store)(rec, req)
+
+		if rec.Code != tc.expected {
+			t.Errorf("Test case %d: Expected status %d, got %d", i, tc.expected, rec.Code)
+		}
+	}
+}
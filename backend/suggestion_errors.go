@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the suggestion pipeline, mapped to status codes by suggestionErrorStatus
+var (
+	errNoRoutes              = errors.New("no routes have been uploaded to base suggestions on")
+	errImpossibleConstraints = errors.New("the distance constraints can't be satisfied")
+	errExceedsMaxDistance    = errors.New("no route within the maximum distance could be found")
+
+	errExceedsMaxElevationGain = errors.New("no route within the maximum elevation gain could be found")
+	errElevationUnavailable    = errors.New("the elevation service is unavailable")
+)
+
+// validateDistanceConstraints checks that some route could satisfy the distance options
+func validateDistanceConstraints(opts SuggestOptions) error {
+	if opts.MinDistance < 0 || opts.MaxDistance < 0 {
+		return fmt.Errorf("%w: distances must not be negative", errImpossibleConstraints)
+	}
+	if opts.MaxDistance > 0 && opts.MinDistance > opts.MaxDistance {
+		return fmt.Errorf("%w: minDistance %.2f km is larger than maxDistance %.2f km",
+			errImpossibleConstraints, opts.MinDistance, opts.MaxDistance)
+	}
+	return nil
+}
+
+// suggestionErrorStatus returns the HTTP status code for an error from the suggestion pipeline
+func suggestionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoRoutes), errors.Is(err, errImpossibleConstraints), errors.Is(err, errExceedsMaxDistance),
+		errors.Is(err, errExceedsMaxElevationGain):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errCoverageGridTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, errOSRMUnavailable), errors.Is(err, errElevationUnavailable):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeSuggestionError responds with the status code of a suggestion error and a JSON
+// body explaining it. Unexpected errors aren't exposed to the client.
+func writeSuggestionError(w http.ResponseWriter, err error) {
+	status := suggestionErrorStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = "Unable to generate suggested routes"
+	}
+
+	writeJSONError(w, status, message)
+}
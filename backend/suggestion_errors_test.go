@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSuggestionErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{errNoRoutes, http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: min above max", errImpossibleConstraints), http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: 12 km", errExceedsMaxDistance), http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: 600x600 cells", errCoverageGridTooLarge), http.StatusBadRequest},
+		{fmt.Errorf("street routing: %w", errOSRMUnavailable), http.StatusBadGateway},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		if status := suggestionErrorStatus(tc.err); status != tc.status {
+			t.Errorf("%v: Expected status %d, got %d", tc.err, tc.status, status)
+		}
+	}
+}
+
+func TestSuggestHandlerErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		routes []RouteData
+		query  string
+		status int
+	}{
+		{"no routes", nil, "followStreets=false", http.StatusUnprocessableEntity},
+		{"min above max", []RouteData{coverageTestRoute}, "minDistance=10&maxDistance=5", http.StatusUnprocessableEntity},
+		{"grid too large", []RouteData{coverageTestRoute}, "followStreets=false&coverage=true&cellSize=10&padding=20000", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		store := withRoutes(t, tc.routes...)
+
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?"+tc.query, nil))
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: Expected status %d, got %d: %s", tc.name, tc.status, rec.Code, rec.Body.String())
+			continue
+		}
+
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Error == "" {
+			t.Errorf("%s: Expected a JSON error message, got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSuggestionHistory is the number of suggestions remembered for the history endpoint
+const maxSuggestionHistory = 50
+
+// SuggestionRecord is a previously generated suggestion
+type SuggestionRecord struct {
+	ID        int            `json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Route     SuggestedRoute `json:"route"`
+}
+
+// suggestionHistory keeps the most recent suggestions in a fixed-size ring buffer,
+// so old ones are overwritten instead of accumulating in memory
+type suggestionHistory struct {
+	mu      sync.Mutex
+	records []SuggestionRecord
+	next    int // Position the next record is written to
+	count   int
+	lastID  int
+}
+
+// suggestionLog remembers the suggestions returned by /suggest
+var suggestionLog = newSuggestionHistory(maxSuggestionHistory)
+
+// newSuggestionHistory creates a history holding up to capacity suggestions
+func newSuggestionHistory(capacity int) *suggestionHistory {
+	return &suggestionHistory{records: make([]SuggestionRecord, capacity)}
+}
+
+// add records suggestions generated at the given time and returns their records
+func (h *suggestionHistory) add(now time.Time, suggested ...SuggestedRoute) []SuggestionRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	added := make([]SuggestionRecord, len(suggested))
+	for i, route := range suggested {
+		h.lastID++
+		added[i] = SuggestionRecord{ID: h.lastID, CreatedAt: now, Route: route}
+		h.records[h.next] = added[i]
+		h.next = (h.next + 1) % len(h.records)
+		if h.count < len(h.records) {
+			h.count++
+		}
+	}
+
+	return added
+}
+
+// get returns the remembered suggestion with the given ID, if it hasn't been overwritten yet
+func (h *suggestionHistory) get(id int) (SuggestionRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := 0; i < h.count; i++ {
+		if h.records[i].ID == id {
+			return h.records[i], true
+		}
+	}
+
+	return SuggestionRecord{}, false
+}
+
+// recent returns the suggestions generated within ttl before now, newest first
+func (h *suggestionHistory) recent(now time.Time, ttl time.Duration) []SuggestionRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := []SuggestionRecord{}
+	for i := 1; i <= h.count; i++ {
+		record := h.records[(h.next-i+len(h.records))%len(h.records)]
+		if now.Sub(record.CreatedAt) > ttl {
+			// Older records were added even earlier
+			break
+		}
+		result = append(result, record)
+	}
+
+	return result
+}
+
+// reset forgets all recorded suggestions
+func (h *suggestionHistory) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = make([]SuggestionRecord, len(h.records))
+	h.next, h.count, h.lastID = 0, 0, 0
+}
+
+// suggestionHistoryHandler lists the suggestions generated within the configured TTL
+func suggestionHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestionLog.recent(time.Now(), config.SuggestionHistoryTTL))
+}
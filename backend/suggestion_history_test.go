@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSuggestionHistoryListsGeneratedSuggestions(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	var generated []SuggestedRoute
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false", nil)
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, req)
+
+		var suggested []SuggestedRoute
+		if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil {
+			t.Fatalf("Unable to decode suggestions: %v", err)
+		}
+		generated = append(generated, suggested...)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/suggestions/history", nil)
+	rec := httptest.NewRecorder()
+	suggestionHistoryHandler(rec, req)
+
+	var history []SuggestionRecord
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("Unable to decode history: %v", err)
+	}
+	if len(history) != len(generated) {
+		t.Fatalf("Expected %d suggestions in the history, got %d", len(generated), len(history))
+	}
+
+	// Newest first
+	for i, record := range history {
+		want := generated[len(generated)-1-i]
+		if record.Route.Distance != want.Distance || len(record.Route.Points) != len(want.Points) {
+			t.Errorf("Expected history entry %d to be %+v, got %+v", i, want, record.Route)
+		}
+	}
+}
+
+func TestSuggestionHistoryIsBounded(t *testing.T) {
+	history := newSuggestionHistory(3)
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 5; i++ {
+		history.add(start.Add(time.Duration(i)*time.Minute), SuggestedRoute{Distance: float64(i)})
+	}
+
+	recent := history.recent(start.Add(5*time.Minute), time.Hour)
+	if len(recent) != 3 || recent[0].Route.Distance != 5 || recent[2].Route.Distance != 3 {
+		t.Errorf("Expected the 3 newest suggestions, got %+v", recent)
+	}
+
+	// Suggestions older than the TTL are left out
+	recent = history.recent(start.Add(5*time.Minute), 90*time.Second)
+	if len(recent) != 2 {
+		t.Errorf("Expected 2 suggestions within the TTL, got %d", len(recent))
+	}
+}
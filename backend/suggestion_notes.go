@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Notes added to suggestions, telling users why one doesn't look like what they asked for
+const (
+	noteOSRMUnreachable    = "OSRM unreachable, the route doesn't follow streets"
+	noteOutsideExplored    = "street route outside explored area, the route doesn't follow streets"
+	noteScaled             = "fell back to mathematical scaling, the route may cut across blocks"
+	noteZigzags            = "extended with zigzags to reach the minimum distance, the route no longer follows streets"
+	noteEstimatedDistance  = "OSRM reported no usable distance, it was estimated from the route's extent"
+	noteShorterThanMinimum = "no street route reached the minimum distance, this is the longest one found"
+)
+
+// addNote adds the note to the suggestion, unless it's there already
+func (r *SuggestedRoute) addNote(note string) {
+	for _, existing := range r.Notes {
+		if existing == note {
+			return
+		}
+	}
+	r.Notes = append(r.Notes, note)
+}
+
+// streetRoutingNote explains a failed street routing request: OSRM being unreachable,
+// whether the circuit breaker gave up on it or the connection failed, or OSRM's own error
+func streetRoutingNote(err error) string {
+	var netErr net.Error
+	if errors.Is(err, errOSRMUnavailable) || errors.As(err, &netErr) {
+		return noteOSRMUnreachable
+	}
+	return fmt.Sprintf("street routing failed: %v, the route doesn't follow streets", err)
+}
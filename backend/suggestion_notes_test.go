@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestStreetRoutingNote(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		note string
+	}{
+		{"circuit breaker open", errOSRMUnavailable, noteOSRMUnreachable},
+		{"connection failure", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, noteOSRMUnreachable},
+		{"OSRM error", errors.New("OSRM API did not return a valid route: NoRoute"),
+			"street routing failed: OSRM API did not return a valid route: NoRoute, the route doesn't follow streets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if note := streetRoutingNote(tt.err); note != tt.note {
+				t.Errorf("Expected %q, got %q", tt.note, note)
+			}
+		})
+	}
+}
+
+func TestAddNoteSkipsDuplicates(t *testing.T) {
+	var route SuggestedRoute
+	route.addNote(noteScaled)
+	route.addNote(noteOutsideExplored)
+	route.addNote(noteScaled)
+	if len(route.Notes) != 2 {
+		t.Errorf("Expected 2 notes, got %q", route.Notes)
+	}
+}
+
+func TestSuggestionNotesExplainFallbacks(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	opts := SuggestOptions{FollowStreets: true}
+
+	// OSRM being unreachable leaves the perimeter
+	unreachable := routerFunc(func(context.Context, []TrackPoint, SuggestOptions) (SuggestedRoute, error) {
+		return SuggestedRoute{}, errOSRMUnavailable
+	})
+	suggested, err := generateSuggestedRoutes(context.Background(), unreachable, store, opts)
+	if err != nil || suggested[0].FollowsStreets || len(suggested[0].Notes) != 1 || suggested[0].Notes[0] != noteOSRMUnreachable {
+		t.Errorf("Expected a perimeter noting that OSRM is unreachable, got %+v, %v", suggested, err)
+	}
+
+	// A street route far from the existing ones is rejected
+	faraway := routerFunc(func(ctx context.Context, points []TrackPoint, opts SuggestOptions) (SuggestedRoute, error) {
+		return SuggestedRoute{Points: []TrackPoint{{Latitude: 48.1, Longitude: 11.5}, {Latitude: 48.2, Longitude: 11.6}},
+			Distance: 1, FollowsStreets: true}, nil
+	})
+	strict := 1.0
+	opts.BoundsStrictness = &strict
+	suggested, err = generateSuggestedRoutes(context.Background(), faraway, store, opts)
+	if err != nil || suggested[0].FollowsStreets || len(suggested[0].Notes) != 1 || suggested[0].Notes[0] != noteOutsideExplored {
+		t.Errorf("Expected a perimeter noting the route is outside the explored area, got %+v, %v", suggested, err)
+	}
+
+	// A street route that can't be fitted to the maximum distance is scaled
+	route := fittingTestRoute()
+	router, _ := stubRouter(3.0, 3.0, 3.0)
+	fitted := fitRouteToMaxDistance(context.Background(), router, route, route.Points, pointsCentroid(route.Points), 2.0, SuggestOptions{})
+	if len(fitted.Notes) != 1 || !strings.Contains(fitted.Notes[0], "mathematical scaling") {
+		t.Errorf("Expected a note on the scaling, got %q", fitted.Notes)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+)
+
+// refreshWaypoints is the number of waypoints a refreshed variant is routed through.
+// Routing through fewer points than the original lets OSRM pick other streets between them.
+const refreshWaypoints = 8
+
+// refreshDistanceTolerance is how much, as a fraction, a variant's distance may differ from
+// the original's before its waypoints are rescaled to bring it closer
+const refreshDistanceTolerance = 0.15
+
+// RefreshSuggestionsRequest is the body of POST /suggestions/refresh
+type RefreshSuggestionsRequest struct {
+	IDs []int `json:"ids"` // IDs from the suggestion history
+}
+
+// SuggestionRefresh is a new variant of a previously generated suggestion
+type SuggestionRefresh struct {
+	OriginalID int             `json:"originalId"`
+	ID         int             `json:"id,omitempty"` // History ID of the variant, so it can be refreshed again
+	Route      *SuggestedRoute `json:"route,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// shiftedStart returns the route walked from a different starting point. Loops start a
+// third of the way around instead, other routes are walked in the opposite direction.
+func shiftedStart(points []TrackPoint) []TrackPoint {
+	shifted := make([]TrackPoint, 0, len(points))
+
+	isLoop := len(points) > 3 && haversineDistance(points[0].Latitude, points[0].Longitude,
+		points[len(points)-1].Latitude, points[len(points)-1].Longitude) <= loopSnapTolerance
+	if !isLoop {
+		for i := len(points) - 1; i >= 0; i-- {
+			shifted = append(shifted, points[i])
+		}
+		return shifted
+	}
+
+	// Leave out the closing point, rotate and close the loop again at the new start
+	open := points[:len(points)-1]
+	offset := len(open) / 3
+	shifted = append(shifted, open[offset:]...)
+	shifted = append(shifted, open[:offset]...)
+	return append(shifted, shifted[0])
+}
+
+// suggestionVariant generates a new variant of a suggestion with a similar length. The
+// variant starts elsewhere along the route and, for street routes, is routed again through
+// fewer waypoints so OSRM picks an alternative path.
+func suggestionVariant(ctx context.Context, original SuggestedRoute, opts SuggestOptions) (SuggestedRoute, error) {
+	if len(original.Points) < 2 {
+		return SuggestedRoute{}, fmt.Errorf("suggestion has no route to vary")
+	}
+
+	variant := original
+	variant.Points = shiftedStart(original.Points)
+	variant.Directions = nil
+	variant.StartLabel, variant.EndLabel, variant.Comparison = "", "", ""
+	if !original.FollowsStreets || !opts.FollowStreets {
+		return variant, nil
+	}
+
+	waypoints := shiftedStart(simplifyToCount(original.Points, refreshWaypoints))
+	streetRoute, err := getRouteFollowingStreets(ctx, waypoints, opts)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to route a suggestion variant, keeping the original streets", "error", err)
+		variant.Reason = fmt.Sprintf("street routing failed: %v", err)
+		variant.addNote(fmt.Sprintf("street routing failed: %v, kept the original streets", err))
+		return variant, nil
+	}
+
+	// Scale the waypoints once if the alternative path is much longer or shorter
+	target := original.Distance
+	if target > 0 && streetRoute.Distance > 0 &&
+		math.Abs(streetRoute.Distance-target)/target > refreshDistanceTolerance {
+		slog.DebugContext(ctx, "Suggestion variant has another distance, rescaling its waypoints",
+			"distance", streetRoute.Distance, "target", target)
+		rescaled, err := getRouteFollowingStreets(ctx, adjustRouteDistance(waypoints, target/streetRoute.Distance), opts)
+		if err == nil && math.Abs(rescaled.Distance-target) < math.Abs(streetRoute.Distance-target) {
+			streetRoute = rescaled
+		}
+	}
+
+	return streetRoute, nil
+}
+
+// refreshSuggestionsHandler regenerates fresh variants of the given suggestions from the
+// history. Suggestions that can't be found or varied are reported with an error of their own.
+func refreshSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var body RefreshSuggestionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if len(body.IDs) == 0 || len(body.IDs) > maxSuggestionHistory {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d suggestion IDs are required", maxSuggestionHistory))
+		return
+	}
+
+	opts := SuggestOptions{FollowStreets: r.URL.Query().Get("followStreets") != "false"}
+	if err := parseStreetOptions(r.URL.Query(), &opts); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	refreshed := make([]SuggestionRefresh, len(body.IDs))
+	for i, id := range body.IDs {
+		refreshed[i].OriginalID = id
+
+		record, ok := suggestionLog.get(id)
+		if !ok {
+			refreshed[i].Error = "suggestion not found"
+			continue
+		}
+
+		variant, err := suggestionVariant(r.Context(), record.Route, opts)
+		if err != nil {
+			refreshed[i].Error = err.Error()
+			continue
+		}
+
+		variants := []SuggestedRoute{variant}
+		addLocationLabels(r.Context(), variants)
+		addBounds(variants)
+		variants = roundSuggestions(variants)
+
+		added := suggestionLog.add(time.Now(), variants...)
+		refreshed[i].ID = added[0].ID
+		refreshed[i].Route = &variants[0]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refreshed)
+}
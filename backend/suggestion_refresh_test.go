@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waypointsOSRMServer stubs OSRM with routes running straight through the requested
+// waypoints, reported 5% longer than the straight lines as streets rarely are straight
+func waypointsOSRMServer(t *testing.T) {
+	t.Helper()
+
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var waypoints []TrackPoint
+		for _, coordinate := range strings.Split(path.Base(r.URL.Path), ";") {
+			var point TrackPoint
+			fmt.Sscanf(coordinate, "%f,%f", &point.Longitude, &point.Latitude)
+			waypoints = append(waypoints, point)
+		}
+
+		distance := calculateRouteDistance(waypoints) * 1050
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"code":"Ok","routes":[{"geometry":%q,"distance":%f,"duration":600}]}`,
+			encodePolyline(waypoints, polyline6Precision), distance)
+	})
+}
+
+func TestRefreshSuggestionsReturnsComparableVariants(t *testing.T) {
+	waypointsOSRMServer(t)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	street := SuggestedRoute{Points: squareLoop(1), Distance: 4, FollowsStreets: true}
+	straight := SuggestedRoute{Points: jitteryLine(20), DistanceIsEstimate: true}
+	straight.Distance = calculateRouteDistance(straight.Points)
+	saved := suggestionLog.add(time.Now(), street, straight)
+
+	ids := []int{saved[0].ID, saved[1].ID, 999}
+	body, _ := json.Marshal(RefreshSuggestionsRequest{IDs: ids})
+	req := httptest.NewRequest(http.MethodPost, "/suggestions/refresh", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	refreshSuggestionsHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var refreshed []SuggestionRefresh
+	if err := json.NewDecoder(rec.Body).Decode(&refreshed); err != nil {
+		t.Fatalf("Unable to decode refreshed suggestions: %v", err)
+	}
+	if len(refreshed) != len(ids) {
+		t.Fatalf("Expected %d results, got %d", len(ids), len(refreshed))
+	}
+
+	for i, original := range []SuggestedRoute{street, straight} {
+		result := refreshed[i]
+		if result.OriginalID != ids[i] || result.Route == nil {
+			t.Fatalf("Expected a variant of suggestion %d, got %+v", ids[i], result)
+		}
+
+		variant := *result.Route
+		if variant.Points[0] == original.Points[0] {
+			t.Errorf("Expected variant %d to start elsewhere than %v", i, original.Points[0])
+		}
+		if variant.FollowsStreets != original.FollowsStreets {
+			t.Errorf("Expected variant %d to keep followsStreets %t", i, original.FollowsStreets)
+		}
+		if math.Abs(variant.Distance-original.Distance)/original.Distance > refreshDistanceTolerance {
+			t.Errorf("Expected variant %d to be about %.2f km, got %.2f km", i, original.Distance, variant.Distance)
+		}
+
+		// Variants are remembered, so they can be refreshed again
+		if _, ok := suggestionLog.get(result.ID); !ok || result.ID == result.OriginalID {
+			t.Errorf("Expected variant %d to be added to the history, got ID %d", i, result.ID)
+		}
+	}
+
+	if missing := refreshed[2]; missing.Route != nil || missing.Error == "" {
+		t.Errorf("Expected an error for the unknown suggestion, got %+v", missing)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+)
+
+// maxSuggestionCount caps the suggestions of a single request, each costing several OSRM requests
+const maxSuggestionCount = 5
+
+// variantRotation is how many degrees each further suggestion of a request turns its seed
+// points. Spreading the variants over half a turn keeps them apart for both rectangles,
+// which repeat every quarter turn, and diagonals, which repeat every half turn.
+const variantRotation = 180.0 / maxSuggestionCount
+
+// suggestVariants generates count suggestions, each from its own Variant of the options,
+// so they start at other corners and head in other directions. A variant that fails is
+// left out; only if all of them fail is the first error returned.
+func suggestVariants(ctx context.Context, count int, opts SuggestOptions,
+	generate func(SuggestOptions) ([]SuggestedRoute, error)) ([]SuggestedRoute, error) {
+	var suggested []SuggestedRoute
+	var firstErr error
+	for variant := 0; variant < count && ctx.Err() == nil; variant++ {
+		variantOpts := opts
+		variantOpts.Variant = variant
+
+		routes, err := generate(variantOpts)
+		if err != nil {
+			slog.InfoContext(ctx, "Unable to generate a suggestion", "variant", variant, "count", count, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		suggested = append(suggested, routes...)
+	}
+
+	if len(suggested) == 0 {
+		return nil, firstErr
+	}
+	return suggested, nil
+}
+
+// variantPoints turns the seed points around the center for the options' variant. Closed
+// loops also start at another corner. Variant 0 returns the points unchanged.
+func variantPoints(points []TrackPoint, center TrackPoint, variant int) []TrackPoint {
+	if variant == 0 {
+		return points
+	}
+
+	rotated := rotatePoints(points, center, float64(variant)*variantRotation)
+	if len(rotated) > 2 && rotated[0] == rotated[len(rotated)-1] {
+		rotated = startAtCorner(rotated, variant)
+	}
+	return rotated
+}
+
+// rotatePoints turns the points clockwise by the given degrees around the center, so a
+// point north of it ends up east of it after 90 degrees. Longitudes are scaled by the
+// center's latitude to keep the shape from being stretched.
+func rotatePoints(points []TrackPoint, center TrackPoint, degrees float64) []TrackPoint {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	lngScale := math.Cos(center.Latitude * math.Pi / 180)
+
+	rotated := make([]TrackPoint, len(points))
+	for i, p := range points {
+		north := p.Latitude - center.Latitude
+		east := (p.Longitude - center.Longitude) * lngScale
+		rotated[i] = TrackPoint{
+			Latitude:  center.Latitude + north*cos - east*sin,
+			Longitude: center.Longitude + (east*cos+north*sin)/lngScale,
+		}
+	}
+	return rotated
+}
+
+// startAtCorner returns the closed loop starting and ending at its corner-th point
+func startAtCorner(loop []TrackPoint, corner int) []TrackPoint {
+	open := loop[:len(loop)-1]
+	corner %= len(open)
+
+	shifted := make([]TrackPoint, 0, len(loop))
+	shifted = append(shifted, open[corner:]...)
+	shifted = append(shifted, open[:corner]...)
+	return append(shifted, shifted[0])
+}
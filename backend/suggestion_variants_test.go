@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRotatePoints(t *testing.T) {
+	center := TrackPoint{Latitude: 52.52, Longitude: 13.4}
+	north := TrackPoint{Latitude: 52.53, Longitude: 13.4}
+
+	// A quarter turn moves a point north of the center as far east of it
+	east := rotatePoints([]TrackPoint{north}, center, 90)[0]
+	if math.Abs(east.Latitude-center.Latitude) > 1e-9 || east.Longitude <= center.Longitude {
+		t.Fatalf("Expected a point east of the center, got %+v", east)
+	}
+	before := haversineDistance(center.Latitude, center.Longitude, north.Latitude, north.Longitude)
+	after := haversineDistance(center.Latitude, center.Longitude, east.Latitude, east.Longitude)
+	if math.Abs(before-after) > 0.001 {
+		t.Errorf("Expected the point to stay %.3f km from the center, got %.3f km", before, after)
+	}
+
+	// A half turn moves it south
+	if south := rotatePoints([]TrackPoint{north}, center, 180)[0]; math.Abs(south.Latitude-52.51) > 1e-9 ||
+		math.Abs(south.Longitude-center.Longitude) > 1e-9 {
+		t.Errorf("Expected a point south of the center, got %+v", south)
+	}
+}
+
+func TestVariantPointsStartAtAnotherCorner(t *testing.T) {
+	square := squareLoop(1)
+	center := pointsCentroid(square[:len(square)-1])
+
+	if unchanged := variantPoints(square, center, 0); &unchanged[0] != &square[0] {
+		t.Error("Expected variant 0 to keep the points")
+	}
+
+	shifted := startAtCorner(square, 1)
+	if len(shifted) != len(square) || shifted[0] != square[1] || shifted[len(shifted)-1] != square[1] {
+		t.Errorf("Expected a closed loop starting at the second corner, got %v", shifted)
+	}
+
+	variant := variantPoints(square, center, 2)
+	if variant[0] != variant[len(variant)-1] {
+		t.Errorf("Expected the variant to stay closed, got %v", variant)
+	}
+	if expected := rotatePoints(square, center, 2*variantRotation)[2]; variant[0] != expected {
+		t.Errorf("Expected the variant to start at the turned third corner %+v, got %+v", expected, variant[0])
+	}
+}
+
+func TestSuggestVariantsSkipsFailedVariants(t *testing.T) {
+	errFailed := errors.New("failed")
+	var variants []int
+	generate := func(opts SuggestOptions) ([]SuggestedRoute, error) {
+		variants = append(variants, opts.Variant)
+		if opts.Variant == 1 {
+			return nil, errFailed
+		}
+		return []SuggestedRoute{{Distance: float64(opts.Variant)}}, nil
+	}
+
+	suggested, err := suggestVariants(context.Background(), 3, SuggestOptions{}, generate)
+	if err != nil || len(suggested) != 2 || suggested[0].Distance != 0 || suggested[1].Distance != 2 {
+		t.Fatalf("Expected variants 0 and 2, got %+v, %v", suggested, err)
+	}
+	if len(variants) != 3 {
+		t.Errorf("Expected 3 variants to be generated, got %v", variants)
+	}
+
+	failing := func(SuggestOptions) ([]SuggestedRoute, error) { return nil, errFailed }
+	if _, err := suggestVariants(context.Background(), 2, SuggestOptions{}, failing); !errors.Is(err, errFailed) {
+		t.Errorf("Expected the error when all variants fail, got %v", err)
+	}
+}
+
+func TestSuggestReturnsRequestedCount(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false&count=3", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var suggested []SuggestedRoute
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 3 {
+		t.Fatalf("Expected three suggestions, got %v, %v", suggested, err)
+	}
+	for i := 1; i < len(suggested); i++ {
+		if suggested[i].Points[0] == suggested[0].Points[0] {
+			t.Errorf("Expected suggestion %d to start elsewhere than the first, both start at %+v", i+1, suggested[0].Points[0])
+		}
+	}
+
+	for _, count := range []string{"0", "6", "two"} {
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false&count="+count, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for count=%s, got %d", count, rec.Code)
+		}
+	}
+}
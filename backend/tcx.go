@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tkrajina/gpxgo/gpx"
+	"golang.org/x/net/html/charset"
+)
+
+// tcxSuffix is the extension of Garmin Training Center files. They're converted to GPX
+// on upload, so the rest of the pipeline only ever sees GPX files.
+const tcxSuffix = ".tcx"
+
+// errInvalidTCX is returned for uploaded TCX files that can't be parsed
+var errInvalidTCX = errors.New("invalid TCX file")
+
+// tcxSportTypes maps the sports of TCX activities to GPX track types. Other sports are
+// left without a type.
+var tcxSportTypes = map[string]string{
+	"running": "running",
+	"biking":  "cycling",
+}
+
+// tcxDocument holds the parts of a Training Center Database routes are built from.
+// The tags carry no namespace, so they match whatever schema version the file uses.
+type tcxDocument struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+	Courses    []tcxCourse   `xml:"Courses>Course"`
+}
+
+// tcxActivity is a recorded workout, split into laps
+type tcxActivity struct {
+	Sport string `xml:"Sport,attr"`
+	Laps  []struct {
+		Tracks []tcxTrack `xml:"Track"`
+	} `xml:"Lap"`
+}
+
+// tcxCourse is a planned route
+type tcxCourse struct {
+	Name   string     `xml:"Name"`
+	Tracks []tcxTrack `xml:"Track"`
+}
+
+// tcxTrack is an uninterrupted run of trackpoints, devices start a new one after a pause
+type tcxTrack struct {
+	Trackpoints []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+// tcxTrackpoint is a single sample. Indoor workouts such as treadmill runs record
+// trackpoints without a position.
+type tcxTrackpoint struct {
+	Time     time.Time `xml:"Time"`
+	Position *struct {
+		Latitude  float64 `xml:"LatitudeDegrees"`
+		Longitude float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude *float64 `xml:"AltitudeMeters"`
+}
+
+// tcxUploadFilename returns the name of the GPX file an uploaded TCX file is stored as,
+// e.g. run.gpx for run.tcx or run.tcx.gz, and whether the file is a TCX file at all
+func tcxUploadFilename(filename string) (string, bool) {
+	if strings.HasSuffix(strings.ToLower(filename), tcxSuffix+gzipSuffix) {
+		filename = filename[:len(filename)-len(gzipSuffix)]
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), tcxSuffix) {
+		return filename, false
+	}
+	return filename[:len(filename)-len(tcxSuffix)] + ".gpx", true
+}
+
+// parseTCX converts a TCX document into GPX data. Every activity and course becomes a
+// track and every TCX track one of its segments, keeping the times and altitudes of the
+// points. Trackpoints without a position are skipped.
+func parseTCX(r io.Reader) (*gpx.GPX, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var doc tcxDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidTCX, err)
+	}
+
+	gpxData := &gpx.GPX{Creator: "walkassistant"}
+	for _, activity := range doc.Activities {
+		track := gpx.GPXTrack{Type: tcxSportTypes[strings.ToLower(activity.Sport)]}
+		for _, lap := range activity.Laps {
+			track.Segments = appendTCXSegments(track.Segments, lap.Tracks)
+		}
+		gpxData.Tracks = append(gpxData.Tracks, track)
+	}
+	for _, course := range doc.Courses {
+		gpxData.Tracks = append(gpxData.Tracks, gpx.GPXTrack{
+			Name:     course.Name,
+			Segments: appendTCXSegments(nil, course.Tracks),
+		})
+	}
+
+	if gpxData.GetTrackPointsNo() == 0 {
+		return nil, errNoTrackPoints
+	}
+	return gpxData, nil
+}
+
+// appendTCXSegments appends a GPX segment for each TCX track holding positioned points
+func appendTCXSegments(segments []gpx.GPXTrackSegment, tracks []tcxTrack) []gpx.GPXTrackSegment {
+	for _, track := range tracks {
+		var segment gpx.GPXTrackSegment
+		for _, trackpoint := range track.Trackpoints {
+			if trackpoint.Position == nil {
+				continue
+			}
+
+			point := gpx.GPXPoint{
+				Point: gpx.Point{
+					Latitude:  trackpoint.Position.Latitude,
+					Longitude: trackpoint.Position.Longitude,
+				},
+				Timestamp: trackpoint.Time,
+			}
+			if trackpoint.Altitude != nil {
+				point.Elevation.SetValue(*trackpoint.Altitude)
+			}
+			segment.Points = append(segment.Points, point)
+		}
+
+		if len(segment.Points) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// saveTCXFile converts an uploaded TCX file, gzipped or not, and stores it in the data
+// directory as the given GPX file
+func saveTCXFile(file io.Reader, filename string) error {
+	if err := os.MkdirAll(config.DataDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	content, err := gunzipIfCompressed(file)
+	if err != nil {
+		return err
+	}
+
+	gpxData, err := parseTCX(content)
+	if err != nil {
+		return err
+	}
+
+	return writeGPX(filename, gpxData)
+}
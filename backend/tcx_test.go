@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTCX is a bike ride paused once, with a sample recorded before the GPS had a fix
+const testTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-05-04T08:00:00Z</Id>
+      <Lap StartTime="2024-05-04T08:00:00Z">
+        <Track>
+          <Trackpoint><Time>2024-05-04T08:00:00Z</Time><HeartRateBpm><Value>90</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2024-05-04T08:01:00Z</Time><Position><LatitudeDegrees>52.5200</LatitudeDegrees><LongitudeDegrees>13.4000</LongitudeDegrees></Position><AltitudeMeters>34</AltitudeMeters></Trackpoint>
+          <Trackpoint><Time>2024-05-04T08:02:00Z</Time><Position><LatitudeDegrees>52.5250</LatitudeDegrees><LongitudeDegrees>13.4000</LongitudeDegrees></Position><AltitudeMeters>40</AltitudeMeters></Trackpoint>
+        </Track>
+        <Track>
+          <Trackpoint><Time>2024-05-04T08:10:00Z</Time><Position><LatitudeDegrees>52.5300</LatitudeDegrees><LongitudeDegrees>13.4100</LongitudeDegrees></Position><AltitudeMeters>38</AltitudeMeters></Trackpoint>
+          <Trackpoint><Time>2024-05-04T08:11:00Z</Time><Position><LatitudeDegrees>52.5350</LatitudeDegrees><LongitudeDegrees>13.4100</LongitudeDegrees></Position><AltitudeMeters>45</AltitudeMeters></Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestUploadImportsTCX(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	rec := httptest.NewRecorder()
+	uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", "ride.tcx", []byte(testTCX)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The ride is stored as GPX, so everything else handles it like any other route
+	if _, err := os.Stat(filepath.Join(dir, "ride.gpx")); err != nil {
+		t.Fatalf("Expected the ride to be stored as ride.gpx: %v", err)
+	}
+	route, ok := store.GetByFilename("ride.gpx")
+	if !ok {
+		t.Fatalf("Expected ride.gpx to be stored, got %+v", store.All())
+	}
+
+	if len(route.TrackPoints) != 4 {
+		t.Errorf("Expected the 4 positioned trackpoints, got %d", len(route.TrackPoints))
+	}
+	if route.Duration != 600 {
+		t.Errorf("Expected 600 s from the first to the last positioned point, got %.0f", route.Duration)
+	}
+	// Neither distance nor elevation is counted across the pause between the two tracks
+	if route.TotalAscent != 13 || route.TotalDescent != 0 {
+		t.Errorf("Expected 13 m up and none down, got %.0f and %.0f", route.TotalAscent, route.TotalDescent)
+	}
+	expected := haversineDistance(52.52, 13.4, 52.525, 13.4) + haversineDistance(52.53, 13.41, 52.535, 13.41)
+	if math.Abs(route.Distance-expected) > 1e-6 {
+		t.Errorf("Expected %.3f km, got %.3f km", expected, route.Distance)
+	}
+
+	if route.ActivityType != "cycling" || route.Source != sourceImported {
+		t.Errorf("Expected an imported cycling route, got %q from %q", route.ActivityType, route.Source)
+	}
+}
+
+func TestUploadRejectsUnusableTCX(t *testing.T) {
+	dir := withDataDir(t)
+	store := withRoutes(t)
+
+	treadmill := `<TrainingCenterDatabase><Activities><Activity Sport="Running"><Lap><Track>
+		<Trackpoint><Time>2024-05-04T08:00:00Z</Time><DistanceMeters>0</DistanceMeters></Trackpoint>
+		<Trackpoint><Time>2024-05-04T08:10:00Z</Time><DistanceMeters>1800</DistanceMeters></Trackpoint>
+	</Track></Lap></Activity></Activities></TrainingCenterDatabase>`
+
+	tests := []struct {
+		filename string
+		content  string
+		status   int
+	}{
+		{"treadmill.tcx", treadmill, http.StatusUnprocessableEntity},
+		{"broken.tcx", "<TrainingCenterDatabase><Activities>", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		uploadHandler(store)(rec, newUploadRequest(t, "gpxfile", tt.filename, []byte(tt.content)))
+		if rec.Code != tt.status {
+			t.Errorf("%s: Expected status %d, got %d: %s", tt.filename, tt.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Nothing is left behind to fail again on the next start
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.gpx")); len(files) != 0 {
+		t.Errorf("Expected no stored files, got %v", files)
+	}
+}
+
+func TestTCXUploadFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		expected string
+		ok       bool
+	}{
+		{"run.tcx", "run.gpx", true},
+		{"Run.TCX.gz", "Run.gpx", true},
+		{"run.gpx", "run.gpx", false},
+		{"run.tcx.zip", "run.tcx.zip", false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := tcxUploadFilename(tt.filename); got != tt.expected || ok != tt.ok {
+			t.Errorf("tcxUploadFilename(%q): Expected %q, %t, got %q, %t", tt.filename, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "fmt"
+
+// Unit is a unit responses can report distances in. Distances are computed and stored
+// in kilometers and only converted when they're written.
+type Unit string
+
+const (
+	unitKilometers Unit = "km"
+	unitMiles      Unit = "mi"
+	unitMeters     Unit = "m"
+)
+
+// kilometersPerMile is the length of an international mile
+const kilometersPerMile = 1.609344
+
+// parseUnit parses the unit query parameter, defaulting to kilometers
+func parseUnit(value string) (Unit, error) {
+	switch unit := Unit(value); unit {
+	case "":
+		return unitKilometers, nil
+	case unitKilometers, unitMiles, unitMeters:
+		return unit, nil
+	default:
+		return "", fmt.Errorf("unit must be %s, %s or %s", unitKilometers, unitMiles, unitMeters)
+	}
+}
+
+// distanceIn converts a distance in kilometers to the unit
+func distanceIn(km float64, unit Unit) float64 {
+	switch unit {
+	case unitMiles:
+		return km / kilometersPerMile
+	case unitMeters:
+		return km * 1000
+	default:
+		return km
+	}
+}
+
+// routesIn returns copies of the routes with their distance in the unit
+func routesIn(routes []RouteData, unit Unit) []RouteData {
+	converted := make([]RouteData, len(routes))
+	for i, route := range routes {
+		route.Distance = distanceIn(route.Distance, unit)
+		converted[i] = route
+	}
+	return converted
+}
+
+// suggestionsIn returns copies of the suggested routes with all their distances, including
+// those of their directions, in the unit
+func suggestionsIn(suggested []SuggestedRoute, unit Unit) []SuggestedRoute {
+	converted := make([]SuggestedRoute, len(suggested))
+	for i, route := range suggested {
+		route.Distance = distanceIn(route.Distance, unit)
+		route.OSRMDistance = distanceIn(route.OSRMDistance, unit)
+		route.GeometryDistance = distanceIn(route.GeometryDistance, unit)
+		if route.Directions != nil {
+			route.Directions = directionsIn(*route.Directions, unit)
+		}
+		converted[i] = route
+	}
+	return converted
+}
+
+// directionsIn returns a copy of the directions with their distances in the unit
+func directionsIn(directions RouteDirections, unit Unit) *RouteDirections {
+	steps := make([]RouteStep, len(directions.Steps))
+	for i, step := range directions.Steps {
+		step.Distance = distanceIn(step.Distance, unit)
+		steps[i] = step
+	}
+	directions.Steps = steps
+	directions.Summary.Distance = distanceIn(directions.Summary.Distance, unit)
+	directions.Summary.Text = summaryText(directions.Summary, unit)
+	return &directions
+}
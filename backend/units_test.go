@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistanceIn(t *testing.T) {
+	testCases := []struct {
+		unit     Unit
+		expected float64
+	}{
+		{unitKilometers, 5},
+		{unitMeters, 5000},
+		{unitMiles, 3.106856},
+	}
+
+	for _, tc := range testCases {
+		if got := distanceIn(5, tc.unit); math.Abs(got-tc.expected) > 1e-6 {
+			t.Errorf("Expected 5 km to be %v %s, got %v", tc.expected, tc.unit, got)
+		}
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	if unit, err := parseUnit(""); err != nil || unit != unitKilometers {
+		t.Errorf("Expected kilometers by default, got %q, %v", unit, err)
+	}
+	if unit, err := parseUnit("mi"); err != nil || unit != unitMiles {
+		t.Errorf("Expected miles, got %q, %v", unit, err)
+	}
+	for _, value := range []string{"KM", "miles", "ft"} {
+		if _, err := parseUnit(value); err == nil {
+			t.Errorf("Expected an error for unit %q", value)
+		}
+	}
+}
+
+func TestRoutesHandlerConvertsUnit(t *testing.T) {
+	store := withRoutes(t, RouteData{
+		Filename:    "test.gpx",
+		TrackPoints: []TrackPoint{{Latitude: 52.52, Longitude: 13.40}, {Latitude: 52.53, Longitude: 13.41}},
+		Distance:    5.283719,
+	})
+
+	testCases := []struct {
+		unit     string
+		expected float64
+	}{
+		{"km", 5.28},
+		{"mi", 3.28},
+		{"m", 5283.72},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		routesHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/routes?unit="+tc.unit, nil))
+
+		var page RoutesPage
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil || len(page.Items) != 1 {
+			t.Fatalf("Expected one route for unit=%s, got %v, %v", tc.unit, page.Items, err)
+		}
+		if page.Items[0].Distance != tc.expected {
+			t.Errorf("Expected distance %v for unit=%s, got %v", tc.expected, tc.unit, page.Items[0].Distance)
+		}
+	}
+
+	// The stored route stays in kilometers
+	if stored := store.All(); stored[0].Distance != 5.283719 {
+		t.Errorf("Stored distance was modified: %v", stored[0].Distance)
+	}
+
+	rec := httptest.NewRecorder()
+	routesHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/routes?unit=ft", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown unit, got %d", rec.Code)
+	}
+}
+
+func TestSuggestHandlerConvertsUnit(t *testing.T) {
+	store := withRoutes(t, coverageTestRoute)
+	suggestionLog.reset()
+	t.Cleanup(suggestionLog.reset)
+
+	rec := httptest.NewRecorder()
+	suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false&unit=m", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var suggested []SuggestedRoute
+	if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 {
+		t.Fatalf("Expected one suggestion, got %v, %v", suggested, err)
+	}
+
+	// The history keeps the distance in kilometers
+	recent := suggestionLog.recent(time.Now(), time.Hour)
+	if len(recent) != 1 {
+		t.Fatalf("Expected one suggestion in the history, got %d", len(recent))
+	}
+	if km := recent[0].Route.Distance; math.Abs(suggested[0].Distance-km*1000) > 5 {
+		t.Errorf("Expected about %v m, got %v", km*1000, suggested[0].Distance)
+	}
+
+	rec = httptest.NewRecorder()
+	suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=false&unit=yd", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown unit, got %d", rec.Code)
+	}
+}
+
+func TestSuggestHandlerConvertsEveryDistance(t *testing.T) {
+	withOSRMServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(steppedOSRMResponse))
+	})
+	store := withRoutes(t, RouteData{Filename: "park.gpx", TrackPoints: squareLoop(1)})
+
+	suggest := func(unit string) SuggestedRoute {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		suggestHandler(store)(rec, httptest.NewRequest(http.MethodGet, "/suggest?followStreets=true&verbose=true&boundsStrictness=0&unit="+unit, nil))
+		var suggested []SuggestedRoute
+		if err := json.NewDecoder(rec.Body).Decode(&suggested); err != nil || len(suggested) != 1 || suggested[0].Directions == nil {
+			t.Fatalf("Expected one suggestion with directions for unit=%s, got %d: %s", unit, rec.Code, rec.Body.String())
+		}
+		return suggested[0]
+	}
+	km, mi := suggest("km"), suggest("mi")
+
+	// Each distance is rounded after converting
+	distances := []struct {
+		name   string
+		km, mi float64
+	}{
+		{"distance", km.Distance, mi.Distance},
+		{"directions.summary.distance", km.Directions.Summary.Distance, mi.Directions.Summary.Distance},
+		{"directions.steps[1].distance", km.Directions.Steps[1].Distance, mi.Directions.Steps[1].Distance},
+	}
+	for _, d := range distances {
+		if d.km == 0 || math.Abs(d.mi-d.km/kilometersPerMile) > 0.01 {
+			t.Errorf("Expected %s of %v km to be %.2f mi, got %v", d.name, d.km, d.km/kilometersPerMile, d.mi)
+		}
+	}
+	if text := mi.Directions.Summary.Text; !strings.HasPrefix(text, "0.6 mi, about 12 min") {
+		t.Errorf("Expected the summary text in miles, got %q", text)
+	}
+}
+
+func TestSuggestionsInConvertsDiagnosticDistances(t *testing.T) {
+	route := SuggestedRoute{Distance: 5, OSRMDistance: 5.1, GeometryDistance: 4.9}
+	converted := suggestionsIn([]SuggestedRoute{route}, unitMeters)[0]
+	if converted.Distance != 5000 || converted.OSRMDistance != 5100 || converted.GeometryDistance != 4900 {
+		t.Errorf("Expected 5000, 5100 and 4900 m, got %v, %v and %v", converted.Distance, converted.OSRMDistance, converted.GeometryDistance)
+	}
+	if route.OSRMDistance != 5.1 {
+		t.Errorf("The original suggestion was modified: %v", route.OSRMDistance)
+	}
+}
@@ -69,7 +69,9 @@ document.addEventListener('DOMContentLoaded', function() {
         })
         .then(response => {
             if (!response.ok) {
-                throw new Error('Upload failed');
+                return response.json().catch(() => ({})).then(body => {
+                    throw new Error(body.error || 'Upload failed');
+                });
             }
             return response.json();
         })
@@ -83,12 +85,24 @@ document.addEventListener('DOMContentLoaded', function() {
         });
     });
 
+    // Fetch every stored route, the server returns them a page at a time
+    function fetchAllRoutes(offset = 0, collected = []) {
+        return fetch(`/routes?limit=500&offset=${offset}`)
+        .then(response => response.json())
+        .then(page => {
+            collected.push(...page.items);
+            if (page.items.length === 0 || collected.length >= page.total) {
+                return collected;
+            }
+            return fetchAllRoutes(collected.length, collected);
+        });
+    }
+
     // Load existing routes
     function loadExistingRoutes() {
         existingRoutesLayer.clearLayers();
 
-        fetch('/routes')
-        .then(response => response.json())
+        fetchAllRoutes()
         .then(routes => {
             if (routes.length === 0) {
                 showStatus('No existing routes found', '');
@@ -117,8 +131,10 @@ document.addEventListener('DOMContentLoaded', function() {
 
                     polyline.bindPopup(`
                         <strong>${route.filename}</strong><br>
+                        ${route.startPlace || route.endPlace ? `${route.startPlace || '?'} → ${route.endPlace || '?'}<br>` : ''}
                         Distance: ${routeDistance.toFixed(2)} km<br>
-                        Duration: ${formatDuration(route.duration)}
+                        Duration: ${formatDuration(route.duration)}<br>
+                        Moving time: ${formatDuration(route.movingTime)}
                     `);
 
                     // Show distance when hovering over the route
@@ -193,7 +209,21 @@ document.addEventListener('DOMContentLoaded', function() {
         }
 
         fetch(url)
-        .then(response => response.json())
+        .then(response => {
+            if (response.ok) {
+                return response.json();
+            }
+            // Errors come as JSON {"error": "..."} or plain text
+            return response.text().then(text => {
+                let message = text.trim() || response.statusText;
+                try {
+                    message = JSON.parse(text).error || message;
+                } catch (e) {
+                    // Plain text error
+                }
+                throw new Error(message);
+            });
+        })
         .then(routes => {
             if (routes.length === 0) {
                 showStatus('No suggested routes found with the current criteria', '');
@@ -236,12 +266,15 @@ document.addEventListener('DOMContentLoaded', function() {
 
                     polyline.bindPopup(`
                         <strong>Suggested Route ${index + 1}</strong><br>
-                        Distance: ${routeDistanceFormatted} km<br>
+                        Distance: ${route.distanceIsEstimate ? '~' : ''}${routeDistanceFormatted} km${route.distanceIsEstimate ? ' (estimate, not a walking distance)' : ''}<br>
                         Follows Streets: ${route.followsStreets ? 'Yes' : 'No'}
+                        ${(route.notes || []).map(note => `<br><em>${note}</em>`).join('')}
                     `);
 
                     suggestedRoutesLayer.addLayer(polyline);
-                    bounds.extend(polyline.getBounds());
+                    bounds.extend(route.bounds
+                        ? L.latLngBounds([route.bounds.minLat, route.bounds.minLng], [route.bounds.maxLat, route.bounds.maxLng])
+                        : polyline.getBounds());
                 }
             });
 
@@ -290,7 +323,7 @@ document.addEventListener('DOMContentLoaded', function() {
                     }
                     return `<div class="route-info-item">
                         <div class="route-color ${route.followsStreets ? 'green' : 'orange'}"></div>
-                        <span>Route ${index + 1}: ${routeDistance.toFixed(2)} km</span>
+                        <span>Route ${index + 1}: ${route.distanceIsEstimate ? '~' : ''}${routeDistance.toFixed(2)} km</span>
                     </div>`;
                 }).join('')}
             `;
@@ -2,9 +2,9 @@ module github.com/korjavin/walkassistant
 
 go 1.24.2
 
-require github.com/tkrajina/gpxgo v1.4.0
-
 require (
-	golang.org/x/net v0.39.0 // indirect
-	golang.org/x/text v0.24.0 // indirect
+	github.com/tkrajina/gpxgo v1.4.0
+	golang.org/x/net v0.39.0
 )
+
+require golang.org/x/text v0.24.0 // indirect